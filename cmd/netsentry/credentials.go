@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/0xdevren/netsentry/internal/credentials"
+)
+
+func newCredentialsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "credentials",
+		Short: "Manage and check the credentials used to reach devices",
+		Long: `Devices, jump hosts and inventory services can reference credentials by
+name instead of passing passwords and tokens on the command line. The
+--credentials flag of scan, validate, drift and topology selects where named
+credentials are looked up:
+
+  env                  $NETSENTRY_CRED_<NAME>_USERNAME, _PASSWORD,
+                       _ENABLE_PASSWORD and _TOKEN (the default)
+  env:PREFIX           the same variables with another prefix
+  file:PATH            a file encrypted with "credentials encrypt", unlocked
+                       with $NETSENTRY_CREDENTIALS_PASSPHRASE
+  vault:MOUNT/PATH     the secret PATH/<name> of the Vault KV v2 engine at
+                       MOUNT, read from $VAULT_ADDR with $VAULT_TOKEN
+  vault-kv1:MOUNT/PATH the same for a KV v1 engine
+  exec:COMMAND         the JSON object printed by "COMMAND <name>"
+
+Secret values are never printed, logged or written to reports.`,
+	}
+	cmd.AddCommand(newCredentialsEncryptCmd(), newCredentialsCheckCmd())
+	return cmd
+}
+
+func newCredentialsEncryptCmd() *cobra.Command {
+	var (
+		inPath  string
+		outPath string
+	)
+	cmd := &cobra.Command{
+		Use:   "encrypt",
+		Short: "Encrypt a YAML file of credentials for the file provider",
+		Long: `Encrypt reads a YAML map of credential names to their username, password,
+enable_password and token, and writes it encrypted with the passphrase in
+$NETSENTRY_CREDENTIALS_PASSPHRASE. Delete the plaintext afterwards.`,
+		Example: `  NETSENTRY_CREDENTIALS_PASSPHRASE=... netsentry credentials encrypt --in creds.yaml --out creds.enc`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			passphrase := os.Getenv(credentials.PassphraseEnv)
+			if passphrase == "" {
+				return fmt.Errorf("$%s is not set", credentials.PassphraseEnv)
+			}
+			var plaintext []byte
+			var err error
+			if inPath == "" || inPath == "-" {
+				plaintext, err = io.ReadAll(os.Stdin)
+			} else {
+				plaintext, err = os.ReadFile(inPath)
+			}
+			if err != nil {
+				return fmt.Errorf("cannot read credentials: %w", err)
+			}
+			data, err := credentials.EncryptFile(plaintext, []byte(passphrase))
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(outPath, data, 0o600); err != nil {
+				return fmt.Errorf("cannot write %q: %w", outPath, err)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&inPath, "in", "-", "Plaintext YAML credentials file (- for stdin)")
+	cmd.Flags().StringVar(&outPath, "out", "", "Encrypted file to write (required)")
+	_ = cmd.MarkFlagRequired("out")
+	return cmd
+}
+
+func newCredentialsCheckCmd() *cobra.Command {
+	var spec string
+	cmd := &cobra.Command{
+		Use:   "check <name>...",
+		Short: "Check that named credentials resolve, without printing them",
+		Args:  cobra.MinimumNArgs(1),
+		Example: `  netsentry credentials check core-routers
+  VAULT_ADDR=https://vault.example.net:8200 netsentry credentials check --credentials vault:secret/netsentry core-routers netbox`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			provider, err := credentials.Open(spec)
+			if err != nil {
+				return err
+			}
+			failed := false
+			for _, name := range args {
+				cred, err := (&credentials.Ref{Provider: provider, Name: name}).Resolve(cmd.Context())
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+					failed = true
+					continue
+				}
+				fmt.Printf("%s: username=%q password=%s enable_password=%s token=%s\n",
+					name, cred.Username, isSet(cred.Password), isSet(cred.EnablePassword), isSet(cred.Token))
+			}
+			if failed {
+				os.Exit(2)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&spec, "credentials", "", "Credentials provider (default env)")
+	return cmd
+}
+
+// isSet describes whether a secret has a value.
+func isSet(s credentials.Secret) string {
+	if s == "" {
+		return "unset"
+	}
+	return "set"
+}
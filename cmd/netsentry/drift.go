@@ -1,14 +1,21 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/spf13/cobra"
+	"github.com/0xdevren/netsentry/internal/app"
 	"github.com/0xdevren/netsentry/internal/config"
+	"github.com/0xdevren/netsentry/internal/config/source"
+	"github.com/0xdevren/netsentry/internal/credentials"
 	"github.com/0xdevren/netsentry/internal/drift"
+	"github.com/0xdevren/netsentry/internal/inventory"
 	"github.com/0xdevren/netsentry/internal/model"
 	"github.com/0xdevren/netsentry/internal/parser"
+	"github.com/0xdevren/netsentry/internal/redact"
 )
 
 func newDriftCmd() *cobra.Command {
@@ -16,14 +23,66 @@ func newDriftCmd() *cobra.Command {
 		baselinePath string
 		currentPath  string
 		threshold    float64
+		gitRepo      string
+		gitPath      string
+		invPath      string
+		credSpec     string
+		redactOn     bool
+		redactFile   string
 	)
 
 	cmd := &cobra.Command{
 		Use:   "drift",
 		Short: "Detect configuration drift between two snapshots",
+		Long: `Drift compares a baseline and a current configuration line by line and
+scores the share of the baseline that changed.
+
+With --git-repo, --baseline and --current are revisions of a Git repository
+of device configurations instead of files. Every file below --git-path that
+differs between the two revisions is compared as one device.
+
+With --inventory, --baseline is a directory of baseline configurations named
+after the device IDs, with or without an extension, and every inventory
+device with a file, Git or API source is compared against its own. A device
+without a baseline is compared against an empty configuration.
+
+With --redact, secrets in the printed diff are replaced by a token with a
+stable hash of their value: a changed password still shows as a changed
+line, without exposing either value.`,
 		Example: `  netsentry drift --baseline router-2024-01-01.conf --current router.conf
-  netsentry drift --baseline baseline.conf --current current.conf --threshold 10`,
+  netsentry drift --baseline baseline.conf --current current.conf --threshold 10
+  netsentry drift --git-repo git@git.example.net:netops/backups.git --baseline HEAD~1 --current HEAD
+  netsentry drift --inventory inventory.yaml --baseline baselines/
+  netsentry drift --baseline baseline.conf --current current.conf --redact`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			redactor, err := newRedactor(cmd, redactOn, redactFile)
+			if err != nil {
+				return err
+			}
+			if invPath != "" {
+				significant, err := inventoryDrift(cmd.Context(), invPath, credSpec, baselinePath, threshold, redactor)
+				if err != nil {
+					return err
+				}
+				if significant {
+					os.Exit(1)
+				}
+				return nil
+			}
+			if currentPath == "" {
+				return fmt.Errorf("--current is required without --inventory")
+			}
+			if gitRepo != "" {
+				significant, err := gitDrift(cmd.Context(), gitRepo, gitPath, baselinePath, currentPath, threshold, redactor)
+				if err != nil {
+					return err
+				}
+				if significant {
+					os.Exit(1)
+				}
+				return nil
+			}
+
 			baselineData, err := os.ReadFile(baselinePath)
 			if err != nil {
 				return fmt.Errorf("cannot read baseline %q: %w", baselinePath, err)
@@ -41,49 +100,171 @@ func newDriftCmd() *cobra.Command {
 				return nil
 			}
 
-			// Line diff.
-			comparator := drift.NewComparator()
-			diff := comparator.Compare("device", baselineData, currentData)
-
-			// Score.
-			scorer := drift.NewDriftScorer(threshold)
-			baselineLines := splitData(baselineData)
-			score := scorer.Score(diff, len(baselineLines))
-
-			// Detect device type for context.
-			detector := config.NewDetector()
-			deviceType := detector.Detect(currentData)
-			_, _ = parser.Parse(cmd.Context(), deviceType, currentData, model.Device{})
-
-			fmt.Printf("Configuration drift detected for device.\n\n")
-			fmt.Printf("Lines added   : %d\n", score.LinesAdded)
-			fmt.Printf("Lines removed : %d\n", score.LinesRemoved)
-			fmt.Printf("Total changes : %d\n", score.TotalChanges)
-			fmt.Printf("Drift percent : %.1f%%\n", score.DriftPercent)
-			if score.Significant {
-				fmt.Printf("Status        : SIGNIFICANT (threshold: %.1f%%)\n", threshold)
-			} else {
-				fmt.Printf("Status        : within threshold (%.1f%%)\n", threshold)
-			}
-
-			fmt.Println("\nDiff:")
-			fmt.Println(diff.String())
-
-			if score.Significant {
+			if printDrift(cmd.Context(), "device", baselineData, currentData, threshold, redactor) {
 				os.Exit(1)
 			}
 			return nil
 		},
 	}
 
-	cmd.Flags().StringVar(&baselinePath, "baseline", "", "Path to baseline configuration file (required)")
-	cmd.Flags().StringVar(&currentPath, "current", "", "Path to current configuration file (required)")
+	cmd.Flags().StringVar(&baselinePath, "baseline", "", "Path to baseline configuration file, or revision with --git-repo (required)")
+	cmd.Flags().StringVar(&currentPath, "current", "", "Path to current configuration file, or revision with --git-repo (required without --inventory)")
 	cmd.Flags().Float64Var(&threshold, "threshold", 5.0, "Drift percentage threshold for significance")
+	cmd.Flags().StringVar(&gitRepo, "git-repo", "", "Compare two revisions of a Git repository URL or path")
+	cmd.Flags().StringVar(&gitPath, "git-path", "", "Directory or file of --git-repo to compare (default: whole tree)")
+	cmd.Flags().StringVar(&invPath, "inventory", "", "Compare the devices of an inventory file against the baselines in --baseline")
+	cmd.Flags().StringVar(&credSpec, "credentials", "", "Credentials provider for the secrets of --inventory credentials (default env)")
+	cmd.Flags().BoolVar(&redactOn, "redact", false, "Mask secrets in the printed diff")
+	cmd.Flags().StringVar(&redactFile, "redact-patterns", "", "YAML file of additional redaction patterns (implies --redact unless it is given)")
+	cmd.MarkFlagsMutuallyExclusive("inventory", "git-repo")
+	cmd.MarkFlagsMutuallyExclusive("inventory", "current")
 	_ = cmd.MarkFlagRequired("baseline")
-	_ = cmd.MarkFlagRequired("current")
 	return cmd
 }
 
+// gitDrift compares every file below dir that changed between revisions
+// baseline and current of the repository at url, and reports whether any of
+// them drifted significantly. A file added or deleted in between is compared
+// against an empty configuration. Diffs are redacted by redactor, if set.
+func gitDrift(ctx context.Context, url, dir, baseline, current string, threshold float64, redactor *redact.Redactor) (bool, error) {
+	repo, err := source.OpenGitRepository(ctx, url, "")
+	if err != nil {
+		return false, err
+	}
+	files, err := repo.ChangedFiles(ctx, baseline, current, dir)
+	if err != nil {
+		return false, err
+	}
+	if len(files) == 0 {
+		fmt.Println("No configuration drift detected.")
+		return false, nil
+	}
+
+	significant := false
+	for i, f := range files {
+		// A side that does not have the file is compared as empty.
+		baselineData, _ := repo.ReadFile(ctx, baseline, f)
+		currentData, _ := repo.ReadFile(ctx, current, f)
+		if i > 0 {
+			fmt.Println()
+		}
+		if printDrift(ctx, f, baselineData, currentData, threshold, redactor) {
+			significant = true
+		}
+	}
+	return significant, nil
+}
+
+// inventoryDrift compares the stored configuration of every device of the
+// inventory file at invPath with its baseline in baselineDir, and reports
+// whether any of them drifted significantly. Secrets of its credentials are
+// resolved from the provider described by credSpec. Diffs are redacted by
+// redactor, if set.
+func inventoryDrift(ctx context.Context, invPath, credSpec, baselineDir string, threshold float64, redactor *redact.Redactor) (bool, error) {
+	if info, err := os.Stat(baselineDir); err != nil || !info.IsDir() {
+		return false, fmt.Errorf("baseline %q is not a directory", baselineDir)
+	}
+	inv, err := inventory.LoadFile(invPath)
+	if err != nil {
+		return false, err
+	}
+	creds, err := credentials.Open(credSpec)
+	if err != nil {
+		return false, err
+	}
+	targets := app.InventoryFleetTargets(inv, creds)
+	if len(targets) == 0 {
+		return false, fmt.Errorf("no inventory device in %q has a file, git or api source", invPath)
+	}
+
+	significant, drifted := false, 0
+	for _, t := range targets {
+		var currentData []byte
+		if t.Load != nil {
+			currentData, err = t.Load(ctx)
+		} else {
+			currentData, err = os.ReadFile(t.Source)
+		}
+		if err != nil {
+			return false, fmt.Errorf("cannot read current %q: %w", t.Source, err)
+		}
+		baselineData, err := readBaseline(baselineDir, t.Device.ID)
+		if err != nil {
+			return false, err
+		}
+		if !drift.HasChanged(drift.HashConfig("baseline", baselineData), drift.HashConfig("current", currentData)) {
+			continue
+		}
+		if drifted > 0 {
+			fmt.Println()
+		}
+		drifted++
+		if printDrift(ctx, t.Device.ID, baselineData, currentData, threshold, redactor) {
+			significant = true
+		}
+	}
+	if drifted == 0 {
+		fmt.Println("No configuration drift detected.")
+	}
+	return significant, nil
+}
+
+// readBaseline reads the baseline of device id in dir: the file named id, or
+// else the first named id with an extension. A missing baseline reads as
+// empty.
+func readBaseline(dir, id string) ([]byte, error) {
+	path := filepath.Join(dir, id)
+	if _, err := os.Stat(path); err != nil {
+		matches, _ := filepath.Glob(filepath.Join(dir, id+".*"))
+		if len(matches) == 0 {
+			return nil, nil
+		}
+		path = matches[0]
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read baseline %q: %w", path, err)
+	}
+	return data, nil
+}
+
+// printDrift prints the diff and drift score of deviceID and reports whether
+// the drift is significant. The diff is redacted by redactor, if set; the
+// score is computed before redaction.
+func printDrift(ctx context.Context, deviceID string, baselineData, currentData []byte, threshold float64, redactor *redact.Redactor) bool {
+	// Line diff.
+	comparator := drift.NewComparator()
+	diff := comparator.Compare(deviceID, baselineData, currentData)
+
+	// Score.
+	scorer := drift.NewDriftScorer(threshold)
+	baselineLines := splitData(baselineData)
+	score := scorer.Score(diff, len(baselineLines))
+
+	// Detect device type for context.
+	detector := config.NewDetector()
+	deviceType := detector.Detect(currentData)
+	_, _ = parser.Parse(ctx, deviceType, currentData, model.Device{})
+	if redactor != nil {
+		diff = redactor.Diff(deviceType, diff)
+	}
+
+	fmt.Printf("Configuration drift detected for %s.\n\n", deviceID)
+	fmt.Printf("Lines added   : %d\n", score.LinesAdded)
+	fmt.Printf("Lines removed : %d\n", score.LinesRemoved)
+	fmt.Printf("Total changes : %d\n", score.TotalChanges)
+	fmt.Printf("Drift percent : %.1f%%\n", score.DriftPercent)
+	if score.Significant {
+		fmt.Printf("Status        : SIGNIFICANT (threshold: %.1f%%)\n", threshold)
+	} else {
+		fmt.Printf("Status        : within threshold (%.1f%%)\n", threshold)
+	}
+
+	fmt.Println("\nDiff:")
+	fmt.Println(diff.String())
+	return score.Significant
+}
+
 func splitData(data []byte) []string {
 	var lines []string
 	line := ""
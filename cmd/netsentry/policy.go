@@ -3,10 +3,14 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 
+	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
 	"github.com/0xdevren/netsentry/internal/policy"
 	"github.com/0xdevren/netsentry/internal/policy/dsl"
+	"github.com/0xdevren/netsentry/internal/policy/policytest"
+	"github.com/0xdevren/netsentry/internal/policy/vars"
 )
 
 func newPolicyCmd() *cobra.Command {
@@ -14,7 +18,7 @@ func newPolicyCmd() *cobra.Command {
 		Use:   "policy",
 		Short: "Manage and inspect policy definitions",
 	}
-	cmd.AddCommand(newPolicyListCmd(), newPolicyValidateCmd(), newPolicyLintCmd())
+	cmd.AddCommand(newPolicyListCmd(), newPolicyValidateCmd(), newPolicyLintCmd(), newPolicyShowCmd(), newPolicyTestCmd())
 	return cmd
 }
 
@@ -23,6 +27,8 @@ func newPolicyListCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "list",
 		Short: "List policy files in a directory",
+		Long: `List prints the files in --dir that may hold policies. Test fixtures,
+named *_test.yaml, are left out.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			entries, err := os.ReadDir(dir)
 			if err != nil {
@@ -30,7 +36,7 @@ func newPolicyListCmd() *cobra.Command {
 			}
 			fmt.Printf("Policies in %s:\n", dir)
 			for _, e := range entries {
-				if !e.IsDir() {
+				if !e.IsDir() && !policytest.IsFixture(e.Name()) {
 					fmt.Printf("  %s\n", e.Name())
 				}
 			}
@@ -59,13 +65,21 @@ func newPolicyValidateCmd() *cobra.Command {
 }
 
 func newPolicyLintCmd() *cobra.Command {
-	return &cobra.Command{
+	var varsPath string
+	cmd := &cobra.Command{
 		Use:   "lint <policy.yaml>",
 		Short: "Lint a policy file for structural and semantic errors",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			p := dsl.NewParser()
 			v := dsl.NewValidator()
+			if varsPath != "" {
+				variables, err := vars.LoadFile(varsPath)
+				if err != nil {
+					return err
+				}
+				v = v.WithVariables(variables)
+			}
 
 			raw, err := p.ParseFile(args[0])
 			if err != nil {
@@ -85,4 +99,99 @@ func newPolicyLintCmd() *cobra.Command {
 			return nil
 		},
 	}
+	cmd.Flags().StringVar(&varsPath, "vars", "", "Variables file used to check template variable references")
+	return cmd
+}
+
+func newPolicyShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show <policy.yaml>",
+		Short: "Show the resolved rules of a policy and where each was defined",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			pol, err := policy.NewLoader().LoadFile(args[0])
+			if err != nil {
+				return fmt.Errorf("policy invalid: %w", err)
+			}
+			fmt.Printf("Policy %q (%d rules resolved)\n", pol.Name, len(pol.Rules))
+
+			table := tablewriter.NewWriter(os.Stdout)
+			table.SetHeader([]string{"RULE-ID", "SEVERITY", "ENABLED", "SOURCE", "OVERRIDDEN-BY"})
+			table.SetBorder(false)
+			table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+			table.SetAlignment(tablewriter.ALIGN_LEFT)
+			table.SetColumnSeparator(" ")
+			for _, r := range pol.Rules {
+				var source, overrides string
+				if r.Provenance != nil {
+					source = r.Provenance.Source
+					overrides = strings.Join(r.Provenance.OverriddenBy, ", ")
+				}
+				table.Append([]string{r.ID, string(r.Severity), fmt.Sprint(r.IsEnabled()), source, overrides})
+			}
+			table.Render()
+			return nil
+		},
+	}
+}
+
+func newPolicyTestCmd() *cobra.Command {
+	var verbose bool
+	cmd := &cobra.Command{
+		Use:   "test <dir|fixture.yaml>...",
+		Short: "Run policy test fixtures and report rules whose status differs",
+		Long: `Test runs every *_test.yaml fixture found under the given paths. Each
+fixture names a policy and lists cases: a configuration snippet and the status
+each rule must produce. The command exits 1 if any case fails.`,
+		Example: `  netsentry policy test policies
+  netsentry policy test policies/security/baseline_test.yaml -v`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var files []string
+			for _, arg := range args {
+				found, err := policytest.Discover(arg)
+				if err != nil {
+					return err
+				}
+				files = append(files, found...)
+			}
+			if len(files) == 0 {
+				return fmt.Errorf("no *_test.yaml fixtures found")
+			}
+
+			runner := policytest.NewRunner()
+			total, failed := 0, 0
+			for _, file := range files {
+				suite, err := policytest.LoadSuite(file)
+				if err != nil {
+					return err
+				}
+				for _, res := range runner.Run(cmd.Context(), suite) {
+					total++
+					if res.Passed() {
+						if verbose {
+							fmt.Printf("ok    %s: %s\n", res.Suite, res.Name)
+						}
+						continue
+					}
+					failed++
+					fmt.Printf("FAIL  %s: %s\n", res.Suite, res.Name)
+					if res.Err != nil {
+						fmt.Printf("        error: %v\n", res.Err)
+					}
+					for _, m := range res.Mismatches {
+						fmt.Printf("        %s\n", m)
+					}
+				}
+			}
+
+			fmt.Printf("\n%d case(s) in %d fixture(s): %d passed, %d failed\n", total, len(files), total-failed, failed)
+			if failed > 0 {
+				os.Exit(1)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Also list passing cases")
+	return cmd
 }
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/0xdevren/netsentry/internal/config"
+	"github.com/0xdevren/netsentry/internal/model"
+	"github.com/0xdevren/netsentry/internal/parser"
+	"github.com/0xdevren/netsentry/internal/policy"
+	"github.com/0xdevren/netsentry/internal/remediation"
+	"github.com/0xdevren/netsentry/internal/util"
+	"github.com/0xdevren/netsentry/internal/validator"
+)
+
+func newRemediateCmd() *cobra.Command {
+	var (
+		configPath   string
+		policyPaths  []string
+		varsPath     string
+		waiversPath  string
+		outputPath   string
+		rollbackPath string
+		format       string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "remediate",
+		Short: "Generate a configuration patch that fixes policy violations",
+		Long: `Remediate validates a device configuration against a policy and assembles
+the structured fixes of every failed rule into a configuration patch for the
+device's platform. Lines are grouped under their parent context and ordered as
+the blocks appear in the configuration. Failed rules without a fix for the
+platform are listed as manual steps.
+
+When --rollback is given, the lines that undo the patch are written to that
+file. Rollback lines come from each fix's rollback list or, where the syntax
+allows, are derived by negating the applied lines.`,
+		Example: `  netsentry remediate --config router.conf --policy baseline.yaml
+  netsentry remediate --config router.conf --policy baseline.yaml --output fix.txt --rollback undo.txt
+  netsentry remediate --config router.conf --policy site.yaml --vars sites.yaml --waivers waivers.yaml`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			rawData, err := os.ReadFile(configPath)
+			if err != nil {
+				return fmt.Errorf("cannot read config %q: %w", configPath, err)
+			}
+			deviceType := config.NewDetector().Detect(rawData)
+			device := model.Device{ID: configPath, Type: deviceType}
+			parsedCfg, err := parser.Parse(ctx, deviceType, rawData, device)
+			if err != nil {
+				return fmt.Errorf("parse failed: %w", err)
+			}
+
+			policies, err := loadPolicies(policyPaths, varsPath)
+			if err != nil {
+				return err
+			}
+			pol, err := policy.Merge(policies...)
+			if err != nil {
+				return err
+			}
+			var waivers []policy.Waiver
+			if waiversPath != "" {
+				if waivers, err = policy.LoadWaiverFile(waiversPath); err != nil {
+					return err
+				}
+			}
+
+			rep, err := validator.Validate(ctx, validator.ValidationRequest{
+				Config:  parsedCfg,
+				Policy:  pol,
+				Waivers: waivers,
+			})
+			if err != nil {
+				return fmt.Errorf("validation failed: %w", err)
+			}
+			patch, err := remediation.Build(rep, pol, parsedCfg)
+			if err != nil {
+				return err
+			}
+
+			var out []byte
+			switch format {
+			case "text":
+				out = []byte(patch.Render())
+			case "json":
+				if out, err = json.MarshalIndent(patch, "", "  "); err != nil {
+					return fmt.Errorf("encode patch: %w", err)
+				}
+				out = append(out, '\n')
+			default:
+				return fmt.Errorf("unsupported format %q; must be text or json", format)
+			}
+
+			if outputPath != "" {
+				if err := util.WriteFile(outputPath, out, 0o644); err != nil {
+					return err
+				}
+			} else {
+				os.Stdout.Write(out)
+			}
+			if rollbackPath != "" {
+				if err := util.WriteFile(rollbackPath, []byte(patch.RenderRollback()), 0o644); err != nil {
+					return err
+				}
+			}
+			if patch.IsEmpty() {
+				fmt.Fprintln(os.Stderr, "No failed rules to remediate.")
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&configPath, "config", "", "Path to device configuration file (required)")
+	cmd.Flags().StringSliceVar(&policyPaths, "policy", nil, "Policy YAML file or directory; may be repeated (required)")
+	cmd.Flags().StringVar(&varsPath, "vars", "", "Path to a variables file for policy templates")
+	cmd.Flags().StringVar(&waiversPath, "waivers", "", "Path to a waiver file; waived rules are not remediated")
+	cmd.Flags().StringVar(&outputPath, "output", "", "Write the patch to file path")
+	cmd.Flags().StringVar(&rollbackPath, "rollback", "", "Write the rollback patch to file path")
+	cmd.Flags().StringVar(&format, "format", "text", "Output format: text|json")
+	_ = cmd.MarkFlagRequired("config")
+	_ = cmd.MarkFlagRequired("policy")
+	return cmd
+}
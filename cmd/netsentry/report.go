@@ -15,10 +15,12 @@ import (
 
 func newReportCmd() *cobra.Command {
 	var (
-		configPath string
-		policyPath string
-		format     string
-		outputPath string
+		configPath  string
+		policyPaths []string
+		varsPath    string
+		waiversPath string
+		format      string
+		outputPath  string
 	)
 
 	cmd := &cobra.Command{
@@ -28,7 +30,8 @@ func newReportCmd() *cobra.Command {
 specified format. Unlike validate, it always exits with code 0 unless an
 execution error occurs, making it suitable for report-only pipelines.`,
 		Example: `  netsentry report --config router.conf --policy baseline.yaml --format html --output report.html
-  netsentry report --config router.conf --policy baseline.yaml --format json`,
+  netsentry report --config router.conf --policy baseline.yaml --format json
+  netsentry report --config router.conf --policy policies/ --format html --output report.html`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			rawData, err := os.ReadFile(configPath)
 			if err != nil {
@@ -44,14 +47,20 @@ execution error occurs, making it suitable for report-only pipelines.`,
 				return fmt.Errorf("parse error: %w", err)
 			}
 
-			loader := policy.NewLoader()
-			pol, err := loader.LoadFile(policyPath)
+			policies, err := loadPolicies(policyPaths, varsPath)
 			if err != nil {
-				return fmt.Errorf("policy error: %w", err)
+				return err
+			}
+
+			var waivers []policy.Waiver
+			if waiversPath != "" {
+				if waivers, err = policy.LoadWaiverFile(waiversPath); err != nil {
+					return fmt.Errorf("waivers error: %w", err)
+				}
 			}
 
 			rep, err := validator.Validate(cmd.Context(), validator.ValidationRequest{
-				Config: parsedCfg, Policy: pol, Concurrency: 4,
+				Config: parsedCfg, Policies: policies, Concurrency: 4, Waivers: waivers,
 			})
 			if err != nil {
 				return fmt.Errorf("validation error: %w", err)
@@ -69,7 +78,9 @@ execution error occurs, making it suitable for report-only pipelines.`,
 	}
 
 	cmd.Flags().StringVar(&configPath, "config", "", "Path to device configuration file (required)")
-	cmd.Flags().StringVar(&policyPath, "policy", "", "Path to policy YAML file (required)")
+	cmd.Flags().StringSliceVar(&policyPaths, "policy", nil, "Policy YAML file or directory; repeat to evaluate several policies in one run (required)")
+	cmd.Flags().StringVar(&varsPath, "vars", "", "Path to a variables file for policy templates")
+	cmd.Flags().StringVar(&waiversPath, "waivers", "", "Path to a waiver file of approved rule exceptions")
 	cmd.Flags().StringVar(&format, "format", "table", "Output format: table|json|yaml|html")
 	cmd.Flags().StringVar(&outputPath, "output", "", "Write report to file path")
 	_ = cmd.MarkFlagRequired("config")
@@ -56,9 +56,11 @@ func init() {
 		newScanCmd(),
 		newPolicyCmd(),
 		newReportCmd(),
+		newRemediateCmd(),
 		newDriftCmd(),
 		newTopologyCmd(),
 		newServeCmd(),
+		newCredentialsCmd(),
 		newVersionCmd(),
 	)
 }
@@ -75,28 +77,3 @@ func newVersionCmd() *cobra.Command {
 		},
 	}
 }
-
-// newScanCmd returns the scan sub-command (SSH-based remote config retrieval).
-func newScanCmd() *cobra.Command {
-	var (
-		target string
-		sshUser string
-		sshKey string
-	)
-	cmd := &cobra.Command{
-		Use:   "scan",
-		Short: "Retrieve and validate configuration from a live device via SSH",
-		RunE: func(cmd *cobra.Command, args []string) error {
-			if target == "" {
-				return fmt.Errorf("--target is required")
-			}
-			fmt.Printf("Scanning device %s as user %s using key %s\n", target, sshUser, sshKey)
-			fmt.Println("(SSH scan: connect to device, run 'show running-config', then validate)")
-			return nil
-		},
-	}
-	cmd.Flags().StringVar(&target, "target", "", "Device IP address or hostname (required)")
-	cmd.Flags().StringVar(&sshUser, "ssh-user", "admin", "SSH username")
-	cmd.Flags().StringVar(&sshKey, "ssh-key", "~/.ssh/id_rsa", "Path to SSH private key")
-	return cmd
-}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/0xdevren/netsentry/internal/app"
+	"github.com/0xdevren/netsentry/internal/config/source"
+	"github.com/0xdevren/netsentry/internal/credentials"
+	"github.com/0xdevren/netsentry/internal/inventory"
+	"github.com/0xdevren/netsentry/internal/model"
+	"github.com/0xdevren/netsentry/internal/parser"
+	"github.com/0xdevren/netsentry/internal/policy"
+	"github.com/0xdevren/netsentry/internal/report"
+	"github.com/0xdevren/netsentry/internal/util"
+	"github.com/0xdevren/netsentry/internal/validator"
+)
+
+// newScanCmd returns the scan sub-command (SSH-based remote config retrieval).
+func newScanCmd() *cobra.Command {
+	var (
+		targets     []string
+		invPath     string
+		netboxURL   string
+		netboxToken string
+		netboxCred  string
+		netbox      inventory.NetBoxFilters
+		nautobotURL string
+		nautobotEnv string
+		nautoCred   string
+		nautobot    inventory.NetBoxFilters
+		cmdbPath    string
+		deviceType  string
+		credSpec    string
+		credName    string
+		policyPaths []string
+		varsPath    string
+		waiversPath string
+		sshUser     string
+		sshKey      string
+		sshCert     string
+		sshAgent    bool
+		proxyJump   string
+		passwordEnv string
+		interactive bool
+		enableEnv   string
+		hostKeys    string
+		knownHosts  string
+		command     string
+		transport   string
+		datastore   string
+		apiUser     string
+		apiPassEnv  string
+		tlsCA       string
+		tlsInsecure bool
+		format      string
+		outputPath  string
+		redactOn    bool
+		redactFile  string
+		strict      bool
+		timeout     time.Duration
+		concurrency int
+	)
+
+	cmd := &cobra.Command{
+		Use:   "scan",
+		Short: "Retrieve and validate configuration from a live device via SSH",
+		Long: `Scan connects to each target over SSH, retrieves its running configuration
+and validates it against the policy. The show command is chosen from --type;
+without it the platform commands are tried in turn and the output is
+identified by the configuration detector.
+
+Credentials come from --ssh-key (with --ssh-cert for certificate
+authentication), the SSH agent with --ssh-agent or, for password
+authentication, from the environment variable named by --ssh-password-env.
+--credential names a credential of the --credentials provider instead, which
+supplies the username, password and enable password the flags leave unset:
+environment variables (the default), an encrypted file, HashiCorp Vault or a
+command, as described under "netsentry credentials".
+Devices behind bastions are reached through the hosts listed in
+--proxy-jump, in OpenSSH notation. Host keys are verified against
+--known-hosts: the strict policy rejects unknown hosts, tofu records the key
+of a host seen for the first time, and both reject changed keys.
+
+With --interactive the command is typed into a terminal session instead:
+scan waits for the prompt, runs "enable" with the password from
+--enable-password-env when the device starts unprivileged, disables paging
+and strips the echo and prompts from the output.
+
+With --transport netconf the configuration is read with a NETCONF
+get-config of the --datastore datastore instead (port 830 by default), which
+returns XML that JunOS and OpenConfig devices are parsed from without any
+screen-scraping. --transport eapi and nxapi run the command through the
+HTTPS APIs of Arista EOS and Cisco NX-OS (port 443 by default), with basic
+authentication as --api-user and the password from --api-password-env.
+
+With --inventory the devices of an inventory file are scanned, each over the
+transport of its source with its credentials and the SSH settings of its
+"ssh" section, falling back to the flags. Devices whose source is a file, a
+Git repository or an HTTP API are validated from that copy instead, and the
+vars of the inventory are available to policy templates. With --netbox
+the devices are listed from NetBox instead, narrowed by the --netbox-site,
+--netbox-role, --netbox-tag and --netbox-status filters, and reached at their
+primary IP. The API token is read from --netbox-token-env or the credential
+named by --netbox-credential. Their config contexts are available to policy
+templates as {{ .device.<key> }}. --nautobot does the same through the
+GraphQL API of Nautobot, with the --nautobot-* filters and token options,
+and --cmdb lists the devices of any JSON HTTP API as described by a
+field-mapping file.
+
+A single target produces a device report; several targets are scanned
+concurrently and produce a fleet report. Exit codes are the same as for
+validate.`,
+		Example: `  netsentry scan --target 10.0.0.1 --policy baseline.yaml --ssh-key ~/.ssh/netops
+  NETSENTRY_SSH_PASSWORD=... netsentry scan --target edge-01 --target edge-02:2222 --type cisco-ios --policy baseline.yaml
+  netsentry scan --target 10.0.0.1,10.0.0.2 --policy policies/ --timeout 45s --format json
+  netsentry scan --target 10.0.0.1 --policy baseline.yaml --host-key-policy tofu --known-hosts ~/.netsentry/known_hosts
+  netsentry scan --target 10.20.0.1 --policy baseline.yaml --ssh-agent --proxy-jump ops@bastion.example.net
+  netsentry scan --inventory inventory.yaml --policy baseline.yaml
+  netsentry scan --target 10.0.0.1 --credentials vault:secret/netsentry --credential core-routers --policy baseline.yaml
+  NETSENTRY_NETBOX_TOKEN=... netsentry scan --netbox https://netbox.example.net --netbox-site dc1 --netbox-role edge --policy baseline.yaml --ssh-agent
+  NETSENTRY_NAUTOBOT_TOKEN=... netsentry scan --nautobot https://nautobot.example.net --nautobot-location DC1 --policy baseline.yaml --ssh-agent
+  CMDB_TOKEN=... netsentry scan --cmdb cmdb-mapping.yaml --policy baseline.yaml --ssh-agent
+  netsentry scan --target mx-01 --transport netconf --policy junos.yaml --ssh-key ~/.ssh/netops
+  NETSENTRY_API_PASSWORD=... netsentry scan --target spine-01,spine-02 --transport eapi --tls-ca netops-ca.pem --policy eos.yaml
+  NETSENTRY_ENABLE_PASSWORD=... netsentry scan --target 10.0.0.1 --type cisco-ios --interactive --policy baseline.yaml --ssh-key ~/.ssh/netops`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			dt := model.DeviceType(deviceType)
+			if dt != "" {
+				if _, ok := parser.DefaultRegistry.Get(dt); !ok {
+					fmt.Fprintf(os.Stderr, "error: unsupported device type %q\n", deviceType)
+					os.Exit(3)
+				}
+			}
+			policies, err := loadPolicies(policyPaths, varsPath)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(3)
+			}
+			var waivers []policy.Waiver
+			if waiversPath != "" {
+				if waivers, err = policy.LoadWaiverFile(waiversPath); err != nil {
+					fmt.Fprintf(os.Stderr, "error: waivers load failed: %v\n", err)
+					os.Exit(3)
+				}
+			}
+
+			redactor, err := newRedactor(cmd, redactOn, redactFile)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(3)
+			}
+
+			if _, ok := app.TransportPort(transport); !ok {
+				fmt.Fprintf(os.Stderr, "error: unsupported transport %q\n", transport)
+				os.Exit(3)
+			}
+			if len(targets) == 0 && invPath == "" && netboxURL == "" && nautobotURL == "" && cmdbPath == "" {
+				fmt.Fprintln(os.Stderr, "error: one of --target, --inventory, --netbox, --nautobot or --cmdb is required")
+				os.Exit(3)
+			}
+			keyPath, err := util.ExpandHome(sshKey)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(3)
+			}
+			certPath, err := util.ExpandHome(sshCert)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(3)
+			}
+			hops, err := source.ParseProxyJump(proxyJump)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(3)
+			}
+			hostKeyPolicy, err := source.ParseHostKeyPolicy(hostKeys)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(3)
+			}
+			if knownHosts, err = util.ExpandHome(knownHosts); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(3)
+			}
+			if tlsCA, err = util.ExpandHome(tlsCA); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(3)
+			}
+			creds, err := credentials.Open(credSpec)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(3)
+			}
+			password := os.Getenv(passwordEnv)
+			viaSSH := transport == "ssh" || transport == "netconf"
+			if viaSSH && invPath == "" && keyPath == "" && !sshAgent && password == "" && credName == "" {
+				fmt.Fprintf(os.Stderr, "error: no SSH credentials: set --ssh-key, --ssh-agent, --credential or $%s\n", passwordEnv)
+				os.Exit(3)
+			}
+			base := source.SSHOptions{
+				User:            sshUser,
+				PrivateKeyPath:  keyPath,
+				CertificatePath: certPath,
+				UseAgent:        sshAgent,
+				Password:        password,
+				ProxyJump:       hops,
+				Command:         command,
+				Timeout:         timeout,
+				HostKeyPolicy:   hostKeyPolicy,
+				KnownHostsFile:  knownHosts,
+				Interactive:     interactive,
+				EnablePassword:  os.Getenv(enableEnv),
+			}
+
+			api := source.DeviceAPIOptions{
+				Username:       apiUser,
+				Password:       os.Getenv(apiPassEnv),
+				EnablePassword: base.EnablePassword,
+				TLS:            source.TLSOptions{CAFile: tlsCA, InsecureSkipVerify: tlsInsecure},
+				Timeout:        timeout,
+			}
+			if command != "" {
+				api.Commands = []string{command}
+			}
+			if credName != "" {
+				// The credential supplies the usernames unless they are
+				// given explicitly.
+				ref := &credentials.Ref{Provider: creds, Name: credName}
+				base.Credential, api.Credential = ref, ref
+				if !cmd.Flags().Changed("ssh-user") {
+					base.User = ""
+				}
+				if !cmd.Flags().Changed("api-user") {
+					api.Username = ""
+				}
+			}
+			scan := app.ScanOptions{
+				Targets:       targets,
+				InventoryPath: invPath,
+				CMDBPath:      cmdbPath,
+				Transport:     transport,
+				DeviceType:    dt,
+				SSH:           base,
+				API:           api,
+				Datastore:     datastore,
+				Credentials:   creds,
+				Policies:      policies,
+			}
+			if netboxURL != "" {
+				scan.NetBox = &inventory.NetBoxOptions{
+					BaseURL: netboxURL,
+					Token:   os.Getenv(netboxToken),
+					Filters: netbox,
+				}
+				if netboxCred != "" {
+					scan.NetBox.Credential = &credentials.Ref{Provider: creds, Name: netboxCred}
+				}
+			}
+			if nautobotURL != "" {
+				scan.Nautobot = &inventory.NautobotOptions{
+					BaseURL: nautobotURL,
+					Token:   os.Getenv(nautobotEnv),
+					Filters: nautobot,
+				}
+				if nautoCred != "" {
+					scan.Nautobot.Credential = &credentials.Ref{Provider: creds, Name: nautoCred}
+				}
+			}
+			fleet, code, err := app.ScanTargets(ctx, scan)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(code)
+			}
+
+			rep, err := validator.NewFleetValidator().Validate(ctx, validator.FleetValidationRequest{
+				Targets:       fleet,
+				Policies:      policies,
+				Waivers:       waivers,
+				Concurrency:   concurrency,
+				DeviceTimeout: timeout,
+			})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: scan failed: %v\n", err)
+				os.Exit(2)
+			}
+			for _, d := range rep.Devices {
+				if d.ErrorCode == validator.ErrorCodeHostKeyMismatch {
+					fmt.Fprintf(os.Stderr, "WARNING: %s: REMOTE HOST KEY HAS CHANGED. The device may have been replaced, or the connection intercepted. Verify the new key before updating %s.\n", d.Source, knownHosts)
+				}
+			}
+
+			opts := report.Options{Format: report.Format(format), OutputPath: outputPath, Redactor: redactor}
+			if len(rep.Devices) == 1 {
+				d := rep.Devices[0]
+				if d.Report == nil {
+					fmt.Fprintf(os.Stderr, "error: %s: %s\n", d.Source, d.Error)
+					os.Exit(2)
+				}
+				reporter, err := report.New(opts)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "error: reporter: %v\n", err)
+					os.Exit(2)
+				}
+				if err := reporter.Generate(d.Report); err != nil {
+					fmt.Fprintf(os.Stderr, "error: report generation: %v\n", err)
+					os.Exit(2)
+				}
+				os.Exit(validator.ExitCode(d.Report, strict))
+			}
+
+			reporter, err := report.NewFleet(opts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: reporter: %v\n", err)
+				os.Exit(2)
+			}
+			if err := reporter.GenerateFleet(rep); err != nil {
+				fmt.Fprintf(os.Stderr, "error: report generation: %v\n", err)
+				os.Exit(2)
+			}
+			os.Exit(validator.FleetExitCode(rep, strict))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&targets, "target", nil, "Device address as host or host:port; repeat for several devices")
+	cmd.Flags().StringVar(&invPath, "inventory", "", "Scan the devices of an inventory file")
+	cmd.Flags().StringVar(&netboxURL, "netbox", "", "Scan the devices of a NetBox instance (base URL)")
+	cmd.Flags().StringVar(&netboxToken, "netbox-token-env", "NETSENTRY_NETBOX_TOKEN", "Environment variable holding the NetBox API token")
+	cmd.Flags().StringVar(&netboxCred, "netbox-credential", "", "Named credential holding the NetBox API token, if the token variable is unset")
+	cmd.Flags().StringSliceVar(&netbox.Sites, "netbox-site", nil, "Only scan NetBox devices of these site slugs")
+	cmd.Flags().StringSliceVar(&netbox.Roles, "netbox-role", nil, "Only scan NetBox devices of these role slugs")
+	cmd.Flags().StringSliceVar(&netbox.Tags, "netbox-tag", nil, "Only scan NetBox devices with these tag slugs")
+	cmd.Flags().StringSliceVar(&netbox.Statuses, "netbox-status", []string{"active"}, "Only scan NetBox devices with these statuses")
+	cmd.Flags().StringVar(&nautobotURL, "nautobot", "", "Scan the devices of a Nautobot instance (base URL)")
+	cmd.Flags().StringVar(&nautobotEnv, "nautobot-token-env", "NETSENTRY_NAUTOBOT_TOKEN", "Environment variable holding the Nautobot API token")
+	cmd.Flags().StringVar(&nautoCred, "nautobot-credential", "", "Named credential holding the Nautobot API token, if the token variable is unset")
+	cmd.Flags().StringSliceVar(&nautobot.Sites, "nautobot-location", nil, "Only scan Nautobot devices of these location names")
+	cmd.Flags().StringSliceVar(&nautobot.Roles, "nautobot-role", nil, "Only scan Nautobot devices of these role names")
+	cmd.Flags().StringSliceVar(&nautobot.Tags, "nautobot-tag", nil, "Only scan Nautobot devices with these tag names")
+	cmd.Flags().StringSliceVar(&nautobot.Statuses, "nautobot-status", []string{"Active"}, "Only scan Nautobot devices with these statuses")
+	cmd.Flags().StringVar(&cmdbPath, "cmdb", "", "Scan the devices of a JSON HTTP API described by a field-mapping file")
+	cmd.Flags().StringVar(&deviceType, "type", "", "Device type (cisco-ios|cisco-nxos|juniper-junos|arista-eos); detected when omitted")
+	cmd.Flags().StringSliceVar(&policyPaths, "policy", nil, "Policy YAML file or directory; may be repeated (required)")
+	cmd.Flags().StringVar(&varsPath, "vars", "", "Path to a variables file for policy templates")
+	cmd.Flags().StringVar(&waiversPath, "waivers", "", "Path to a waiver file of approved rule exceptions")
+	cmd.Flags().StringVar(&credSpec, "credentials", "", "Credentials provider: env[:PREFIX], file:PATH, vault:MOUNT/PATH or exec:COMMAND (default env)")
+	cmd.Flags().StringVar(&credName, "credential", "", "Named credential supplying the SSH and API username and passwords")
+	cmd.Flags().StringVar(&sshUser, "ssh-user", "admin", "SSH username")
+	cmd.Flags().StringVar(&sshKey, "ssh-key", "", "Path to SSH private key")
+	cmd.Flags().StringVar(&sshCert, "ssh-cert", "", "Path to an OpenSSH certificate for --ssh-key")
+	cmd.Flags().BoolVar(&sshAgent, "ssh-agent", false, "Authenticate with the keys of the SSH agent ($SSH_AUTH_SOCK)")
+	cmd.Flags().StringVar(&proxyJump, "proxy-jump", "", "Jump hosts as [user@]host[:port], comma separated, connected in order")
+	cmd.Flags().StringVar(&passwordEnv, "ssh-password-env", "NETSENTRY_SSH_PASSWORD", "Environment variable holding the SSH password")
+	cmd.Flags().BoolVar(&interactive, "interactive", false, "Run the command in an interactive terminal session (enable, paging)")
+	cmd.Flags().StringVar(&enableEnv, "enable-password-env", "NETSENTRY_ENABLE_PASSWORD", "Environment variable holding the enable password for --interactive")
+	cmd.Flags().StringVar(&hostKeys, "host-key-policy", "strict", "Host key verification: strict|tofu|insecure")
+	cmd.Flags().StringVar(&knownHosts, "known-hosts", source.DefaultKnownHostsFile(), "known_hosts file of trusted host keys")
+	cmd.Flags().StringVar(&command, "command", "", "Override the command that prints the configuration")
+	cmd.Flags().StringVar(&transport, "transport", "ssh", "Collection protocol: ssh (CLI), netconf, eapi (Arista) or nxapi (Cisco NX-OS)")
+	cmd.Flags().StringVar(&datastore, "datastore", "running", "NETCONF datastore to read: running|candidate")
+	cmd.Flags().StringVar(&apiUser, "api-user", "admin", "Username for eapi and nxapi basic authentication")
+	cmd.Flags().StringVar(&apiPassEnv, "api-password-env", "NETSENTRY_API_PASSWORD", "Environment variable holding the eapi/nxapi password")
+	cmd.Flags().StringVar(&tlsCA, "tls-ca", "", "PEM file of CAs trusted for eapi/nxapi device certificates")
+	cmd.Flags().BoolVar(&tlsInsecure, "tls-skip-verify", false, "Skip eapi/nxapi certificate verification (lab use only)")
+	cmd.Flags().StringVar(&format, "format", "table", "Output format: table|json|yaml|html")
+	cmd.Flags().StringVar(&outputPath, "output", "", "Write report to file path")
+	cmd.Flags().BoolVar(&redactOn, "redact", false, "Mask secrets in the configuration lines quoted by the report")
+	cmd.Flags().StringVar(&redactFile, "redact-patterns", "", "YAML file of additional redaction patterns (implies --redact unless it is given)")
+	cmd.Flags().BoolVar(&strict, "strict", false, "Treat warnings as violations (exit 1)")
+	cmd.Flags().DurationVar(&timeout, "timeout", 60*time.Second, "Per-device timeout for collection and validation")
+	cmd.Flags().IntVar(&concurrency, "concurrency", 8, "Devices scanned in parallel")
+	cmd.MarkFlagsMutuallyExclusive("target", "inventory", "netbox", "nautobot", "cmdb")
+	_ = cmd.MarkFlagRequired("policy")
+	return cmd
+}
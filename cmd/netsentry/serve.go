@@ -10,7 +10,11 @@ import (
 )
 
 func newServeCmd() *cobra.Command {
-	var addr string
+	var (
+		addr       string
+		redactOn   bool
+		redactFile string
+	)
 
 	cmd := &cobra.Command{
 		Use:   "serve",
@@ -24,11 +28,25 @@ Endpoints:
   POST /api/v1/validate      – validate a device configuration
   GET  /api/v1/policy        – list available policies
   POST /api/v1/policy/lint   – lint a policy definition
-  GET  /api/v1/drift/{id}    – retrieve drift report`,
+  GET  /api/v1/drift/{id}    – retrieve drift report
+  POST /api/v1/drift/{id}    – store a configuration snapshot
+
+Secrets in stored snapshots, drift reports and validation results are masked
+by the default redaction patterns and those of --redact-patterns; a masked
+secret is replaced by a token with a stable hash of its value, keyed with
+$NETSENTRY_REDACT_KEY, or with a random key generated at startup when it is
+unset. Set $NETSENTRY_REDACT_KEY for tokens that stay comparable across
+restarts and with the CLI. --redact=false serves them as they are.`,
 		Example: `  netsentry serve
-  netsentry serve --addr 0.0.0.0:9090`,
+  netsentry serve --addr 0.0.0.0:9090
+  netsentry serve --redact-patterns redact.yaml`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
+			redactor, err := newRedactor(cmd, redactOn, redactFile)
+			if err != nil {
+				return err
+			}
+			appCtx.Redactor = redactor
 
 			srv := api.NewServer(appCtx, addr)
 			runtime := app.NewRuntime(appCtx)
@@ -52,5 +70,7 @@ Endpoints:
 	}
 
 	cmd.Flags().StringVar(&addr, "addr", ":8080", "Listen address for the HTTP API server")
+	cmd.Flags().BoolVar(&redactOn, "redact", true, "Mask secrets in stored snapshots and API responses")
+	cmd.Flags().StringVar(&redactFile, "redact-patterns", "", "YAML file of additional redaction patterns")
 	return cmd
 }
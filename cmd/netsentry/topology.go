@@ -5,37 +5,75 @@ import (
 	"os"
 
 	"github.com/spf13/cobra"
+	"github.com/0xdevren/netsentry/internal/app"
 	"github.com/0xdevren/netsentry/internal/config"
+	"github.com/0xdevren/netsentry/internal/credentials"
+	"github.com/0xdevren/netsentry/internal/inventory"
 	"github.com/0xdevren/netsentry/internal/model"
 	"github.com/0xdevren/netsentry/internal/parser"
 	"github.com/0xdevren/netsentry/internal/topology"
+	"github.com/0xdevren/netsentry/internal/validator"
 )
 
 func newTopologyCmd() *cobra.Command {
-	var configs []string
+	var (
+		configs  []string
+		invPath  string
+		credSpec string
+	)
 
 	cmd := &cobra.Command{
 		Use:   "topology",
 		Short: "Build and analyze the network topology from device configurations",
-		Example: `  netsentry topology --config r1.conf --config r2.conf --config r3.conf`,
+		Long: `Topology links the devices of the given configurations by their BGP and
+OSPF neighbours and reports duplicate IPs, overlapping subnets, loops and
+adjacency issues.
+
+With --inventory the devices of an inventory file are used instead, each
+read from its file, Git or API source; devices collected live are skipped.`,
+		Example: `  netsentry topology --config r1.conf --config r2.conf --config r3.conf
+  netsentry topology --inventory inventory.yaml`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if len(configs) == 0 {
-				return fmt.Errorf("at least one --config is required")
+			var targets []validator.FleetTarget
+			for _, cfgPath := range configs {
+				targets = append(targets, validator.FleetTarget{Source: cfgPath, Device: model.Device{ID: cfgPath}})
+			}
+			if invPath != "" {
+				inv, err := inventory.LoadFile(invPath)
+				if err != nil {
+					return err
+				}
+				creds, err := credentials.Open(credSpec)
+				if err != nil {
+					return err
+				}
+				targets = append(targets, app.InventoryFleetTargets(inv, creds)...)
+			}
+			if len(targets) == 0 {
+				return fmt.Errorf("at least one --config or an --inventory with stored configurations is required")
 			}
 
 			detector := config.NewDetector()
 			var parsedConfigs []*model.ConfigModel
 
-			for _, cfgPath := range configs {
-				data, err := os.ReadFile(cfgPath)
+			for _, t := range targets {
+				var data []byte
+				var err error
+				if t.Load != nil {
+					data, err = t.Load(cmd.Context())
+				} else {
+					data, err = os.ReadFile(t.Source)
+				}
 				if err != nil {
-					return fmt.Errorf("cannot read %q: %w", cfgPath, err)
+					return fmt.Errorf("cannot read %q: %w", t.Source, err)
+				}
+				device := t.Device
+				if device.Type == "" {
+					device.Type = detector.Detect(data)
 				}
-				deviceType := detector.Detect(data)
-				device := model.Device{ID: cfgPath, Type: deviceType}
-				parsed, err := parser.Parse(cmd.Context(), deviceType, data, device)
+				parsed, err := parser.Parse(cmd.Context(), device.Type, data, device)
 				if err != nil {
-					return fmt.Errorf("parse %q: %w", cfgPath, err)
+					return fmt.Errorf("parse %q: %w", t.Source, err)
 				}
 				parsedConfigs = append(parsedConfigs, parsed)
 			}
@@ -61,5 +99,7 @@ func newTopologyCmd() *cobra.Command {
 	}
 
 	cmd.Flags().StringArrayVar(&configs, "config", nil, "Device configuration file (repeatable)")
+	cmd.Flags().StringVar(&invPath, "inventory", "", "Build the topology of the devices of an inventory file")
+	cmd.Flags().StringVar(&credSpec, "credentials", "", "Credentials provider for the secrets of --inventory credentials (default env)")
 	return cmd
 }
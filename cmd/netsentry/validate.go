@@ -8,10 +8,15 @@ import (
 	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/0xdevren/netsentry/internal/app"
 	"github.com/0xdevren/netsentry/internal/config"
+	"github.com/0xdevren/netsentry/internal/config/source"
+	"github.com/0xdevren/netsentry/internal/credentials"
 	"github.com/0xdevren/netsentry/internal/model"
 	"github.com/0xdevren/netsentry/internal/parser"
 	"github.com/0xdevren/netsentry/internal/policy"
+	"github.com/0xdevren/netsentry/internal/policy/vars"
+	"github.com/0xdevren/netsentry/internal/redact"
 	"github.com/0xdevren/netsentry/internal/report"
 	"github.com/0xdevren/netsentry/internal/validator"
 )
@@ -19,7 +24,20 @@ import (
 func newValidateCmd() *cobra.Command {
 	var (
 		configPath  string
-		policyPath  string
+		configDir   string
+		inventory   string
+		credSpec    string
+		gitRepo     string
+		gitRef      string
+		gitPath     string
+		backupDir   string
+		backupFmt   string
+		routerDB    string
+		policyPaths []string
+		varsPath    string
+		waiversPath string
+		redactOn    bool
+		redactFile  string
 		format      string
 		outputPath  string
 		strict      bool
@@ -31,7 +49,30 @@ func newValidateCmd() *cobra.Command {
 		Use:   "validate",
 		Short: "Validate a device configuration against a policy",
 		Long: `Validate parses a device configuration file and evaluates it against
-the specified policy definition. Exit codes:
+the specified policy definition.
+
+With --config-dir or --inventory every configuration is validated in parallel
+and a fleet report is produced: per-device scores, the worst offenders and the
+rules failing on most devices. Devices are identified by their configured
+hostname. The exit code is the most severe of all devices.
+
+With --git-repo the configurations are read from a Git repository, such as
+an Oxidized or RANCID backup repository, at any revision: --ref selects the
+commit and --git-path a directory of the tree to validate as a fleet, or
+--config names a single "<ref>:<path>". The repository is cloned once into
+the user cache directory and only fetched on later runs.
+
+With --backup-format the devices of an Oxidized or RANCID backup are
+validated: they are listed from its router.db, with the vendor model mapped
+to the device type and the group to the site, and each configuration is read
+from the --backup directory or, without it, from --git-repo.
+
+With --redact, secrets such as enable secrets, SNMP communities and
+routing protocol passwords are masked in the configuration lines the report
+quotes. Each is replaced by a token with a keyed hash of the value, so that
+reports can be compared without exposing the secrets when
+$NETSENTRY_REDACT_KEY is set; without it every run uses a random key.
+--redact-patterns adds patterns of its own. Exit codes:
 
   0  All rules passed (fully compliant)
   1  Policy violations detected
@@ -40,16 +81,80 @@ the specified policy definition. Exit codes:
   4  Timeout`,
 		Example: `  netsentry validate --config router.conf --policy baseline.yaml
   netsentry validate --config router.conf --policy baseline.yaml --format json --output report.json
-  netsentry validate --config router.conf --policy baseline.yaml --strict --timeout 30s`,
+  netsentry validate --config router.conf --policy baseline.yaml --strict --timeout 30s
+  netsentry validate --config router.conf --policy site.yaml --vars sites.yaml
+  netsentry validate --config router.conf --policy baseline.yaml --waivers waivers.yaml
+  netsentry validate --config router.conf --policy security.yaml --policy routing.yaml
+  netsentry validate --config router.conf --policy policies/
+  netsentry validate --config-dir configs/ --policy baseline.yaml --concurrency 16
+  netsentry validate --inventory inventory.yaml --policy baseline.yaml --format json
+  netsentry validate --git-repo git@git.example.net:netops/backups.git --ref HEAD~1 --git-path configs --policy baseline.yaml
+  netsentry validate --git-repo ../backups --config v2024.06:configs/core-01 --policy baseline.yaml
+  netsentry validate --backup-format oxidized --backup /var/lib/oxidized/configs --router-db ~/.config/oxidized/router.db --policy baseline.yaml
+  netsentry validate --backup-format rancid --backup /var/lib/rancid --policy baseline.yaml`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx := cmd.Context()
+			if (gitRepo != "" || backupFmt != "") && (configDir != "" || inventory != "") {
+				fmt.Fprintln(os.Stderr, "error: --git-repo and --backup-format cannot be combined with --config-dir or --inventory")
+				os.Exit(3)
+			}
+			if backupFmt != "" && backupDir == "" && gitRepo == "" {
+				fmt.Fprintln(os.Stderr, "error: --backup-format requires --backup or --git-repo")
+				os.Exit(3)
+			}
+			redactor, err := newRedactor(cmd, redactOn, redactFile)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(3)
+			}
+			if configDir != "" || inventory != "" || backupFmt != "" || (gitRepo != "" && configPath == "") {
+				creds, err := credentials.Open(credSpec)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "error: %v\n", err)
+					os.Exit(3)
+				}
+				_, code, err := app.NewOrchestrator(appCtx).RunValidateFleet(ctx, app.ValidateCommandOptions{
+					ConfigDir:     configDir,
+					InventoryPath: inventory,
+					Credentials:   creds,
+					GitRepo:       gitRepo,
+					GitRef:        gitRef,
+					GitPath:       gitPath,
+					BackupFormat:  backupFmt,
+					BackupDir:     backupDir,
+					RouterDB:      routerDB,
+					PolicyPaths:   policyPaths,
+					VarsPath:      varsPath,
+					WaiversPath:   waiversPath,
+					Format:        format,
+					OutputPath:    outputPath,
+					Redactor:      redactor,
+					Strict:        strict,
+					Timeout:       timeout,
+					Concurrency:   concurrency,
+				})
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				}
+				os.Exit(code)
+			}
+			if configPath == "" {
+				fmt.Fprintln(os.Stderr, "error: one of --config, --config-dir, --inventory or --git-repo is required")
+				os.Exit(3)
+			}
+
 			if timeout > 0 {
 				var cancel context.CancelFunc
 				ctx, cancel = context.WithTimeout(ctx, timeout)
 				defer cancel()
 			}
 
-			rawData, err := os.ReadFile(configPath)
+			var rawData []byte
+			if gitRepo != "" {
+				rawData, err = readGitConfig(ctx, gitRepo, gitRef, configPath)
+			} else {
+				rawData, err = os.ReadFile(configPath)
+			}
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "error: cannot read config %q: %v\n", configPath, err)
 				os.Exit(3)
@@ -65,21 +170,30 @@ the specified policy definition. Exit codes:
 				os.Exit(3)
 			}
 
-			loader := policy.NewLoader()
-			pol, err := loader.LoadFile(policyPath)
+			policies, err := loadPolicies(policyPaths, varsPath)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "error: policy load failed: %v\n", err)
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
 				os.Exit(3)
 			}
 
+			var waivers []policy.Waiver
+			if waiversPath != "" {
+				waivers, err = policy.LoadWaiverFile(waiversPath)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "error: waivers load failed: %v\n", err)
+					os.Exit(3)
+				}
+			}
+
 			if concurrency <= 0 {
 				concurrency = 4
 			}
 			rep, err := validator.Validate(ctx, validator.ValidationRequest{
 				Config:      parsedCfg,
-				Policy:      pol,
+				Policies:    policies,
 				Strict:      strict,
 				Concurrency: concurrency,
+				Waivers:     waivers,
 			})
 			if err != nil {
 				if ctx.Err() != nil {
@@ -93,6 +207,7 @@ the specified policy definition. Exit codes:
 			reporter, err := report.New(report.Options{
 				Format:     report.Format(format),
 				OutputPath: outputPath,
+				Redactor:   redactor,
 			})
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "error: reporter: %v\n", err)
@@ -108,14 +223,88 @@ the specified policy definition. Exit codes:
 		},
 	}
 
-	cmd.Flags().StringVar(&configPath, "config", "", "Path to device configuration file (required)")
-	cmd.Flags().StringVar(&policyPath, "policy", "", "Path to policy YAML file (required)")
+	cmd.Flags().StringVar(&configPath, "config", "", "Path to device configuration file")
+	cmd.Flags().StringVar(&configDir, "config-dir", "", "Validate every configuration file in a directory as a fleet")
+	cmd.Flags().StringVar(&inventory, "inventory", "", "Validate the devices of an inventory file as a fleet")
+	cmd.Flags().StringVar(&credSpec, "credentials", "", "Credentials provider for the secrets of --inventory credentials (default env)")
+	cmd.Flags().StringVar(&gitRepo, "git-repo", "", "Read configurations from a Git repository URL or path")
+	cmd.Flags().StringVar(&gitRef, "ref", "HEAD", "Revision of --git-repo to validate")
+	cmd.Flags().StringVar(&gitPath, "git-path", "", "Directory of --git-repo holding the configurations (default: whole tree)")
+	cmd.Flags().StringVar(&backupFmt, "backup-format", "", "Validate the devices of a backup written by oxidized or rancid")
+	cmd.Flags().StringVar(&backupDir, "backup", "", "Backup output directory for --backup-format (default: read --git-repo)")
+	cmd.Flags().StringVar(&routerDB, "router-db", "", "Device list of the backup: a router.db or Oxidized nodes.json")
+	cmd.Flags().StringSliceVar(&policyPaths, "policy", nil, "Policy YAML file or directory; repeat to evaluate several policies in one run (required)")
+	cmd.Flags().StringVar(&varsPath, "vars", "", "Path to a variables file for policy templates")
+	cmd.Flags().StringVar(&waiversPath, "waivers", "", "Path to a waiver file of approved rule exceptions")
 	cmd.Flags().StringVar(&format, "format", "table", "Output format: table|json|yaml|html")
 	cmd.Flags().StringVar(&outputPath, "output", "", "Write report to file path")
+	cmd.Flags().BoolVar(&redactOn, "redact", false, "Mask secrets in the configuration lines quoted by the report")
+	cmd.Flags().StringVar(&redactFile, "redact-patterns", "", "YAML file of additional redaction patterns (implies --redact unless it is given)")
 	cmd.Flags().BoolVar(&strict, "strict", false, "Treat warnings as violations (exit 1)")
-	cmd.Flags().DurationVar(&timeout, "timeout", 0, "Validation timeout (e.g. 30s)")
-	cmd.Flags().IntVar(&concurrency, "concurrency", 4, "Parallel rule evaluation workers")
-	_ = cmd.MarkFlagRequired("config")
+	cmd.Flags().DurationVar(&timeout, "timeout", 0, "Validation timeout (e.g. 30s); per device when validating a fleet")
+	cmd.Flags().IntVar(&concurrency, "concurrency", 4, "Parallel rule evaluation workers, or devices in a fleet run")
+	cmd.MarkFlagsMutuallyExclusive("config", "config-dir", "inventory")
 	_ = cmd.MarkFlagRequired("policy")
 	return cmd
 }
+
+// readGitConfig reads the configuration named by ref, a path or a
+// "<ref>:<path>" reference, from the repository at url. A bare path is read
+// at defaultRef.
+func readGitConfig(ctx context.Context, url, defaultRef, ref string) ([]byte, error) {
+	rev, filePath := source.ParseGitPath(ref)
+	if rev == "" {
+		rev = defaultRef
+	}
+	repo, err := source.OpenGitRepository(ctx, url, "")
+	if err != nil {
+		return nil, err
+	}
+	return repo.ReadFile(ctx, rev, filePath)
+}
+
+// newRedactor returns the redactor selected by the --redact flags of cmd, or
+// nil when redaction is off. --redact-patterns implies --redact unless
+// --redact was given explicitly. Token hashes are keyed with
+// $NETSENTRY_REDACT_KEY, or with a random key when it is unset, so that
+// tokens are never plain hashes a short secret could be guessed back from.
+func newRedactor(cmd *cobra.Command, enabled bool, patternsPath string) (*redact.Redactor, error) {
+	if !enabled && (patternsPath == "" || cmd.Flags().Changed("redact")) {
+		return nil, nil
+	}
+	var opts redact.Options
+	if patternsPath != "" {
+		var err error
+		if opts, err = redact.LoadFile(patternsPath); err != nil {
+			return nil, err
+		}
+	}
+	opts.HashKey = []byte(os.Getenv(redactKeyEnv))
+	if len(opts.HashKey) == 0 {
+		opts.HashKey = redact.RandomKey()
+	}
+	return redact.NewRedactor(opts)
+}
+
+// redactKeyEnv is the environment variable holding the key of redaction
+// token hashes.
+const redactKeyEnv = "NETSENTRY_REDACT_KEY"
+
+// loadPolicies loads the policies named by paths, expanding directories, and
+// attaches the variables file at varsPath to each of them.
+func loadPolicies(paths []string, varsPath string) ([]*policy.Policy, error) {
+	policies, err := policy.NewLoader().LoadPaths(paths)
+	if err != nil {
+		return nil, fmt.Errorf("policy load failed: %w", err)
+	}
+	if varsPath != "" {
+		variables, err := vars.LoadFile(varsPath)
+		if err != nil {
+			return nil, fmt.Errorf("variables load failed: %w", err)
+		}
+		for _, p := range policies {
+			p.Variables = variables
+		}
+	}
+	return policies, nil
+}
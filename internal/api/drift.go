@@ -2,16 +2,23 @@ package api
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
+	"sync"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/0xdevren/netsentry/internal/app"
+	"github.com/0xdevren/netsentry/internal/config"
 	"github.com/0xdevren/netsentry/internal/drift"
 )
 
+// maxSnapshotBytes bounds the size of a stored configuration snapshot.
+const maxSnapshotBytes = 16 << 20
+
 // driftStore is a simple in-memory store of configuration snapshots.
 // In production this would be backed by a persistent store.
 var driftStore = struct {
+	mu       sync.Mutex
 	baseline map[string][]byte
 	current  map[string][]byte
 }{
@@ -31,13 +38,15 @@ func DriftHandler(appCtx *app.Context) http.HandlerFunc {
 			return
 		}
 
-		baseline, ok := driftStore.baseline[deviceID]
-		if !ok {
+		driftStore.mu.Lock()
+		baseline, okBaseline := driftStore.baseline[deviceID]
+		current, okCurrent := driftStore.current[deviceID]
+		driftStore.mu.Unlock()
+		if !okBaseline {
 			jsonError(w, "no baseline found for device "+deviceID, http.StatusNotFound)
 			return
 		}
-		current, ok := driftStore.current[deviceID]
-		if !ok {
+		if !okCurrent {
 			jsonError(w, "no current config found for device "+deviceID, http.StatusNotFound)
 			return
 		}
@@ -52,6 +61,52 @@ func DriftHandler(appCtx *app.Context) http.HandlerFunc {
 	}
 }
 
+// SnapshotHandler handles POST /api/v1/drift/{deviceID}. The request body is
+// the configuration text of the device; it becomes its current snapshot, and
+// the previous current snapshot its baseline. Secrets are redacted before the
+// snapshot is stored, so drift reports show a changed secret as a changed
+// token.
+func SnapshotHandler(appCtx *app.Context) http.HandlerFunc {
+	detector := config.NewDetector()
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		deviceID := chi.URLParam(r, "deviceID")
+		if deviceID == "" {
+			jsonError(w, "deviceID is required", http.StatusBadRequest)
+			return
+		}
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSnapshotBytes))
+		if err != nil {
+			jsonError(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(data) == 0 {
+			jsonError(w, "configuration is required", http.StatusBadRequest)
+			return
+		}
+		if appCtx.Redactor != nil {
+			data = appCtx.Redactor.Text(detector.Detect(data), data)
+		}
+
+		// The first snapshot of a device is both its baseline and its
+		// current configuration.
+		driftStore.mu.Lock()
+		baseline, ok := driftStore.current[deviceID]
+		if !ok {
+			baseline = data
+		}
+		driftStore.baseline[deviceID] = baseline
+		driftStore.current[deviceID] = data
+		driftStore.mu.Unlock()
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]string{ //nolint:errcheck
+			"device_id": deviceID,
+			"status":    "stored",
+		})
+	}
+}
+
 func splitLinesToCount(data []byte) []string {
 	var lines []string
 	s := string(data)
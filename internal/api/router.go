@@ -19,6 +19,7 @@ import (
 //   GET  /api/v1/policy         – list available policies
 //   POST /api/v1/policy/lint    – lint a policy file
 //   GET  /api/v1/drift/{id}     – retrieve drift report for a device
+//   POST /api/v1/drift/{id}     – store a configuration snapshot of a device
 
 // BuildRouter is the canonical router constructor used by tests and main server.
 func BuildRouter(appCtx *app.Context) http.Handler {
@@ -38,6 +39,7 @@ func BuildRouter(appCtx *app.Context) http.Handler {
 		r.Get("/policy", PolicyListHandler(appCtx))
 		r.Post("/policy/lint", PolicyLintHandler(appCtx))
 		r.Get("/drift/{deviceID}", DriftHandler(appCtx))
+		r.Post("/drift/{deviceID}", SnapshotHandler(appCtx))
 	})
 
 	return r
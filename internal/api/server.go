@@ -65,6 +65,7 @@ func NewRouter(appCtx *app.Context) http.Handler {
 		r.Get("/policy", PolicyListHandler(appCtx))
 		r.Post("/policy/lint", PolicyLintHandler(appCtx))
 		r.Get("/drift/{deviceID}", DriftHandler(appCtx))
+		r.Post("/drift/{deviceID}", SnapshotHandler(appCtx))
 	})
 
 	return r
@@ -80,6 +80,9 @@ func ValidateHandler(appCtx *app.Context) http.HandlerFunc {
 			return
 		}
 
+		if appCtx.Redactor != nil {
+			report = appCtx.Redactor.Report(report)
+		}
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(report) //nolint:errcheck
 	}
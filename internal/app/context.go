@@ -3,6 +3,7 @@
 package app
 
 import (
+	"github.com/0xdevren/netsentry/internal/redact"
 	"github.com/0xdevren/netsentry/internal/telemetry"
 )
 
@@ -23,6 +24,10 @@ type Context struct {
 	Metrics *telemetry.Metrics
 	// Config holds the application runtime configuration.
 	Config RuntimeConfig
+	// Redactor masks secrets in the configurations and reports served by
+	// the API. Nil disables redaction. NewContext sets one hashing tokens
+	// with a random per-process key.
+	Redactor *redact.Redactor
 }
 
 // RuntimeConfig holds configuration values parsed from flags and environment.
@@ -47,8 +52,9 @@ func NewContext(cfg RuntimeConfig) *Context {
 	})
 	metrics := telemetry.NewMetrics("netsentry")
 	return &Context{
-		Logger:  logger,
-		Metrics: metrics,
-		Config:  cfg,
+		Logger:   logger,
+		Metrics:  metrics,
+		Config:   cfg,
+		Redactor: redact.Default().WithKey(redact.RandomKey()),
 	}
 }
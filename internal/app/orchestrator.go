@@ -3,12 +3,18 @@ package app
 import (
 	"context"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/0xdevren/netsentry/internal/config"
+	"github.com/0xdevren/netsentry/internal/config/source"
+	"github.com/0xdevren/netsentry/internal/credentials"
+	"github.com/0xdevren/netsentry/internal/inventory"
 	"github.com/0xdevren/netsentry/internal/model"
 	"github.com/0xdevren/netsentry/internal/parser"
 	"github.com/0xdevren/netsentry/internal/policy"
+	"github.com/0xdevren/netsentry/internal/policy/vars"
+	"github.com/0xdevren/netsentry/internal/redact"
 	"github.com/0xdevren/netsentry/internal/report"
 	"github.com/0xdevren/netsentry/internal/validator"
 	"github.com/prometheus/client_golang/prometheus"
@@ -18,17 +24,53 @@ import (
 type ValidateCommandOptions struct {
 	// ConfigPath is the filesystem path to the device configuration file.
 	ConfigPath string
+	// ConfigDir is a directory of device configurations validated as a fleet
+	// by RunValidateFleet.
+	ConfigDir string
+	// InventoryPath is an inventory file naming the devices and configuration
+	// sources validated as a fleet by RunValidateFleet. The vars of its
+	// devices and groups are available to policy templates.
+	InventoryPath string
+	// Credentials resolves the secrets inventory credentials name.
+	Credentials credentials.Provider
+	// GitRepo is a Git repository URL or path whose device configurations
+	// are validated as a fleet by RunValidateFleet.
+	GitRepo string
+	// GitRef is the revision of GitRepo to validate (defaults to HEAD).
+	GitRef string
+	// GitPath limits the GitRepo fleet to the files below a directory.
+	GitPath string
+	// BackupFormat validates the devices of an Oxidized or RANCID backup,
+	// read from BackupDir or, when empty, from GitRepo at GitRef below
+	// GitPath.
+	BackupFormat string
+	// BackupDir is the backup output directory on disk.
+	BackupDir string
+	// RouterDB overrides the device list of the backup.
+	RouterDB string
 	// PolicyPath is the filesystem path to the policy YAML file.
 	PolicyPath string
+	// PolicyPaths lists further policy files or directories evaluated in the
+	// same run alongside PolicyPath.
+	PolicyPaths []string
+	// VarsPath is an optional variables file for policy template variables.
+	VarsPath string
+	// WaiversPath is an optional waiver file of approved rule exceptions.
+	WaiversPath string
 	// Format is the output format ("table", "json", "yaml", "html").
 	Format string
 	// OutputPath writes the report to a file instead of stdout.
 	OutputPath string
+	// Redactor masks secrets in the configuration lines quoted by the
+	// report. Nil leaves them as they are.
+	Redactor *redact.Redactor
 	// Strict treats warnings as failures for exit code purposes.
 	Strict bool
-	// Timeout is the maximum allowed duration for the validation run.
+	// Timeout is the maximum allowed duration for the validation run, or for
+	// each device in a fleet run.
 	Timeout time.Duration
-	// Concurrency is the number of parallel rule evaluation workers.
+	// Concurrency is the number of parallel rule evaluation workers, or of
+	// devices validated in parallel in a fleet run.
 	Concurrency int
 }
 
@@ -78,10 +120,9 @@ func (o *Orchestrator) RunValidate(ctx context.Context, opts ValidateCommandOpti
 		return nil, 3, fmt.Errorf("orchestrator: parse config: %w", err)
 	}
 
-	o.appCtx.Logger.Info("loading policy", "path", opts.PolicyPath)
-	pol, err := o.policyLoader.LoadFile(opts.PolicyPath)
+	policies, waivers, err := o.loadPolicies(opts)
 	if err != nil {
-		return nil, 3, fmt.Errorf("orchestrator: load policy: %w", err)
+		return nil, 3, err
 	}
 
 	timer := prometheus.NewTimer(o.appCtx.Metrics.ValidationDuration)
@@ -92,9 +133,10 @@ func (o *Orchestrator) RunValidate(ctx context.Context, opts ValidateCommandOpti
 
 	rep, err := validator.Validate(ctx, validator.ValidationRequest{
 		Config:      parsedCfg,
-		Policy:      pol,
+		Policies:    policies,
 		Strict:      opts.Strict,
 		Concurrency: opts.Concurrency,
+		Waivers:     waivers,
 	})
 	if err != nil {
 		if ctx.Err() != nil {
@@ -121,6 +163,7 @@ func (o *Orchestrator) RunValidate(ctx context.Context, opts ValidateCommandOpti
 	reporter, err := report.New(report.Options{
 		Format:     report.Format(opts.Format),
 		OutputPath: opts.OutputPath,
+		Redactor:   opts.Redactor,
 	})
 	if err != nil {
 		return rep, 2, fmt.Errorf("orchestrator: reporter: %w", err)
@@ -133,3 +176,275 @@ func (o *Orchestrator) RunValidate(ctx context.Context, opts ValidateCommandOpti
 }
 
 
+
+// loadPolicies loads the policies, variables and waivers named by opts.
+func (o *Orchestrator) loadPolicies(opts ValidateCommandOptions) ([]*policy.Policy, []policy.Waiver, error) {
+	policyPaths := opts.PolicyPaths
+	if opts.PolicyPath != "" {
+		policyPaths = append([]string{opts.PolicyPath}, policyPaths...)
+	}
+	o.appCtx.Logger.Info("loading policies", "paths", policyPaths)
+	policies, err := o.policyLoader.LoadPaths(policyPaths)
+	if err != nil {
+		return nil, nil, fmt.Errorf("orchestrator: load policy: %w", err)
+	}
+	if opts.VarsPath != "" {
+		variables, err := vars.LoadFile(opts.VarsPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("orchestrator: load variables: %w", err)
+		}
+		for _, pol := range policies {
+			pol.Variables = variables
+		}
+	}
+
+	var waivers []policy.Waiver
+	if opts.WaiversPath != "" {
+		if waivers, err = policy.LoadWaiverFile(opts.WaiversPath); err != nil {
+			return nil, nil, fmt.Errorf("orchestrator: load waivers: %w", err)
+		}
+	}
+	return policies, waivers, nil
+}
+
+// FleetTargets lists the devices of a fleet run from a configuration
+// directory or an inventory file. Inventory devices without a stored
+// configuration are skipped.
+func FleetTargets(configDir, inventoryPath string) ([]validator.FleetTarget, error) {
+	switch {
+	case configDir != "" && inventoryPath != "":
+		return nil, fmt.Errorf("fleet: config directory and inventory are mutually exclusive")
+	case configDir != "":
+		files, err := config.Discover(configDir)
+		if err != nil {
+			return nil, err
+		}
+		targets := make([]validator.FleetTarget, 0, len(files))
+		for _, f := range files {
+			targets = append(targets, validator.FleetTarget{Source: f})
+		}
+		return targets, nil
+	case inventoryPath != "":
+		targets, _, err := inventoryFleetTargets(inventoryPath, nil)
+		return targets, err
+	default:
+		return nil, fmt.Errorf("fleet: config directory or inventory is required")
+	}
+}
+
+// inventoryFleetTargets loads the inventory file at path and lists its
+// devices with a stored configuration.
+func inventoryFleetTargets(path string, creds credentials.Provider) ([]validator.FleetTarget, *inventory.FileInventory, error) {
+	inv, err := inventory.LoadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	targets := InventoryFleetTargets(inv, creds)
+	if len(targets) == 0 {
+		return nil, nil, fmt.Errorf("fleet: no inventory device in %q has a file, git or api source", path)
+	}
+	return targets, inv, nil
+}
+
+// InventoryFleetTargets lists the devices of inv whose configuration is
+// stored in a file, a Git repository or behind an HTTP API, in inventory
+// order. Devices without a source or collected live are skipped. Git
+// sources read "<ref>:<path>" and each repository is fetched once. Tokens of
+// api sources named by a credential's secret are resolved from creds, which
+// may be nil when none is.
+func InventoryFleetTargets(inv *inventory.FileInventory, creds credentials.Provider) []validator.FleetTarget {
+	git, api := source.NewGitSource(), source.NewAPISource()
+	var targets []validator.FleetTarget
+	for _, e := range inv.Entries() {
+		if e.Source == nil {
+			continue
+		}
+		s := *e.Source
+		switch s.Type {
+		case inventory.SourceFile:
+			targets = append(targets, validator.FleetTarget{Source: s.Path, Device: e.Device})
+		case inventory.SourceGit:
+			req := source.LoadRequest{GitOptions: &source.GitOptions{RepoURL: s.Repo, Ref: s.Ref, FilePath: s.Path}}
+			targets = append(targets, validator.FleetTarget{
+				Source: s.Ref + ":" + s.Path,
+				Device: e.Device,
+				Load: func(ctx context.Context) ([]byte, error) {
+					return git.Load(ctx, req)
+				},
+			})
+		case inventory.SourceAPI:
+			opts := &source.APIOptions{URL: s.URL}
+			if c, ok := inv.Credential(e.Credentials); ok {
+				if c.TokenEnv != "" {
+					opts.Token = os.Getenv(c.TokenEnv)
+				}
+				if c.Secret != "" {
+					opts.Credential = &credentials.Ref{Provider: creds, Name: c.Secret}
+				}
+			}
+			targets = append(targets, validator.FleetTarget{
+				Source: s.URL,
+				Device: e.Device,
+				Load: func(ctx context.Context) ([]byte, error) {
+					return api.Load(ctx, source.LoadRequest{APIOptions: opts})
+				},
+			})
+		}
+	}
+	return targets
+}
+
+// GitFleetTargets lists the device configurations below dir in repo at
+// revision ref. The revision is resolved once so that every device is read
+// from the same commit; sources read "<ref>:<path>".
+func GitFleetTargets(ctx context.Context, repo *source.GitRepository, ref, dir string) ([]validator.FleetTarget, error) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	commit, err := repo.Resolve(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("fleet: %w", err)
+	}
+	files, err := repo.Files(ctx, commit, dir)
+	if err != nil {
+		return nil, fmt.Errorf("fleet: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("fleet: no configuration files in %s:%s", ref, dir)
+	}
+	targets := make([]validator.FleetTarget, 0, len(files))
+	for _, f := range files {
+		f := f
+		targets = append(targets, validator.FleetTarget{
+			Source: ref + ":" + f,
+			Load: func(ctx context.Context) ([]byte, error) {
+				return repo.ReadFile(ctx, commit, f)
+			},
+		})
+	}
+	return targets, nil
+}
+
+// ProviderFleetTargets lists the devices of an inventory provider, each
+// loaded from src with its ID as the request path. Sources read
+// "<name>://<id>".
+func ProviderFleetTargets(ctx context.Context, name string, p inventory.Provider, src source.ConfigSource) ([]validator.FleetTarget, error) {
+	devices, err := p.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("fleet: %w", err)
+	}
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("fleet: %s inventory lists no devices", name)
+	}
+	targets := make([]validator.FleetTarget, 0, len(devices))
+	for _, d := range devices {
+		id := d.ID
+		targets = append(targets, validator.FleetTarget{
+			Source: name + "://" + id,
+			Device: d,
+			Load: func(ctx context.Context) ([]byte, error) {
+				return src.Load(ctx, source.LoadRequest{Path: id})
+			},
+		})
+	}
+	return targets, nil
+}
+
+// RunValidateFleet validates every device named by opts.ConfigDir,
+// opts.InventoryPath, opts.GitRepo or opts.BackupFormat and returns the fleet
+// report and the aggregate exit code.
+func (o *Orchestrator) RunValidateFleet(ctx context.Context, opts ValidateCommandOptions) (*policy.FleetReport, int, error) {
+	var (
+		targets []validator.FleetTarget
+		inv     *inventory.FileInventory
+		err     error
+	)
+	if opts.BackupFormat != "" {
+		backupOpts := inventory.BackupOptions{
+			Format:   inventory.BackupFormat(opts.BackupFormat),
+			Dir:      opts.BackupDir,
+			RouterDB: opts.RouterDB,
+		}
+		if opts.BackupDir == "" {
+			backupOpts.GitRepo, backupOpts.Ref, backupOpts.Dir = opts.GitRepo, opts.GitRef, opts.GitPath
+		}
+		backup, loadErr := inventory.LoadBackup(ctx, backupOpts)
+		if loadErr != nil {
+			return nil, 3, fmt.Errorf("orchestrator: %w", loadErr)
+		}
+		targets, err = ProviderFleetTargets(ctx, opts.BackupFormat, backup, backup)
+	} else if opts.GitRepo != "" {
+		repo, openErr := source.OpenGitRepository(ctx, opts.GitRepo, "")
+		if openErr != nil {
+			return nil, 3, fmt.Errorf("orchestrator: %w", openErr)
+		}
+		targets, err = GitFleetTargets(ctx, repo, opts.GitRef, opts.GitPath)
+	} else if opts.InventoryPath != "" && opts.ConfigDir == "" {
+		targets, inv, err = inventoryFleetTargets(opts.InventoryPath, opts.Credentials)
+	} else {
+		targets, err = FleetTargets(opts.ConfigDir, opts.InventoryPath)
+	}
+	if err != nil {
+		return nil, 3, fmt.Errorf("orchestrator: %w", err)
+	}
+	policies, waivers, err := o.loadPolicies(opts)
+	if err != nil {
+		return nil, 3, err
+	}
+	if inv != nil {
+		for _, pol := range policies {
+			pol.Variables = vars.Merge(pol.Variables, inv.Variables())
+		}
+	}
+
+	timer := prometheus.NewTimer(o.appCtx.Metrics.ValidationDuration)
+	defer timer.ObserveDuration()
+
+	o.appCtx.Logger.Info("validating fleet", "devices", len(targets))
+	rep, err := validator.NewFleetValidator().Validate(ctx, validator.FleetValidationRequest{
+		Targets:       targets,
+		Policies:      policies,
+		Waivers:       waivers,
+		Concurrency:   opts.Concurrency,
+		DeviceTimeout: opts.Timeout,
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, 4, fmt.Errorf("orchestrator: validation timed out: %w", ctx.Err())
+		}
+		return nil, 2, fmt.Errorf("orchestrator: validation: %w", err)
+	}
+
+	for _, d := range rep.Devices {
+		if d.Report == nil {
+			continue
+		}
+		o.appCtx.Metrics.ValidationTotal.Add(1)
+		for _, res := range d.Report.Results {
+			if res.Status == policy.StatusFail || res.Status == policy.StatusWarn {
+				o.appCtx.Metrics.PolicyViolations.WithLabelValues(string(res.Severity)).Inc()
+			}
+		}
+	}
+
+	o.appCtx.Logger.Info("fleet validation complete",
+		"devices", rep.Summary.Devices,
+		"non_compliant", rep.Summary.NonCompliant,
+		"errors", rep.Summary.Errors,
+		"score", fmt.Sprintf("%.0f%%", rep.Summary.Score),
+	)
+
+	reporter, err := report.NewFleet(report.Options{
+		Format:     report.Format(opts.Format),
+		OutputPath: opts.OutputPath,
+		Redactor:   opts.Redactor,
+	})
+	if err != nil {
+		return rep, 2, fmt.Errorf("orchestrator: reporter: %w", err)
+	}
+	if err := reporter.GenerateFleet(rep); err != nil {
+		return rep, 2, fmt.Errorf("orchestrator: generate report: %w", err)
+	}
+
+	return rep, validator.FleetExitCode(rep, opts.Strict), nil
+}
@@ -0,0 +1,355 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/0xdevren/netsentry/internal/config"
+	"github.com/0xdevren/netsentry/internal/config/source"
+	"github.com/0xdevren/netsentry/internal/credentials"
+	"github.com/0xdevren/netsentry/internal/inventory"
+	"github.com/0xdevren/netsentry/internal/model"
+	"github.com/0xdevren/netsentry/internal/policy"
+	"github.com/0xdevren/netsentry/internal/policy/vars"
+	"github.com/0xdevren/netsentry/internal/validator"
+)
+
+// ScanOptions describes the devices of a scan and how the devices collected
+// live are reached.
+type ScanOptions struct {
+	// Targets are device addresses as host or host:port.
+	Targets []string
+	// InventoryPath is an inventory file whose devices are scanned, each over
+	// the transport of its source with its credentials and SSH settings.
+	// Devices whose configuration is stored are read as validate reads
+	// them.
+	InventoryPath string
+	// NetBox lists the devices of a NetBox instance when set.
+	NetBox *inventory.NetBoxOptions
+	// Nautobot lists the devices of a Nautobot instance when set.
+	Nautobot *inventory.NautobotOptions
+	// CMDBPath is a field-mapping file listing the devices of a JSON HTTP
+	// API.
+	CMDBPath string
+	// Transport is the collection protocol: "ssh", "netconf", "eapi" or
+	// "nxapi".
+	Transport string
+	// DeviceType is the type of devices whose type is not otherwise known.
+	// When empty the type is implied by the transport or detected.
+	DeviceType model.DeviceType
+	// SSH holds the settings of SSH and NETCONF connections. Host and Port
+	// are set per device.
+	SSH source.SSHOptions
+	// API holds the settings of eAPI and NX-API requests.
+	API source.DeviceAPIOptions
+	// Datastore is the NETCONF datastore to read.
+	Datastore string
+	// Credentials resolves the secrets inventory credentials name.
+	Credentials credentials.Provider
+	// Policies receive the template variables of the inventory and the
+	// inventory services.
+	Policies []*policy.Policy
+}
+
+// scanService is an inventory service whose devices are scanned. Its devices
+// are reported by name when idTag is set, with their ID in that tag.
+type scanService struct {
+	idTag    string
+	provider inventory.VariablesProvider
+}
+
+// ScanTargets lists the devices of a scan, in the order inventory file,
+// inventory services, targets, and returns them with the process exit code
+// of a failure: 3 for invalid options and 2 when an inventory service
+// cannot be listed.
+func ScanTargets(ctx context.Context, opts ScanOptions) ([]validator.FleetTarget, int, error) {
+	defaultPort, ok := TransportPort(opts.Transport)
+	if !ok {
+		return nil, 3, fmt.Errorf("scan: unsupported transport %q", opts.Transport)
+	}
+	dt := opts.DeviceType
+	if dt == "" {
+		dt = transportDeviceType(opts.Transport)
+	}
+	hosts := make([]source.SSHOptions, 0, len(opts.Targets))
+	for _, t := range opts.Targets {
+		host, port, err := splitTarget(t, defaultPort)
+		if err != nil {
+			return nil, 3, fmt.Errorf("scan: %w", err)
+		}
+		o := opts.SSH
+		o.Host, o.Port = host, port
+		hosts = append(hosts, o)
+	}
+
+	s := newScanLoaders(opts.Datastore)
+	var fleet []validator.FleetTarget
+	if opts.InventoryPath != "" {
+		inv, err := inventory.LoadFile(opts.InventoryPath)
+		if err != nil {
+			return nil, 3, fmt.Errorf("scan: %w", err)
+		}
+		fleet = append(fleet, s.inventoryTargets(inv, opts)...)
+		for _, p := range opts.Policies {
+			p.Variables = vars.Merge(p.Variables, inv.Variables())
+		}
+	}
+
+	// Devices listed by an inventory service; those keyed by an opaque ID
+	// are reported by name, keeping the ID as a tag.
+	var services []scanService
+	if opts.NetBox != nil {
+		services = append(services, scanService{"netbox_id", inventory.NewNetBoxInventory(*opts.NetBox)})
+	}
+	if opts.Nautobot != nil {
+		services = append(services, scanService{"nautobot_id", inventory.NewNautobotInventory(*opts.Nautobot)})
+	}
+	if opts.CMDBPath != "" {
+		mapping, err := inventory.LoadHTTPMapping(opts.CMDBPath)
+		if err != nil {
+			return nil, 3, fmt.Errorf("scan: %w", err)
+		}
+		services = append(services, scanService{"", inventory.NewHTTPInventory(mapping, inventory.HTTPOptions{})})
+	}
+	for _, svc := range services {
+		devices, err := svc.provider.List(ctx)
+		if err != nil {
+			return nil, 2, fmt.Errorf("scan: %w", err)
+		}
+		for _, d := range devices {
+			if svc.idTag != "" && d.Hostname != "" {
+				if d.Tags == nil {
+					d.Tags = make(map[string]string)
+				}
+				d.Tags[svc.idTag] = d.ID
+				d.ID = d.Hostname
+			}
+			if d.Type == "" {
+				d.Type = dt
+			}
+			o := opts.SSH
+			o.Host, o.Port = d.ManagementIP, defaultPort
+			if o.Host == "" {
+				o.Host = d.ID
+			}
+			fleet = append(fleet, s.target(opts.Transport, o, opts.API, d))
+		}
+		for _, p := range opts.Policies {
+			p.Variables = vars.Merge(p.Variables, svc.provider.Variables())
+		}
+	}
+
+	for _, o := range hosts {
+		fleet = append(fleet, s.target(opts.Transport, o, opts.API, model.Device{ManagementIP: o.Host, Type: dt}))
+	}
+	return fleet, 0, nil
+}
+
+// scanLoaders are the configuration sources of the devices collected live,
+// shared by every device of a scan.
+type scanLoaders struct {
+	collector   *config.Collector
+	netconf     *source.NetconfSource
+	eapi, nxapi source.ConfigSource
+	datastore   string
+}
+
+func newScanLoaders(datastore string) *scanLoaders {
+	return &scanLoaders{
+		collector: config.NewCollector(),
+		netconf:   source.NewNetconfSource(),
+		eapi:      source.NewEAPISource(),
+		nxapi:     source.NewNXAPISource(),
+		datastore: datastore,
+	}
+}
+
+// target returns the fleet target collecting device over transport.
+func (s *scanLoaders) target(transport string, opts source.SSHOptions, api source.DeviceAPIOptions, device model.Device) validator.FleetTarget {
+	addr := net.JoinHostPort(opts.Host, strconv.Itoa(opts.Port))
+	var load func(ctx context.Context) ([]byte, error)
+	switch transport {
+	case "netconf":
+		load = func(ctx context.Context) ([]byte, error) {
+			return s.netconf.Load(ctx, source.LoadRequest{
+				Path:           opts.Host,
+				NetconfOptions: &source.NetconfOptions{SSH: opts, Datastore: s.datastore},
+			})
+		}
+	case "eapi", "nxapi":
+		src := s.eapi
+		if transport == "nxapi" {
+			src = s.nxapi
+		}
+		load = func(ctx context.Context) ([]byte, error) {
+			return src.Load(ctx, source.LoadRequest{Path: addr, DeviceAPIOptions: &api})
+		}
+	default:
+		load = func(ctx context.Context) ([]byte, error) {
+			data, _, err := s.collector.Collect(ctx, opts, device.Type)
+			return data, err
+		}
+	}
+	return validator.FleetTarget{
+		Source: transport + "://" + addr,
+		Device: device,
+		Load:   load,
+	}
+}
+
+// inventoryTargets lists the devices of inv: those with a stored
+// configuration as InventoryFleetTargets does, the others collected over the
+// transport of their source.
+func (s *scanLoaders) inventoryTargets(inv *inventory.FileInventory, opts ScanOptions) []validator.FleetTarget {
+	fleet := InventoryFleetTargets(inv, opts.Credentials)
+	for _, e := range inv.Entries() {
+		if e.Source != nil && !e.Source.Live() {
+			continue
+		}
+		t := opts.Transport
+		if e.Source != nil {
+			t = string(e.Source.Type)
+		}
+		if e.Type == "" {
+			e.Type = opts.DeviceType
+		}
+		if e.Type == "" {
+			e.Type = transportDeviceType(t)
+		}
+		port, _ := TransportPort(t)
+		cred, _ := inv.Credential(e.Credentials)
+		ssh := inventorySSHOptions(opts.SSH, e, cred, opts.Credentials, port)
+		api := opts.API
+		if cred.User != "" {
+			api.Username = cred.User
+		}
+		if cred.PasswordEnv != "" {
+			api.Password = os.Getenv(cred.PasswordEnv)
+		}
+		if cred.Secret != "" {
+			api.Username, api.Password = cred.User, os.Getenv(cred.PasswordEnv)
+			api.Credential = ssh.Credential
+		}
+		api.EnablePassword = ssh.EnablePassword
+		if e.Source != nil && e.Source.Command != "" {
+			api.Commands = []string{e.Source.Command}
+		}
+		fleet = append(fleet, s.target(t, ssh, api, e.Device))
+	}
+	return fleet
+}
+
+// TransportPort returns the default port of a collection transport and
+// whether the transport is supported.
+func TransportPort(transport string) (int, bool) {
+	switch transport {
+	case "ssh":
+		return 22, true
+	case "netconf":
+		return 830, true
+	case "eapi", "nxapi":
+		return 443, true
+	}
+	return 0, false
+}
+
+// transportDeviceType returns the device type implied by a transport: the
+// device APIs are platform specific.
+func transportDeviceType(transport string) model.DeviceType {
+	switch transport {
+	case "eapi":
+		return model.DeviceTypeAristaEOS
+	case "nxapi":
+		return model.DeviceTypeCiscoNXOS
+	}
+	return ""
+}
+
+// inventorySSHOptions applies the credentials and SSH settings of an
+// inventory device to base. Credentials set on the device, by reference or in
+// its SSH settings, replace those from the flags as a whole, as do its jump
+// hosts. The secret of a credential is resolved from creds on connection.
+func inventorySSHOptions(base source.SSHOptions, e inventory.FileDevice, cred inventory.Credential, creds credentials.Provider, defaultPort int) source.SSHOptions {
+	opts := base
+	opts.Host, opts.Port = e.ManagementIP, defaultPort
+	if opts.Host == "" {
+		opts.Host = e.ID
+	}
+	if e.Source != nil && e.Source.Command != "" {
+		opts.Command = e.Source.Command
+	}
+	if cred.User != "" {
+		opts.User = cred.User
+	}
+	if cred.Key != "" || cred.Agent || cred.PasswordEnv != "" || cred.Secret != "" {
+		hop := sshHop(inventory.SSHEndpoint{Key: cred.Key, Certificate: cred.Certificate, Agent: cred.Agent, PasswordEnv: cred.PasswordEnv})
+		opts.PrivateKeyPath, opts.CertificatePath = hop.PrivateKeyPath, hop.CertificatePath
+		opts.UseAgent, opts.Password = hop.UseAgent, hop.Password
+	}
+	if cred.EnablePasswordEnv != "" {
+		opts.EnablePassword = os.Getenv(cred.EnablePasswordEnv)
+	}
+	if cred.Secret != "" {
+		opts.User, opts.EnablePassword = cred.User, os.Getenv(cred.EnablePasswordEnv)
+		opts.Credential = &credentials.Ref{Provider: creds, Name: cred.Secret}
+	}
+	if e.SSH == nil {
+		return opts
+	}
+	ep := e.SSH.SSHEndpoint
+	if ep.Host != "" {
+		opts.Host = ep.Host
+	}
+	if ep.Port != 0 {
+		opts.Port = ep.Port
+	}
+	if ep.User != "" {
+		opts.User = ep.User
+	}
+	if ep.Key != "" || ep.Agent || ep.PasswordEnv != "" {
+		hop := sshHop(ep)
+		opts.PrivateKeyPath, opts.CertificatePath = hop.PrivateKeyPath, hop.CertificatePath
+		opts.UseAgent, opts.Password = hop.UseAgent, hop.Password
+	}
+	if len(e.SSH.ProxyJump) > 0 {
+		opts.ProxyJump = nil
+		for _, j := range e.SSH.ProxyJump {
+			opts.ProxyJump = append(opts.ProxyJump, sshHop(j))
+		}
+	}
+	return opts
+}
+
+// sshHop converts inventory SSH settings, reading the password from the
+// environment.
+func sshHop(ep inventory.SSHEndpoint) source.SSHHop {
+	hop := source.SSHHop{
+		Host:            ep.Host,
+		Port:            ep.Port,
+		User:            ep.User,
+		PrivateKeyPath:  ep.Key,
+		CertificatePath: ep.Certificate,
+		UseAgent:        ep.Agent,
+	}
+	if ep.PasswordEnv != "" {
+		hop.Password = os.Getenv(ep.PasswordEnv)
+	}
+	return hop
+}
+
+// splitTarget parses a host or host:port target, defaulting to defaultPort.
+func splitTarget(target string, defaultPort int) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(target)
+	if err != nil {
+		// No port, or an unbracketed IPv6 address.
+		return target, defaultPort, nil
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port <= 0 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid port in target %q", target)
+	}
+	return host, port, nil
+}
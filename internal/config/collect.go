@@ -0,0 +1,86 @@
+package config
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/0xdevren/netsentry/internal/config/source"
+	"github.com/0xdevren/netsentry/internal/model"
+)
+
+// runningConfigCommands maps each platform to the command that prints its
+// running configuration in the syntax the platform's parser expects.
+var runningConfigCommands = map[model.DeviceType]string{
+	model.DeviceTypeCiscoIOS:  "show running-config",
+	model.DeviceTypeCiscoNXOS: "show running-config",
+	model.DeviceTypeAristaEOS: "show running-config",
+	model.DeviceTypeJuniperOS: "show configuration | display set",
+}
+
+// probeCommands are tried in order when the platform of a device is unknown.
+var probeCommands = []string{
+	"show running-config",
+	"show configuration | display set",
+}
+
+// RunningConfigCommand returns the command that prints the running
+// configuration of a device of type t, or "" for an unknown platform.
+func RunningConfigCommand(t model.DeviceType) string {
+	return runningConfigCommands[t]
+}
+
+// Collector retrieves running configurations from live devices over SSH.
+type Collector struct {
+	ssh      source.ConfigSource
+	detector *Detector
+}
+
+// NewCollector constructs a Collector using the built-in SSH source.
+func NewCollector() *Collector {
+	return &Collector{ssh: source.NewSSHSource(), detector: NewDetector()}
+}
+
+// Collect fetches the running configuration of the device described by opts
+// and returns it with the device type. When deviceType is known its platform
+// command is run; otherwise each probe command is tried until the output is
+// recognised by the Detector. A non-empty opts.Command overrides both.
+// In interactive mode the device type also selects the prompt conventions.
+func (c *Collector) Collect(ctx context.Context, opts source.SSHOptions, deviceType model.DeviceType) ([]byte, model.DeviceType, error) {
+	known := deviceType != "" && deviceType != model.DeviceTypeUnknown
+	if opts.DeviceType == "" {
+		opts.DeviceType = deviceType
+	}
+	if opts.Command == "" && known {
+		if opts.Command = RunningConfigCommand(deviceType); opts.Command == "" {
+			return nil, deviceType, fmt.Errorf("collector: no configuration command for device type %q", deviceType)
+		}
+	}
+	if opts.Command != "" {
+		data, err := c.ssh.Load(ctx, source.LoadRequest{Path: opts.Host, SSHOptions: &opts})
+		if err != nil {
+			return nil, deviceType, fmt.Errorf("collector: %w", err)
+		}
+		if !known {
+			deviceType = c.detector.Detect(data)
+		}
+		return data, deviceType, nil
+	}
+
+	var lastErr error
+	for _, cmd := range probeCommands {
+		opts.Command = cmd
+		data, err := c.ssh.Load(ctx, source.LoadRequest{Path: opts.Host, SSHOptions: &opts})
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, model.DeviceTypeUnknown, fmt.Errorf("collector: %w", err)
+			}
+			lastErr = err
+			continue
+		}
+		if t := c.detector.Detect(data); t != model.DeviceTypeUnknown {
+			return data, t, nil
+		}
+		lastErr = fmt.Errorf("output of %q not recognised as a device configuration", cmd)
+	}
+	return nil, model.DeviceTypeUnknown, fmt.Errorf("collector: cannot determine device type of %s: %w", opts.Host, lastErr)
+}
@@ -21,6 +21,15 @@ func (d *Detector) Detect(data []byte) model.DeviceType {
 	content := strings.ToLower(string(data))
 	lines := bytes.Split(data, []byte("\n"))
 
+	// XML configurations, as collected over NETCONF. OpenConfig XML is
+	// vendor-neutral and leaves the platform unknown.
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("<")) {
+		if strings.Contains(content, "<configuration") {
+			return model.DeviceTypeJuniperOS
+		}
+		return model.DeviceTypeUnknown
+	}
+
 	// Cisco NX-OS fingerprinting - check for NX-OS specific directives first.
 	if strings.Contains(content, "nxos") ||
 		strings.Contains(content, "feature nxapi") ||
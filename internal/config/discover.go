@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/0xdevren/netsentry/internal/model"
+)
+
+// configExtensions are the file extensions of device configurations. Files
+// with other extensions, or none, are only configurations if the Detector
+// recognises their platform.
+var configExtensions = map[string]bool{
+	".conf":   true,
+	".cfg":    true,
+	".config": true,
+	".txt":    true,
+	".xml":    true,
+}
+
+// Discover returns the configuration files under dir in lexical order. The
+// directory is searched recursively; hidden files and directories, such as
+// .git, are skipped, as are files such as variables files or READMEs that
+// have no configuration extension and whose platform is not recognised.
+func Discover(dir string) ([]string, error) {
+	detector := NewDetector()
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if !configExtensions[strings.ToLower(filepath.Ext(path))] {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			if detector.Detect(data) == model.DeviceTypeUnknown {
+				return nil
+			}
+		}
+		files = append(files, path)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("config discover: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("config discover: no configuration files in %q", dir)
+	}
+	sort.Strings(files)
+	return files, nil
+}
@@ -10,7 +10,8 @@ import (
 
 // LoadOptions configures a configuration load operation.
 type LoadOptions struct {
-	// Source identifies the config source type: "filesystem", "ssh", "api", "git".
+	// Source identifies the config source type: "filesystem", "ssh", "api",
+	// "git", "netconf", "eapi", "nxapi".
 	Source string
 	// Path is the filesystem path or remote URL/identifier for the configuration.
 	Path string
@@ -20,6 +21,10 @@ type LoadOptions struct {
 	APIOptions *source.APIOptions
 	// GitOptions is only used when Source is "git".
 	GitOptions *source.GitOptions
+	// NetconfOptions is only used when Source is "netconf".
+	NetconfOptions *source.NetconfOptions
+	// DeviceAPIOptions is only used when Source is "eapi" or "nxapi".
+	DeviceAPIOptions *source.DeviceAPIOptions
 }
 
 // Loader abstracts configuration retrieval from multiple source backends.
@@ -34,6 +39,9 @@ func NewLoader() *Loader {
 	l.sources["ssh"] = source.NewSSHSource()
 	l.sources["api"] = source.NewAPISource()
 	l.sources["git"] = source.NewGitSource()
+	l.sources["netconf"] = source.NewNetconfSource()
+	l.sources["eapi"] = source.NewEAPISource()
+	l.sources["nxapi"] = source.NewNXAPISource()
 	return l
 }
 
@@ -44,10 +52,12 @@ func (l *Loader) Load(ctx context.Context, opts LoadOptions) ([]byte, error) {
 		return nil, fmt.Errorf("config loader: unknown source %q", opts.Source)
 	}
 	req := source.LoadRequest{
-		Path:       opts.Path,
-		SSHOptions: opts.SSHOptions,
-		APIOptions: opts.APIOptions,
-		GitOptions: opts.GitOptions,
+		Path:             opts.Path,
+		SSHOptions:       opts.SSHOptions,
+		APIOptions:       opts.APIOptions,
+		GitOptions:       opts.GitOptions,
+		NetconfOptions:   opts.NetconfOptions,
+		DeviceAPIOptions: opts.DeviceAPIOptions,
 	}
 	data, err := src.Load(ctx, req)
 	if err != nil {
@@ -8,6 +8,8 @@ import (
 	"io"
 	"net/http"
 	"time"
+
+	"github.com/0xdevren/netsentry/internal/credentials"
 )
 
 // LoadRequest encapsulates all parameters needed to retrieve a configuration.
@@ -20,6 +22,10 @@ type LoadRequest struct {
 	APIOptions *APIOptions
 	// GitOptions is populated when the source is "git".
 	GitOptions *GitOptions
+	// NetconfOptions is populated when the source is "netconf".
+	NetconfOptions *NetconfOptions
+	// DeviceAPIOptions is populated when the source is "eapi" or "nxapi".
+	DeviceAPIOptions *DeviceAPIOptions
 }
 
 // ConfigSource is the interface that all configuration source backends implement.
@@ -34,6 +40,9 @@ type APIOptions struct {
 	URL string
 	// Token is an optional Bearer token for authentication.
 	Token string
+	// Credential names the credential supplying the token when Token is
+	// empty.
+	Credential *credentials.Ref
 	// Method is the HTTP method (defaults to "GET").
 	Method string
 	// Timeout for the HTTP request.
@@ -77,8 +86,16 @@ func (a *apiSource) Load(ctx context.Context, req LoadRequest) ([]byte, error) {
 		return nil, fmt.Errorf("api source: create request: %w", err)
 	}
 
-	if opts.Token != "" {
-		httpReq.Header.Set("Authorization", "Bearer "+opts.Token)
+	token := opts.Token
+	if token == "" && opts.Credential != nil {
+		cred, err := opts.Credential.Resolve(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("api source: %w", err)
+		}
+		token = cred.Token.Reveal()
+	}
+	if token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+token)
 	}
 
 	client := &http.Client{Timeout: timeout}
@@ -0,0 +1,305 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/0xdevren/netsentry/internal/credentials"
+)
+
+// DeviceAPIOptions configures the Arista eAPI and Cisco NX-API sources.
+type DeviceAPIOptions struct {
+	// URL is the API endpoint. Defaults to https://<Path>/command-api for
+	// eAPI and https://<Path>/ins for NX-API.
+	URL string
+	// Username and Password are sent with HTTP basic authentication.
+	Username string
+	Password string
+	// EnablePassword is sent with the "enable" command eAPI runs first.
+	EnablePassword string
+	// Credential names the credential supplying Username, Password and
+	// EnablePassword where they are empty.
+	Credential *credentials.Ref
+	// Commands are run in order and their outputs concatenated. Defaults to
+	// "show running-config".
+	Commands []string
+	// TLS configures verification of the device certificate.
+	TLS TLSOptions
+	// Timeout for the HTTP request.
+	Timeout time.Duration
+}
+
+// TLSOptions configures certificate verification for HTTPS sources.
+type TLSOptions struct {
+	// CAFile is a PEM bundle of certificate authorities trusted in addition
+	// to the system roots, e.g. an internal CA signing device certificates.
+	CAFile string
+	// InsecureSkipVerify disables certificate verification.
+	InsecureSkipVerify bool
+}
+
+// config returns the tls.Config for o.
+func (o TLSOptions) config() (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: o.InsecureSkipVerify, //nolint:gosec // explicitly requested
+	}
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file %q: %w", o.CAFile, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA file %q holds no PEM certificates", o.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+// deviceAPICall holds the endpoint, commands and HTTP client of a device
+// API request.
+type deviceAPICall struct {
+	opts     *DeviceAPIOptions
+	url      string
+	commands []string
+	client   *http.Client
+}
+
+// newDeviceAPICall prepares a request of the device API source name, whose
+// endpoint is path on the device when no URL is configured.
+func newDeviceAPICall(ctx context.Context, req LoadRequest, name, path string) (*deviceAPICall, error) {
+	opts := req.DeviceAPIOptions
+	if opts == nil {
+		return nil, fmt.Errorf("%s source: DeviceAPIOptions are required", name)
+	}
+	if opts.Credential != nil {
+		cred, err := opts.Credential.Resolve(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s source: %w", name, err)
+		}
+		resolved := *opts
+		if resolved.Username == "" {
+			resolved.Username = cred.Username
+		}
+		if resolved.Password == "" {
+			resolved.Password = cred.Password.Reveal()
+		}
+		if resolved.EnablePassword == "" {
+			resolved.EnablePassword = cred.EnablePassword.Reveal()
+		}
+		opts = &resolved
+	}
+	c := &deviceAPICall{opts: opts, url: opts.URL, commands: opts.Commands}
+	if c.url == "" && req.Path != "" {
+		c.url = "https://" + req.Path + path
+	}
+	if c.url == "" {
+		return nil, fmt.Errorf("%s source: URL or Path is required", name)
+	}
+	if len(c.commands) == 0 {
+		c.commands = []string{"show running-config"}
+	}
+	tlsConfig, err := opts.TLS.config()
+	if err != nil {
+		return nil, fmt.Errorf("%s source: tls: %w", name, err)
+	}
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	c.client = &http.Client{Timeout: timeout, Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	return c, nil
+}
+
+// post sends body as JSON with basic authentication and decodes the JSON
+// response into out.
+func (c *deviceAPICall) post(ctx context.Context, body, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("encode request: %w", err)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.opts.Username != "" {
+		httpReq.SetBasicAuth(c.opts.Username, c.opts.Password)
+	}
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("do request: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read response body: %w", err)
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("authentication failed (status 401)")
+	}
+	// Both APIs report command errors in a JSON body, some with a 500 status.
+	if err := json.Unmarshal(data, out); err != nil {
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+		}
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
+
+// joinOutputs concatenates command outputs, each ending in a newline.
+func joinOutputs(outputs []string) []byte {
+	var buf bytes.Buffer
+	for _, out := range outputs {
+		buf.WriteString(out)
+		if out != "" && !strings.HasSuffix(out, "\n") {
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes()
+}
+
+// eAPISource retrieves configuration from Arista EOS devices with the eAPI
+// runCmds JSON-RPC method.
+type eAPISource struct{}
+
+// NewEAPISource constructs an Arista eAPI source.
+func NewEAPISource() ConfigSource {
+	return &eAPISource{}
+}
+
+// Load runs the configured commands in text format, after "enable", and
+// returns their concatenated output.
+func (e *eAPISource) Load(ctx context.Context, req LoadRequest) ([]byte, error) {
+	call, err := newDeviceAPICall(ctx, req, "eapi", "/command-api")
+	if err != nil {
+		return nil, err
+	}
+
+	var enable interface{} = "enable"
+	if call.opts.EnablePassword != "" {
+		enable = map[string]string{"cmd": "enable", "input": call.opts.EnablePassword}
+	}
+	cmds := []interface{}{enable}
+	for _, c := range call.commands {
+		cmds = append(cmds, c)
+	}
+	body := map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "runCmds",
+		"params":  map[string]interface{}{"version": 1, "cmds": cmds, "format": "text"},
+		"id":      "netsentry",
+	}
+	var resp struct {
+		Result []struct {
+			Output string `json:"output"`
+		} `json:"result"`
+		Error *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := call.post(ctx, body, &resp); err != nil {
+		return nil, fmt.Errorf("eapi source: %w", err)
+	}
+	if resp.Error != nil {
+		return nil, fmt.Errorf("eapi source: error %d: %s", resp.Error.Code, resp.Error.Message)
+	}
+	if len(resp.Result) != len(cmds) {
+		return nil, fmt.Errorf("eapi source: %d results for %d commands", len(resp.Result), len(cmds))
+	}
+	outputs := make([]string, 0, len(call.commands))
+	for _, r := range resp.Result[1:] {
+		outputs = append(outputs, r.Output)
+	}
+	return joinOutputs(outputs), nil
+}
+
+// nxAPISource retrieves configuration from Cisco NX-OS devices with NX-API
+// cli_show_ascii requests.
+type nxAPISource struct{}
+
+// NewNXAPISource constructs a Cisco NX-API source.
+func NewNXAPISource() ConfigSource {
+	return &nxAPISource{}
+}
+
+// nxapiOutput is the result of one command in an NX-API response.
+type nxapiOutput struct {
+	Code     string `json:"code"`
+	Msg      string `json:"msg"`
+	Body     string `json:"body"`
+	CLIError string `json:"clierror"`
+}
+
+// Load runs the configured commands and returns their concatenated output.
+func (n *nxAPISource) Load(ctx context.Context, req LoadRequest) ([]byte, error) {
+	call, err := newDeviceAPICall(ctx, req, "nxapi", "/ins")
+	if err != nil {
+		return nil, err
+	}
+
+	body := map[string]interface{}{"ins_api": map[string]string{
+		"version":       "1.0",
+		"type":          "cli_show_ascii",
+		"chunk":         "0",
+		"sid":           "1",
+		"input":         strings.Join(call.commands, " ;"),
+		"output_format": "json",
+	}}
+	var resp struct {
+		InsAPI struct {
+			Outputs struct {
+				// Output is one object for a single command, an array for
+				// several.
+				Output json.RawMessage `json:"output"`
+			} `json:"outputs"`
+		} `json:"ins_api"`
+	}
+	if err := call.post(ctx, body, &resp); err != nil {
+		return nil, fmt.Errorf("nxapi source: %w", err)
+	}
+
+	raw := bytes.TrimSpace(resp.InsAPI.Outputs.Output)
+	var results []nxapiOutput
+	if bytes.HasPrefix(raw, []byte("[")) {
+		err = json.Unmarshal(raw, &results)
+	} else {
+		var single nxapiOutput
+		err = json.Unmarshal(raw, &single)
+		results = []nxapiOutput{single}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("nxapi source: decode outputs: %w", err)
+	}
+	if len(results) != len(call.commands) {
+		return nil, fmt.Errorf("nxapi source: %d outputs for %d commands", len(results), len(call.commands))
+	}
+	outputs := make([]string, 0, len(results))
+	for i, r := range results {
+		if r.Code != "200" {
+			msg := strings.TrimSpace(r.CLIError)
+			if msg == "" {
+				msg = r.Msg
+			}
+			return nil, fmt.Errorf("nxapi source: %q: code %s: %s", call.commands[i], r.Code, msg)
+		}
+		outputs = append(outputs, r.Body)
+	}
+	return joinOutputs(outputs), nil
+}
@@ -1,34 +1,51 @@
 package source
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"net/url"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"strings"
+	"sync"
 )
 
 // GitOptions configures a Git repository config source.
 type GitOptions struct {
-	// RepoURL is the remote Git repository URL.
+	// RepoURL is the remote Git repository URL or a local repository path.
 	RepoURL string
-	// Branch is the branch to check out (defaults to "main").
+	// Branch is the branch to read when Ref is empty (defaults to the
+	// repository's default branch).
 	Branch string
-	// FilePath is the path within the repository to the config file.
+	// Ref is any revision to read the file at, e.g. a commit, a tag or
+	// "HEAD~1". It takes precedence over Branch.
+	Ref string
+	// FilePath is the path within the repository to the config file. When
+	// empty, the request Path is read as "<ref>:<path>".
 	FilePath string
-	// CloneDir is the local directory used for the clone (defaults to a temp dir).
+	// CloneDir is the directory holding the cached clone (defaults to a
+	// directory per repository under the user cache directory).
 	CloneDir string
 }
 
-// gitSource fetches configurations from a Git repository.
-type gitSource struct{}
+// gitSource fetches configurations from Git repositories. Each repository is
+// cloned once and fetched once per source, however many files are read.
+type gitSource struct {
+	mu    sync.Mutex
+	repos map[string]*GitRepository
+}
 
 // NewGitSource constructs a gitSource.
 func NewGitSource() ConfigSource {
-	return &gitSource{}
+	return &gitSource{repos: make(map[string]*GitRepository)}
 }
 
-// Load clones or fetches the repository and reads the specified file.
+// Load reads the requested file from the cached clone of the repository.
 func (g *gitSource) Load(ctx context.Context, req LoadRequest) ([]byte, error) {
 	opts := req.GitOptions
 	if opts == nil {
@@ -37,35 +54,217 @@ func (g *gitSource) Load(ctx context.Context, req LoadRequest) ([]byte, error) {
 	if opts.RepoURL == "" {
 		return nil, fmt.Errorf("git source: RepoURL is required")
 	}
-	if opts.FilePath == "" {
+
+	ref, filePath := opts.Ref, opts.FilePath
+	if ref == "" {
+		ref = opts.Branch
+	}
+	if filePath == "" {
+		var pathRef string
+		pathRef, filePath = ParseGitPath(req.Path)
+		if pathRef != "" {
+			ref = pathRef
+		}
+	}
+	if filePath == "" {
 		return nil, fmt.Errorf("git source: FilePath is required")
 	}
 
-	branch := opts.Branch
-	if branch == "" {
-		branch = "main"
+	repo, err := g.open(ctx, opts.RepoURL, opts.CloneDir)
+	if err != nil {
+		return nil, fmt.Errorf("git source: %w", err)
+	}
+	data, err := repo.ReadFile(ctx, ref, filePath)
+	if err != nil {
+		return nil, fmt.Errorf("git source: %w", err)
 	}
+	return data, nil
+}
+
+func (g *gitSource) open(ctx context.Context, url, dir string) (*GitRepository, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	key := url + "\x00" + dir
+	if repo, ok := g.repos[key]; ok {
+		return repo, nil
+	}
+	repo, err := OpenGitRepository(ctx, url, dir)
+	if err != nil {
+		return nil, err
+	}
+	g.repos[key] = repo
+	return repo, nil
+}
 
-	cloneDir := opts.CloneDir
-	if cloneDir == "" {
-		tmp, err := os.MkdirTemp("", "netsentry-git-*")
+// ParseGitPath splits a "<ref>:<path>" reference such as
+// "HEAD~1:configs/core-01.conf". A reference without a colon is a path at
+// the default branch and yields an empty ref.
+func ParseGitPath(s string) (ref, filePath string) {
+	if i := strings.Index(s, ":"); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return "", s
+}
+
+// GitRepository is a local mirror of a Git repository of device
+// configurations. Files are read from any revision without a checkout, so
+// the history of every device is available from one clone.
+type GitRepository struct {
+	dir string
+}
+
+// OpenGitRepository clones repoURL into dir as a mirror, or fetches the
+// mirror already there. An empty dir selects a directory per repository
+// under the user cache directory, so later runs only fetch new commits.
+func OpenGitRepository(ctx context.Context, repoURL, dir string) (*GitRepository, error) {
+	if repoURL == "" {
+		return nil, fmt.Errorf("git repository: URL is required")
+	}
+	if dir == "" {
+		cache, err := os.UserCacheDir()
 		if err != nil {
-			return nil, fmt.Errorf("git source: create temp dir: %w", err)
+			return nil, fmt.Errorf("git repository: cache directory: %w", err)
 		}
-		defer os.RemoveAll(tmp)
-		cloneDir = tmp
+		sum := sha256.Sum256([]byte(repoURL))
+		dir = filepath.Join(cache, "netsentry", "git", hex.EncodeToString(sum[:8]))
 	}
+	repo := &GitRepository{dir: dir}
 
-	args := []string{"clone", "--depth=1", "--branch", branch, opts.RepoURL, cloneDir}
-	cmd := exec.CommandContext(ctx, "git", args...)
+	if _, err := os.Stat(filepath.Join(dir, "HEAD")); err == nil {
+		if _, err := repo.git(ctx, "fetch", "--prune", "--quiet", "origin"); err != nil {
+			return nil, err
+		}
+		return repo, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), 0o755); err != nil {
+		return nil, fmt.Errorf("git repository: create cache directory: %w", err)
+	}
+	// "--" keeps a URL starting with a dash from being read as an option.
+	cmd := exec.CommandContext(ctx, "git", "clone", "--mirror", "--quiet", "--", repoURL, dir)
 	if out, err := cmd.CombinedOutput(); err != nil {
-		return nil, fmt.Errorf("git source: clone: %w: %s", err, string(out))
+		safe := redactURL(repoURL)
+		msg := strings.ReplaceAll(strings.TrimSpace(string(out)), repoURL, safe)
+		return nil, fmt.Errorf("git repository: clone %s: %w: %s", safe, err, msg)
+	}
+	return repo, nil
+}
+
+// redactURL returns repoURL without its user information, so that errors
+// do not carry credentials. Tokens are often given as the user name alone,
+// which url.URL.Redacted keeps.
+func redactURL(repoURL string) string {
+	u, err := url.Parse(repoURL)
+	if err != nil || u.User == nil {
+		return repoURL
 	}
+	u.User = nil
+	return u.String()
+}
+
+// Dir returns the directory of the local mirror.
+func (r *GitRepository) Dir() string { return r.dir }
 
-	targetPath := filepath.Join(cloneDir, opts.FilePath)
-	data, err := os.ReadFile(targetPath)
+// Resolve returns the commit hash ref points to. An empty ref is the
+// default branch.
+func (r *GitRepository) Resolve(ctx context.Context, ref string) (string, error) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	out, err := r.git(ctx, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
 	if err != nil {
-		return nil, fmt.Errorf("git source: read %q: %w", targetPath, err)
+		return "", fmt.Errorf("git repository: unknown revision %q", ref)
 	}
-	return data, nil
+	return strings.TrimSpace(string(out)), nil
+}
+
+// ReadFile returns the content of filePath at revision ref.
+func (r *GitRepository) ReadFile(ctx context.Context, ref, filePath string) ([]byte, error) {
+	commit, err := r.Resolve(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	filePath = strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(filePath)), "/")
+	out, err := r.git(ctx, "cat-file", "blob", commit+":"+filePath)
+	if err != nil {
+		return nil, fmt.Errorf("git repository: read %s:%s: no such file", displayRef(ref), filePath)
+	}
+	return out, nil
+}
+
+// Files lists the files below dir at revision ref, sorted. Files in hidden
+// directories and hidden files are left out, as for a configuration
+// directory on disk.
+func (r *GitRepository) Files(ctx context.Context, ref, dir string) ([]string, error) {
+	commit, err := r.Resolve(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"ls-tree", "-r", "-z", "--name-only", commit}
+	if dir = cleanTreePath(dir); dir != "" {
+		args = append(args, "--", dir)
+	}
+	out, err := r.git(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	return visibleFiles(out), nil
+}
+
+// ChangedFiles lists the files below dir that differ between revisions from
+// and to, including files added or deleted in between.
+func (r *GitRepository) ChangedFiles(ctx context.Context, from, to, dir string) ([]string, error) {
+	fromCommit, err := r.Resolve(ctx, from)
+	if err != nil {
+		return nil, err
+	}
+	toCommit, err := r.Resolve(ctx, to)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"diff", "--name-only", "-z", "--no-renames", fromCommit, toCommit}
+	if dir = cleanTreePath(dir); dir != "" {
+		args = append(args, "--", dir)
+	}
+	out, err := r.git(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	return visibleFiles(out), nil
+}
+
+// git runs a git command against the mirror and returns its standard output.
+func (r *GitRepository) git(ctx context.Context, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"--git-dir", r.dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git repository: git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// cleanTreePath normalises a directory within the repository; the root is "".
+func cleanTreePath(dir string) string {
+	return strings.Trim(path.Clean("/"+filepath.ToSlash(dir)), "/")
+}
+
+// visibleFiles splits NUL-separated git output into paths, leaving out paths
+// with a hidden component.
+func visibleFiles(out []byte) []string {
+	var files []string
+	for _, name := range strings.Split(string(out), "\x00") {
+		if name == "" || strings.HasPrefix(name, ".") || strings.Contains(name, "/.") {
+			continue
+		}
+		files = append(files, name)
+	}
+	return files
+}
+
+func displayRef(ref string) string {
+	if ref == "" {
+		return "HEAD"
+	}
+	return ref
 }
@@ -0,0 +1,210 @@
+package source
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// HostKeyPolicy selects how SSH host keys are verified.
+type HostKeyPolicy string
+
+const (
+	// HostKeyStrict accepts only hosts whose key is listed in the known_hosts
+	// file. Unknown hosts and changed keys are rejected.
+	HostKeyStrict HostKeyPolicy = "strict"
+	// HostKeyTOFU trusts the key of a host seen for the first time and records
+	// it in the known_hosts file. Changed keys are rejected.
+	HostKeyTOFU HostKeyPolicy = "tofu"
+	// HostKeyInsecure skips host key verification entirely.
+	HostKeyInsecure HostKeyPolicy = "insecure"
+)
+
+// ParseHostKeyPolicy converts a policy name into a HostKeyPolicy. The empty
+// string selects HostKeyStrict.
+func ParseHostKeyPolicy(s string) (HostKeyPolicy, error) {
+	switch p := HostKeyPolicy(strings.ToLower(s)); p {
+	case "":
+		return HostKeyStrict, nil
+	case HostKeyStrict, HostKeyTOFU, HostKeyInsecure:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown host key policy %q; must be strict, tofu or insecure", s)
+	}
+}
+
+// DefaultKnownHostsFile returns ~/.ssh/known_hosts.
+func DefaultKnownHostsFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".ssh", "known_hosts")
+	}
+	return filepath.Join(home, ".ssh", "known_hosts")
+}
+
+// HostKeyMismatchError reports a host presenting a key different from the one
+// recorded for it. It may indicate a man-in-the-middle attack or a replaced
+// device and is never accepted automatically.
+type HostKeyMismatchError struct {
+	// Host is the address the client connected to.
+	Host string
+	// Fingerprint is the SHA256 fingerprint of the presented key.
+	Fingerprint string
+	// Known lists the known_hosts entries recorded for the host as
+	// "file:line fingerprint".
+	Known []string
+}
+
+func (e *HostKeyMismatchError) Error() string {
+	return fmt.Sprintf("host key mismatch for %s: presented %s, known %s",
+		e.Host, e.Fingerprint, strings.Join(e.Known, ", "))
+}
+
+// UnknownHostKeyError reports a host without a known_hosts entry under the
+// strict policy.
+type UnknownHostKeyError struct {
+	// Host is the address the client connected to.
+	Host string
+	// Fingerprint is the SHA256 fingerprint of the presented key.
+	Fingerprint string
+	// File is the known_hosts file that was consulted.
+	File string
+}
+
+func (e *UnknownHostKeyError) Error() string {
+	return fmt.Sprintf("host %s is not in %s (key %s); add it or use the tofu host key policy",
+		e.Host, e.File, e.Fingerprint)
+}
+
+// hostKeys verifies the host keys of the hops of a connection.
+type hostKeys struct {
+	policy HostKeyPolicy
+	// known is the known_hosts file keys are checked against; nil under the
+	// insecure policy.
+	known *knownHostsFile
+}
+
+// callback returns the HostKeyCallback implementing the policy.
+func (h hostKeys) callback() ssh.HostKeyCallback {
+	if h.known == nil {
+		return ssh.InsecureIgnoreHostKey() //nolint:gosec // explicitly requested
+	}
+	return h.known.callback(h.policy)
+}
+
+// algorithms returns the host key algorithms to negotiate with addr: those
+// of its known keys, so that a host recorded with one key type is not asked
+// for another and taken for a changed key. It is nil, leaving the choice to
+// the server, for hosts without known keys.
+func (h hostKeys) algorithms(addr string) ([]string, error) {
+	if h.known == nil {
+		return nil, nil
+	}
+	return h.known.algorithms(addr)
+}
+
+// knownHostsFile verifies host keys against one known_hosts file. The file is
+// read on every check so that keys recorded by concurrent connections are
+// seen, and writes are serialised.
+type knownHostsFile struct {
+	path string
+	mu   sync.Mutex
+}
+
+// callback returns the HostKeyCallback implementing policy.
+func (k *knownHostsFile) callback(policy HostKeyPolicy) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		return k.check(policy, hostname, remote, key)
+	}
+}
+
+func (k *knownHostsFile) check(policy HostKeyPolicy, hostname string, remote net.Addr, key ssh.PublicKey) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if _, err := os.Stat(k.path); err == nil {
+		verify, err := knownhosts.New(k.path)
+		if err != nil {
+			return fmt.Errorf("known_hosts: %w", err)
+		}
+		err = verify(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		switch {
+		case err == nil:
+			return nil
+		case errors.As(err, &keyErr) && len(keyErr.Want) > 0:
+			known := make([]string, 0, len(keyErr.Want))
+			for _, w := range keyErr.Want {
+				known = append(known, fmt.Sprintf("%s:%d %s", w.Filename, w.Line, ssh.FingerprintSHA256(w.Key)))
+			}
+			return &HostKeyMismatchError{Host: hostname, Fingerprint: ssh.FingerprintSHA256(key), Known: known}
+		case !errors.As(err, &keyErr):
+			return fmt.Errorf("known_hosts: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("known_hosts: %w", err)
+	}
+
+	if policy != HostKeyTOFU {
+		return &UnknownHostKeyError{Host: hostname, Fingerprint: ssh.FingerprintSHA256(key), File: k.path}
+	}
+	return k.record(hostname, key)
+}
+
+// probeKey is a key no host has. Checking it lists the known keys of a host.
+var probeKey, _ = ssh.NewPublicKey(ed25519.PublicKey(make([]byte, ed25519.PublicKeySize)))
+
+// algorithms returns the host key algorithms of the keys known for hostname.
+func (k *knownHostsFile) algorithms(hostname string) ([]string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if _, err := os.Stat(k.path); os.IsNotExist(err) {
+		return nil, nil
+	}
+	verify, err := knownhosts.New(k.path)
+	if err != nil {
+		return nil, fmt.Errorf("known_hosts: %w", err)
+	}
+	var keyErr *knownhosts.KeyError
+	if err := verify(hostname, &net.TCPAddr{}, probeKey); !errors.As(err, &keyErr) {
+		return nil, nil
+	}
+	sort.Slice(keyErr.Want, func(i, j int) bool { return keyErr.Want[i].Key.Type() < keyErr.Want[j].Key.Type() })
+	var algorithms []string
+	for _, w := range keyErr.Want {
+		switch t := w.Key.Type(); t {
+		case ssh.KeyAlgoRSA:
+			algorithms = append(algorithms, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA)
+		default:
+			algorithms = append(algorithms, t)
+		}
+	}
+	return algorithms, nil
+}
+
+// record appends a known_hosts line for hostname.
+func (k *knownHostsFile) record(hostname string, key ssh.PublicKey) error {
+	if err := os.MkdirAll(filepath.Dir(k.path), 0o700); err != nil {
+		return fmt.Errorf("known_hosts: %w", err)
+	}
+	f, err := os.OpenFile(k.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("known_hosts: %w", err)
+	}
+	defer f.Close()
+	line := knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key)
+	if _, err := fmt.Fprintln(f, line); err != nil {
+		return fmt.Errorf("known_hosts: record %s: %w", hostname, err)
+	}
+	return nil
+}
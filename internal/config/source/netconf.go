@@ -0,0 +1,294 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	netconfBase10 = "urn:ietf:params:netconf:base:1.0"
+	netconfBase11 = "urn:ietf:params:netconf:base:1.1"
+	netconfNS     = "urn:ietf:params:xml:ns:netconf:base:1.0"
+	// netconfEOM terminates messages in NETCONF 1.0 framing and the hello
+	// exchange (RFC 6242).
+	netconfEOM = "]]>]]>"
+	// maxChunkSize bounds a single chunk of 1.1 framing, per RFC 6242.
+	maxChunkSize = 4294967295
+	// maxMessageSize bounds a message read from the device, so that a
+	// misbehaving one cannot exhaust memory.
+	maxMessageSize = 64 << 20
+)
+
+// NetconfOptions configures a NETCONF config source.
+type NetconfOptions struct {
+	// SSH holds the connection settings. Port defaults to 830; the command
+	// and interactive settings are not used.
+	SSH SSHOptions
+	// Datastore is the datastore to read: "running" (default) or
+	// "candidate".
+	Datastore string
+	// Filter is an optional subtree filter, e.g. "<configuration><system/>
+	// </configuration>", limiting the returned configuration.
+	Filter string
+}
+
+// NetconfSource retrieves device configuration with the NETCONF get-config
+// operation over SSH. Both the end-of-message framing of NETCONF 1.0 and the
+// chunked framing of 1.1 are supported; 1.1 is used when the device offers it.
+type NetconfSource struct {
+	ssh *SSHSource
+}
+
+// NewNetconfSource constructs a NetconfSource.
+func NewNetconfSource() *NetconfSource {
+	return &NetconfSource{ssh: NewSSHSource()}
+}
+
+// Load opens a NETCONF session, reads the configured datastore and returns
+// the content of the reply's data element as XML.
+func (n *NetconfSource) Load(ctx context.Context, req LoadRequest) ([]byte, error) {
+	opts := req.NetconfOptions
+	if opts == nil {
+		return nil, fmt.Errorf("netconf source: NetconfOptions are required")
+	}
+	datastore := opts.Datastore
+	if datastore == "" {
+		datastore = "running"
+	}
+	if datastore != "running" && datastore != "candidate" {
+		return nil, fmt.Errorf("netconf source: unsupported datastore %q", datastore)
+	}
+
+	sshOpts, err := withCredential(ctx, &opts.SSH)
+	if err != nil {
+		return nil, fmt.Errorf("netconf source: %w", err)
+	}
+	client, closeClient, err := n.ssh.dial(sshOpts, 830)
+	if err != nil {
+		return nil, fmt.Errorf("netconf source: %w", err)
+	}
+	defer closeClient()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("netconf source: new session: %w", err)
+	}
+	defer session.Close()
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("netconf source: stdin: %w", err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("netconf source: stdout: %w", err)
+	}
+	if err := session.RequestSubsystem("netconf"); err != nil {
+		return nil, fmt.Errorf("netconf source: request subsystem: %w", err)
+	}
+
+	type result struct {
+		data []byte
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		conn := &netconfConn{r: bufio.NewReader(stdout), w: stdin}
+		data, err := conn.getConfig(datastore, opts.Filter)
+		done <- result{data, err}
+	}()
+	select {
+	case <-ctx.Done():
+		session.Close()
+		return nil, fmt.Errorf("netconf source: context cancelled: %w", ctx.Err())
+	case r := <-done:
+		if r.err != nil {
+			return nil, fmt.Errorf("netconf source: %w", r.err)
+		}
+		return r.data, nil
+	}
+}
+
+// netconfConn is a NETCONF session over a byte stream.
+type netconfConn struct {
+	r *bufio.Reader
+	w io.Writer
+	// chunked is set once both peers announced base:1.1.
+	chunked bool
+	msgID   int
+}
+
+// getConfig performs the hello exchange and a get-config of datastore, then
+// closes the session.
+func (c *netconfConn) getConfig(datastore, filter string) ([]byte, error) {
+	if err := c.hello(); err != nil {
+		return nil, err
+	}
+	var op strings.Builder
+	op.WriteString("<get-config><source><" + datastore + "/></source>")
+	if filter != "" {
+		op.WriteString(`<filter type="subtree">` + filter + "</filter>")
+	}
+	op.WriteString("</get-config>")
+	reply, err := c.rpc(op.String())
+	if err != nil {
+		return nil, fmt.Errorf("get-config: %w", err)
+	}
+	// A device that fails to close cleanly has still delivered the data.
+	_, _ = c.rpc("<close-session/>")
+	return reply.Data.Inner, nil
+}
+
+// hello sends the client capabilities and reads the server's.
+func (c *netconfConn) hello() error {
+	msg := `<?xml version="1.0" encoding="UTF-8"?><hello xmlns="` + netconfNS + `"><capabilities>` +
+		"<capability>" + netconfBase10 + "</capability><capability>" + netconfBase11 + "</capability>" +
+		"</capabilities></hello>"
+	if _, err := io.WriteString(c.w, msg+netconfEOM); err != nil {
+		return fmt.Errorf("send hello: %w", err)
+	}
+	data, err := c.readEOM()
+	if err != nil {
+		return fmt.Errorf("read hello: %w", err)
+	}
+	var hello struct {
+		Capabilities []string `xml:"capabilities>capability"`
+	}
+	if err := xml.Unmarshal(data, &hello); err != nil {
+		return fmt.Errorf("parse hello: %w", err)
+	}
+	base10 := false
+	for _, capability := range hello.Capabilities {
+		switch strings.TrimSpace(capability) {
+		case netconfBase11:
+			c.chunked = true
+		case netconfBase10:
+			base10 = true
+		}
+	}
+	if !c.chunked && !base10 {
+		return fmt.Errorf("device supports neither NETCONF base 1.0 nor 1.1")
+	}
+	return nil
+}
+
+// rpcReply is the part of an rpc-reply the source inspects.
+type rpcReply struct {
+	Errors []struct {
+		Severity string `xml:"error-severity"`
+		Tag      string `xml:"error-tag"`
+		Message  string `xml:"error-message"`
+	} `xml:"rpc-error"`
+	Data struct {
+		Inner []byte `xml:",innerxml"`
+	} `xml:"data"`
+}
+
+// rpc sends operation in an rpc element and returns the reply, or an error
+// for a reply carrying an rpc-error of severity "error".
+func (c *netconfConn) rpc(operation string) (*rpcReply, error) {
+	c.msgID++
+	msg := `<rpc message-id="` + strconv.Itoa(c.msgID) + `" xmlns="` + netconfNS + `">` + operation + "</rpc>"
+	if err := c.write([]byte(msg)); err != nil {
+		return nil, fmt.Errorf("send rpc: %w", err)
+	}
+	data, err := c.read()
+	if err != nil {
+		return nil, fmt.Errorf("read reply: %w", err)
+	}
+	var reply rpcReply
+	if err := xml.Unmarshal(data, &reply); err != nil {
+		return nil, fmt.Errorf("parse reply: %w", err)
+	}
+	for _, e := range reply.Errors {
+		if e.Severity == "" || e.Severity == "error" {
+			msg := strings.TrimSpace(e.Message)
+			if msg == "" {
+				msg = e.Tag
+			}
+			return nil, fmt.Errorf("rpc-error: %s", msg)
+		}
+	}
+	return &reply, nil
+}
+
+func (c *netconfConn) write(msg []byte) error {
+	if !c.chunked {
+		_, err := c.w.Write(append(msg, netconfEOM...))
+		return err
+	}
+	_, err := fmt.Fprintf(c.w, "\n#%d\n%s\n##\n", len(msg), msg)
+	return err
+}
+
+func (c *netconfConn) read() ([]byte, error) {
+	if c.chunked {
+		return c.readChunked()
+	}
+	return c.readEOM()
+}
+
+// readEOM reads a message terminated by the 1.0 end-of-message marker.
+func (c *netconfConn) readEOM() ([]byte, error) {
+	var buf bytes.Buffer
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteByte(b)
+		if b == '>' && bytes.HasSuffix(buf.Bytes(), []byte(netconfEOM)) {
+			return buf.Bytes()[:buf.Len()-len(netconfEOM)], nil
+		}
+		if buf.Len() > maxMessageSize+len(netconfEOM) {
+			return nil, fmt.Errorf("message exceeds %d bytes", maxMessageSize)
+		}
+	}
+}
+
+// readChunked reads a message in 1.1 chunked framing: chunks of the form
+// "\n#<size>\n<data>" ended by "\n##\n".
+func (c *netconfConn) readChunked() ([]byte, error) {
+	var buf bytes.Buffer
+	for {
+		if err := c.expect("\n#"); err != nil {
+			return nil, err
+		}
+		header, err := c.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		header = strings.TrimSuffix(header, "\n")
+		if header == "#" {
+			return buf.Bytes(), nil
+		}
+		size, err := strconv.ParseUint(header, 10, 64)
+		if err != nil || size == 0 || size > maxChunkSize {
+			return nil, fmt.Errorf("invalid chunk size %q", header)
+		}
+		if uint64(buf.Len())+size > maxMessageSize {
+			return nil, fmt.Errorf("message exceeds %d bytes", maxMessageSize)
+		}
+		if _, err := io.CopyN(&buf, c.r, int64(size)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *netconfConn) expect(s string) error {
+	for i := 0; i < len(s); i++ {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b != s[i] {
+			return fmt.Errorf("malformed chunk framing")
+		}
+	}
+	return nil
+}
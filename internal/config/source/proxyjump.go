@@ -0,0 +1,64 @@
+package source
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// SSHHop is one SSH endpoint of a connection: a bastion host of
+// SSHOptions.ProxyJump, or the device itself. A bastion without credentials
+// of its own is authenticated with the device's, and without a user with the
+// device's user.
+type SSHHop struct {
+	// Host is the hostname or IP address of the hop.
+	Host string
+	// Port is the SSH port (defaults to 22 if zero).
+	Port int
+	// User is the SSH username.
+	User string
+	// PrivateKeyPath is the path to the PEM-encoded private key file.
+	PrivateKeyPath string
+	// CertificatePath is the path to an OpenSSH certificate for the key.
+	CertificatePath string
+	// UseAgent offers the keys of the SSH agent at $SSH_AUTH_SOCK.
+	UseAgent bool
+	// Password is used for password authentication.
+	Password string
+}
+
+// hasCredentials reports whether the hop configures its own authentication.
+func (h SSHHop) hasCredentials() bool {
+	return h.PrivateKeyPath != "" || h.UseAgent || h.Password != ""
+}
+
+// ParseProxyJump parses an OpenSSH ProxyJump specification, a comma
+// separated list of [user@]host[:port] hops such as
+// "ops@bastion.example.net,10.1.0.1:2222".
+func ParseProxyJump(spec string) ([]SSHHop, error) {
+	if strings.TrimSpace(spec) == "" {
+		return nil, nil
+	}
+	var hops []SSHHop
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		var hop SSHHop
+		if i := strings.LastIndexByte(part, '@'); i >= 0 {
+			hop.User, part = part[:i], part[i+1:]
+		}
+		hop.Host = part
+		if host, port, err := net.SplitHostPort(part); err == nil {
+			p, err := strconv.Atoi(port)
+			if err != nil || p <= 0 || p > 65535 {
+				return nil, fmt.Errorf("proxy jump: invalid port in %q", part)
+			}
+			hop.Host, hop.Port = host, p
+		}
+		if hop.Host == "" {
+			return nil, fmt.Errorf("proxy jump: empty host in %q", spec)
+		}
+		hops = append(hops, hop)
+	}
+	return hops, nil
+}
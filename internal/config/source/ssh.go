@@ -6,9 +6,14 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"strconv"
+	"sync"
 	"time"
 
+	"github.com/0xdevren/netsentry/internal/credentials"
+	"github.com/0xdevren/netsentry/internal/model"
 	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
 )
 
 // SSHOptions holds the authentication and connection parameters for SSH sources.
@@ -21,62 +26,105 @@ type SSHOptions struct {
 	User string
 	// PrivateKeyPath is the path to the PEM-encoded private key file.
 	PrivateKeyPath string
-	// Password is used for password authentication when PrivateKeyPath is empty.
+	// CertificatePath is the path to an OpenSSH certificate for the key at
+	// PrivateKeyPath, for devices trusting a user certificate authority.
+	CertificatePath string
+	// UseAgent offers the keys of the SSH agent at $SSH_AUTH_SOCK.
+	UseAgent bool
+	// Password is used for password authentication when no key is accepted.
 	Password string
+	// ProxyJump lists the bastion hosts the connection is tunnelled through,
+	// in order, like OpenSSH's ProxyJump. A hop without credentials of its
+	// own is offered the key, certificate and agent of the device, but not
+	// its password.
+	ProxyJump []SSHHop
 	// Command is the CLI command to execute to retrieve the configuration.
 	// Defaults to "show running-config".
 	Command string
 	// Timeout is the connection and command execution timeout.
 	Timeout time.Duration
+	// HostKeyPolicy selects how the device's host key is verified. Defaults
+	// to HostKeyStrict.
+	HostKeyPolicy HostKeyPolicy
+	// KnownHostsFile is the known_hosts file holding trusted host keys, and
+	// where HostKeyTOFU records new ones. Defaults to ~/.ssh/known_hosts.
+	KnownHostsFile string
+	// Interactive runs Command in a PTY-backed shell instead of an exec
+	// request, for devices that need paging disabled or "enable" before
+	// printing their full configuration.
+	Interactive bool
+	// EnablePassword is sent when the device asks for one after "enable" in
+	// interactive mode.
+	EnablePassword string
+	// DeviceType selects the prompt and pager conventions used in
+	// interactive mode. Unknown types are driven like Cisco IOS.
+	DeviceType model.DeviceType
+	// Credential names the credential supplying User, Password and
+	// EnablePassword where they are empty. It is resolved when connecting.
+	Credential *credentials.Ref
+}
+
+// withCredential returns opts with its Credential resolved into the user,
+// password and enable password it leaves empty.
+func withCredential(ctx context.Context, opts *SSHOptions) (*SSHOptions, error) {
+	if opts.Credential == nil {
+		return opts, nil
+	}
+	cred, err := opts.Credential.Resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resolved := *opts
+	if resolved.User == "" {
+		resolved.User = cred.Username
+	}
+	if resolved.Password == "" {
+		resolved.Password = cred.Password.Reveal()
+	}
+	if resolved.EnablePassword == "" {
+		resolved.EnablePassword = cred.EnablePassword.Reveal()
+	}
+	return &resolved, nil
 }
 
 // SSHSource retrieves device configuration via SSH command execution.
-type SSHSource struct{}
+type SSHSource struct {
+	mu         sync.Mutex
+	knownHosts map[string]*knownHostsFile
+}
 
 // NewSSHSource constructs an SSHSource.
 func NewSSHSource() *SSHSource {
-	return &SSHSource{}
+	return &SSHSource{knownHosts: make(map[string]*knownHostsFile)}
 }
 
 // Load establishes an SSH session to the target device, executes the
-// configuration retrieval command, and returns the output.
+// configuration retrieval command, and returns the output. In interactive
+// mode the command is typed into a shell; see SSHOptions.Interactive.
 func (s *SSHSource) Load(ctx context.Context, req LoadRequest) ([]byte, error) {
 	opts := req.SSHOptions
 	if opts == nil {
 		return nil, fmt.Errorf("ssh source: SSHOptions are required")
 	}
-
-	port := opts.Port
-	if port == 0 {
-		port = 22
+	opts, err := withCredential(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("ssh source: %w", err)
 	}
+
 	command := opts.Command
 	if command == "" {
 		command = "show running-config"
 	}
-	timeout := opts.Timeout
-	if timeout == 0 {
-		timeout = 30 * time.Second
-	}
 
-	authMethods, err := s.buildAuthMethods(opts)
+	client, closeClient, err := s.dial(opts, 22)
 	if err != nil {
-		return nil, fmt.Errorf("ssh source: auth: %w", err)
+		return nil, fmt.Errorf("ssh source: %w", err)
 	}
+	defer closeClient()
 
-	cfg := &ssh.ClientConfig{
-		User:            opts.User,
-		Auth:            authMethods,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(), //nolint:gosec // device fingerprints managed separately
-		Timeout:         timeout,
-	}
-
-	addr := net.JoinHostPort(opts.Host, fmt.Sprintf("%d", port))
-	client, err := ssh.Dial("tcp", addr, cfg)
-	if err != nil {
-		return nil, fmt.Errorf("ssh source: dial %s: %w", addr, err)
+	if opts.Interactive {
+		return runInteractive(ctx, client, opts, command)
 	}
-	defer client.Close()
 
 	session, err := client.NewSession()
 	if err != nil {
@@ -104,21 +152,214 @@ func (s *SSHSource) Load(ctx context.Context, req LoadRequest) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-// buildAuthMethods returns the appropriate SSH authentication methods.
-func (s *SSHSource) buildAuthMethods(opts *SSHOptions) ([]ssh.AuthMethod, error) {
-	if opts.PrivateKeyPath != "" {
-		key, err := os.ReadFile(opts.PrivateKeyPath)
+// hostKeys returns the host key verification for opts. Connections sharing
+// a known_hosts file share its lock, so concurrent trust-on-first-use
+// connections record each host once.
+func (s *SSHSource) hostKeys(opts *SSHOptions) (hostKeys, error) {
+	policy, err := ParseHostKeyPolicy(string(opts.HostKeyPolicy))
+	if err != nil {
+		return hostKeys{}, err
+	}
+	if policy == HostKeyInsecure {
+		return hostKeys{policy: policy}, nil
+	}
+	path := opts.KnownHostsFile
+	if path == "" {
+		path = DefaultKnownHostsFile()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.knownHosts[path]
+	if !ok {
+		k = &knownHostsFile{path: path}
+		s.knownHosts[path] = k
+	}
+	return hostKeys{policy: policy, known: k}, nil
+}
+
+// dial connects to the device described by opts through its jump hosts,
+// using defaultPort when opts.Port is zero. The returned function closes the
+// device connection and the jump host connections beneath it.
+func (s *SSHSource) dial(opts *SSHOptions, defaultPort int) (*ssh.Client, func(), error) {
+	port := opts.Port
+	if port == 0 {
+		port = defaultPort
+	}
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+
+	keys, err := s.hostKeys(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	device := SSHHop{
+		Host:            opts.Host,
+		Port:            port,
+		User:            opts.User,
+		PrivateKeyPath:  opts.PrivateKeyPath,
+		CertificatePath: opts.CertificatePath,
+		UseAgent:        opts.UseAgent,
+		Password:        opts.Password,
+	}
+	var clients []*ssh.Client
+	closeAll := func() {
+		for i := len(clients) - 1; i >= 0; i-- {
+			clients[i].Close()
+		}
+	}
+	var via *ssh.Client
+	for _, hop := range opts.ProxyJump {
+		// A hop without credentials of its own uses the device's keys, but
+		// never its password, which would disclose it to every bastion.
+		if !hop.hasCredentials() {
+			hop.PrivateKeyPath, hop.CertificatePath = device.PrivateKeyPath, device.CertificatePath
+			hop.UseAgent = device.UseAgent
+		}
+		if hop.User == "" {
+			hop.User = device.User
+		}
+		next, err := s.connect(via, hop, keys, timeout)
 		if err != nil {
-			return nil, fmt.Errorf("read private key %q: %w", opts.PrivateKeyPath, err)
+			closeAll()
+			return nil, nil, fmt.Errorf("jump host: %w", err)
+		}
+		clients = append(clients, next)
+		via = next
+	}
+	client, err := s.connect(via, device, keys, timeout)
+	if err != nil {
+		closeAll()
+		return nil, nil, err
+	}
+	clients = append(clients, client)
+	return client, closeAll, nil
+}
+
+// connect opens an SSH connection to hop, tunnelled through via when it is
+// not nil.
+func (s *SSHSource) connect(via *ssh.Client, hop SSHHop, keys hostKeys, timeout time.Duration) (*ssh.Client, error) {
+	port := hop.Port
+	if port == 0 {
+		port = 22
+	}
+	addr := net.JoinHostPort(hop.Host, strconv.Itoa(port))
+
+	authMethods, closeAuth, err := s.buildAuthMethods(hop)
+	if err != nil {
+		return nil, fmt.Errorf("auth %s: %w", addr, err)
+	}
+	defer closeAuth()
+
+	algorithms, err := keys.algorithms(addr)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &ssh.ClientConfig{
+		User:              hop.User,
+		Auth:              authMethods,
+		HostKeyCallback:   keys.callback(),
+		HostKeyAlgorithms: algorithms,
+		Timeout:           timeout,
+	}
+	if via == nil {
+		client, err := ssh.Dial("tcp", addr, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("dial %s: %w", addr, err)
+		}
+		return client, nil
+	}
+
+	conn, err := via.Dial("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s via %s: %w", addr, via.RemoteAddr(), err)
+	}
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, cfg)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("dial %s via %s: %w", addr, via.RemoteAddr(), err)
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// buildAuthMethods returns the SSH authentication methods for hop. Keys,
+// certificates and agent keys are offered in one public key method, since
+// the client tries each method only once. The returned function releases
+// the agent connection once authentication is done.
+func (s *SSHSource) buildAuthMethods(hop SSHHop) ([]ssh.AuthMethod, func(), error) {
+	var signers []ssh.Signer
+	if hop.PrivateKeyPath != "" {
+		key, err := os.ReadFile(hop.PrivateKeyPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("read private key %q: %w", hop.PrivateKeyPath, err)
 		}
 		signer, err := ssh.ParsePrivateKey(key)
 		if err != nil {
-			return nil, fmt.Errorf("parse private key: %w", err)
+			return nil, nil, fmt.Errorf("parse private key: %w", err)
+		}
+		if hop.CertificatePath != "" {
+			if signer, err = certSigner(hop.CertificatePath, signer); err != nil {
+				return nil, nil, err
+			}
+		}
+		signers = append(signers, signer)
+	} else if hop.CertificatePath != "" {
+		return nil, nil, fmt.Errorf("certificate %q given without its private key", hop.CertificatePath)
+	}
+
+	closeAuth := func() {}
+	if hop.UseAgent {
+		sock := os.Getenv("SSH_AUTH_SOCK")
+		if sock == "" {
+			return nil, nil, fmt.Errorf("ssh agent requested but SSH_AUTH_SOCK is not set")
+		}
+		conn, err := net.Dial("unix", sock)
+		if err != nil {
+			return nil, nil, fmt.Errorf("connect to ssh agent: %w", err)
+		}
+		closeAuth = func() { conn.Close() }
+		agentSigners, err := agent.NewClient(conn).Signers()
+		if err != nil {
+			conn.Close()
+			return nil, nil, fmt.Errorf("list ssh agent keys: %w", err)
 		}
-		return []ssh.AuthMethod{ssh.PublicKeys(signer)}, nil
+		signers = append(signers, agentSigners...)
 	}
-	if opts.Password != "" {
-		return []ssh.AuthMethod{ssh.Password(opts.Password)}, nil
+
+	var methods []ssh.AuthMethod
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	if hop.Password != "" {
+		methods = append(methods, ssh.Password(hop.Password))
+	}
+	if len(methods) == 0 {
+		closeAuth()
+		return nil, nil, fmt.Errorf("no credentials: set a private key, the ssh agent or a password")
+	}
+	return methods, closeAuth, nil
+}
+
+// certSigner pairs signer with the OpenSSH certificate at path.
+func certSigner(path string, signer ssh.Signer) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read certificate %q: %w", path, err)
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse certificate %q: %w", path, err)
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%q is not an ssh certificate", path)
+	}
+	certSigner, err := ssh.NewCertSigner(cert, signer)
+	if err != nil {
+		return nil, fmt.Errorf("certificate %q: %w", path, err)
 	}
-	return nil, fmt.Errorf("either PrivateKeyPath or Password must be provided")
+	return certSigner, nil
 }
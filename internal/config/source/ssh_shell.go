@@ -0,0 +1,311 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/0xdevren/netsentry/internal/model"
+	"golang.org/x/crypto/ssh"
+)
+
+// shellProfile describes how to drive the interactive CLI of a platform.
+type shellProfile struct {
+	// prompt matches the CLI prompt at the end of the output.
+	prompt *regexp.Regexp
+	// pager is the command that disables output paging for the session.
+	pager string
+	// enable reports whether the platform has an unprivileged exec mode that
+	// "enable" escalates from.
+	enable bool
+}
+
+var (
+	// A Cisco-style prompt: "edge-01>", "edge-01#", "edge-01(config)#".
+	ciscoPrompt = regexp.MustCompile(`(?:^|\n)[A-Za-z0-9._@/:()\-]+[>#] ?$`)
+	// A JunOS prompt: "admin@mx-01>", "admin@mx-01#", or "%" in the shell.
+	junosPrompt = regexp.MustCompile(`(?:^|\n)(?:\{[^}\n]*\}\n)?[A-Za-z0-9._@\-]+[>#%] ?$`)
+	// Any of the above.
+	genericPrompt = regexp.MustCompile(`(?:^|\n)(?:\{[^}\n]*\}\n)?[A-Za-z0-9._@/:()\-]+[>#%] ?$`)
+	// The enable password prompt.
+	passwordPrompt = regexp.MustCompile(`(?i)password: ?$`)
+	// A pager prompt left behind when paging could not be disabled.
+	morePrompt = regexp.MustCompile(`(?i)(?:-+ ?\(?more\b[^\n]*|<--- more --->) ?$`)
+	// Terminal control sequences and bells.
+	controlSeq = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]|\x1b[()][A-Za-z0-9]|\x07`)
+)
+
+var shellProfiles = map[model.DeviceType]shellProfile{
+	model.DeviceTypeCiscoIOS:  {prompt: ciscoPrompt, pager: "terminal length 0", enable: true},
+	model.DeviceTypeCiscoNXOS: {prompt: ciscoPrompt, pager: "terminal length 0"},
+	model.DeviceTypeAristaEOS: {prompt: ciscoPrompt, pager: "terminal length 0", enable: true},
+	model.DeviceTypeJuniperOS: {prompt: junosPrompt, pager: "set cli screen-length 0"},
+}
+
+// shellProfileFor returns the profile for a device of type t. Devices of
+// unknown type are driven with a prompt pattern covering all platforms and
+// are only escalated when an enable password is configured, since "enable"
+// is not a command everywhere.
+func shellProfileFor(t model.DeviceType, enablePassword string) shellProfile {
+	if p, ok := shellProfiles[t]; ok {
+		return p
+	}
+	return shellProfile{prompt: genericPrompt, pager: "terminal length 0", enable: enablePassword != ""}
+}
+
+// runInteractive runs command in a PTY-backed shell on client. It waits for
+// the prompt, escalates with "enable" when the device is in unprivileged
+// mode, disables paging, and returns the command output without the echoed
+// command and the trailing prompt.
+func runInteractive(ctx context.Context, client *ssh.Client, opts *SSHOptions, command string) ([]byte, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("ssh source: new session: %w", err)
+	}
+	defer session.Close()
+
+	modes := ssh.TerminalModes{ssh.ECHO: 1, ssh.TTY_OP_ISPEED: 38400, ssh.TTY_OP_OSPEED: 38400}
+	if err := session.RequestPty("vt100", 0, 511, modes); err != nil {
+		return nil, fmt.Errorf("ssh source: request pty: %w", err)
+	}
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("ssh source: stdin: %w", err)
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("ssh source: stdout: %w", err)
+	}
+	if err := session.Shell(); err != nil {
+		return nil, fmt.Errorf("ssh source: start shell: %w", err)
+	}
+
+	sh := newShell(stdin, stdout)
+	out, err := sh.collect(ctx, shellProfileFor(opts.DeviceType, opts.EnablePassword), opts.EnablePassword, command)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("ssh source: context cancelled: %w", ctx.Err())
+		}
+		return nil, fmt.Errorf("ssh source: shell: %w", err)
+	}
+	_ = sh.send("exit")
+	return out, nil
+}
+
+// shell buffers the output of an interactive session so it can be matched
+// against prompts.
+type shell struct {
+	stdin  io.Writer
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	notify chan struct{}
+	closed chan struct{}
+}
+
+func newShell(stdin io.Writer, stdout io.Reader) *shell {
+	sh := &shell{stdin: stdin, notify: make(chan struct{}, 1), closed: make(chan struct{})}
+	go sh.read(stdout)
+	return sh
+}
+
+func (sh *shell) read(r io.Reader) {
+	defer close(sh.closed)
+	chunk := make([]byte, 4096)
+	for {
+		n, err := r.Read(chunk)
+		if n > 0 {
+			sh.mu.Lock()
+			sh.buf.Write(chunk[:n])
+			sh.mu.Unlock()
+			select {
+			case sh.notify <- struct{}{}:
+			default:
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (sh *shell) send(line string) error {
+	_, err := io.WriteString(sh.stdin, line+"\n")
+	return err
+}
+
+// mark returns the current end of the output, from which the next expect
+// call reads.
+func (sh *shell) mark() int {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	return sh.buf.Len()
+}
+
+// expect waits until the output written since from ends with a match of one
+// of patterns, and returns the index of the matching pattern and the end of
+// the output it matched.
+func (sh *shell) expect(ctx context.Context, from int, patterns ...*regexp.Regexp) (int, int, error) {
+	closed := false
+	for {
+		sh.mu.Lock()
+		data := sh.buf.Bytes()[from:]
+		// Prompts are short; only the tail needs matching.
+		tail := data
+		if len(tail) > 512 {
+			tail = tail[len(tail)-512:]
+		}
+		cleanTail := cleanTerminal(string(tail))
+		end := sh.buf.Len()
+		sh.mu.Unlock()
+		for i, p := range patterns {
+			if p.MatchString(cleanTail) {
+				return i, end, nil
+			}
+		}
+		if closed {
+			return -1, end, fmt.Errorf("connection closed while waiting for prompt")
+		}
+
+		select {
+		case <-sh.notify:
+		case <-sh.closed:
+			// Check the output once more; it may have arrived with the close.
+			closed = true
+		case <-ctx.Done():
+			return -1, end, ctx.Err()
+		}
+	}
+}
+
+// text returns the cleaned output between offsets start and end.
+func (sh *shell) text(start, end int) string {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	return cleanTerminal(string(sh.buf.Bytes()[start:end]))
+}
+
+// command sends line and waits for one of patterns, returning the index of
+// the matching pattern and the cleaned output including the echoed line.
+func (sh *shell) command(ctx context.Context, line string, patterns ...*regexp.Regexp) (int, string, error) {
+	from := sh.mark()
+	if err := sh.send(line); err != nil {
+		return -1, "", err
+	}
+	i, end, err := sh.expect(ctx, from, patterns...)
+	if err != nil {
+		return -1, "", err
+	}
+	return i, sh.text(from, end), nil
+}
+
+// collect drives the session through escalation and pager disabling, then
+// runs command and returns its output.
+func (sh *shell) collect(ctx context.Context, p shellProfile, enablePassword, command string) ([]byte, error) {
+	_, end, err := sh.expect(ctx, 0, p.prompt)
+	if err != nil {
+		return nil, fmt.Errorf("waiting for initial prompt: %w", err)
+	}
+	// From here on only the prompt of this device ends a command, so that
+	// output lines resembling a prompt do not.
+	p.prompt = learnPrompt(sh.text(0, end), p.prompt)
+
+	if p.enable && strings.HasSuffix(strings.TrimSpace(sh.text(0, end)), ">") {
+		i, out, err := sh.command(ctx, "enable", passwordPrompt, p.prompt)
+		if err != nil {
+			return nil, fmt.Errorf("enable: %w", err)
+		}
+		if i == 0 {
+			if enablePassword == "" {
+				return nil, fmt.Errorf("enable: device asked for a password and none is configured")
+			}
+			if _, out, err = sh.command(ctx, enablePassword, passwordPrompt, p.prompt); err != nil {
+				return nil, fmt.Errorf("enable: %w", err)
+			}
+		}
+		if !strings.HasSuffix(strings.TrimSpace(out), "#") {
+			return nil, fmt.Errorf("enable: privileged mode refused")
+		}
+	}
+
+	if p.pager != "" {
+		if _, _, err := sh.command(ctx, p.pager, p.prompt); err != nil {
+			return nil, fmt.Errorf("%s: %w", p.pager, err)
+		}
+	}
+
+	start := sh.mark()
+	if err := sh.send(command); err != nil {
+		return nil, err
+	}
+	from := start
+	for {
+		i, end, err := sh.expect(ctx, from, p.prompt, morePrompt)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", command, err)
+		}
+		if i == 0 {
+			return []byte(stripEchoAndPrompt(sh.text(start, end))), nil
+		}
+		// Paging is still on; ask for the next page.
+		if _, err := io.WriteString(sh.stdin, " "); err != nil {
+			return nil, err
+		}
+		from = end
+	}
+}
+
+// learnPrompt returns a pattern matching the prompt the output of a session
+// ends with in any mode: its text up to the mode character, which changes
+// from ">" to "#" after "enable", optionally followed by a configuration
+// mode such as "(config)". It returns fallback when no prompt is found.
+func learnPrompt(out string, fallback *regexp.Regexp) *regexp.Regexp {
+	line := strings.TrimRight(out, " ")
+	if i := strings.LastIndexByte(line, '\n'); i >= 0 {
+		line = line[i+1:]
+	}
+	if len(line) < 2 || !strings.ContainsRune(">#%", rune(line[len(line)-1])) {
+		return fallback
+	}
+	return regexp.MustCompile(`(?:^|\n)(?:\{[^}\n]*\}\n)?` + regexp.QuoteMeta(line[:len(line)-1]) + `(?:\([^)\n]*\))?[>#%] ?$`)
+}
+
+// cleanTerminal normalises PTY output: line endings become "\n", terminal
+// control sequences are removed and backspaces erase the preceding
+// character, as they do on screen when a pager clears its prompt.
+func cleanTerminal(s string) string {
+	s = controlSeq.ReplaceAllString(s, "")
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "")
+	if !strings.ContainsRune(s, '\b') {
+		return s
+	}
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\b' {
+			out = append(out, s[i])
+		} else if len(out) > 0 && out[len(out)-1] != '\n' {
+			out = out[:len(out)-1]
+		}
+	}
+	return string(out)
+}
+
+// stripEchoAndPrompt removes the echoed command line before, and the prompt
+// line after, the output of a command.
+func stripEchoAndPrompt(out string) string {
+	if i := strings.IndexByte(out, '\n'); i >= 0 {
+		out = out[i+1:]
+	} else {
+		return ""
+	}
+	if i := strings.LastIndexByte(out, '\n'); i >= 0 {
+		out = out[:i+1]
+	} else {
+		return ""
+	}
+	return out
+}
@@ -0,0 +1,155 @@
+// Package credentials resolves the secrets used to reach devices and
+// inventory services by name, so that passwords and tokens are kept in a
+// secret store rather than in flags, files or configuration sources.
+//
+// A Provider looks credentials up by name. The built-in providers read them
+// from environment variables, an encrypted local file, HashiCorp Vault or
+// the output of a command. Secrets are held as Secret values, which print
+// and marshal as "[REDACTED]" so they do not leak into logs or reports.
+package credentials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Credential is a named set of secrets. Fields a store does not hold are
+// empty.
+type Credential struct {
+	// Username is the login name. It is not secret.
+	Username string
+	// Password authenticates Username, over SSH or HTTP basic
+	// authentication.
+	Password Secret
+	// EnablePassword is sent to enter privileged mode.
+	EnablePassword Secret
+	// Token is an API token.
+	Token Secret
+}
+
+// Provider looks up credentials by name.
+type Provider interface {
+	// Get returns the credential called name, or an error wrapping
+	// ErrNotFound when the store has none.
+	Get(ctx context.Context, name string) (Credential, error)
+}
+
+// ErrNotFound is returned by providers for unknown credentials.
+var ErrNotFound = errors.New("credential not found")
+
+// Ref names a credential of a provider. Configuration sources and inventory
+// providers take a Ref instead of secrets and resolve it when they connect.
+type Ref struct {
+	Provider Provider
+	Name     string
+}
+
+// Resolve returns the referenced credential. A nil Ref resolves to an empty
+// credential.
+func (r *Ref) Resolve(ctx context.Context) (Credential, error) {
+	if r == nil {
+		return Credential{}, nil
+	}
+	if r.Provider == nil {
+		return Credential{}, fmt.Errorf("credentials: %q: no credentials provider configured", r.Name)
+	}
+	c, err := r.Provider.Get(ctx, r.Name)
+	if err != nil {
+		return Credential{}, fmt.Errorf("credentials: %q: %w", r.Name, err)
+	}
+	return c, nil
+}
+
+// cache memoizes the credentials of a provider.
+type cache struct {
+	p  Provider
+	mu sync.Mutex
+	m  map[string]Credential
+}
+
+// NewCache returns a provider answering each name from p once, for stores
+// that are slow or rate-limited such as Vault or a command. Failed lookups
+// are not cached.
+func NewCache(p Provider) Provider {
+	return &cache{p: p, m: make(map[string]Credential)}
+}
+
+// Get returns the cached credential called name, looking it up on first use.
+func (c *cache) Get(ctx context.Context, name string) (Credential, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cred, ok := c.m[name]; ok {
+		return cred, nil
+	}
+	cred, err := c.p.Get(ctx, name)
+	if err != nil {
+		return Credential{}, err
+	}
+	c.m[name] = cred
+	return cred, nil
+}
+
+// PassphraseEnv is the environment variable holding the passphrase of the
+// encrypted file opened by Open.
+const PassphraseEnv = "NETSENTRY_CREDENTIALS_PASSPHRASE"
+
+// Open returns the provider described by spec:
+//
+//	env                  environment variables prefixed NETSENTRY_CRED_
+//	env:PREFIX           environment variables prefixed PREFIX
+//	file:PATH            an encrypted file, with the passphrase from
+//	                     $NETSENTRY_CREDENTIALS_PASSPHRASE
+//	vault:MOUNT/PATH     Vault KV version 2 secrets below PATH of the engine
+//	                     mounted at MOUNT, at $VAULT_ADDR with $VAULT_TOKEN
+//	vault-kv1:MOUNT/PATH the same for a KV version 1 engine
+//	exec:COMMAND [ARGS]  the JSON output of COMMAND ARGS NAME
+//
+// Providers other than env and file are cached.
+func Open(spec string) (Provider, error) {
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "", "env":
+		return NewEnvProvider(arg), nil
+	case "file":
+		if arg == "" {
+			return nil, fmt.Errorf("credentials: file: path is required")
+		}
+		passphrase := os.Getenv(PassphraseEnv)
+		if passphrase == "" {
+			return nil, fmt.Errorf("credentials: file: $%s is not set", PassphraseEnv)
+		}
+		return LoadEncryptedFile(arg, []byte(passphrase))
+	case "vault", "vault-kv1":
+		mount, prefix, _ := strings.Cut(strings.Trim(arg, "/"), "/")
+		if mount == "" {
+			return nil, fmt.Errorf("credentials: vault: mount is required")
+		}
+		opts := VaultOptions{
+			Address:   os.Getenv("VAULT_ADDR"),
+			Token:     Secret(os.Getenv("VAULT_TOKEN")),
+			Namespace: os.Getenv("VAULT_NAMESPACE"),
+			Mount:     mount,
+			Prefix:    prefix,
+			KVVersion: 2,
+		}
+		if kind == "vault-kv1" {
+			opts.KVVersion = 1
+		}
+		if opts.Address == "" {
+			return nil, fmt.Errorf("credentials: vault: $VAULT_ADDR is not set")
+		}
+		return NewCache(NewVaultProvider(opts)), nil
+	case "exec":
+		command := strings.Fields(arg)
+		if len(command) == 0 {
+			return nil, fmt.Errorf("credentials: exec: command is required")
+		}
+		return NewCache(NewExecProvider(command...)), nil
+	default:
+		return nil, fmt.Errorf("credentials: unsupported provider %q", kind)
+	}
+}
@@ -0,0 +1,60 @@
+package credentials
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DefaultEnvPrefix prefixes the environment variables read by an
+// EnvProvider without a prefix of its own.
+const DefaultEnvPrefix = "NETSENTRY_CRED_"
+
+// EnvProvider reads credentials from environment variables. The credential
+// "core-routers" is read from <PREFIX>CORE_ROUTERS_USERNAME,
+// <PREFIX>CORE_ROUTERS_PASSWORD, <PREFIX>CORE_ROUTERS_ENABLE_PASSWORD and
+// <PREFIX>CORE_ROUTERS_TOKEN: the name is upper-cased and every character
+// other than a letter or digit becomes "_".
+type EnvProvider struct {
+	prefix string
+}
+
+// NewEnvProvider constructs an EnvProvider reading variables with the given
+// prefix (defaults to DefaultEnvPrefix).
+func NewEnvProvider(prefix string) *EnvProvider {
+	if prefix == "" {
+		prefix = DefaultEnvPrefix
+	}
+	return &EnvProvider{prefix: prefix}
+}
+
+// Get returns the credential called name. It is not found when none of its
+// variables is set.
+func (e *EnvProvider) Get(_ context.Context, name string) (Credential, error) {
+	base := e.prefix + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+	lookup := func(suffix string) (string, bool) {
+		return os.LookupEnv(base + suffix)
+	}
+	user, okUser := lookup("_USERNAME")
+	password, okPassword := lookup("_PASSWORD")
+	enable, okEnable := lookup("_ENABLE_PASSWORD")
+	token, okToken := lookup("_TOKEN")
+	if !okUser && !okPassword && !okEnable && !okToken {
+		return Credential{}, fmt.Errorf("env: %s_*: %w", base, ErrNotFound)
+	}
+	return Credential{
+		Username:       user,
+		Password:       Secret(password),
+		EnablePassword: Secret(enable),
+		Token:          Secret(token),
+	}, nil
+}
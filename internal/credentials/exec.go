@@ -0,0 +1,63 @@
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+)
+
+// ExecProvider runs a command to look up credentials, for password managers
+// and secret stores with a command-line client. The credential name is
+// appended to the arguments and the command prints a JSON object with the
+// username, password, enable_password and token keys it has:
+//
+//	{"username": "netops", "password": "s3cret"}
+//
+// A command that exits with status 2 reports the credential as not found.
+// The output of the command is never included in errors.
+type ExecProvider struct {
+	command []string
+}
+
+// NewExecProvider constructs an ExecProvider running command.
+func NewExecProvider(command ...string) *ExecProvider {
+	return &ExecProvider{command: command}
+}
+
+// Get runs the command for the credential called name.
+func (e *ExecProvider) Get(ctx context.Context, name string) (Credential, error) {
+	if len(e.command) == 0 {
+		return Credential{}, fmt.Errorf("exec: no command")
+	}
+	args := append(append([]string(nil), e.command[1:]...), name)
+	cmd := exec.CommandContext(ctx, e.command[0], args...)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 2 {
+			return Credential{}, fmt.Errorf("exec: %s: %w", e.command[0], ErrNotFound)
+		}
+		return Credential{}, fmt.Errorf("exec: %s: %w", e.command[0], err)
+	}
+
+	var out struct {
+		Username       string `json:"username"`
+		Password       string `json:"password"`
+		EnablePassword string `json:"enable_password"`
+		Token          string `json:"token"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		// The error of json.Unmarshal may quote the output; leave it out.
+		return Credential{}, fmt.Errorf("exec: %s: output is not a JSON credential object", e.command[0])
+	}
+	return Credential{
+		Username:       out.Username,
+		Password:       Secret(out.Password),
+		EnablePassword: Secret(out.EnablePassword),
+		Token:          Secret(out.Token),
+	}, nil
+}
@@ -0,0 +1,151 @@
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// fileHeader starts every encrypted credentials file.
+const fileHeader = "NETSENTRY-CREDENTIALS-V1\n"
+
+// Key derivation parameters of the encrypted file format.
+const (
+	saltSize  = 16
+	nonceSize = 24
+	scryptN   = 1 << 15
+	scryptR   = 8
+	scryptP   = 1
+)
+
+// fileEntry is a credential as stored in a credentials file. Secret values
+// are plain strings here so that marshalling does not redact them.
+type fileEntry struct {
+	Username       string `yaml:"username,omitempty"`
+	Password       string `yaml:"password,omitempty"`
+	EnablePassword string `yaml:"enable_password,omitempty"`
+	Token          string `yaml:"token,omitempty"`
+}
+
+// FileProvider serves the credentials of an encrypted credentials file.
+type FileProvider struct {
+	entries map[string]fileEntry
+}
+
+// EncryptFile encrypts plaintext, a YAML map of credential names to their
+// username, password, enable_password and token, with passphrase:
+//
+//	core-routers:
+//	  username: netops
+//	  password: s3cret
+//	  enable_password: en4ble
+//	netbox:
+//	  token: 0123456789abcdef
+//
+// The key is derived from the passphrase with scrypt and the document is
+// sealed with NaCl secretbox. The plaintext is checked before it is
+// encrypted.
+func EncryptFile(plaintext, passphrase []byte) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("credentials: file: empty passphrase")
+	}
+	var entries map[string]fileEntry
+	if err := yaml.Unmarshal(plaintext, &entries); err != nil {
+		return nil, fmt.Errorf("credentials: file: yaml unmarshal: %w", err)
+	}
+
+	var salt [saltSize]byte
+	var nonce [nonceSize]byte
+	if _, err := rand.Read(salt[:]); err != nil {
+		return nil, fmt.Errorf("credentials: file: %w", err)
+	}
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, fmt.Errorf("credentials: file: %w", err)
+	}
+	key, err := deriveKey(passphrase, salt[:])
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := append(salt[:], nonce[:]...)
+	sealed = secretbox.Seal(sealed, plaintext, &nonce, key)
+	var out bytes.Buffer
+	out.WriteString(fileHeader)
+	encoded := base64.StdEncoding.EncodeToString(sealed)
+	for len(encoded) > 76 {
+		out.WriteString(encoded[:76])
+		out.WriteByte('\n')
+		encoded = encoded[76:]
+	}
+	out.WriteString(encoded)
+	out.WriteByte('\n')
+	return out.Bytes(), nil
+}
+
+// LoadEncryptedFile reads and decrypts the credentials file at path, as
+// written by EncryptFile.
+func LoadEncryptedFile(path string, passphrase []byte) (*FileProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("credentials: file: read %q: %w", path, err)
+	}
+	if !bytes.HasPrefix(data, []byte(fileHeader)) {
+		return nil, fmt.Errorf("credentials: file: %s: not an encrypted credentials file", path)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(string(bytes.Join(bytes.Fields(data[len(fileHeader):]), nil)))
+	if err != nil {
+		return nil, fmt.Errorf("credentials: file: %s: %w", path, err)
+	}
+	if len(sealed) < saltSize+nonceSize+secretbox.Overhead {
+		return nil, fmt.Errorf("credentials: file: %s: truncated", path)
+	}
+
+	var nonce [nonceSize]byte
+	copy(nonce[:], sealed[saltSize:])
+	key, err := deriveKey(passphrase, sealed[:saltSize])
+	if err != nil {
+		return nil, err
+	}
+	plaintext, ok := secretbox.Open(nil, sealed[saltSize+nonceSize:], &nonce, key)
+	if !ok {
+		return nil, fmt.Errorf("credentials: file: %s: wrong passphrase or corrupted file", path)
+	}
+
+	var entries map[string]fileEntry
+	if err := yaml.Unmarshal(plaintext, &entries); err != nil {
+		return nil, fmt.Errorf("credentials: file: %s: yaml unmarshal: %w", path, err)
+	}
+	return &FileProvider{entries: entries}, nil
+}
+
+// Get returns the credential called name.
+func (f *FileProvider) Get(_ context.Context, name string) (Credential, error) {
+	e, ok := f.entries[name]
+	if !ok {
+		return Credential{}, fmt.Errorf("file: %w", ErrNotFound)
+	}
+	return Credential{
+		Username:       e.Username,
+		Password:       Secret(e.Password),
+		EnablePassword: Secret(e.EnablePassword),
+		Token:          Secret(e.Token),
+	}, nil
+}
+
+// deriveKey derives the secretbox key from a passphrase and salt.
+func deriveKey(passphrase, salt []byte) (*[32]byte, error) {
+	k, err := scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		return nil, fmt.Errorf("credentials: file: derive key: %w", err)
+	}
+	var key [32]byte
+	copy(key[:], k)
+	return &key, nil
+}
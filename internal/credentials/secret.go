@@ -0,0 +1,36 @@
+package credentials
+
+import (
+	"encoding/json"
+	"log/slog"
+)
+
+// redacted replaces secrets wherever they are printed or marshalled.
+const redacted = "[REDACTED]"
+
+// Secret is a password, token or other secret value. It prints, marshals and
+// logs as "[REDACTED]"; Reveal returns the value where it is needed.
+type Secret string
+
+// Reveal returns the secret value.
+func (s Secret) Reveal() string { return string(s) }
+
+// String implements fmt.Stringer, redacting the value.
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+// GoString redacts the value for the %#v verb.
+func (s Secret) GoString() string { return s.String() }
+
+// LogValue implements slog.LogValuer, redacting the value.
+func (s Secret) LogValue() slog.Value { return slog.StringValue(s.String()) }
+
+// MarshalJSON redacts the value.
+func (s Secret) MarshalJSON() ([]byte, error) { return json.Marshal(s.String()) }
+
+// MarshalYAML redacts the value.
+func (s Secret) MarshalYAML() (interface{}, error) { return s.String(), nil }
@@ -0,0 +1,118 @@
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// VaultOptions configures the Vault provider.
+type VaultOptions struct {
+	// Address is the Vault server URL, e.g. "https://vault.example.net:8200".
+	Address string
+	// Token authenticates requests.
+	Token Secret
+	// Namespace is the Vault Enterprise namespace, if any.
+	Namespace string
+	// Mount is the path the KV secrets engine is mounted at, e.g. "secret".
+	Mount string
+	// Prefix is prepended to credential names to form secret paths, e.g.
+	// "netsentry" reads the credential "core" from "netsentry/core".
+	Prefix string
+	// KVVersion is the KV secrets engine version, 1 or 2 (defaults to 2).
+	KVVersion int
+	// Timeout is the HTTP request timeout.
+	Timeout time.Duration
+}
+
+// VaultProvider reads credentials from a HashiCorp Vault KV secrets engine
+// over its HTTP API. Each credential is a secret whose username, password,
+// enable_password and token keys are read.
+type VaultProvider struct {
+	opts   VaultOptions
+	client *http.Client
+}
+
+// NewVaultProvider constructs a VaultProvider.
+func NewVaultProvider(opts VaultOptions) *VaultProvider {
+	if opts.KVVersion == 0 {
+		opts.KVVersion = 2
+	}
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	return &VaultProvider{opts: opts, client: &http.Client{Timeout: timeout}}
+}
+
+// Get reads the secret of the credential called name.
+func (v *VaultProvider) Get(ctx context.Context, name string) (Credential, error) {
+	secret := strings.Trim(v.opts.Prefix, "/")
+	if secret != "" {
+		secret += "/"
+	}
+	secret += strings.Trim(name, "/")
+	endpoint := strings.TrimRight(v.opts.Address, "/") + "/v1/" + url.PathEscape(strings.Trim(v.opts.Mount, "/")) + "/"
+	if v.opts.KVVersion == 2 {
+		endpoint += "data/"
+	}
+	endpoint += (&url.URL{Path: secret}).EscapedPath()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return Credential{}, fmt.Errorf("vault: build request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", v.opts.Token.Reveal())
+	if v.opts.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.opts.Namespace)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return Credential{}, fmt.Errorf("vault: request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return Credential{}, fmt.Errorf("vault: %s: %w", secret, ErrNotFound)
+	default:
+		return Credential{}, fmt.Errorf("vault: %s: unexpected status %d", secret, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Credential{}, fmt.Errorf("vault: read body: %w", err)
+	}
+	var doc struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return Credential{}, fmt.Errorf("vault: %s: parse response: %w", secret, err)
+	}
+	data := doc.Data
+	if v.opts.KVVersion == 2 {
+		// KV version 2 nests the secret under data.data, next to its
+		// metadata; a deleted version has no data.
+		data, _ = data["data"].(map[string]interface{})
+		if data == nil {
+			return Credential{}, fmt.Errorf("vault: %s: %w", secret, ErrNotFound)
+		}
+	}
+	field := func(key string) string {
+		s, _ := data[key].(string)
+		return s
+	}
+	return Credential{
+		Username:       field("username"),
+		Password:       Secret(field("password")),
+		EnablePassword: Secret(field("enable_password")),
+		Token:          Secret(field("token")),
+	}, nil
+}
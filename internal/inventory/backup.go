@@ -0,0 +1,420 @@
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/0xdevren/netsentry/internal/config/source"
+	"github.com/0xdevren/netsentry/internal/model"
+)
+
+// BackupFormat identifies the tool that wrote a configuration backup.
+type BackupFormat string
+
+const (
+	// BackupFormatOxidized is an Oxidized file or git output, with devices
+	// listed in its CSV router.db or in a nodes.json export.
+	BackupFormatOxidized BackupFormat = "oxidized"
+	// BackupFormatRANCID is a RANCID base directory of groups, each with a
+	// router.db and a configs directory.
+	BackupFormatRANCID BackupFormat = "rancid"
+)
+
+// BackupOptions configures a BackupInventory.
+type BackupOptions struct {
+	// Format is the tool that wrote the backup.
+	Format BackupFormat
+	// Dir is the backup output directory: the Oxidized output directory or
+	// the RANCID base directory. With GitRepo it is a directory within the
+	// repository and may be empty.
+	Dir string
+	// GitRepo reads the backup from a Git repository URL or path instead of
+	// Dir on disk, at revision Ref (defaults to HEAD).
+	GitRepo string
+	Ref     string
+	// RouterDB is the device list. For Oxidized it defaults to router.db in
+	// the backup and may be a nodes.json export of the Oxidized web API. For
+	// RANCID the router.db of every group is read when it is empty; when set,
+	// Dir is the directory of that one group.
+	RouterDB string
+	// Delimiter and Columns describe an Oxidized router.db, as the csv
+	// source's delimiter and map do. They default to ":" and name, model,
+	// group. Recognised columns are name, ip, model and group; other named
+	// columns become device tags and "" or "-" columns are ignored.
+	Delimiter string
+	Columns   []string
+}
+
+// BackupDevice is a device of a backup with the location of its
+// configuration within the backup.
+type BackupDevice struct {
+	model.Device
+	// Config is the configuration file, relative to the backup directory.
+	Config string
+}
+
+// BackupInventory lists the devices of an Oxidized or RANCID backup and
+// loads their backed-up configurations. It implements Provider, and
+// source.ConfigSource with the device ID as the request path.
+type BackupInventory struct {
+	format  BackupFormat
+	tree    backupTree
+	devices []BackupDevice
+	index   map[string]int
+}
+
+// LoadBackup reads the device list of the backup described by opts. Devices
+// whose configuration is missing from the backup are left out, as are RANCID
+// devices not marked "up".
+func LoadBackup(ctx context.Context, opts BackupOptions) (*BackupInventory, error) {
+	var tree backupTree
+	switch {
+	case opts.GitRepo != "":
+		repo, err := source.OpenGitRepository(ctx, opts.GitRepo, "")
+		if err != nil {
+			return nil, fmt.Errorf("backup inventory: %w", err)
+		}
+		ref := opts.Ref
+		if ref == "" {
+			ref = "HEAD"
+		}
+		commit, err := repo.Resolve(ctx, ref)
+		if err != nil {
+			return nil, fmt.Errorf("backup inventory: %w", err)
+		}
+		tree = &gitTree{repo: repo, commit: commit, dir: opts.Dir}
+	case opts.Dir != "":
+		tree = dirTree(opts.Dir)
+	default:
+		return nil, fmt.Errorf("backup inventory: a backup directory or git repository is required")
+	}
+	files, err := tree.files(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("backup inventory: %w", err)
+	}
+	present := make(map[string]bool, len(files))
+	for _, f := range files {
+		present[f] = true
+	}
+
+	var devices []BackupDevice
+	switch opts.Format {
+	case BackupFormatOxidized, "":
+		devices, err = oxidizedDevices(ctx, tree, opts, present)
+	case BackupFormatRANCID:
+		devices, err = rancidDevices(ctx, tree, opts, files, present)
+	default:
+		return nil, fmt.Errorf("backup inventory: unsupported format %q (want oxidized or rancid)", opts.Format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("backup inventory: %w", err)
+	}
+
+	b := &BackupInventory{format: opts.Format, tree: tree, index: make(map[string]int, len(devices))}
+	for _, d := range devices {
+		if _, dup := b.index[d.ID]; dup {
+			return nil, fmt.Errorf("backup inventory: duplicate device %q", d.ID)
+		}
+		b.index[d.ID] = len(b.devices)
+		b.devices = append(b.devices, d)
+	}
+	return b, nil
+}
+
+// oxidizedDevices reads an Oxidized router.db or nodes.json. A device's
+// configuration is <group>/<name> when the output uses groups, <name>
+// otherwise.
+func oxidizedDevices(ctx context.Context, tree backupTree, opts BackupOptions, present map[string]bool) ([]BackupDevice, error) {
+	var (
+		data []byte
+		name = opts.RouterDB
+		err  error
+	)
+	if name == "" {
+		name = "router.db"
+		data, err = tree.readFile(ctx, name)
+	} else {
+		data, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read device list: %w", err)
+	}
+
+	type node struct {
+		Name  string `json:"name"`
+		IP    string `json:"ip"`
+		Model string `json:"model"`
+		Group string `json:"group"`
+		tags  map[string]string
+	}
+	var nodes []node
+	if strings.HasSuffix(name, ".json") {
+		if err := json.Unmarshal(data, &nodes); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	} else {
+		delim, columns := opts.Delimiter, opts.Columns
+		if delim == "" {
+			delim = ":"
+		}
+		if len(columns) == 0 {
+			columns = []string{"name", "model", "group"}
+		}
+		for _, fields := range routerDBLines(data, delim) {
+			n := node{tags: make(map[string]string)}
+			for i, col := range columns {
+				if i >= len(fields) {
+					break
+				}
+				switch col {
+				case "name":
+					n.Name = fields[i]
+				case "ip":
+					n.IP = fields[i]
+				case "model":
+					n.Model = fields[i]
+				case "group":
+					n.Group = fields[i]
+				case "", "-":
+				default:
+					if fields[i] != "" {
+						n.tags[col] = fields[i]
+					}
+				}
+			}
+			nodes = append(nodes, n)
+		}
+	}
+
+	var devices []BackupDevice
+	for i, n := range nodes {
+		if n.Name == "" {
+			return nil, fmt.Errorf("%s: device %d has no name", name, i)
+		}
+		config := n.Name
+		if n.Group != "" && present[n.Group+"/"+n.Name] {
+			config = n.Group + "/" + n.Name
+		}
+		if !present[config] {
+			continue
+		}
+		d := BackupDevice{Device: backupDevice(n.Name, n.Model, n.Group), Config: config}
+		d.ManagementIP = n.IP
+		for k, v := range n.tags {
+			d.Tags[k] = v
+		}
+		devices = append(devices, d)
+	}
+	return devices, nil
+}
+
+// rancidDevices reads the router.db of every RANCID group, or opts.RouterDB
+// for a single group directory. A device's configuration is
+// <group>/configs/<name>.
+func rancidDevices(ctx context.Context, tree backupTree, opts BackupOptions, files []string, present map[string]bool) ([]BackupDevice, error) {
+	type groupDB struct {
+		group string
+		data  []byte
+	}
+	var dbs []groupDB
+	if opts.RouterDB != "" {
+		data, err := os.ReadFile(opts.RouterDB)
+		if err != nil {
+			return nil, fmt.Errorf("read device list: %w", err)
+		}
+		dbs = append(dbs, groupDB{group: filepath.Base(filepath.Dir(opts.RouterDB)), data: data})
+	} else {
+		for _, f := range files {
+			group, base := path.Split(f)
+			group = strings.TrimSuffix(group, "/")
+			if base != "router.db" || group == "" || strings.Contains(group, "/") {
+				continue
+			}
+			data, err := tree.readFile(ctx, f)
+			if err != nil {
+				return nil, fmt.Errorf("read device list: %w", err)
+			}
+			dbs = append(dbs, groupDB{group: group, data: data})
+		}
+		if len(dbs) == 0 {
+			return nil, fmt.Errorf("no <group>/router.db in the backup")
+		}
+	}
+
+	var devices []BackupDevice
+	for _, db := range dbs {
+		// RANCID 3 separates fields with ";", earlier versions with ":".
+		delim := ":"
+		if strings.Contains(string(db.data), ";") {
+			delim = ";"
+		}
+		for _, fields := range routerDBLines(db.data, delim) {
+			if len(fields) < 3 || !strings.EqualFold(fields[2], "up") {
+				continue
+			}
+			name := strings.ToLower(fields[0])
+			config := db.group + "/configs/" + name
+			if opts.RouterDB != "" {
+				config = "configs/" + name
+			}
+			if !present[config] {
+				continue
+			}
+			d := BackupDevice{Device: backupDevice(name, fields[1], db.group), Config: config}
+			if len(fields) > 3 && fields[3] != "" {
+				d.Tags["comment"] = fields[3]
+			}
+			devices = append(devices, d)
+		}
+	}
+	return devices, nil
+}
+
+// backupDevice builds the device of a backup entry. The group becomes the
+// site, and the tool's model is kept in the "model" tag.
+func backupDevice(name, platform, group string) model.Device {
+	d := model.Device{
+		ID:   name,
+		Type: PlatformDeviceType(platform),
+		Site: group,
+		Tags: make(map[string]string),
+	}
+	if platform != "" {
+		d.Tags["model"] = platform
+	}
+	return d
+}
+
+// routerDBLines splits a router.db into fields, skipping comments and blank
+// lines.
+func routerDBLines(data []byte, delim string) [][]string {
+	var out [][]string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, delim)
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		out = append(out, fields)
+	}
+	return out
+}
+
+// Format returns the tool that wrote the backup.
+func (b *BackupInventory) Format() BackupFormat { return b.format }
+
+// List returns all devices in device list order.
+func (b *BackupInventory) List(_ context.Context) ([]model.Device, error) {
+	out := make([]model.Device, 0, len(b.devices))
+	for _, d := range b.devices {
+		out = append(out, d.Device)
+	}
+	return out, nil
+}
+
+// Get returns the device with the given ID.
+func (b *BackupInventory) Get(_ context.Context, id string) (model.Device, error) {
+	i, ok := b.index[id]
+	if !ok {
+		return model.Device{}, fmt.Errorf("backup inventory: device %q not found", id)
+	}
+	return b.devices[i].Device, nil
+}
+
+// Entries returns the devices with their configuration paths.
+func (b *BackupInventory) Entries() []BackupDevice {
+	return append([]BackupDevice(nil), b.devices...)
+}
+
+// Load returns the backed-up configuration of the device whose ID is
+// req.Path.
+func (b *BackupInventory) Load(ctx context.Context, req source.LoadRequest) ([]byte, error) {
+	i, ok := b.index[req.Path]
+	if !ok {
+		return nil, fmt.Errorf("backup inventory: device %q not found", req.Path)
+	}
+	data, err := b.tree.readFile(ctx, b.devices[i].Config)
+	if err != nil {
+		return nil, fmt.Errorf("backup inventory: %w", err)
+	}
+	return data, nil
+}
+
+// backupTree is the file tree of a backup, on disk or in a Git revision.
+// Paths are slash-separated and relative to the backup directory.
+type backupTree interface {
+	files(ctx context.Context) ([]string, error)
+	readFile(ctx context.Context, name string) ([]byte, error)
+}
+
+// dirTree is a backup directory on disk.
+type dirTree string
+
+func (d dirTree) files(_ context.Context) ([]string, error) {
+	root := string(d)
+	var files []string
+	err := filepath.WalkDir(root, func(p string, e fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != root && strings.HasPrefix(e.Name(), ".") {
+			if e.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if e.Type().IsRegular() {
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func (d dirTree) readFile(_ context.Context, name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(string(d), filepath.FromSlash(name)))
+}
+
+// gitTree is a directory of a Git revision.
+type gitTree struct {
+	repo   *source.GitRepository
+	commit string
+	dir    string
+}
+
+func (g *gitTree) files(ctx context.Context) ([]string, error) {
+	files, err := g.repo.Files(ctx, g.commit, g.dir)
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.Trim(path.Clean("/"+filepath.ToSlash(g.dir)), "/")
+	if prefix == "" {
+		return files, nil
+	}
+	for i, f := range files {
+		files[i] = strings.TrimPrefix(f, prefix+"/")
+	}
+	return files, nil
+}
+
+func (g *gitTree) readFile(ctx context.Context, name string) ([]byte, error) {
+	return g.repo.ReadFile(ctx, g.commit, path.Join(filepath.ToSlash(g.dir), name))
+}
@@ -0,0 +1,635 @@
+package inventory
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/0xdevren/netsentry/internal/model"
+	"github.com/0xdevren/netsentry/internal/policy/vars"
+	"github.com/0xdevren/netsentry/internal/util"
+	"gopkg.in/yaml.v3"
+)
+
+// FileDevice is a device entry of an inventory file. Entries returned by
+// Entries have the settings of their groups applied.
+type FileDevice struct {
+	model.Device `yaml:",inline"`
+	// Groups lists the groups the device belongs to, from the least to the
+	// most specific.
+	Groups []string `yaml:"groups,omitempty"`
+	// Vars are the device's policy template variables.
+	Vars map[string]interface{} `yaml:"vars,omitempty"`
+	// Credentials names an entry of the credentials section.
+	Credentials string `yaml:"credentials,omitempty"`
+	// Config is the path to the device's configuration file, relative to the
+	// inventory file. It is shorthand for a file source.
+	Config string `yaml:"config,omitempty"`
+	// Source defines where the device's configuration is read from.
+	Source *SourceSpec `yaml:"source,omitempty"`
+	// SSH holds the settings used to connect to the device when it is
+	// scanned.
+	SSH *SSHSettings `yaml:"ssh,omitempty"`
+}
+
+// FileGroup holds the settings shared by the devices of a group. A device's
+// own settings take precedence over those of its groups, and later groups
+// over earlier ones; tags and vars are merged key by key.
+type FileGroup struct {
+	Type        model.DeviceType       `yaml:"type,omitempty"`
+	Site        string                 `yaml:"site,omitempty"`
+	Role        string                 `yaml:"role,omitempty"`
+	Tags        map[string]string      `yaml:"tags,omitempty"`
+	Vars        map[string]interface{} `yaml:"vars,omitempty"`
+	Credentials string                 `yaml:"credentials,omitempty"`
+	Source      *SourceSpec            `yaml:"source,omitempty"`
+	SSH         *SSHSettings           `yaml:"ssh,omitempty"`
+}
+
+// SourceType identifies where an inventory device's configuration is read
+// from.
+type SourceType string
+
+const (
+	// SourceFile reads a configuration file on disk.
+	SourceFile SourceType = "file"
+	// SourceGit reads a file of a Git repository.
+	SourceGit SourceType = "git"
+	// SourceAPI fetches the configuration from an HTTP endpoint.
+	SourceAPI SourceType = "api"
+	// SourceSSH, SourceNetconf, SourceEAPI and SourceNXAPI collect the
+	// configuration from the device itself when it is scanned.
+	SourceSSH     SourceType = "ssh"
+	SourceNetconf SourceType = "netconf"
+	SourceEAPI    SourceType = "eapi"
+	SourceNXAPI   SourceType = "nxapi"
+)
+
+// SourceSpec defines the configuration source of a device. In a group,
+// "{id}" and "{hostname}" in Path and URL are replaced by those of each
+// device.
+type SourceSpec struct {
+	Type SourceType `yaml:"type,omitempty"`
+	// Path is the configuration file for file sources, relative to the
+	// inventory file, and the file within the repository for git sources.
+	Path string `yaml:"path,omitempty"`
+	// Repo and Ref are the repository URL or path and the revision of git
+	// sources. Ref defaults to HEAD.
+	Repo string `yaml:"repo,omitempty"`
+	Ref  string `yaml:"ref,omitempty"`
+	// URL is the endpoint of api sources.
+	URL string `yaml:"url,omitempty"`
+	// Command overrides the command that prints the configuration for ssh,
+	// eapi and nxapi sources.
+	Command string `yaml:"command,omitempty"`
+}
+
+// Live reports whether the source collects the configuration from the
+// device itself rather than from a stored copy.
+func (s *SourceSpec) Live() bool {
+	switch s.Type {
+	case SourceSSH, SourceNetconf, SourceEAPI, SourceNXAPI:
+		return true
+	}
+	return false
+}
+
+// Credential is a named set of credentials devices refer to. Secrets are
+// never stored in the file; the *_env fields name the environment variables
+// holding them, and Secret a credential of the credentials provider.
+type Credential struct {
+	User              string `yaml:"user,omitempty"`
+	Key               string `yaml:"key,omitempty"`
+	Certificate       string `yaml:"certificate,omitempty"`
+	Agent             bool   `yaml:"agent,omitempty"`
+	PasswordEnv       string `yaml:"password_env,omitempty"`
+	EnablePasswordEnv string `yaml:"enable_password_env,omitempty"`
+	// TokenEnv holds the bearer token of api sources.
+	TokenEnv string `yaml:"token_env,omitempty"`
+	// Secret names the credential of the credentials provider supplying the
+	// user, passwords and token the fields above leave unset.
+	Secret string `yaml:"secret,omitempty"`
+}
+
+// SSHEndpoint holds the connection settings of a device or jump host.
+// Passwords are never stored in the file; PasswordEnv names the environment
+// variable holding one.
+type SSHEndpoint struct {
+	// Host is the address to connect to. For a device it defaults to the
+	// management IP, then the device ID.
+	Host        string `yaml:"host,omitempty"`
+	Port        int    `yaml:"port,omitempty"`
+	User        string `yaml:"user,omitempty"`
+	Key         string `yaml:"key,omitempty"`
+	Certificate string `yaml:"certificate,omitempty"`
+	Agent       bool   `yaml:"agent,omitempty"`
+	PasswordEnv string `yaml:"password_env,omitempty"`
+}
+
+// SSHSettings are the SSH settings of an inventory device. Jump hosts are
+// connected through in order; one without credentials of its own uses the
+// device's key, certificate and agent, but never its password.
+type SSHSettings struct {
+	SSHEndpoint `yaml:",inline"`
+	ProxyJump   []SSHEndpoint `yaml:"proxy_jump,omitempty"`
+}
+
+// fileDocument is the top-level structure of an inventory file.
+type fileDocument struct {
+	Groups      map[string]FileGroup  `yaml:"groups"`
+	Credentials map[string]Credential `yaml:"credentials"`
+	Devices     []FileDevice          `yaml:"devices"`
+	// DeviceFiles are CSV device lists, relative to the inventory file,
+	// whose devices follow those of Devices.
+	DeviceFiles []string `yaml:"device_files"`
+}
+
+// allGroup is the group every device belongs to, before its own groups.
+const allGroup = "all"
+
+// FileInventory is an inventory loaded from a YAML or CSV file, in the
+// manner of an Ansible inventory:
+//
+//	groups:
+//	  all:
+//	    credentials: netops
+//	  dc1:
+//	    site: dc1
+//	    vars:
+//	      ntp_server: 10.1.1.1
+//	  backups:
+//	    source:
+//	      type: git
+//	      repo: git@git.example.net:netops/backups.git
+//	      path: configs/{id}
+//	credentials:
+//	  netops:
+//	    user: netops
+//	    key: ~/.ssh/netops
+//	devices:
+//	  - id: edge-01
+//	    type: cisco-ios
+//	    role: edge
+//	    groups: [dc1]
+//	    config: configs/edge-01.conf
+//	    ssh:
+//	      proxy_jump:
+//	        - host: bastion.example.net
+//	          agent: true
+//	  - id: core-01
+//	    groups: [dc1, backups]
+//	device_files:
+//	  - devices.csv
+//
+// A CSV file has a header row naming the columns id, hostname, type,
+// management_ip, version, site, role, groups (separated by ";"), credentials
+// and config; other columns become device tags.
+type FileInventory struct {
+	devices     []FileDevice
+	index       map[string]int
+	credentials map[string]Credential
+}
+
+// LoadFile reads and checks the inventory file at path. Every device needs an
+// id or hostname, IDs must be unique, and the groups and credentials devices
+// refer to must be defined. Files ending in .csv are read as a device list.
+func LoadFile(path string) (*FileInventory, error) {
+	var doc fileDocument
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		devices, err := loadCSV(path)
+		if err != nil {
+			return nil, fmt.Errorf("file inventory: %w", err)
+		}
+		doc.Devices = devices
+	} else {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("file inventory: read %q: %w", path, err)
+		}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("file inventory: %s: yaml unmarshal: %w", path, err)
+		}
+		for _, f := range doc.DeviceFiles {
+			if !filepath.IsAbs(f) {
+				f = filepath.Join(filepath.Dir(path), f)
+			}
+			devices, err := loadCSV(f)
+			if err != nil {
+				return nil, fmt.Errorf("file inventory: %s: %w", path, err)
+			}
+			doc.Devices = append(doc.Devices, devices...)
+		}
+	}
+
+	for name, g := range doc.Groups {
+		if err := checkType(g.Type); err != nil {
+			return nil, fmt.Errorf("file inventory: %s: group %q: %w", path, name, err)
+		}
+		if g.Credentials != "" {
+			if _, ok := doc.Credentials[g.Credentials]; !ok {
+				return nil, fmt.Errorf("file inventory: %s: group %q: unknown credentials %q", path, name, g.Credentials)
+			}
+		}
+	}
+	for name, c := range doc.Credentials {
+		var err error
+		if c.Key, err = resolvePath(path, c.Key); err != nil {
+			return nil, fmt.Errorf("file inventory: %s: credentials %q: %w", path, name, err)
+		}
+		if c.Certificate, err = resolvePath(path, c.Certificate); err != nil {
+			return nil, fmt.Errorf("file inventory: %s: credentials %q: %w", path, name, err)
+		}
+		doc.Credentials[name] = c
+	}
+
+	inv := &FileInventory{
+		index:       make(map[string]int, len(doc.Devices)),
+		credentials: doc.Credentials,
+	}
+	for i, d := range doc.Devices {
+		if d.ID == "" {
+			d.ID = d.Hostname
+		}
+		if d.ID == "" {
+			return nil, fmt.Errorf("file inventory: %s: device %d has no id or hostname", path, i)
+		}
+		if _, dup := inv.index[d.ID]; dup {
+			return nil, fmt.Errorf("file inventory: %s: duplicate device %q", path, d.ID)
+		}
+		if err := resolveDevice(path, &d, doc); err != nil {
+			return nil, fmt.Errorf("file inventory: %s: device %q: %w", path, d.ID, err)
+		}
+		inv.index[d.ID] = len(inv.devices)
+		inv.devices = append(inv.devices, d)
+	}
+	return inv, nil
+}
+
+// resolveDevice applies the settings of d's groups to d and checks the
+// result.
+func resolveDevice(path string, d *FileDevice, doc fileDocument) error {
+	groups := d.Groups
+	if _, ok := doc.Groups[allGroup]; ok {
+		groups = append([]string{allGroup}, groups...)
+	}
+	// Groups are applied from the most specific down, each only filling
+	// what is still unset.
+	var source *SourceSpec
+	if d.Config != "" {
+		if d.Source != nil {
+			return fmt.Errorf("config and source cannot be combined")
+		}
+		source = &SourceSpec{Type: SourceFile, Path: d.Config}
+	} else if d.Source != nil {
+		s := *d.Source
+		source = &s
+	}
+	var ssh *SSHSettings
+	if d.SSH != nil {
+		s := *d.SSH
+		ssh = &s
+	}
+	tags, variables := d.Tags, d.Vars
+	for i := len(groups) - 1; i >= 0; i-- {
+		g, ok := doc.Groups[groups[i]]
+		if !ok {
+			return fmt.Errorf("unknown group %q", groups[i])
+		}
+		if d.Type == "" {
+			d.Type = g.Type
+		}
+		if d.Site == "" {
+			d.Site = g.Site
+		}
+		if d.Role == "" {
+			d.Role = g.Role
+		}
+		if d.Credentials == "" {
+			d.Credentials = g.Credentials
+		}
+		tags = mergeTags(g.Tags, tags)
+		variables = mergeVars(g.Vars, variables)
+		source = mergeSource(g.Source, source)
+		ssh = mergeSSH(g.SSH, ssh)
+	}
+	d.Tags, d.Vars, d.Source, d.SSH = tags, variables, source, ssh
+
+	if err := checkType(d.Type); err != nil {
+		return err
+	}
+	if d.Credentials != "" {
+		if _, ok := doc.Credentials[d.Credentials]; !ok {
+			return fmt.Errorf("unknown credentials %q", d.Credentials)
+		}
+	}
+	if d.Source != nil {
+		if err := resolveSource(path, d); err != nil {
+			return err
+		}
+	}
+	if d.SSH != nil {
+		if err := resolveSSH(path, d.SSH); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveSource fills the placeholders of d's source, checks it and makes
+// file paths absolute. The configuration path of a file source is kept in
+// d.Config.
+func resolveSource(path string, d *FileDevice) error {
+	s := d.Source
+	r := strings.NewReplacer("{id}", d.ID, "{hostname}", d.Hostname)
+	s.Path, s.URL = r.Replace(s.Path), r.Replace(s.URL)
+	switch s.Type {
+	case SourceFile:
+		if s.Path == "" {
+			return fmt.Errorf("file source has no path")
+		}
+		if !filepath.IsAbs(s.Path) {
+			s.Path = filepath.Join(filepath.Dir(path), s.Path)
+		}
+		d.Config = s.Path
+	case SourceGit:
+		if s.Repo == "" || s.Path == "" {
+			return fmt.Errorf("git source needs a repo and a path")
+		}
+		// A local repository path is relative to the inventory file.
+		if !strings.Contains(s.Repo, ":") && !filepath.IsAbs(s.Repo) {
+			s.Repo = filepath.Join(filepath.Dir(path), s.Repo)
+		}
+		if s.Ref == "" {
+			s.Ref = "HEAD"
+		}
+	case SourceAPI:
+		if s.URL == "" {
+			return fmt.Errorf("api source has no url")
+		}
+	case SourceSSH, SourceNetconf, SourceEAPI, SourceNXAPI:
+	case "":
+		return fmt.Errorf("source has no type")
+	default:
+		return fmt.Errorf("unsupported source type %q", s.Type)
+	}
+	return nil
+}
+
+// mergeTags returns the union of base and over, with over taking precedence.
+func mergeTags(base, over map[string]string) map[string]string {
+	if len(base) == 0 {
+		return over
+	}
+	out := make(map[string]string, len(base)+len(over))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range over {
+		out[k] = v
+	}
+	return out
+}
+
+// mergeVars returns the union of base and over, with over taking precedence.
+func mergeVars(base, over map[string]interface{}) map[string]interface{} {
+	if len(base) == 0 {
+		return over
+	}
+	out := make(map[string]interface{}, len(base)+len(over))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range over {
+		out[k] = v
+	}
+	return out
+}
+
+// mergeSource fills the unset fields of over from base. A source of another
+// type replaces base as a whole.
+func mergeSource(base, over *SourceSpec) *SourceSpec {
+	if base == nil {
+		return over
+	}
+	if over == nil {
+		s := *base
+		return &s
+	}
+	if over.Type != "" && over.Type != base.Type {
+		return over
+	}
+	s := *over
+	s.Type = base.Type
+	fill := func(v *string, b string) {
+		if *v == "" {
+			*v = b
+		}
+	}
+	fill(&s.Path, base.Path)
+	fill(&s.Repo, base.Repo)
+	fill(&s.Ref, base.Ref)
+	fill(&s.URL, base.URL)
+	fill(&s.Command, base.Command)
+	return &s
+}
+
+// mergeSSH fills the unset fields of over from base. Jump hosts are replaced
+// as a whole.
+func mergeSSH(base, over *SSHSettings) *SSHSettings {
+	if base == nil {
+		return over
+	}
+	if over == nil {
+		s := *base
+		return &s
+	}
+	s := *over
+	fill := func(v *string, b string) {
+		if *v == "" {
+			*v = b
+		}
+	}
+	fill(&s.Host, base.Host)
+	fill(&s.User, base.User)
+	fill(&s.Key, base.Key)
+	fill(&s.Certificate, base.Certificate)
+	fill(&s.PasswordEnv, base.PasswordEnv)
+	if s.Port == 0 {
+		s.Port = base.Port
+	}
+	s.Agent = s.Agent || base.Agent
+	if len(s.ProxyJump) == 0 {
+		s.ProxyJump = base.ProxyJump
+	}
+	return &s
+}
+
+// checkType rejects device types no parser handles. An empty type is
+// detected from the configuration.
+func checkType(t model.DeviceType) error {
+	switch t {
+	case "", model.DeviceTypeCiscoIOS, model.DeviceTypeCiscoNXOS, model.DeviceTypeJuniperOS, model.DeviceTypeAristaEOS:
+		return nil
+	}
+	return fmt.Errorf("unsupported device type %q", t)
+}
+
+// csvColumns are the CSV columns that set device fields rather than tags.
+var csvColumns = map[string]func(d *FileDevice, v string){
+	"id":            func(d *FileDevice, v string) { d.ID = v },
+	"hostname":      func(d *FileDevice, v string) { d.Hostname = v },
+	"type":          func(d *FileDevice, v string) { d.Type = model.DeviceType(v) },
+	"management_ip": func(d *FileDevice, v string) { d.ManagementIP = v },
+	"version":       func(d *FileDevice, v string) { d.Version = v },
+	"site":          func(d *FileDevice, v string) { d.Site = v },
+	"role":          func(d *FileDevice, v string) { d.Role = v },
+	"credentials":   func(d *FileDevice, v string) { d.Credentials = v },
+	"groups": func(d *FileDevice, v string) {
+		for _, g := range strings.Split(v, ";") {
+			if g = strings.TrimSpace(g); g != "" {
+				d.Groups = append(d.Groups, g)
+			}
+		}
+	},
+	// The configuration path is relative to the inventory file that names
+	// the CSV file.
+	"config": func(d *FileDevice, v string) { d.Config = v },
+}
+
+// loadCSV reads the devices of a CSV device list. Empty cells are skipped.
+func loadCSV(path string) ([]FileDevice, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %q: %w", path, err)
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.Comment = '#'
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+	}
+
+	var devices []FileDevice
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return devices, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		var d FileDevice
+		for i, v := range record {
+			if v = strings.TrimSpace(v); v == "" {
+				continue
+			}
+			if set, ok := csvColumns[header[i]]; ok {
+				set(&d, v)
+				continue
+			}
+			if d.Tags == nil {
+				d.Tags = make(map[string]string)
+			}
+			d.Tags[header[i]] = v
+		}
+		devices = append(devices, d)
+	}
+}
+
+// resolvePath expands a leading ~ in p and makes it absolute, relative to
+// the inventory file.
+func resolvePath(path, p string) (string, error) {
+	if p == "" {
+		return "", nil
+	}
+	p, err := util.ExpandHome(p)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(filepath.Dir(path), p)
+	}
+	return p, nil
+}
+
+// resolveSSH checks the SSH settings of a device and makes their key and
+// certificate paths absolute, relative to the inventory file.
+func resolveSSH(path string, s *SSHSettings) error {
+	endpoints := []*SSHEndpoint{&s.SSHEndpoint}
+	s.ProxyJump = append([]SSHEndpoint(nil), s.ProxyJump...)
+	for i := range s.ProxyJump {
+		if s.ProxyJump[i].Host == "" {
+			return fmt.Errorf("proxy_jump hop %d has no host", i)
+		}
+		endpoints = append(endpoints, &s.ProxyJump[i])
+	}
+	for _, e := range endpoints {
+		if e.Port < 0 || e.Port > 65535 {
+			return fmt.Errorf("invalid ssh port %d", e.Port)
+		}
+		var err error
+		if e.Key, err = resolvePath(path, e.Key); err != nil {
+			return err
+		}
+		if e.Certificate, err = resolvePath(path, e.Certificate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List returns all devices in file order.
+func (f *FileInventory) List(_ context.Context) ([]model.Device, error) {
+	out := make([]model.Device, 0, len(f.devices))
+	for _, d := range f.devices {
+		out = append(out, d.Device)
+	}
+	return out, nil
+}
+
+// Get returns the device with the given ID.
+func (f *FileInventory) Get(_ context.Context, id string) (model.Device, error) {
+	i, ok := f.index[id]
+	if !ok {
+		return model.Device{}, fmt.Errorf("file inventory: device %q not found", id)
+	}
+	return f.devices[i].Device, nil
+}
+
+// Entries returns the device entries, including their configuration sources,
+// in file order.
+func (f *FileInventory) Entries() []FileDevice {
+	return append([]FileDevice(nil), f.devices...)
+}
+
+// Credential returns the credentials named name.
+func (f *FileInventory) Credential(name string) (Credential, bool) {
+	c, ok := f.credentials[name]
+	return c, ok
+}
+
+// Variables returns the vars of the devices merged with those of their
+// groups. Devices are keyed by ID.
+func (f *FileInventory) Variables() *vars.File {
+	file := &vars.File{Devices: make(map[string]map[string]interface{})}
+	for _, d := range f.devices {
+		if len(d.Vars) > 0 {
+			file.Devices[d.ID] = d.Vars
+		}
+	}
+	return file
+}
@@ -0,0 +1,345 @@
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/0xdevren/netsentry/internal/model"
+	"github.com/0xdevren/netsentry/internal/policy/vars"
+	"gopkg.in/yaml.v3"
+)
+
+// HTTPMapping describes how the device list of a JSON HTTP API, such as a
+// homegrown CMDB, maps to devices. Paths are JSONPath expressions; Items is
+// evaluated against each response and the other paths against each device
+// record it selects:
+//
+//	url: https://cmdb.example.net/api/v2/assets?class=network
+//	headers:
+//	  Authorization: Bearer ${CMDB_TOKEN}
+//	items: $.data[*]
+//	next: $.links.next
+//	fields:
+//	  id: $.asset_tag
+//	  hostname: $.name
+//	  type: $.os.family
+//	  management_ip: $.interfaces[0].address
+//	  site: $.location.site
+//	  role: $.function
+//	  version: $.os.version
+//	types:
+//	  IOS-XE: cisco-ios
+//	tags:
+//	  rack: $.location.rack
+//	vars: $.attributes
+type HTTPMapping struct {
+	// URL is the device list endpoint.
+	URL string `yaml:"url"`
+	// Headers are sent with every request. Environment variables referenced
+	// as $VAR or ${VAR} are expanded when the request is made, so tokens are
+	// not stored in the file.
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// Items selects the device records of a response (defaults to "$[*]",
+	// a top-level list).
+	Items string `yaml:"items,omitempty"`
+	// Next selects the URL of the next page, absolute or relative to the
+	// current one. Listing stops when it selects nothing, and fails when
+	// the page is on another scheme or host than URL.
+	Next string `yaml:"next,omitempty"`
+	// Fields maps device fields (id, hostname, type, management_ip, version,
+	// site and role) to paths. Either id or hostname is required; the ID
+	// defaults to the hostname.
+	Fields map[string]string `yaml:"fields"`
+	// Types maps the values of the type field to device types. Values not
+	// listed are read as platform names, e.g. "iosxe" or "arista_eos".
+	Types map[string]model.DeviceType `yaml:"types,omitempty"`
+	// Tags maps device tag names to paths. Objects and lists keep their JSON
+	// form.
+	Tags map[string]string `yaml:"tags,omitempty"`
+	// Vars selects an object of template variables for each device.
+	Vars string `yaml:"vars,omitempty"`
+
+	items, next, vars *jsonPath
+	fields, tags      map[string]*jsonPath
+}
+
+// httpDeviceFields are the device fields a mapping can set.
+var httpDeviceFields = map[string]func(d *model.Device, v string){
+	"id":            func(d *model.Device, v string) { d.ID = v },
+	"hostname":      func(d *model.Device, v string) { d.Hostname = v },
+	"type":          func(d *model.Device, v string) { d.Type = model.DeviceType(v) },
+	"management_ip": func(d *model.Device, v string) { d.ManagementIP = stripPrefixLength(v) },
+	"version":       func(d *model.Device, v string) { d.Version = v },
+	"site":          func(d *model.Device, v string) { d.Site = v },
+	"role":          func(d *model.Device, v string) { d.Role = v },
+}
+
+// LoadHTTPMapping reads and compiles the mapping file at path.
+func LoadHTTPMapping(path string) (*HTTPMapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("http inventory: read %q: %w", path, err)
+	}
+	var m HTTPMapping
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("http inventory: %s: yaml unmarshal: %w", path, err)
+	}
+	if err := m.compile(); err != nil {
+		return nil, fmt.Errorf("http inventory: %s: %w", path, err)
+	}
+	return &m, nil
+}
+
+// compile checks the mapping and compiles its paths.
+func (m *HTTPMapping) compile() error {
+	if m.URL == "" {
+		return fmt.Errorf("url is required")
+	}
+	if m.Fields["id"] == "" && m.Fields["hostname"] == "" {
+		return fmt.Errorf("fields need an id or hostname path")
+	}
+	items := m.Items
+	if items == "" {
+		items = "$[*]"
+	}
+	var err error
+	if m.items, err = compileJSONPath(items); err != nil {
+		return err
+	}
+	if m.Next != "" {
+		if m.next, err = compileJSONPath(m.Next); err != nil {
+			return err
+		}
+	}
+	if m.Vars != "" {
+		if m.vars, err = compileJSONPath(m.Vars); err != nil {
+			return err
+		}
+	}
+	m.fields = make(map[string]*jsonPath, len(m.Fields))
+	for name, expr := range m.Fields {
+		if _, ok := httpDeviceFields[name]; !ok {
+			return fmt.Errorf("unknown device field %q", name)
+		}
+		if m.fields[name], err = compileJSONPath(expr); err != nil {
+			return err
+		}
+	}
+	m.tags = make(map[string]*jsonPath, len(m.Tags))
+	for name, expr := range m.Tags {
+		if m.tags[name], err = compileJSONPath(expr); err != nil {
+			return err
+		}
+	}
+	for value, t := range m.Types {
+		if err := checkType(t); err != nil {
+			return fmt.Errorf("types: %q: %w", value, err)
+		}
+	}
+	return nil
+}
+
+// HTTPOptions configures the HTTP inventory provider.
+type HTTPOptions struct {
+	// Timeout is the HTTP request timeout.
+	Timeout time.Duration
+}
+
+// HTTPInventory fetches the device inventory from a JSON HTTP API, mapping
+// its records to devices as described by an HTTPMapping.
+type HTTPInventory struct {
+	mapping *HTTPMapping
+	client  *http.Client
+
+	mu        sync.Mutex
+	variables map[string]map[string]interface{}
+}
+
+// NewHTTPInventory constructs an HTTPInventory for a mapping loaded by
+// LoadHTTPMapping.
+func NewHTTPInventory(mapping *HTTPMapping, opts HTTPOptions) *HTTPInventory {
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	return &HTTPInventory{
+		mapping: mapping,
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+// List fetches every page of the device list and returns the devices in
+// response order. Records that map to neither an ID nor a hostname are
+// skipped.
+func (h *HTTPInventory) List(ctx context.Context) ([]model.Device, error) {
+	m := h.mapping
+	var devices []model.Device
+	variables := make(map[string]map[string]interface{})
+	seen := make(map[string]bool)
+	for next := m.URL; next != ""; {
+		doc, err := h.get(ctx, next)
+		if err != nil {
+			return nil, fmt.Errorf("http inventory: %w", err)
+		}
+		for _, item := range m.items.eval(doc) {
+			d := m.device(item)
+			if d.ID == "" {
+				continue
+			}
+			devices = append(devices, d)
+			if m.vars != nil {
+				if v, ok := m.vars.first(item).(map[string]interface{}); ok && len(v) > 0 {
+					variables[d.ID] = v
+					if d.Hostname != "" {
+						variables[d.Hostname] = v
+					}
+				}
+			}
+		}
+
+		// Follow the next link unless it is missing or loops.
+		seen[next] = true
+		link := m.nextLink(doc)
+		if link == "" {
+			break
+		}
+		u, err := url.Parse(next)
+		if err != nil {
+			return nil, fmt.Errorf("http inventory: %w", err)
+		}
+		ref, err := url.Parse(link)
+		if err != nil {
+			return nil, fmt.Errorf("http inventory: next page %q: %w", link, err)
+		}
+		resolved := u.ResolveReference(ref)
+		// The headers usually carry a token; never send them to another
+		// server.
+		if resolved.Scheme != u.Scheme || resolved.Host != u.Host {
+			return nil, fmt.Errorf("http inventory: next page %q is not on %s://%s", link, u.Scheme, u.Host)
+		}
+		next = resolved.String()
+		if seen[next] {
+			break
+		}
+	}
+
+	h.mu.Lock()
+	h.variables = variables
+	h.mu.Unlock()
+	return devices, nil
+}
+
+// Get returns the device with the given ID. The API is not assumed to
+// serve single devices, so the device list is fetched.
+func (h *HTTPInventory) Get(ctx context.Context, id string) (model.Device, error) {
+	devices, err := h.List(ctx)
+	if err != nil {
+		return model.Device{}, err
+	}
+	for _, d := range devices {
+		if d.ID == id {
+			return d, nil
+		}
+	}
+	return model.Device{}, fmt.Errorf("http inventory: device %q not found", id)
+}
+
+// Variables returns the objects selected by the vars path for the devices
+// of the last List. Devices are keyed by ID and by hostname.
+func (h *HTTPInventory) Variables() *vars.File {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return &vars.File{Devices: h.variables}
+}
+
+// get fetches endpoint and decodes the JSON response.
+func (h *HTTPInventory) get(ctx context.Context, endpoint string) (interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range h.mapping.Headers {
+		req.Header.Set(k, os.ExpandEnv(v))
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("parse response: %w", err)
+	}
+	return doc, nil
+}
+
+// nextLink returns the next page link of a response, or "" on the last
+// page.
+func (m *HTTPMapping) nextLink(doc interface{}) string {
+	if m.next == nil {
+		return ""
+	}
+	s, _ := m.next.first(doc).(string)
+	return s
+}
+
+// device maps a device record to a model.Device.
+func (m *HTTPMapping) device(item interface{}) model.Device {
+	var d model.Device
+	for name, p := range m.fields {
+		if v, ok := scalarValue(p.first(item)); ok {
+			httpDeviceFields[name](&d, v)
+		}
+	}
+	if d.ID == "" {
+		d.ID = d.Hostname
+	}
+	if d.Type != "" {
+		if t, ok := m.Types[string(d.Type)]; ok {
+			d.Type = t
+		} else if checkType(d.Type) != nil {
+			d.Type = PlatformDeviceType(string(d.Type))
+		}
+	}
+	for name, p := range m.tags {
+		if v, ok := tagValue(p.first(item)); ok {
+			if d.Tags == nil {
+				d.Tags = make(map[string]string)
+			}
+			d.Tags[name] = v
+		}
+	}
+	return d
+}
+
+// scalarValue returns the text of a string, number or boolean.
+func scalarValue(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, v != ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
@@ -0,0 +1,132 @@
+package inventory
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonPathStep is a single step of a JSONPath: a member name, a list index,
+// or a wildcard over the members or elements of a value.
+type jsonPathStep struct {
+	name     string
+	index    int
+	wildcard bool
+}
+
+// jsonPath is a compiled JSONPath expression. The subset understood covers
+// what field mappings need: "$" for the document, ".name" and "['name']"
+// for members, "[n]" for list elements (negative from the end), and ".*" or
+// "[*]" for every member or element.
+//
+//	$.data.devices[*]
+//	$.location['site name']
+//	$.interfaces[0].address
+type jsonPath struct {
+	expr  string
+	steps []jsonPathStep
+}
+
+// compileJSONPath parses a JSONPath expression. The leading "$" may be
+// omitted.
+func compileJSONPath(expr string) (*jsonPath, error) {
+	p := &jsonPath{expr: expr}
+	s := strings.TrimSpace(expr)
+	s = strings.TrimPrefix(s, "$")
+	for s != "" {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			name := s[:end]
+			if name == "" {
+				return nil, fmt.Errorf("jsonpath %q: empty member name", expr)
+			}
+			if name == "*" {
+				p.steps = append(p.steps, jsonPathStep{wildcard: true})
+			} else {
+				p.steps = append(p.steps, jsonPathStep{name: name, index: -1})
+			}
+			s = s[end:]
+		case '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("jsonpath %q: unterminated bracket", expr)
+			}
+			inner := strings.TrimSpace(s[1:end])
+			switch {
+			case inner == "*":
+				p.steps = append(p.steps, jsonPathStep{wildcard: true})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				p.steps = append(p.steps, jsonPathStep{name: inner[1 : len(inner)-1], index: -1})
+			default:
+				n, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("jsonpath %q: invalid index %q", expr, inner)
+				}
+				p.steps = append(p.steps, jsonPathStep{index: n})
+			}
+			s = s[end+1:]
+		default:
+			return nil, fmt.Errorf("jsonpath %q: unexpected %q", expr, s[:1])
+		}
+	}
+	return p, nil
+}
+
+// eval returns the values v selects, in document order; members of a
+// wildcard over an object are ordered by name. Steps that do not match yield
+// nothing.
+func (p *jsonPath) eval(v interface{}) []interface{} {
+	values := []interface{}{v}
+	for _, step := range p.steps {
+		var next []interface{}
+		for _, v := range values {
+			switch v := v.(type) {
+			case map[string]interface{}:
+				switch {
+				case step.wildcard:
+					keys := make([]string, 0, len(v))
+					for k := range v {
+						keys = append(keys, k)
+					}
+					sort.Strings(keys)
+					for _, k := range keys {
+						next = append(next, v[k])
+					}
+				case step.name != "":
+					if m, ok := v[step.name]; ok {
+						next = append(next, m)
+					}
+				}
+			case []interface{}:
+				switch {
+				case step.wildcard:
+					next = append(next, v...)
+				case step.name == "":
+					i := step.index
+					if i < 0 {
+						i += len(v)
+					}
+					if i >= 0 && i < len(v) {
+						next = append(next, v[i])
+					}
+				}
+			}
+		}
+		values = next
+	}
+	return values
+}
+
+// first returns the first value v selects, or nil.
+func (p *jsonPath) first(v interface{}) interface{} {
+	if values := p.eval(v); len(values) > 0 {
+		return values[0]
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+package inventory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0xdevren/netsentry/internal/credentials"
+	"github.com/0xdevren/netsentry/internal/model"
+	"github.com/0xdevren/netsentry/internal/policy/vars"
+)
+
+// NautobotOptions configures the Nautobot inventory provider.
+type NautobotOptions struct {
+	// BaseURL is the Nautobot base URL (e.g. "https://nautobot.example.com").
+	BaseURL string
+	// Token is the Nautobot API authentication token.
+	Token string
+	// Credential names the credential supplying the token when Token is
+	// empty.
+	Credential *credentials.Ref
+	// Timeout is the HTTP request timeout.
+	Timeout time.Duration
+	// Filters restrict List to matching devices. Nautobot matches names
+	// rather than slugs, and Sites select locations.
+	Filters NetBoxFilters
+	// PageSize is the number of devices requested per query (defaults to
+	// 1000).
+	PageSize int
+}
+
+// NautobotInventory fetches the device inventory from the GraphQL API of a
+// Nautobot 2.x instance.
+//
+// Devices are identified by their Nautobot UUID. The platform's network
+// driver (or its name) selects the device type, and the role and location
+// names become the role and site. Tags become device tags with the value
+// "true" and custom fields tags with their value, as for NetBox. Config
+// contexts are kept as template variables.
+type NautobotInventory struct {
+	opts   NautobotOptions
+	client *http.Client
+
+	mu       sync.Mutex
+	contexts map[string]map[string]interface{}
+}
+
+// NewNautobotInventory constructs a NautobotInventory with the given options.
+func NewNautobotInventory(opts NautobotOptions) *NautobotInventory {
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	return &NautobotInventory{
+		opts:   opts,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// nautobotDeviceFields selects the device fields read from Nautobot.
+const nautobotDeviceFields = `id
+    name
+    platform { name network_driver }
+    role { name }
+    location { name }
+    primary_ip4 { address }
+    primary_ip6 { address }
+    tags { name }
+    config_context
+    _custom_field_data`
+
+// nautobotRef is a related object in Nautobot GraphQL responses.
+type nautobotRef struct {
+	Name          string `json:"name"`
+	NetworkDriver string `json:"network_driver"`
+}
+
+// nautobotDevice is the JSON shape of a device in Nautobot GraphQL
+// responses.
+type nautobotDevice struct {
+	ID         string       `json:"id"`
+	Name       string       `json:"name"`
+	Platform   *nautobotRef `json:"platform"`
+	Role       *nautobotRef `json:"role"`
+	Location   *nautobotRef `json:"location"`
+	PrimaryIP4 *struct {
+		Address string `json:"address"`
+	} `json:"primary_ip4"`
+	PrimaryIP6 *struct {
+		Address string `json:"address"`
+	} `json:"primary_ip6"`
+	Tags          []nautobotRef          `json:"tags"`
+	ConfigContext map[string]interface{} `json:"config_context"`
+	CustomFields  map[string]interface{} `json:"_custom_field_data"`
+}
+
+// List queries Nautobot for all devices matching the filters, a page at a
+// time, and returns them as model.Device values.
+func (n *NautobotInventory) List(ctx context.Context) ([]model.Device, error) {
+	pageSize := n.opts.PageSize
+	if pageSize <= 0 {
+		pageSize = 1000
+	}
+	// Only the filters in use are declared: a null list argument would
+	// match nothing.
+	params := []string{"$limit: Int", "$offset: Int"}
+	args := []string{"limit: $limit", "offset: $offset"}
+	variables := map[string]interface{}{"limit": pageSize}
+	for _, f := range []struct {
+		name   string
+		values []string
+	}{
+		{"location", n.opts.Filters.Sites},
+		{"role", n.opts.Filters.Roles},
+		{"tag", n.opts.Filters.Tags},
+		{"status", n.opts.Filters.Statuses},
+	} {
+		if len(f.values) == 0 {
+			continue
+		}
+		params = append(params, "$"+f.name+": [String]")
+		args = append(args, f.name+": $"+f.name)
+		variables[f.name] = f.values
+	}
+	query := fmt.Sprintf("query (%s) {\n  devices(%s) {\n    %s\n  }\n}",
+		strings.Join(params, ", "), strings.Join(args, ", "), nautobotDeviceFields)
+
+	var devices []model.Device
+	contexts := make(map[string]map[string]interface{})
+	for offset := 0; ; offset += pageSize {
+		variables["offset"] = offset
+		var data struct {
+			Devices []nautobotDevice `json:"devices"`
+		}
+		if err := n.query(ctx, query, variables, &data); err != nil {
+			return nil, fmt.Errorf("nautobot: %w", err)
+		}
+		for _, d := range data.Devices {
+			dev := d.device()
+			devices = append(devices, dev)
+			if len(d.ConfigContext) > 0 {
+				contexts[dev.ID] = d.ConfigContext
+				if dev.Hostname != "" {
+					contexts[dev.Hostname] = d.ConfigContext
+				}
+			}
+		}
+		if len(data.Devices) < pageSize {
+			break
+		}
+	}
+
+	n.mu.Lock()
+	n.contexts = contexts
+	n.mu.Unlock()
+	return devices, nil
+}
+
+// Get retrieves a single device by its UUID from Nautobot.
+func (n *NautobotInventory) Get(ctx context.Context, id string) (model.Device, error) {
+	query := "query ($id: ID!) {\n  device(id: $id) {\n    " + nautobotDeviceFields + "\n  }\n}"
+	var data struct {
+		Device *nautobotDevice `json:"device"`
+	}
+	if err := n.query(ctx, query, map[string]interface{}{"id": id}, &data); err != nil {
+		return model.Device{}, fmt.Errorf("nautobot: device %s: %w", id, err)
+	}
+	if data.Device == nil {
+		return model.Device{}, fmt.Errorf("nautobot: device %q not found", id)
+	}
+	return data.Device.device(), nil
+}
+
+// Variables returns the config contexts of the devices of the last List.
+// Devices are keyed by UUID and by name.
+func (n *NautobotInventory) Variables() *vars.File {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return &vars.File{Devices: n.contexts}
+}
+
+// query runs a GraphQL query and decodes its data into out. GraphQL errors
+// are returned as an error.
+func (n *NautobotInventory) query(ctx context.Context, query string, variables map[string]interface{}, out interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		return fmt.Errorf("encode query: %w", err)
+	}
+	endpoint := strings.TrimRight(n.opts.BaseURL, "/") + "/api/graphql/"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	token, err := apiToken(ctx, n.opts.Token, n.opts.Credential)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Token "+token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read body: %w", err)
+	}
+	var result struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		return fmt.Errorf("parse response: %w", err)
+	}
+	// Query errors come with a 400 status and are more telling.
+	if len(result.Errors) > 0 {
+		msgs := make([]string, 0, len(result.Errors))
+		for _, e := range result.Errors {
+			msgs = append(msgs, e.Message)
+		}
+		return fmt.Errorf("graphql: %s", strings.Join(msgs, "; "))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	if err := json.Unmarshal(result.Data, out); err != nil {
+		return fmt.Errorf("parse response: %w", err)
+	}
+	return nil
+}
+
+// device converts a Nautobot device into a model.Device.
+func (d nautobotDevice) device() model.Device {
+	dev := model.Device{
+		ID:       d.ID,
+		Hostname: d.Name,
+		Tags:     make(map[string]string),
+	}
+	switch {
+	case d.PrimaryIP4 != nil:
+		dev.ManagementIP = stripPrefixLength(d.PrimaryIP4.Address)
+	case d.PrimaryIP6 != nil:
+		dev.ManagementIP = stripPrefixLength(d.PrimaryIP6.Address)
+	}
+	if d.Location != nil {
+		dev.Site = d.Location.Name
+	}
+	if d.Role != nil {
+		dev.Role = d.Role.Name
+	}
+	if d.Platform != nil {
+		platform := d.Platform.NetworkDriver
+		if platform == "" {
+			platform = d.Platform.Name
+		}
+		dev.Type = PlatformDeviceType(platform)
+		dev.Tags["platform"] = platform
+	}
+	for _, t := range d.Tags {
+		dev.Tags[t.Name] = "true"
+	}
+	for k, v := range d.CustomFields {
+		if s, ok := tagValue(v); ok {
+			dev.Tags[k] = s
+		}
+	}
+	return dev
+}
@@ -6,9 +6,15 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/0xdevren/netsentry/internal/credentials"
 	"github.com/0xdevren/netsentry/internal/model"
+	"github.com/0xdevren/netsentry/internal/policy/vars"
 )
 
 // NetBoxOptions configures the NetBox inventory provider.
@@ -17,14 +23,56 @@ type NetBoxOptions struct {
 	BaseURL string
 	// Token is the NetBox API authentication token.
 	Token string
+	// Credential names the credential supplying the token when Token is
+	// empty.
+	Credential *credentials.Ref
 	// Timeout is the HTTP request timeout.
 	Timeout time.Duration
+	// Filters restrict List to matching devices.
+	Filters NetBoxFilters
+	// PageSize is the number of devices requested per page (defaults to
+	// 1000, the NetBox maximum unless raised by MAX_PAGE_SIZE).
+	PageSize int
+}
+
+// NetBoxFilters select devices by slug, as the NetBox device list filters
+// do. A device matches several sites, roles or statuses if it has any of
+// them, and several tags if it has all of them.
+type NetBoxFilters struct {
+	Sites    []string
+	Roles    []string
+	Tags     []string
+	Statuses []string
+}
+
+// query adds the filters to q.
+func (f NetBoxFilters) query(q url.Values) {
+	for _, s := range f.Sites {
+		q.Add("site", s)
+	}
+	for _, r := range f.Roles {
+		q.Add("role", r)
+	}
+	for _, t := range f.Tags {
+		q.Add("tag", t)
+	}
+	for _, s := range f.Statuses {
+		q.Add("status", s)
+	}
 }
 
 // NetBoxInventory fetches the device inventory from a NetBox instance.
+//
+// Devices are identified by their NetBox ID. The platform slug selects the
+// device type, the role slug becomes the role, and tags and custom fields
+// become device tags: each tag slug with the value "true", each custom field
+// with its value. Config contexts are kept as template variables.
 type NetBoxInventory struct {
 	opts   NetBoxOptions
 	client *http.Client
+
+	mu       sync.Mutex
+	contexts map[string]map[string]interface{}
 }
 
 // NewNetBoxInventory constructs a NetBoxInventory with the given options.
@@ -39,101 +87,230 @@ func NewNetBoxInventory(opts NetBoxOptions) *NetBoxInventory {
 	}
 }
 
+// netBoxRef is a nested object reference in NetBox API responses.
+type netBoxRef struct {
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
 // netBoxDevice is the JSON shape returned by the NetBox /dcim/devices/ API.
 type netBoxDevice struct {
-	ID       int    `json:"id"`
-	Name     string `json:"name"`
-	Platform struct {
-		Slug string `json:"slug"`
-	} `json:"platform"`
-	PrimaryIP struct {
+	ID       int        `json:"id"`
+	Name     string     `json:"name"`
+	Platform *netBoxRef `json:"platform"`
+	// Role is named device_role before NetBox 4.0.
+	Role       *netBoxRef `json:"role"`
+	DeviceRole *netBoxRef `json:"device_role"`
+	PrimaryIP4 *struct {
 		Address string `json:"address"`
 	} `json:"primary_ip4"`
-	Site struct {
-		Name string `json:"name"`
-	} `json:"site"`
+	PrimaryIP *struct {
+		Address string `json:"address"`
+	} `json:"primary_ip"`
+	Site          *netBoxRef             `json:"site"`
+	Tags          []netBoxRef            `json:"tags"`
+	CustomFields  map[string]interface{} `json:"custom_fields"`
+	ConfigContext map[string]interface{} `json:"config_context"`
 }
 
 type netBoxResponse struct {
+	Next    string         `json:"next"`
 	Results []netBoxDevice `json:"results"`
 }
 
-// List queries NetBox for all devices and returns them as model.Device values.
+// List queries NetBox for all devices matching the filters, following the
+// pagination links against BaseURL, and returns them as model.Device values.
 func (n *NetBoxInventory) List(ctx context.Context) ([]model.Device, error) {
-	url := n.opts.BaseURL + "/api/dcim/devices/?limit=1000"
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("netbox: build request: %w", err)
+	pageSize := n.opts.PageSize
+	if pageSize <= 0 {
+		pageSize = 1000
 	}
-	req.Header.Set("Authorization", "Token "+n.opts.Token)
-	req.Header.Set("Accept", "application/json")
+	q := url.Values{}
+	q.Set("limit", strconv.Itoa(pageSize))
+	n.opts.Filters.query(q)
+	next := strings.TrimRight(n.opts.BaseURL, "/") + "/api/dcim/devices/?" + q.Encode()
 
-	resp, err := n.client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("netbox: request: %w", err)
+	var devices []model.Device
+	contexts := make(map[string]map[string]interface{})
+	seen := make(map[string]bool)
+	for next != "" {
+		var page netBoxResponse
+		if err := n.get(ctx, next, &page); err != nil {
+			return nil, fmt.Errorf("netbox: %w", err)
+		}
+		for _, d := range page.Results {
+			dev := d.device()
+			devices = append(devices, dev)
+			if len(d.ConfigContext) > 0 {
+				contexts[dev.ID] = d.ConfigContext
+				if dev.Hostname != "" {
+					contexts[dev.Hostname] = d.ConfigContext
+				}
+			}
+		}
+		// Follow the next link unless it is missing or loops.
+		seen[next] = true
+		if page.Next == "" {
+			break
+		}
+		link, err := n.nextPage(page.Next)
+		if err != nil {
+			return nil, fmt.Errorf("netbox: %w", err)
+		}
+		if seen[link] {
+			break
+		}
+		next = link
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("netbox: unexpected status %d", resp.StatusCode)
-	}
+	n.mu.Lock()
+	n.contexts = contexts
+	n.mu.Unlock()
+	return devices, nil
+}
 
-	body, err := io.ReadAll(resp.Body)
+// nextPage returns the URL of the page a pagination link refers to. Only the
+// path and query of the link are used, resolved against BaseURL: NetBox
+// builds the link from the request it received, which behind a proxy names
+// an internal host or the wrong scheme, and the token must never be sent
+// anywhere but BaseURL.
+func (n *NetBoxInventory) nextPage(link string) (string, error) {
+	base, err := url.Parse(n.opts.BaseURL)
+	if err != nil {
+		return "", fmt.Errorf("base url: %w", err)
+	}
+	ref, err := url.Parse(link)
 	if err != nil {
-		return nil, fmt.Errorf("netbox: read body: %w", err)
+		return "", fmt.Errorf("next page %q: %w", link, err)
 	}
+	return base.ResolveReference(&url.URL{Path: ref.Path, RawPath: ref.RawPath, RawQuery: ref.RawQuery}).String(), nil
+}
 
-	var nbResp netBoxResponse
-	if err := json.Unmarshal(body, &nbResp); err != nil {
-		return nil, fmt.Errorf("netbox: parse response: %w", err)
+// Get retrieves a single device by its ID from NetBox.
+func (n *NetBoxInventory) Get(ctx context.Context, id string) (model.Device, error) {
+	var d netBoxDevice
+	endpoint := strings.TrimRight(n.opts.BaseURL, "/") + "/api/dcim/devices/" + url.PathEscape(id) + "/"
+	if err := n.get(ctx, endpoint, &d); err != nil {
+		return model.Device{}, fmt.Errorf("netbox: device %s: %w", id, err)
 	}
+	return d.device(), nil
+}
+
+// Variables returns the config contexts of the devices of the last List.
+// Devices are keyed by ID and by name.
+func (n *NetBoxInventory) Variables() *vars.File {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return &vars.File{Devices: n.contexts}
+}
 
-	devices := make([]model.Device, 0, len(nbResp.Results))
-	for _, d := range nbResp.Results {
-		devices = append(devices, model.Device{
-			ID:           fmt.Sprintf("%d", d.ID),
-			Hostname:     d.Name,
-			ManagementIP: d.PrimaryIP.Address,
-			Site:         d.Site.Name,
-		})
+// apiToken returns token, or the token of ref when token is empty.
+func apiToken(ctx context.Context, token string, ref *credentials.Ref) (string, error) {
+	if token != "" || ref == nil {
+		return token, nil
 	}
-	return devices, nil
+	cred, err := ref.Resolve(ctx)
+	if err != nil {
+		return "", err
+	}
+	return cred.Token.Reveal(), nil
 }
 
-// Get retrieves a single device by its ID from NetBox.
-func (n *NetBoxInventory) Get(ctx context.Context, id string) (model.Device, error) {
-	url := n.opts.BaseURL + "/api/dcim/devices/" + id + "/"
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+// get fetches endpoint and decodes the JSON response into out.
+func (n *NetBoxInventory) get(ctx context.Context, endpoint string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	token, err := apiToken(ctx, n.opts.Token, n.opts.Credential)
 	if err != nil {
-		return model.Device{}, fmt.Errorf("netbox: build request: %w", err)
+		return err
 	}
-	req.Header.Set("Authorization", "Token "+n.opts.Token)
+	req.Header.Set("Authorization", "Token "+token)
 	req.Header.Set("Accept", "application/json")
 
 	resp, err := n.client.Do(req)
 	if err != nil {
-		return model.Device{}, fmt.Errorf("netbox: request: %w", err)
+		return fmt.Errorf("request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return model.Device{}, fmt.Errorf("netbox: device %s not found (status %d)", id, resp.StatusCode)
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return model.Device{}, fmt.Errorf("netbox: read body: %w", err)
+		return fmt.Errorf("read body: %w", err)
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("parse response: %w", err)
+	}
+	return nil
+}
+
+// device converts a NetBox device into a model.Device.
+func (d netBoxDevice) device() model.Device {
+	dev := model.Device{
+		ID:       strconv.Itoa(d.ID),
+		Hostname: d.Name,
+		Tags:     make(map[string]string),
+	}
+	switch {
+	case d.PrimaryIP4 != nil:
+		dev.ManagementIP = stripPrefixLength(d.PrimaryIP4.Address)
+	case d.PrimaryIP != nil:
+		dev.ManagementIP = stripPrefixLength(d.PrimaryIP.Address)
+	}
+	if d.Site != nil {
+		dev.Site = d.Site.Name
+	}
+	role := d.Role
+	if role == nil {
+		role = d.DeviceRole
+	}
+	if role != nil {
+		dev.Role = role.Slug
+	}
+	if d.Platform != nil {
+		dev.Type = PlatformDeviceType(d.Platform.Slug)
+		dev.Tags["platform"] = d.Platform.Slug
 	}
+	for _, t := range d.Tags {
+		dev.Tags[t.Slug] = "true"
+	}
+	for k, v := range d.CustomFields {
+		if s, ok := tagValue(v); ok {
+			dev.Tags[k] = s
+		}
+	}
+	return dev
+}
 
-	var d netBoxDevice
-	if err := json.Unmarshal(body, &d); err != nil {
-		return model.Device{}, fmt.Errorf("netbox: parse response: %w", err)
+// tagValue returns the tag form of a JSON-decoded value: scalars as text,
+// objects and lists in their JSON form. Null and empty values have none.
+func tagValue(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, v != ""
+	case bool, float64:
+		return fmt.Sprint(v), true
+	default:
+		// Object, multi-select and JSON fields keep their JSON form.
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", false
+		}
+		return string(data), true
 	}
+}
 
-	return model.Device{
-		ID:           fmt.Sprintf("%d", d.ID),
-		Hostname:     d.Name,
-		ManagementIP: d.PrimaryIP.Address,
-		Site:         d.Site.Name,
-	}, nil
+// stripPrefixLength returns the address of a NetBox IP in CIDR notation.
+func stripPrefixLength(addr string) string {
+	if i := strings.IndexByte(addr, '/'); i >= 0 {
+		return addr[:i]
+	}
+	return addr
 }
@@ -0,0 +1,45 @@
+package inventory
+
+import (
+	"strings"
+
+	"github.com/0xdevren/netsentry/internal/model"
+)
+
+// platformTypes maps the platform names used by inventory and backup tools to
+// device types: Oxidized models, RANCID device types, NetBox platform slugs
+// and Netmiko/NAPALM driver names.
+var platformTypes = map[string]model.DeviceType{
+	"ios":           model.DeviceTypeCiscoIOS,
+	"iosxe":         model.DeviceTypeCiscoIOS,
+	"ios-xe":        model.DeviceTypeCiscoIOS,
+	"cisco":         model.DeviceTypeCiscoIOS,
+	"cisco-ios":     model.DeviceTypeCiscoIOS,
+	"cisco-ios-xe":  model.DeviceTypeCiscoIOS,
+	"cisco_ios":     model.DeviceTypeCiscoIOS,
+	"cisco_xe":      model.DeviceTypeCiscoIOS,
+	"nxos":          model.DeviceTypeCiscoNXOS,
+	"nx-os":         model.DeviceTypeCiscoNXOS,
+	"cisco-nx":      model.DeviceTypeCiscoNXOS,
+	"cisco-nxos":    model.DeviceTypeCiscoNXOS,
+	"cisco_nxos":    model.DeviceTypeCiscoNXOS,
+	"nxos_ssh":      model.DeviceTypeCiscoNXOS,
+	"junos":         model.DeviceTypeJuniperOS,
+	"juniper":       model.DeviceTypeJuniperOS,
+	"juniper-junos": model.DeviceTypeJuniperOS,
+	"juniper_junos": model.DeviceTypeJuniperOS,
+	"eos":           model.DeviceTypeAristaEOS,
+	"arista":        model.DeviceTypeAristaEOS,
+	"arista-eos":    model.DeviceTypeAristaEOS,
+	"arista_eos":    model.DeviceTypeAristaEOS,
+}
+
+// PlatformDeviceType returns the device type of a platform name such as the
+// Oxidized model "iosxe", the RANCID type "cisco-nx" or the NetBox platform
+// slug "arista-eos". Display names such as "Arista EOS" match as their
+// hyphenated slug. Unknown platforms yield an empty type, leaving the type
+// to be detected from the configuration.
+func PlatformDeviceType(platform string) model.DeviceType {
+	name := strings.ToLower(strings.TrimSpace(platform))
+	return platformTypes[strings.Join(strings.Fields(name), "-")]
+}
@@ -4,6 +4,7 @@ package inventory
 import (
 	"context"
 	"github.com/0xdevren/netsentry/internal/model"
+	"github.com/0xdevren/netsentry/internal/policy/vars"
 )
 
 // Provider is the interface implemented by all inventory backends.
@@ -13,3 +14,14 @@ type Provider interface {
 	// Get returns a single device by its ID.
 	Get(ctx context.Context, id string) (model.Device, error)
 }
+
+// VariablesProvider is a Provider that also holds template variables for its
+// devices, such as the vars of an inventory file or the config contexts of
+// NetBox. Variables returns them as a variables file, so that policies can
+// reference them as {{ .device.<key> }}. Backends that learn the variables
+// while listing return those of the devices of the last List.
+type VariablesProvider interface {
+	Provider
+	// Variables returns the template variables of the devices.
+	Variables() *vars.File
+}
@@ -0,0 +1,45 @@
+package model
+
+// ConfigBlock is a hierarchical configuration stanza such as an interface,
+// line or router block. Vendor parsers populate blocks from the indentation
+// (Cisco, Arista) or brace (JunOS) structure of the source configuration.
+type ConfigBlock struct {
+	// Header is the line that opens the block (e.g. "interface GigabitEthernet0/1").
+	Header string `json:"header" yaml:"header"`
+	// Line is the 1-based source line number of the header, or 0 when unknown.
+	Line int `json:"line,omitempty" yaml:"line,omitempty"`
+	// Lines holds every line nested beneath the header, including lines of
+	// nested child blocks, with leading indentation removed.
+	Lines []string `json:"lines,omitempty" yaml:"lines,omitempty"`
+	// LineNumbers holds the 1-based source line number of each entry in Lines.
+	LineNumbers []int `json:"line_numbers,omitempty" yaml:"line_numbers,omitempty"`
+	// Children are the blocks nested directly beneath this block.
+	Children []ConfigBlock `json:"children,omitempty" yaml:"children,omitempty"`
+}
+
+// FindBlocks returns every block, at any depth, whose header satisfies match.
+// Blocks are returned in configuration order, parents before their children.
+func (c *ConfigModel) FindBlocks(match func(header string) bool) []ConfigBlock {
+	var out []ConfigBlock
+	var walk func(blocks []ConfigBlock)
+	walk = func(blocks []ConfigBlock) {
+		for _, b := range blocks {
+			if match(b.Header) {
+				out = append(out, b)
+			}
+			walk(b.Children)
+		}
+	}
+	walk(c.Blocks)
+	return out
+}
+
+// contains reports whether the source line lies within the block body.
+func (b *ConfigBlock) contains(line int) bool {
+	for _, n := range b.LineNumbers {
+		if n == line {
+			return true
+		}
+	}
+	return false
+}
@@ -27,6 +27,12 @@ type ConfigModel struct {
 	GlobalSettings map[string]string `json:"global_settings,omitempty" yaml:"global_settings,omitempty"`
 	// Lines holds the raw configuration lines for regex/contains matching.
 	Lines []string `json:"lines,omitempty" yaml:"lines,omitempty"`
+	// LineNumbers holds the 1-based source line number of each entry in Lines.
+	// It is empty when the configuration did not come from a parser.
+	LineNumbers []int `json:"line_numbers,omitempty" yaml:"line_numbers,omitempty"`
+	// Blocks holds the hierarchical block structure of the configuration for
+	// block-scoped matching.
+	Blocks []ConfigBlock `json:"blocks,omitempty" yaml:"blocks,omitempty"`
 }
 
 // HasLine reports whether the configuration contains the given exact line.
@@ -48,3 +54,35 @@ func (c *ConfigModel) ContainsText(text string) bool {
 	}
 	return false
 }
+
+// LineNumber returns the source line number of Lines[i], or 0 when unknown.
+func (c *ConfigModel) LineNumber(i int) int {
+	if i < 0 || i >= len(c.LineNumbers) {
+		return 0
+	}
+	return c.LineNumbers[i]
+}
+
+// BlockPath returns the headers of the blocks enclosing the given source line,
+// outermost first. It returns nil for top-level lines and unknown positions.
+func (c *ConfigModel) BlockPath(line int) []string {
+	if line <= 0 {
+		return nil
+	}
+	var path []string
+	blocks := c.Blocks
+	for {
+		var inner *ConfigBlock
+		for i := range blocks {
+			if blocks[i].contains(line) {
+				inner = &blocks[i]
+				break
+			}
+		}
+		if inner == nil {
+			return path
+		}
+		path = append(path, inner.Header)
+		blocks = inner.Children
+	}
+}
@@ -27,15 +27,17 @@ func (p *IOSParser) DeviceType() model.DeviceType {
 
 // Parse converts raw Cisco IOS configuration bytes into a ConfigModel.
 func (p *IOSParser) Parse(_ context.Context, data []byte, device model.Device) (*model.ConfigModel, error) {
-	lines := splitLines(data)
+	lines, numbers := splitLines(data)
 	cfg := &model.ConfigModel{
 		Device:         device,
 		RawText:        string(data),
 		Lines:          lines,
+		LineNumbers:    numbers,
 		GlobalSettings: make(map[string]string),
 	}
 
 	tokens := p.lexer.Tokenise(data)
+	cfg.Blocks = BuildBlocks(tokens)
 
 	i := 0
 	for i < len(tokens) {
@@ -47,6 +49,11 @@ func (p *IOSParser) Parse(_ context.Context, data []byte, device model.Device) (
 			cfg.Device.Hostname = strings.TrimPrefix(text, "hostname ")
 			cfg.GlobalSettings["hostname"] = cfg.Device.Hostname
 
+		case strings.HasPrefix(text, "version "):
+			if cfg.Device.Version == "" {
+				cfg.Device.Version = strings.TrimPrefix(text, "version ")
+			}
+
 		case strings.HasPrefix(text, "interface "):
 			iface, consumed := p.parseInterface(tokens, i)
 			cfg.Interfaces = append(cfg.Interfaces, iface)
@@ -239,6 +246,7 @@ func (p *IOSParser) parseBGP(tokens []Token, start int) (*model.BGPConfig, int)
 
 	var currentNeighbor *model.BGPNeighbor
 	neighborMap := make(map[string]*model.BGPNeighbor)
+	var neighborOrder []string
 
 	for i := start + 1; i < len(tokens); i++ {
 		tok := tokens[i]
@@ -254,9 +262,8 @@ func (p *IOSParser) parseBGP(tokens []Token, start int) (*model.BGPConfig, int)
 			if len(parts) >= 3 {
 				addr := parts[1]
 				if _, ok := neighborMap[addr]; !ok {
-					n := &model.BGPNeighbor{Address: addr}
-					neighborMap[addr] = n
-					bgp.Neighbors = append(bgp.Neighbors, *n)
+					neighborMap[addr] = &model.BGPNeighbor{Address: addr}
+					neighborOrder = append(neighborOrder, addr)
 				}
 				currentNeighbor = neighborMap[addr]
 				attr := strings.Join(parts[2:], " ")
@@ -273,6 +280,17 @@ func (p *IOSParser) parseBGP(tokens []Token, start int) (*model.BGPConfig, int)
 					currentNeighbor.Shutdown = true
 				case strings.HasPrefix(attr, "update-source "):
 					currentNeighbor.UpdateSource = strings.TrimPrefix(attr, "update-source ")
+				case strings.HasPrefix(attr, "password "):
+					currentNeighbor.Password = "configured"
+				case strings.HasPrefix(attr, "prefix-list "):
+					pparts := strings.Fields(attr)
+					if len(pparts) == 3 {
+						if pparts[2] == "in" {
+							currentNeighbor.PrefixListIn = pparts[1]
+						} else {
+							currentNeighbor.PrefixListOut = pparts[1]
+						}
+					}
 				case strings.HasPrefix(attr, "route-map "):
 					rparts := strings.Fields(attr)
 					if len(rparts) == 3 {
@@ -283,8 +301,6 @@ func (p *IOSParser) parseBGP(tokens []Token, start int) (*model.BGPConfig, int)
 						}
 					}
 				}
-				// Sync back.
-				_ = currentNeighbor
 			}
 		case strings.HasPrefix(text, "network "):
 			parts := strings.Fields(text)
@@ -300,12 +316,11 @@ func (p *IOSParser) parseBGP(tokens []Token, start int) (*model.BGPConfig, int)
 		consumed++
 	}
 
-	// Re-sync neighbors from map.
-	updated := make([]model.BGPNeighbor, 0, len(neighborMap))
-	for _, n := range neighborMap {
-		updated = append(updated, *n)
+	// Materialise neighbors in declaration order.
+	bgp.Neighbors = make([]model.BGPNeighbor, 0, len(neighborOrder))
+	for _, addr := range neighborOrder {
+		bgp.Neighbors = append(bgp.Neighbors, *neighborMap[addr])
 	}
-	bgp.Neighbors = updated
 
 	return bgp, consumed
 }
@@ -389,18 +404,21 @@ func (p *IOSParser) parseVLAN(text string) model.VLAN {
 	return vlan
 }
 
-// splitLines splits raw config bytes on newlines and returns trimmed non-empty lines.
-func splitLines(data []byte) []string {
+// splitLines splits raw config bytes on newlines and returns trimmed non-empty
+// lines with their 1-based source line numbers.
+func splitLines(data []byte) ([]string, []int) {
 	// Count lines first to pre-allocate slice capacity.
 	lineCount := bytes.Count(data, []byte("\n")) + 1
 	lines := make([]string, 0, lineCount)
-	for _, line := range strings.Split(string(data), "\n") {
+	numbers := make([]int, 0, lineCount)
+	for i, line := range strings.Split(string(data), "\n") {
 		trimmed := strings.TrimRight(line, "\r")
 		if trimmed != "" {
 			lines = append(lines, trimmed)
+			numbers = append(numbers, i+1)
 		}
 	}
-	return lines
+	return lines, numbers
 }
 
 // maskToPrefix converts a dotted subnet mask to a CIDR prefix string.
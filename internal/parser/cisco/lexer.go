@@ -5,6 +5,8 @@ import (
 	"bufio"
 	"bytes"
 	"strings"
+
+	"github.com/0xdevren/netsentry/internal/model"
 )
 
 // TokenType classifies a lexer token from a Cisco IOS configuration.
@@ -29,6 +31,8 @@ type Token struct {
 	Text string
 	// Depth is the indentation depth (number of leading spaces / 1 space unit).
 	Depth int
+	// Line is the 1-based source line number.
+	Line int
 }
 
 // Lexer tokenises Cisco IOS configuration text into a flat token stream.
@@ -45,15 +49,17 @@ func (l *Lexer) Tokenise(data []byte) []Token {
 	tokens := make([]Token, 0, lineCount)
 	scanner := bufio.NewScanner(bytes.NewReader(data))
 	prevDepth := 0
+	lineNo := 0
 
 	for scanner.Scan() {
+		lineNo++
 		raw := scanner.Text()
 		trimmed := strings.TrimLeft(raw, " ")
 		depth := len(raw) - len(trimmed)
 
 		// Skip comment lines.
 		if strings.HasPrefix(trimmed, "!") {
-			tokens = append(tokens, Token{Type: TokenComment, Text: raw, Depth: depth})
+			tokens = append(tokens, Token{Type: TokenComment, Text: raw, Depth: depth, Line: lineNo})
 			continue
 		}
 		// Skip empty lines.
@@ -67,9 +73,54 @@ func (l *Lexer) Tokenise(data []byte) []Token {
 		} else if depth < prevDepth {
 			tt = TokenBlockEnd
 		}
-		tokens = append(tokens, Token{Type: tt, Text: trimmed, Depth: depth})
+		tokens = append(tokens, Token{Type: tt, Text: trimmed, Depth: depth, Line: lineNo})
 		prevDepth = depth
 	}
 
 	return tokens
 }
+
+// BuildBlocks reconstructs the block hierarchy from a token stream. A line
+// followed by more deeply indented lines becomes a block whose body holds
+// those lines. Comment tokens are ignored so that "!" separators inside a
+// stanza do not terminate it.
+func BuildBlocks(tokens []Token) []model.ConfigBlock {
+	content := make([]Token, 0, len(tokens))
+	for _, tok := range tokens {
+		if tok.Type != TokenComment {
+			content = append(content, tok)
+		}
+	}
+	blocks, _, _, _ := buildBlocks(content, 0, -1)
+	return blocks
+}
+
+// buildBlocks consumes tokens starting at start that are indented deeper than
+// parentDepth. It returns the blocks found, every consumed line with its
+// source line number, and the index of the first token that was not consumed.
+func buildBlocks(tokens []Token, start, parentDepth int) ([]model.ConfigBlock, []string, []int, int) {
+	var blocks []model.ConfigBlock
+	var lines []string
+	var numbers []int
+	i := start
+	for i < len(tokens) {
+		tok := tokens[i]
+		if tok.Depth <= parentDepth {
+			break
+		}
+		lines = append(lines, tok.Text)
+		numbers = append(numbers, tok.Line)
+		if i+1 < len(tokens) && tokens[i+1].Depth > tok.Depth {
+			children, body, bodyNumbers, next := buildBlocks(tokens, i+1, tok.Depth)
+			blocks = append(blocks, model.ConfigBlock{
+				Header: tok.Text, Line: tok.Line, Lines: body, LineNumbers: bodyNumbers, Children: children,
+			})
+			lines = append(lines, body...)
+			numbers = append(numbers, bodyNumbers...)
+			i = next
+			continue
+		}
+		i++
+	}
+	return blocks, lines, numbers, i
+}
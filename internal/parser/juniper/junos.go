@@ -22,13 +22,30 @@ func (p *JunOSParser) DeviceType() model.DeviceType { return model.DeviceTypeJun
 
 // Parse converts JunOS configuration (both set-format and hierarchical) into
 // a ConfigModel. The parser handles both "set system host-name R1" flat stanzas
-// and hierarchical block formats.
+// and hierarchical block formats. XML configuration, as collected over
+// NETCONF, is converted to set statements first; Lines then holds those
+// statements.
 func (p *JunOSParser) Parse(_ context.Context, data []byte, device model.Device) (*model.ConfigModel, error) {
-	lines := splitLines(data)
+	if isXML(data) {
+		lines, err := xmlToSet(data)
+		if err != nil {
+			return nil, err
+		}
+		cfg := &model.ConfigModel{
+			Device:         device,
+			RawText:        string(data),
+			Lines:          lines,
+			GlobalSettings: make(map[string]string),
+		}
+		return p.parseSetFormat(cfg, lines)
+	}
+
+	lines, numbers := splitLines(data)
 	cfg := &model.ConfigModel{
 		Device:         device,
 		RawText:        string(data),
 		Lines:          lines,
+		LineNumbers:    numbers,
 		GlobalSettings: make(map[string]string),
 	}
 
@@ -44,9 +61,55 @@ func (p *JunOSParser) Parse(_ context.Context, data []byte, device model.Device)
 	if isSetFormat {
 		return p.parseSetFormat(cfg, lines)
 	}
+	cfg.Blocks = buildBlocks(lines, numbers)
 	return p.parseHierarchical(cfg, lines)
 }
 
+// buildBlocks reconstructs the brace hierarchy of a JunOS configuration. Each
+// "name {" stanza becomes a block whose body holds every nested statement
+// with its trailing semicolon removed. numbers holds the source line number of
+// each entry in lines.
+func buildBlocks(lines []string, numbers []int) []model.ConfigBlock {
+	var roots []model.ConfigBlock
+	var stack []*model.ConfigBlock
+	lineNo := 0
+
+	addLine := func(text string) {
+		for _, b := range stack {
+			b.Lines = append(b.Lines, text)
+			b.LineNumbers = append(b.LineNumbers, lineNo)
+		}
+	}
+
+	for i, line := range lines {
+		lineNo = numbers[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "/*"):
+			continue
+		case strings.HasSuffix(trimmed, "{"):
+			header := strings.TrimSpace(strings.TrimSuffix(trimmed, "{"))
+			addLine(header)
+			stack = append(stack, &model.ConfigBlock{Header: header, Line: lineNo})
+		case trimmed == "}":
+			if len(stack) == 0 {
+				continue
+			}
+			closed := *stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				roots = append(roots, closed)
+			} else {
+				parent := stack[len(stack)-1]
+				parent.Children = append(parent.Children, closed)
+			}
+		default:
+			addLine(strings.TrimSuffix(trimmed, ";"))
+		}
+	}
+	return roots
+}
+
 // parseSetFormat handles "set path value" style JunOS configuration.
 func (p *JunOSParser) parseSetFormat(cfg *model.ConfigModel, lines []string) (*model.ConfigModel, error) {
 	interfaceMap := make(map[string]*model.Interface)
@@ -65,6 +128,11 @@ func (p *JunOSParser) parseSetFormat(cfg *model.ConfigModel, lines []string) (*m
 		}
 
 		switch parts[0] {
+		case "version":
+			if len(parts) >= 2 && cfg.Device.Version == "" {
+				cfg.Device.Version = parts[1]
+			}
+
 		case "system":
 			if len(parts) >= 3 && parts[1] == "host-name" {
 				cfg.Device.Hostname = parts[2]
@@ -199,6 +267,10 @@ func (p *JunOSParser) parseHierarchical(cfg *model.ConfigModel, lines []string)
 		// Attribute assignment inside a block.
 		stmt := strings.TrimSuffix(trimmed, ";")
 
+		if len(stack) == 0 && strings.HasPrefix(stmt, "version ") && cfg.Device.Version == "" {
+			cfg.Device.Version = strings.TrimPrefix(stmt, "version ")
+		}
+
 		// System block.
 		if len(stack) >= 1 && stack[0].block == "system" {
 			if strings.HasPrefix(stmt, "host-name ") {
@@ -245,14 +317,17 @@ func (p *JunOSParser) parseHierarchical(cfg *model.ConfigModel, lines []string)
 	return cfg, nil
 }
 
-// splitLines splits raw bytes on newlines.
-func splitLines(data []byte) []string {
+// splitLines splits raw bytes on newlines and returns the non-empty lines with
+// their 1-based source line numbers.
+func splitLines(data []byte) ([]string, []int) {
 	var lines []string
-	for _, line := range strings.Split(string(data), "\n") {
+	var numbers []int
+	for i, line := range strings.Split(string(data), "\n") {
 		trimmed := strings.TrimRight(line, "\r")
 		if trimmed != "" {
 			lines = append(lines, trimmed)
+			numbers = append(numbers, i+1)
 		}
 	}
-	return lines
+	return lines, numbers
 }
@@ -0,0 +1,182 @@
+package juniper
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// omittedListElements maps JunOS list containers to the element name of
+// their entries where set statements leave the entry name out:
+// <interfaces><interface><name>ge-0/0/0</name> is "set interfaces ge-0/0/0".
+var omittedListElements = map[string]string{
+	"interfaces":        "interface",
+	"vlans":             "vlan",
+	"routing-instances": "instance",
+	"logical-systems":   "logical-system",
+	"groups":            "group",
+}
+
+// xmlNode is an element of a JunOS XML configuration.
+type xmlNode struct {
+	name     string
+	text     string
+	children []*xmlNode
+}
+
+// child returns the first child element called name.
+func (n *xmlNode) child(name string) *xmlNode {
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// isXML reports whether data is an XML document rather than CLI text.
+func isXML(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("<"))
+}
+
+// xmlToSet converts a JunOS XML configuration, as returned by "show
+// configuration | display xml" or a NETCONF get-config, into the equivalent
+// "set" statements. The configuration may be wrapped in rpc-reply, data and
+// configuration elements. Inactive statements and comments are left out.
+func xmlToSet(data []byte) ([]string, error) {
+	root, err := decodeXML(data)
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, c := range statements(root) {
+		walkSet(c, "", []string{"set"}, &lines)
+	}
+	return lines, nil
+}
+
+// statements returns the top-level configuration statements below the
+// rpc-reply, data and configuration wrappers of root.
+func statements(root *xmlNode) []*xmlNode {
+	n := root
+	for n.name != "configuration" {
+		var next *xmlNode
+		for _, c := range n.children {
+			switch c.name {
+			case "rpc-reply", "data", "configuration":
+				next = c
+			}
+		}
+		if next == nil {
+			break
+		}
+		n = next
+	}
+	return n.children
+}
+
+// walkSet appends the set statements for n, nested in parent at path.
+func walkSet(n *xmlNode, parent string, path []string, lines *[]string) {
+	if len(n.children) == 0 {
+		stmt := append(append([]string(nil), path...), n.name)
+		if n.text != "" {
+			stmt = append(stmt, quoteValue(n.text))
+		}
+		*lines = append(*lines, strings.Join(stmt, " "))
+		return
+	}
+
+	seg := []string{n.name}
+	children := n.children
+	if key := n.child("name"); key != nil && len(key.children) == 0 {
+		seg = append(seg, quoteValue(key.text))
+		if omittedListElements[parent] == n.name {
+			seg = seg[1:]
+		}
+		children = nil
+		for _, c := range n.children {
+			if c != key {
+				children = append(children, c)
+			}
+		}
+	}
+	path = append(append([]string(nil), path...), seg...)
+	if len(children) == 0 {
+		*lines = append(*lines, strings.Join(path, " "))
+		return
+	}
+	for _, c := range children {
+		walkSet(c, n.name, path, lines)
+	}
+}
+
+// quoteValue quotes values containing whitespace or quotes, as the JunOS CLI
+// displays them.
+func quoteValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\"';{}") {
+		return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+	}
+	return s
+}
+
+// decodeXML builds the element tree of data under an unnamed root.
+func decodeXML(data []byte) (*xmlNode, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	root := &xmlNode{}
+	stack := []*xmlNode{root}
+	skip := 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("junos parser: xml: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if skip > 0 || skipElement(t) {
+				skip++
+				continue
+			}
+			n := &xmlNode{name: t.Name.Local}
+			top := stack[len(stack)-1]
+			top.children = append(top.children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			if skip > 0 {
+				skip--
+				continue
+			}
+			if len(stack) > 1 {
+				n := stack[len(stack)-1]
+				n.text = strings.TrimSpace(n.text)
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			if skip == 0 && len(stack) > 1 {
+				stack[len(stack)-1].text += string(t)
+			}
+		}
+	}
+	if len(stack) != 1 {
+		return nil, fmt.Errorf("junos parser: xml: unexpected end of document")
+	}
+	return root, nil
+}
+
+// skipElement reports whether an element is left out of the configuration:
+// inactive statements and JunOS comment annotations.
+func skipElement(t xml.StartElement) bool {
+	if t.Name.Local == "comment" && strings.Contains(t.Name.Space, "junos") {
+		return true
+	}
+	for _, a := range t.Attr {
+		if a.Name.Local == "inactive" && a.Value == "inactive" {
+			return true
+		}
+	}
+	return false
+}
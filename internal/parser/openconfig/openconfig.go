@@ -0,0 +1,273 @@
+// Package openconfig parses OpenConfig XML, as returned by a NETCONF
+// get-config of devices supporting the OpenConfig models, into a ConfigModel.
+package openconfig
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/0xdevren/netsentry/internal/model"
+)
+
+// namespacePrefix starts the XML namespace of every OpenConfig model.
+const namespacePrefix = "http://openconfig.net/yang/"
+
+// IsOpenConfig reports whether data is an XML document using OpenConfig
+// models.
+func IsOpenConfig(data []byte) bool {
+	trimmed := bytes.TrimSpace(data)
+	return bytes.HasPrefix(trimmed, []byte("<")) && bytes.Contains(trimmed, []byte(namespacePrefix))
+}
+
+// document holds the parts of the OpenConfig models mapped into ConfigModel.
+type document struct {
+	System struct {
+		Hostname   string   `xml:"config>hostname"`
+		DomainName string   `xml:"config>domain-name"`
+		NTPServers []string `xml:"ntp>servers>server>address"`
+	} `xml:"system"`
+	Interfaces       []ocInterface       `xml:"interfaces>interface"`
+	NetworkInstances []ocNetworkInstance `xml:"network-instances>network-instance"`
+}
+
+type ocInterface struct {
+	Name   string `xml:"name"`
+	Config struct {
+		Description string `xml:"description"`
+		Enabled     string `xml:"enabled"`
+		MTU         int    `xml:"mtu"`
+	} `xml:"config"`
+	Subinterfaces []struct {
+		Index int         `xml:"index"`
+		IPv4  []ocAddress `xml:"ipv4>addresses>address"`
+		IPv6  []ocAddress `xml:"ipv6>addresses>address"`
+	} `xml:"subinterfaces>subinterface"`
+}
+
+type ocAddress struct {
+	IP           string `xml:"config>ip"`
+	PrefixLength string `xml:"config>prefix-length"`
+}
+
+type ocNetworkInstance struct {
+	Name  string `xml:"name"`
+	VLANs []struct {
+		ID     int    `xml:"config>vlan-id"`
+		Name   string `xml:"config>name"`
+		Status string `xml:"config>status"`
+	} `xml:"vlans>vlan"`
+	Protocols []struct {
+		BGP *struct {
+			AS        int    `xml:"global>config>as"`
+			RouterID  string `xml:"global>config>router-id"`
+			Neighbors []struct {
+				Address     string `xml:"config>neighbor-address"`
+				PeerAS      int    `xml:"config>peer-as"`
+				Description string `xml:"config>description"`
+				Enabled     string `xml:"config>enabled"`
+			} `xml:"neighbors>neighbor"`
+		} `xml:"bgp"`
+		Static []struct {
+			Prefix   string `xml:"prefix"`
+			NextHops []struct {
+				NextHop string `xml:"config>next-hop"`
+			} `xml:"next-hops>next-hop"`
+		} `xml:"static-routes>static"`
+	} `xml:"protocols>protocol"`
+}
+
+// Parse converts OpenConfig XML into a ConfigModel. The document may be a
+// NETCONF data element or the bare top-level containers. Lines holds one
+// entry per configured leaf as a path with list keys in brackets followed by
+// the value, e.g. "/interfaces/interface[name=Ethernet1]/config/mtu 9214".
+func Parse(data []byte, device model.Device) (*model.ConfigModel, error) {
+	root, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &model.ConfigModel{
+		Device:         device,
+		RawText:        string(data),
+		GlobalSettings: make(map[string]string),
+	}
+	for _, c := range root.children {
+		flatten(c, "", &cfg.Lines)
+	}
+
+	var doc document
+	if err := xml.Unmarshal(root.inner, &doc); err != nil {
+		return nil, fmt.Errorf("openconfig parser: %w", err)
+	}
+	if doc.System.Hostname != "" {
+		cfg.Device.Hostname = doc.System.Hostname
+		cfg.GlobalSettings["hostname"] = doc.System.Hostname
+	}
+	if doc.System.DomainName != "" {
+		cfg.GlobalSettings["domain_name"] = doc.System.DomainName
+	}
+	if len(doc.System.NTPServers) > 0 {
+		cfg.GlobalSettings["ntp_server"] = doc.System.NTPServers[0]
+	}
+
+	for _, oi := range doc.Interfaces {
+		iface := model.Interface{
+			Name:        oi.Name,
+			Description: oi.Config.Description,
+			Shutdown:    oi.Config.Enabled == "false",
+			MTU:         oi.Config.MTU,
+			Attributes:  make(map[string]string),
+		}
+		for _, sub := range oi.Subinterfaces {
+			if sub.Index != 0 {
+				continue
+			}
+			if len(sub.IPv4) > 0 {
+				iface.IPAddress = sub.IPv4[0].cidr()
+			}
+			if len(sub.IPv6) > 0 {
+				iface.IPv6Address = sub.IPv6[0].cidr()
+			}
+		}
+		cfg.Interfaces = append(cfg.Interfaces, iface)
+	}
+
+	for _, ni := range doc.NetworkInstances {
+		for _, v := range ni.VLANs {
+			cfg.VLANs = append(cfg.VLANs, model.VLAN{ID: v.ID, Name: v.Name, State: strings.ToLower(v.Status)})
+		}
+		for _, proto := range ni.Protocols {
+			for _, st := range proto.Static {
+				route := model.StaticRoute{Destination: st.Prefix}
+				if len(st.NextHops) > 0 {
+					route.NextHop = st.NextHops[0].NextHop
+				}
+				cfg.StaticRoutes = append(cfg.StaticRoutes, route)
+			}
+			// Only the default instance maps onto the device-wide BGP model.
+			if proto.BGP == nil || cfg.BGPConfig != nil || (ni.Name != "default" && ni.Name != "") {
+				continue
+			}
+			bgp := &model.BGPConfig{LocalAS: proto.BGP.AS, RouterID: proto.BGP.RouterID}
+			for _, n := range proto.BGP.Neighbors {
+				bgp.Neighbors = append(bgp.Neighbors, model.BGPNeighbor{
+					Address:     n.Address,
+					RemoteAS:    n.PeerAS,
+					Description: n.Description,
+					Shutdown:    n.Enabled == "false",
+				})
+			}
+			cfg.BGPConfig = bgp
+		}
+	}
+	return cfg, nil
+}
+
+func (a ocAddress) cidr() string {
+	if a.PrefixLength == "" {
+		return a.IP
+	}
+	return a.IP + "/" + a.PrefixLength
+}
+
+// node is an element of the document with the raw XML of its content.
+type node struct {
+	name     string
+	text     string
+	children []*node
+	inner    []byte
+}
+
+// decode builds the element tree of data below any NETCONF data or
+// rpc-reply wrapper.
+func decode(data []byte) (*node, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	root := &node{}
+	stack := []*node{root}
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("openconfig parser: xml: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &node{name: t.Name.Local}
+			top := stack[len(stack)-1]
+			top.children = append(top.children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			if len(stack) > 1 {
+				n := stack[len(stack)-1]
+				n.text = strings.TrimSpace(n.text)
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			if len(stack) > 1 {
+				stack[len(stack)-1].text += string(t)
+			}
+		}
+	}
+	if len(stack) != 1 {
+		return nil, fmt.Errorf("openconfig parser: xml: unexpected end of document")
+	}
+
+	for len(root.children) == 1 && (root.children[0].name == "data" || root.children[0].name == "rpc-reply") {
+		root = root.children[0]
+	}
+	// Re-encode the top-level containers under one element for unmarshalling.
+	var buf bytes.Buffer
+	buf.WriteString("<root>")
+	for _, c := range root.children {
+		encode(&buf, c)
+	}
+	buf.WriteString("</root>")
+	root.inner = buf.Bytes()
+	return root, nil
+}
+
+func encode(buf *bytes.Buffer, n *node) {
+	buf.WriteString("<" + n.name + ">")
+	if len(n.children) == 0 {
+		_ = xml.EscapeText(buf, []byte(n.text))
+	}
+	for _, c := range n.children {
+		encode(buf, c)
+	}
+	buf.WriteString("</" + n.name + ">")
+}
+
+// flatten appends a line per leaf below n. List entries are recognised by
+// holding both leaves, their keys, and containers; the keys become a path
+// predicate.
+func flatten(n *node, path string, lines *[]string) {
+	if len(n.children) == 0 {
+		*lines = append(*lines, path+"/"+n.name+" "+n.text)
+		return
+	}
+	var keys, containers []*node
+	for _, c := range n.children {
+		if len(c.children) == 0 {
+			keys = append(keys, c)
+		} else {
+			containers = append(containers, c)
+		}
+	}
+	path += "/" + n.name
+	if len(containers) == 0 {
+		for _, leaf := range keys {
+			flatten(leaf, path, lines)
+		}
+		return
+	}
+	for _, k := range keys {
+		path += "[" + k.name + "=" + k.text + "]"
+	}
+	for _, c := range containers {
+		flatten(c, path, lines)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 
 	"github.com/0xdevren/netsentry/internal/model"
+	"github.com/0xdevren/netsentry/internal/parser/openconfig"
 )
 
 // DeviceParser is the interface implemented by all vendor-specific parsers.
@@ -19,8 +20,15 @@ type DeviceParser interface {
 }
 
 // Parse is a convenience function that locates the appropriate parser from
-// the default registry and parses the configuration.
+// the default registry and parses the configuration. OpenConfig XML is
+// vendor-neutral and parsed the same way for every device type.
 func Parse(ctx context.Context, deviceType model.DeviceType, data []byte, device model.Device) (*model.ConfigModel, error) {
+	if openconfig.IsOpenConfig(data) {
+		if device.Type == "" {
+			device.Type = deviceType
+		}
+		return openconfig.Parse(data, device)
+	}
 	p, ok := DefaultRegistry.Get(deviceType)
 	if !ok {
 		return nil, fmt.Errorf("parser: no parser registered for device type %q", deviceType)
@@ -0,0 +1,81 @@
+package policy
+
+import (
+	"fmt"
+
+	"github.com/0xdevren/netsentry/internal/model"
+	"github.com/0xdevren/netsentry/internal/util"
+)
+
+// Applicability restricts a rule to a subset of devices. Every populated
+// selector must match; within a list selector any entry may match.
+type Applicability struct {
+	// Types lists the device platforms the rule applies to (e.g. "cisco-ios").
+	Types []model.DeviceType `json:"types,omitempty" yaml:"types,omitempty"`
+	// Roles lists the device roles the rule applies to (e.g. "spine").
+	Roles []string `json:"roles,omitempty" yaml:"roles,omitempty"`
+	// Sites lists the sites the rule applies to.
+	Sites []string `json:"sites,omitempty" yaml:"sites,omitempty"`
+	// Tags lists device tags that must all be present. An empty value only
+	// requires the key to exist.
+	Tags map[string]string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	// Version is an OS version constraint such as ">= 15.2, < 17".
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+}
+
+// Matches reports whether the rule applies to the device. When it does not,
+// the returned reason explains which selector excluded it.
+func (a *Applicability) Matches(d model.Device) (bool, string) {
+	if a == nil {
+		return true, ""
+	}
+	if len(a.Types) > 0 && !containsType(a.Types, d.Type) {
+		return false, fmt.Sprintf("device type %q not in %v", d.Type, a.Types)
+	}
+	if len(a.Roles) > 0 && !containsString(a.Roles, d.Role) {
+		return false, fmt.Sprintf("device role %q not in %v", d.Role, a.Roles)
+	}
+	if len(a.Sites) > 0 && !containsString(a.Sites, d.Site) {
+		return false, fmt.Sprintf("device site %q not in %v", d.Site, a.Sites)
+	}
+	for k, want := range a.Tags {
+		got, ok := d.Tags[k]
+		if !ok {
+			return false, fmt.Sprintf("device tag %q is not set", k)
+		}
+		if want != "" && got != want {
+			return false, fmt.Sprintf("device tag %s=%q, want %q", k, got, want)
+		}
+	}
+	if a.Version != "" {
+		c, err := util.ParseVersionConstraint(a.Version)
+		if err != nil {
+			return false, err.Error()
+		}
+		if d.Version == "" {
+			return false, fmt.Sprintf("device version unknown for constraint %q", a.Version)
+		}
+		if !c.Allows(d.Version) {
+			return false, fmt.Sprintf("device version %q does not satisfy %q", d.Version, a.Version)
+		}
+	}
+	return true, ""
+}
+
+func containsType(types []model.DeviceType, t model.DeviceType) bool {
+	for _, v := range types {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -5,12 +5,35 @@ package dsl
 // grammar.go defines the structural grammar constants and helpers for
 // validating policy file structure beyond basic YAML parsing.
 
+import "github.com/0xdevren/netsentry/internal/model"
+
 // SupportedMatchKeys enumerates the valid keys within a match block.
 var SupportedMatchKeys = []string{
 	"contains",
 	"not_contains",
 	"regex",
 	"required_block",
+	"within",
+	"all_of",
+	"any_of",
+	"none_of",
+	"query",
+	"assert",
+}
+
+// CompositeMatchKeys enumerates match keys whose value is a list of nested
+// match blocks combined with boolean logic.
+var CompositeMatchKeys = []string{
+	"all_of",
+	"any_of",
+	"none_of",
+}
+
+// ScopeMatchKeys enumerates match keys that qualify a condition rather than
+// define one. A match block must contain at least one other key.
+var ScopeMatchKeys = []string{
+	"within",
+	"assert",
 }
 
 // SupportedActionKeys enumerates the valid keys within an action block.
@@ -18,6 +41,31 @@ var SupportedActionKeys = []string{
 	"deny",
 	"warn",
 	"remediation",
+	"fix",
+}
+
+// SupportedFixKeys enumerates the valid keys within a per-device-type fix.
+var SupportedFixKeys = []string{
+	"parents",
+	"lines",
+	"rollback",
+}
+
+// SupportedAppliesToKeys enumerates the valid keys within an applies_to block.
+var SupportedAppliesToKeys = []string{
+	"types",
+	"roles",
+	"sites",
+	"tags",
+	"version",
+}
+
+// ValidDeviceTypes lists the device types accepted in applies_to.types.
+var ValidDeviceTypes = []string{
+	string(model.DeviceTypeCiscoIOS),
+	string(model.DeviceTypeCiscoNXOS),
+	string(model.DeviceTypeJuniperOS),
+	string(model.DeviceTypeAristaEOS),
 }
 
 // ValidSeverities lists valid severity values accepted in policy documents.
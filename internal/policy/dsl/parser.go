@@ -16,15 +16,36 @@ type RawRule struct {
 	Match       map[string]interface{} `yaml:"match"`
 	Action      map[string]interface{} `yaml:"action"`
 	Enabled     *bool                  `yaml:"enabled"`
+	AppliesTo   map[string]interface{} `yaml:"applies_to"`
+}
+
+// RawOverride is the raw YAML-decoded form of an override applied to an
+// imported rule.
+type RawOverride struct {
+	Severity    string `yaml:"severity"`
+	Enabled     *bool  `yaml:"enabled"`
+	Remediation string `yaml:"remediation"`
 }
 
 // RawPolicy is the raw YAML-decoded form of a policy file.
 type RawPolicy struct {
-	Name        string    `yaml:"name"`
-	Version     string    `yaml:"version"`
-	Description string    `yaml:"description"`
-	Author      string    `yaml:"author"`
-	Rules       []RawRule `yaml:"rules"`
+	Name        string                 `yaml:"name"`
+	Version     string                 `yaml:"version"`
+	Description string                 `yaml:"description"`
+	Author      string                 `yaml:"author"`
+	AppliesTo   map[string]interface{} `yaml:"applies_to"`
+	// Extends lists parent policy files whose rules and metadata are inherited.
+	Extends []string `yaml:"extends"`
+	// Include lists policy files or directories whose rules are imported.
+	Include []string `yaml:"include"`
+	// Overrides adjusts imported rules, keyed by rule ID.
+	Overrides map[string]RawOverride `yaml:"overrides"`
+	Rules     []RawRule              `yaml:"rules"`
+}
+
+// HasImports reports whether the policy extends or includes other policies.
+func (p *RawPolicy) HasImports() bool {
+	return len(p.Extends) > 0 || len(p.Include) > 0
 }
 
 // Parser parses raw YAML policy files into RawPolicy structures for
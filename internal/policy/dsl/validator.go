@@ -2,6 +2,12 @@ package dsl
 
 import (
 	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/0xdevren/netsentry/internal/policy/query"
+	"github.com/0xdevren/netsentry/internal/policy/vars"
+	"github.com/0xdevren/netsentry/internal/util"
 )
 
 // ValidationError describes a structural error in a raw policy document.
@@ -24,13 +30,22 @@ func (e ValidationError) Error() string {
 }
 
 // Validator performs structural and semantic validation on a RawPolicy.
-type Validator struct{}
+type Validator struct {
+	variables *vars.File
+}
 
 // NewValidator constructs a new DSL Validator.
 func NewValidator() *Validator {
 	return &Validator{}
 }
 
+// WithVariables returns a Validator that checks template variable references
+// against the given variables file instead of reporting site and global
+// variables as unresolved.
+func (v *Validator) WithVariables(f *vars.File) *Validator {
+	return &Validator{variables: f}
+}
+
 // Validate checks a RawPolicy for structural integrity and returns any errors.
 func (v *Validator) Validate(p *RawPolicy) []ValidationError {
 	var errs []ValidationError
@@ -39,6 +54,12 @@ func (v *Validator) Validate(p *RawPolicy) []ValidationError {
 		errs = append(errs, ValidationError{RuleIndex: -1, Field: "name", Message: "policy name is required"})
 	}
 
+	if p.AppliesTo != nil {
+		errs = append(errs, validateAppliesTo(-1, "", "applies_to", p.AppliesTo)...)
+	}
+
+	errs = append(errs, validateImports(p)...)
+
 	seen := make(map[string]struct{}, len(p.Rules))
 	for i, r := range p.Rules {
 		if r.ID == "" {
@@ -60,14 +81,13 @@ func (v *Validator) Validate(p *RawPolicy) []ValidationError {
 		if len(r.Match) == 0 {
 			errs = append(errs, ValidationError{RuleIndex: i, RuleID: r.ID, Field: "match", Message: "match block is required"})
 		} else {
-			for k := range r.Match {
-				if !containsKey(SupportedMatchKeys, k) {
-					errs = append(errs, ValidationError{
-						RuleIndex: i, RuleID: r.ID, Field: "match." + k,
-						Message: fmt.Sprintf("unsupported match key %q", k),
-					})
-				}
-			}
+			errs = append(errs, v.validateMatch(i, r.ID, "match", r.Match, false)...)
+		}
+
+		errs = append(errs, v.validateTemplates(i, r)...)
+
+		if r.AppliesTo != nil {
+			errs = append(errs, validateAppliesTo(i, r.ID, "applies_to", r.AppliesTo)...)
 		}
 
 		if len(r.Action) == 0 {
@@ -81,8 +101,327 @@ func (v *Validator) Validate(p *RawPolicy) []ValidationError {
 					})
 				}
 			}
+			if fix, ok := r.Action["fix"]; ok {
+				errs = append(errs, validateFix(i, r.ID, "action.fix", fix)...)
+			}
+		}
+	}
+
+	return errs
+}
+
+// validateMatch checks a match block, recursing into boolean combinators.
+// Nested blocks may not carry a within scope.
+func (v *Validator) validateMatch(idx int, ruleID, field string, match map[string]interface{}, nested bool) []ValidationError {
+	var errs []ValidationError
+	conditions := 0
+	for _, k := range sortedKeys(match) {
+		val := match[k]
+		path := field + "." + k
+		if !containsKey(SupportedMatchKeys, k) {
+			errs = append(errs, ValidationError{
+				RuleIndex: idx, RuleID: ruleID, Field: path,
+				Message: fmt.Sprintf("unsupported match key %q", k),
+			})
+			continue
+		}
+		if k == "assert" {
+			continue
+		}
+		if containsKey(ScopeMatchKeys, k) {
+			if nested {
+				errs = append(errs, ValidationError{
+					RuleIndex: idx, RuleID: ruleID, Field: path,
+					Message: "within is only supported at the top level of a match block",
+				})
+			}
+			continue
+		}
+		conditions++
+		switch {
+		case containsKey(CompositeMatchKeys, k):
+			errs = append(errs, v.validateComposite(idx, ruleID, path, val)...)
+		case k == "regex":
+			errs = append(errs, validatePattern(idx, ruleID, path, val)...)
+		}
+	}
+	if conditions == 0 {
+		errs = append(errs, ValidationError{
+			RuleIndex: idx, RuleID: ruleID, Field: field,
+			Message: "match block has no condition to evaluate",
+		})
+	}
+	if within, ok := match["within"]; ok && !nested {
+		errs = append(errs, validatePattern(idx, ruleID, field+".within", within)...)
+	}
+	errs = append(errs, validateQuery(idx, ruleID, field, match, conditions)...)
+	return errs
+}
+
+// validateQuery checks the query and assert keys of a match block. A query
+// must be the only condition in its block and carry at least one assertion.
+func validateQuery(idx int, ruleID, field string, match map[string]interface{}, conditions int) []ValidationError {
+	q, hasQuery := match["query"]
+	asserts, hasAssert := match["assert"]
+	if !hasQuery {
+		if hasAssert {
+			return []ValidationError{{RuleIndex: idx, RuleID: ruleID, Field: field + ".assert", Message: "assert requires a query"}}
+		}
+		return nil
+	}
+
+	var errs []ValidationError
+	if expr, ok := q.(string); !ok {
+		errs = append(errs, ValidationError{RuleIndex: idx, RuleID: ruleID, Field: field + ".query", Message: "must be a path expression string"})
+	} else if _, err := query.ParsePath(vars.Stub(expr)); err != nil {
+		errs = append(errs, ValidationError{RuleIndex: idx, RuleID: ruleID, Field: field + ".query", Message: err.Error()})
+	}
+	if conditions > 1 {
+		errs = append(errs, ValidationError{
+			RuleIndex: idx, RuleID: ruleID, Field: field + ".query",
+			Message: "query cannot be combined with other conditions in the same block; use all_of",
+		})
+	}
+	if _, scoped := match["within"]; scoped {
+		errs = append(errs, ValidationError{RuleIndex: idx, RuleID: ruleID, Field: field + ".query", Message: "query cannot be combined with within"})
+	}
+
+	list, ok := asserts.([]interface{})
+	if !hasAssert || !ok || len(list) == 0 {
+		return append(errs, ValidationError{RuleIndex: idx, RuleID: ruleID, Field: field + ".assert", Message: "query requires a non-empty list of assertions"})
+	}
+	for j, item := range list {
+		path := fmt.Sprintf("%s.assert[%d]", field, j)
+		expr, ok := item.(string)
+		if !ok {
+			errs = append(errs, ValidationError{RuleIndex: idx, RuleID: ruleID, Field: path, Message: "must be an assertion string"})
+			continue
+		}
+		if _, err := query.ParseAssertion(vars.Stub(expr)); err != nil {
+			errs = append(errs, ValidationError{RuleIndex: idx, RuleID: ruleID, Field: path, Message: err.Error()})
+		}
+	}
+	return errs
+}
+
+// validateComposite checks that an all_of/any_of/none_of value is a non-empty
+// list of match blocks and validates each of them.
+func (v *Validator) validateComposite(idx int, ruleID, field string, value interface{}) []ValidationError {
+	items, ok := value.([]interface{})
+	if !ok || len(items) == 0 {
+		return []ValidationError{{RuleIndex: idx, RuleID: ruleID, Field: field, Message: "must be a non-empty list of match blocks"}}
+	}
+	var errs []ValidationError
+	for j, item := range items {
+		path := fmt.Sprintf("%s[%d]", field, j)
+		sub, ok := item.(map[string]interface{})
+		if !ok {
+			errs = append(errs, ValidationError{RuleIndex: idx, RuleID: ruleID, Field: path, Message: "must be a match block"})
+			continue
+		}
+		errs = append(errs, v.validateMatch(idx, ruleID, path, sub, true)...)
+	}
+	return errs
+}
+
+// validateImports checks the extends, include and overrides directives.
+// Whether overridden rule IDs exist is only known once imports are resolved,
+// which is left to the policy loader.
+func validateImports(p *RawPolicy) []ValidationError {
+	var errs []ValidationError
+	checkPaths := func(field string, refs []string) {
+		for i, ref := range refs {
+			if ref == "" {
+				errs = append(errs, ValidationError{RuleIndex: -1, Field: fmt.Sprintf("%s[%d]", field, i), Message: "path must not be empty"})
+			}
+		}
+	}
+	checkPaths("extends", p.Extends)
+	checkPaths("include", p.Include)
+	if len(p.Overrides) > 0 && !p.HasImports() {
+		errs = append(errs, ValidationError{RuleIndex: -1, Field: "overrides", Message: "overrides require extends or include"})
+	}
+	ids := make([]string, 0, len(p.Overrides))
+	for id := range p.Overrides {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		o := p.Overrides[id]
+		field := "overrides." + id
+		if o.Severity == "" && o.Enabled == nil && o.Remediation == "" {
+			errs = append(errs, ValidationError{RuleIndex: -1, Field: field, Message: "override must set severity, enabled or remediation"})
+		}
+		if o.Severity != "" && !containsKey(ValidSeverities, o.Severity) {
+			errs = append(errs, ValidationError{
+				RuleIndex: -1, Field: field + ".severity",
+				Message: fmt.Sprintf("invalid severity %q; must be one of %v", o.Severity, ValidSeverities),
+			})
+		}
+	}
+	return errs
+}
+
+// validateAppliesTo checks the keys and values of an applies_to block.
+func validateAppliesTo(idx int, ruleID, field string, a map[string]interface{}) []ValidationError {
+	var errs []ValidationError
+	for _, k := range sortedKeys(a) {
+		path := field + "." + k
+		if !containsKey(SupportedAppliesToKeys, k) {
+			errs = append(errs, ValidationError{
+				RuleIndex: idx, RuleID: ruleID, Field: path,
+				Message: fmt.Sprintf("unsupported applies_to key %q; must be one of %v", k, SupportedAppliesToKeys),
+			})
+			continue
+		}
+		val := a[k]
+		switch k {
+		case "types", "roles", "sites":
+			items, ok := val.([]interface{})
+			if !ok {
+				errs = append(errs, ValidationError{RuleIndex: idx, RuleID: ruleID, Field: path, Message: "must be a list of strings"})
+				continue
+			}
+			if k != "types" {
+				continue
+			}
+			for _, item := range items {
+				if t, _ := item.(string); !containsKey(ValidDeviceTypes, t) {
+					errs = append(errs, ValidationError{
+						RuleIndex: idx, RuleID: ruleID, Field: path,
+						Message: fmt.Sprintf("unknown device type %v; must be one of %v", item, ValidDeviceTypes),
+					})
+				}
+			}
+		case "tags":
+			if _, ok := val.(map[string]interface{}); !ok {
+				errs = append(errs, ValidationError{RuleIndex: idx, RuleID: ruleID, Field: path, Message: "must be a map of tag keys to values"})
+			}
+		case "version":
+			expr, ok := val.(string)
+			if !ok {
+				errs = append(errs, ValidationError{RuleIndex: idx, RuleID: ruleID, Field: path, Message: "must be a version constraint string"})
+			} else if _, err := util.ParseVersionConstraint(expr); err != nil {
+				errs = append(errs, ValidationError{RuleIndex: idx, RuleID: ruleID, Field: path, Message: err.Error()})
+			}
+		}
+	}
+	return errs
+}
+
+// validateFix checks a fix block: a map of device types to the parents, lines
+// and rollback of the change for that type.
+func validateFix(idx int, ruleID, field string, value interface{}) []ValidationError {
+	fixes, ok := value.(map[string]interface{})
+	if !ok {
+		return []ValidationError{{RuleIndex: idx, RuleID: ruleID, Field: field, Message: "must be a map of device types to fixes"}}
+	}
+	var errs []ValidationError
+	for _, t := range sortedKeys(fixes) {
+		path := field + "." + t
+		if !containsKey(ValidDeviceTypes, t) {
+			errs = append(errs, ValidationError{
+				RuleIndex: idx, RuleID: ruleID, Field: path,
+				Message: fmt.Sprintf("unknown device type %q; must be one of %v", t, ValidDeviceTypes),
+			})
+			continue
+		}
+		fix, ok := fixes[t].(map[string]interface{})
+		if !ok {
+			errs = append(errs, ValidationError{RuleIndex: idx, RuleID: ruleID, Field: path, Message: "must be a map with parents, lines and rollback"})
+			continue
+		}
+		for _, k := range sortedKeys(fix) {
+			if !containsKey(SupportedFixKeys, k) {
+				errs = append(errs, ValidationError{
+					RuleIndex: idx, RuleID: ruleID, Field: path + "." + k,
+					Message: fmt.Sprintf("unsupported fix key %q", k),
+				})
+				continue
+			}
+			items, ok := fix[k].([]interface{})
+			if ok {
+				for _, item := range items {
+					if s, isString := item.(string); !isString || s == "" {
+						ok = false
+					}
+				}
+			}
+			if !ok {
+				errs = append(errs, ValidationError{RuleIndex: idx, RuleID: ruleID, Field: path + "." + k, Message: "must be a list of non-empty strings"})
+			}
+		}
+		if lines, _ := fix["lines"].([]interface{}); len(lines) == 0 {
+			errs = append(errs, ValidationError{RuleIndex: idx, RuleID: ruleID, Field: path + ".lines", Message: "at least one line is required"})
 		}
 	}
+	return errs
+}
 
+// validateTemplates checks the syntax of every template variable referenced by
+// a rule's match block, remediation and fixes, and that each one resolves.
+func (v *Validator) validateTemplates(idx int, r RawRule) []ValidationError {
+	var errs []ValidationError
+	visit := func(field, s string) {
+		refs, err := vars.References(s)
+		if err != nil {
+			errs = append(errs, ValidationError{RuleIndex: idx, RuleID: r.ID, Field: field, Message: err.Error()})
+			return
+		}
+		for _, ref := range refs {
+			if reason := v.variables.Check(ref); reason != "" {
+				errs = append(errs, ValidationError{
+					RuleIndex: idx, RuleID: r.ID, Field: field,
+					Message: fmt.Sprintf("unresolved variable %q: %s", ref.String(), reason),
+				})
+			}
+		}
+	}
+	walkStrings("match", r.Match, visit)
+	if rem, ok := r.Action["remediation"].(string); ok {
+		visit("action.remediation", rem)
+	}
+	if fix, ok := r.Action["fix"]; ok {
+		walkStrings("action.fix", fix, visit)
+	}
 	return errs
 }
+
+// walkStrings calls fn for every string within v, with its field path.
+func walkStrings(field string, v interface{}, fn func(field, s string)) {
+	switch c := v.(type) {
+	case string:
+		fn(field, c)
+	case []interface{}:
+		for i, item := range c {
+			walkStrings(fmt.Sprintf("%s[%d]", field, i), item, fn)
+		}
+	case map[string]interface{}:
+		for _, k := range sortedKeys(c) {
+			walkStrings(field+"."+k, c[k], fn)
+		}
+	}
+}
+
+// validatePattern checks that value is a non-empty, compilable regular expression.
+func validatePattern(idx int, ruleID, field string, value interface{}) []ValidationError {
+	pattern, ok := value.(string)
+	if !ok || pattern == "" {
+		return []ValidationError{{RuleIndex: idx, RuleID: ruleID, Field: field, Message: "must be a non-empty string"}}
+	}
+	if _, err := regexp.Compile(vars.Stub(pattern)); err != nil {
+		return []ValidationError{{RuleIndex: idx, RuleID: ruleID, Field: field, Message: fmt.Sprintf("invalid regex: %v", err)}}
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of m in lexical order so that errors are
+// reported deterministically.
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -6,6 +6,7 @@ import (
 	"sync"
 
 	"github.com/0xdevren/netsentry/internal/model"
+	"github.com/0xdevren/netsentry/internal/policy/vars"
 )
 
 // EngineOptions configures the behaviour of the policy Engine.
@@ -34,12 +35,14 @@ func NewEngine(opts EngineOptions) *Engine {
 
 // job is an internal unit of work for the worker pool.
 type job struct {
-	rule Rule
-	cfg  *model.ConfigModel
+	rule  Rule
+	cfg   *model.ConfigModel
+	scope vars.Scope
 }
 
 // Run evaluates all enabled rules in the policy against the given configuration
-// using a worker pool. It respects context cancellation.
+// using a worker pool. Block-scoped rules may contribute more than one result.
+// It respects context cancellation.
 func (e *Engine) Run(ctx context.Context, p *Policy, cfg *model.ConfigModel) ([]ValidationResult, error) {
 	if p == nil {
 		return nil, fmt.Errorf("engine: nil policy")
@@ -58,24 +61,30 @@ func (e *Engine) Run(ctx context.Context, p *Policy, cfg *model.ConfigModel) ([]
 		go func() {
 			defer wg.Done()
 			for j := range jobs {
-				select {
-				case <-ctx.Done():
-					return
-				case results <- e.evaluator.Evaluate(j.rule, j.cfg):
+				for _, r := range e.evaluate(j) {
+					select {
+					case <-ctx.Done():
+						return
+					case results <- r:
+					}
 				}
 			}
 		}()
 	}
 
-	// Enqueue jobs.
+	// Enqueue jobs. Rules without their own applicability inherit the policy default.
+	scope := p.Variables.Scope(cfg.Device)
 	for _, rule := range p.Rules {
+		if rule.AppliesTo == nil {
+			rule.AppliesTo = p.AppliesTo
+		}
 		select {
 		case <-ctx.Done():
 			close(jobs)
 			wg.Wait()
 			close(results)
 			return nil, fmt.Errorf("engine: context cancelled before all jobs enqueued: %w", ctx.Err())
-		case jobs <- job{rule: rule, cfg: cfg}:
+		case jobs <- job{rule: rule, cfg: cfg, scope: scope}:
 		}
 	}
 	close(jobs)
@@ -97,3 +106,21 @@ func (e *Engine) Run(ctx context.Context, p *Policy, cfg *model.ConfigModel) ([]
 
 	return out, nil
 }
+
+// evaluate resolves the template variables of the job's rule and evaluates it.
+// Variables are only resolved for rules that will actually be evaluated, so a
+// rule skipped as disabled or not applicable never fails on a missing value.
+func (e *Engine) evaluate(j job) []ValidationResult {
+	rule := j.rule
+	if ok, _ := rule.AppliesTo.Matches(j.cfg.Device); ok && rule.IsEnabled() {
+		rendered, err := rule.Render(j.scope)
+		if err != nil {
+			res := newResult(rule, j.cfg.Device)
+			res.Status = StatusError
+			res.Message = fmt.Sprintf("template error: %s", err.Error())
+			return []ValidationResult{res}
+		}
+		rule = rendered
+	}
+	return e.evaluator.EvaluateAll(rule, j.cfg)
+}
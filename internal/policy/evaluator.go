@@ -17,21 +17,171 @@ func NewEvaluator(m *Matcher) *Evaluator {
 }
 
 // Evaluate applies the rule to the configuration and returns a ValidationResult.
+// Block-scoped and query rules are summarised into a single result describing
+// the first offending block or element; use EvaluateAll to obtain one result
+// per block or element.
 func (e *Evaluator) Evaluate(rule Rule, cfg *model.ConfigModel) ValidationResult {
-	result := ValidationResult{
+	return e.EvaluateAll(rule, cfg)[0]
+}
+
+// target is a single block or model element that a scoped rule is evaluated
+// against independently.
+type target struct {
+	label string
+	block string
+	// header is the evidence used when the match itself records none, such
+	// as a block that lacks a required line.
+	header *Evidence
+	match  func() (bool, []Evidence, error)
+}
+
+// EvaluateAll applies the rule to the configuration and returns every result it
+// produces. Unscoped rules always yield exactly one result. Block-scoped and
+// query rules yield one result per offending block or element, a single PASS
+// when every target complies, or a single SKIP when there is nothing to check.
+func (e *Evaluator) EvaluateAll(rule Rule, cfg *model.ConfigModel) []ValidationResult {
+	base := newResult(rule, cfg.Device)
+
+	if !rule.IsEnabled() {
+		base.Status = StatusSkip
+		base.Message = "rule is disabled"
+		return []ValidationResult{base}
+	}
+
+	if ok, reason := rule.AppliesTo.Matches(cfg.Device); !ok {
+		base.Status = StatusSkip
+		base.Message = "not applicable: " + reason
+		return []ValidationResult{base}
+	}
+
+	var (
+		targets []target
+		kind    string
+		err     error
+	)
+	switch {
+	case rule.Match.IsScoped():
+		kind = "block"
+		targets, err = e.blockTargets(rule, cfg)
+		if err == nil && len(targets) == 0 {
+			base.Status = StatusSkip
+			base.Message = fmt.Sprintf("no configuration blocks match scope %q", rule.Match.Within)
+			return []ValidationResult{base}
+		}
+	case rule.Match.IsQuery():
+		kind = "element"
+		targets, err = e.queryTargets(rule, cfg)
+		if err == nil && len(targets) == 0 {
+			base.Status = StatusSkip
+			base.Message = fmt.Sprintf("query %q selected no elements", rule.Match.Query)
+			return []ValidationResult{base}
+		}
+	default:
+		matched, evidence, err := e.matcher.MatchEvidence(rule.Match, cfg)
+		res := e.decide(rule, matched, err, base)
+		attachEvidence(&res, evidence, nil, cfg)
+		return []ValidationResult{res}
+	}
+	if err != nil {
+		base.Status = StatusError
+		base.Message = fmt.Sprintf("evaluation error: %s", err.Error())
+		return []ValidationResult{base}
+	}
+
+	var offending []ValidationResult
+	for _, t := range targets {
+		matched, evidence, err := t.match()
+		res := e.decide(rule, matched, err, base)
+		if res.Status == StatusError {
+			return []ValidationResult{res}
+		}
+		if res.Status == StatusPass {
+			continue
+		}
+		res.Message = fmt.Sprintf("%s [%s %s]", res.Message, kind, t.label)
+		res.Block = t.block
+		attachEvidence(&res, evidence, t.header, cfg)
+		offending = append(offending, res)
+	}
+	if len(offending) == 0 {
+		base.Status = StatusPass
+		base.Message = fmt.Sprintf("rule %s passed in %d %s(s)", rule.ID, len(targets), kind)
+		return []ValidationResult{base}
+	}
+	return offending
+}
+
+// newResult returns a result for rule on device carrying the rule's identity
+// but no status.
+func newResult(rule Rule, device model.Device) ValidationResult {
+	res := ValidationResult{
 		RuleID:          rule.ID,
 		RuleDescription: rule.Description,
-		Device:          cfg.Device,
+		Device:          device,
 		Severity:        rule.Severity,
 	}
+	if rule.Provenance != nil {
+		res.Policy = rule.Provenance.Policy
+	}
+	return res
+}
 
-	if !rule.IsEnabled() {
-		result.Status = StatusSkip
-		result.Message = "rule is disabled"
-		return result
+// blockTargets returns one target per configuration block in the rule's scope.
+func (e *Evaluator) blockTargets(rule Rule, cfg *model.ConfigModel) ([]target, error) {
+	blocks, err := e.matcher.ScopeBlocks(rule.Match, cfg)
+	if err != nil {
+		return nil, err
+	}
+	targets := make([]target, 0, len(blocks))
+	for _, b := range blocks {
+		scoped := &model.ConfigModel{Device: cfg.Device, Lines: b.Lines, LineNumbers: b.LineNumbers, Blocks: b.Children}
+		targets = append(targets, target{
+			label:  fmt.Sprintf("%q", b.Header),
+			block:  b.Header,
+			header: &Evidence{Line: b.Line, Text: b.Header},
+			match:  func() (bool, []Evidence, error) { return e.matcher.MatchEvidence(rule.Match, scoped) },
+		})
+	}
+	return targets, nil
+}
+
+// queryTargets returns one target per model element selected by the rule's query.
+func (e *Evaluator) queryTargets(rule Rule, cfg *model.ConfigModel) ([]target, error) {
+	elements, err := e.matcher.QueryElements(rule.Match, cfg)
+	if err != nil {
+		return nil, err
+	}
+	targets := make([]target, 0, len(elements))
+	for _, el := range elements {
+		targets = append(targets, target{
+			label: el.Label,
+			match: func() (bool, []Evidence, error) {
+				ok, err := e.matcher.MatchElement(rule.Match, el)
+				return ok, nil, err
+			},
+		})
 	}
+	return targets, nil
+}
+
+// attachEvidence records the lines behind a FAIL or WARN result, resolving
+// the enclosing block path of each against the full configuration. fallback
+// is used when the match recorded no lines.
+func attachEvidence(res *ValidationResult, evidence []Evidence, fallback *Evidence, cfg *model.ConfigModel) {
+	if res.Status != StatusFail && res.Status != StatusWarn {
+		return
+	}
+	if len(evidence) == 0 && fallback != nil {
+		evidence = []Evidence{*fallback}
+	}
+	for i := range evidence {
+		evidence[i].Path = cfg.BlockPath(evidence[i].Line)
+	}
+	res.Evidence = evidence
+}
 
-	matched, err := e.matcher.Match(rule.Match, cfg)
+// decide derives the status of result from the match outcome and the rule action.
+func (e *Evaluator) decide(rule Rule, matched bool, err error, result ValidationResult) ValidationResult {
 	if err != nil {
 		result.Status = StatusError
 		result.Message = fmt.Sprintf("evaluation error: %s", err.Error())
@@ -0,0 +1,142 @@
+package policy
+
+import (
+	"sort"
+
+	"github.com/0xdevren/netsentry/internal/model"
+)
+
+// FleetReport is the output of a validation run across many devices.
+type FleetReport struct {
+	// Policy is the policy name used for every device.
+	Policy string `json:"policy" yaml:"policy"`
+	// Devices holds one entry per device, in device order.
+	Devices []DeviceOutcome `json:"devices" yaml:"devices"`
+	// Summary provides fleet-wide compliance metrics.
+	Summary FleetSummary `json:"summary" yaml:"summary"`
+}
+
+// DeviceOutcome is the result of validating one device of a fleet.
+type DeviceOutcome struct {
+	// Device is the evaluated device. Its ID is the parsed hostname unless an
+	// inventory supplied one.
+	Device model.Device `json:"device" yaml:"device"`
+	// Source is the configuration file the device was loaded from.
+	Source string `json:"source" yaml:"source"`
+	// Report is the device's validation report; nil when Error is set.
+	Report *Report `json:"report,omitempty" yaml:"report,omitempty"`
+	// Error describes why the device could not be validated.
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+	// ErrorCode classifies Error for programmatic handling, e.g.
+	// "host_key_mismatch". Empty for unclassified errors.
+	ErrorCode string `json:"error_code,omitempty" yaml:"error_code,omitempty"`
+}
+
+// FleetSummary aggregates the compliance metrics of a fleet run.
+type FleetSummary struct {
+	// Devices is the number of devices in the run.
+	Devices int `json:"devices" yaml:"devices"`
+	// Compliant is the number of devices without failed rules.
+	Compliant int `json:"compliant" yaml:"compliant"`
+	// NonCompliant is the number of devices with at least one failed rule.
+	NonCompliant int `json:"non_compliant" yaml:"non_compliant"`
+	// Errors is the number of devices that could not be validated.
+	Errors int `json:"errors" yaml:"errors"`
+	// Score is the mean compliance score of the validated devices (0-100).
+	Score float64 `json:"score" yaml:"score"`
+	// WorstOffenders lists the lowest scoring non-compliant devices.
+	WorstOffenders []DeviceScore `json:"worst_offenders,omitempty" yaml:"worst_offenders,omitempty"`
+	// TopFailingRules lists the rules failing on the most devices.
+	TopFailingRules []RuleFailures `json:"top_failing_rules,omitempty" yaml:"top_failing_rules,omitempty"`
+}
+
+// DeviceScore is a device's score and failure count in a fleet summary.
+type DeviceScore struct {
+	Device   string  `json:"device" yaml:"device"`
+	Score    float64 `json:"score" yaml:"score"`
+	Failed   int     `json:"failed" yaml:"failed"`
+	Warnings int     `json:"warnings" yaml:"warnings"`
+}
+
+// RuleFailures counts the devices on which a rule failed.
+type RuleFailures struct {
+	RuleID   string   `json:"rule_id" yaml:"rule_id"`
+	Severity Severity `json:"severity" yaml:"severity"`
+	Devices  int      `json:"devices" yaml:"devices"`
+}
+
+// ComputeFleetSummary calculates fleet-wide statistics from device outcomes.
+// WorstOffenders and TopFailingRules are limited to top entries each.
+func ComputeFleetSummary(devices []DeviceOutcome, top int) FleetSummary {
+	s := FleetSummary{Devices: len(devices)}
+	rules := make(map[string]*RuleFailures)
+	var total float64
+	for _, d := range devices {
+		if d.Report == nil {
+			s.Errors++
+			continue
+		}
+		sum := d.Report.Summary
+		total += sum.Score
+		if sum.Failed == 0 {
+			s.Compliant++
+		} else {
+			s.NonCompliant++
+			s.WorstOffenders = append(s.WorstOffenders, DeviceScore{
+				Device: d.Device.String(), Score: sum.Score, Failed: sum.Failed, Warnings: sum.Warnings,
+			})
+		}
+
+		// A block-scoped rule can fail several times on one device; count the
+		// device once.
+		counted := make(map[string]bool)
+		for _, r := range d.Report.Results {
+			if r.Status != StatusFail || counted[r.RuleID] {
+				continue
+			}
+			counted[r.RuleID] = true
+			rf, ok := rules[r.RuleID]
+			if !ok {
+				rf = &RuleFailures{RuleID: r.RuleID, Severity: r.Severity}
+				rules[r.RuleID] = rf
+			}
+			rf.Devices++
+		}
+	}
+	if validated := s.Compliant + s.NonCompliant; validated > 0 {
+		s.Score = total / float64(validated)
+	}
+
+	sort.SliceStable(s.WorstOffenders, func(i, j int) bool {
+		a, b := s.WorstOffenders[i], s.WorstOffenders[j]
+		if a.Score != b.Score {
+			return a.Score < b.Score
+		}
+		if a.Failed != b.Failed {
+			return a.Failed > b.Failed
+		}
+		return a.Device < b.Device
+	})
+	for _, rf := range rules {
+		s.TopFailingRules = append(s.TopFailingRules, *rf)
+	}
+	sort.Slice(s.TopFailingRules, func(i, j int) bool {
+		a, b := s.TopFailingRules[i], s.TopFailingRules[j]
+		if a.Devices != b.Devices {
+			return a.Devices > b.Devices
+		}
+		if a.Severity.Weight() != b.Severity.Weight() {
+			return a.Severity.Weight() > b.Severity.Weight()
+		}
+		return a.RuleID < b.RuleID
+	})
+	if top > 0 {
+		if len(s.WorstOffenders) > top {
+			s.WorstOffenders = s.WorstOffenders[:top]
+		}
+		if len(s.TopFailingRules) > top {
+			s.TopFailingRules = s.TopFailingRules[:top]
+		}
+	}
+	return s
+}
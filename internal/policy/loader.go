@@ -3,7 +3,12 @@ package policy
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
+	"github.com/0xdevren/netsentry/internal/policy/dsl"
+	"github.com/0xdevren/netsentry/internal/util"
 	"gopkg.in/yaml.v3"
 )
 
@@ -15,29 +20,284 @@ func NewLoader() *Loader {
 	return &Loader{}
 }
 
-// LoadFile reads the policy at the given filesystem path and returns the parsed Policy.
+// LoadFile reads the policy at the given filesystem path, resolves its extends
+// and include directives relative to the file, and returns the parsed Policy.
 func (l *Loader) LoadFile(path string) (*Policy, error) {
-	data, err := os.ReadFile(path)
+	p, err := newResolver().loadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("policy loader: read file %q: %w", path, err)
+		return nil, fmt.Errorf("policy loader: %w", err)
 	}
-	return l.LoadBytes(data)
+	return p, nil
 }
 
 // LoadBytes parses YAML-encoded policy bytes and returns the parsed Policy.
+// Policies loaded from bytes have no location to resolve imports against, so
+// extends and include directives are rejected.
 func (l *Loader) LoadBytes(data []byte) (*Policy, error) {
+	p, err := newResolver().load(data, "")
+	if err != nil {
+		return nil, fmt.Errorf("policy loader: %w", err)
+	}
+	return p, nil
+}
+
+// importFrame is an entry in the chain of policy files being resolved.
+type importFrame struct {
+	key  string
+	name string
+}
+
+// resolver loads a policy and the graph of policies it imports. It tracks the
+// active import chain to detect cycles and caches every resolved file so that
+// a policy imported along several paths is only loaded once.
+type resolver struct {
+	chain []importFrame
+	cache map[string]*Policy
+}
+
+func newResolver() *resolver {
+	return &resolver{cache: make(map[string]*Policy)}
+}
+
+// loadFile resolves the policy at path.
+func (r *resolver) loadFile(path string) (*Policy, error) {
+	name := filepath.Clean(path)
+	key, err := filepath.Abs(name)
+	if err != nil {
+		return nil, fmt.Errorf("resolve path %q: %w", path, err)
+	}
+	for i, f := range r.chain {
+		if f.key == key {
+			cycle := make([]string, 0, len(r.chain)-i+1)
+			for _, c := range r.chain[i:] {
+				cycle = append(cycle, c.name)
+			}
+			return nil, fmt.Errorf("import cycle: %s -> %s", strings.Join(cycle, " -> "), name)
+		}
+	}
+	if p, ok := r.cache[key]; ok {
+		return p, nil
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("read file %q: %w", path, err)
+	}
+	r.chain = append(r.chain, importFrame{key: key, name: name})
+	p, err := r.load(data, name)
+	r.chain = r.chain[:len(r.chain)-1]
+	if err != nil {
+		return nil, err
+	}
+	r.cache[key] = p
+	return p, nil
+}
+
+// load parses a single policy document and merges in the policies it
+// imports. source is the file the document was read from, or empty when it
+// was supplied as bytes.
+//
+// Imported rules keep their position in import order (extends first, then
+// include); a rule imported twice from the same defining file is kept once.
+// Overrides are applied to imported rules, and a local rule with the ID of an
+// imported rule replaces it.
+func (r *resolver) load(data []byte, source string) (*Policy, error) {
 	var p Policy
 	if err := yaml.Unmarshal(data, &p); err != nil {
-		return nil, fmt.Errorf("policy loader: yaml unmarshal: %w", err)
+		return nil, fmt.Errorf("yaml unmarshal: %w", err)
+	}
+	raw, err := dsl.NewParser().ParseBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := validate(&p); err != nil {
+		return nil, fmt.Errorf("validation: %w", err)
+	}
+
+	name := source
+	if name == "" {
+		name = "<inline>"
+	}
+	for i := range p.Rules {
+		p.Rules[i].Provenance = &Provenance{Source: name}
+	}
+
+	if !raw.HasImports() {
+		if len(raw.Overrides) > 0 {
+			return nil, fmt.Errorf("validation: overrides require extends or include")
+		}
+		return &p, nil
+	}
+	if source == "" {
+		return nil, fmt.Errorf("extends and include are only supported when loading from a file")
+	}
+
+	m := &merger{index: make(map[string]int)}
+	base := filepath.Dir(source)
+	for _, ref := range raw.Extends {
+		parent, err := r.loadFile(resolvePath(base, ref))
+		if err != nil {
+			return nil, fmt.Errorf("%s: extends %q: %w", name, ref, err)
+		}
+		if err := m.add(parent); err != nil {
+			return nil, fmt.Errorf("%s: extends %q: %w", name, ref, err)
+		}
+		inheritMetadata(&p, parent)
+	}
+	for _, ref := range raw.Include {
+		paths, err := expandInclude(resolvePath(base, ref), source)
+		if err != nil {
+			return nil, fmt.Errorf("%s: include %q: %w", name, ref, err)
+		}
+		for _, path := range paths {
+			inc, err := r.loadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("%s: include %q: %w", name, ref, err)
+			}
+			if err := m.add(inc); err != nil {
+				return nil, fmt.Errorf("%s: include %q: %w", name, ref, err)
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(raw.Overrides))
+	for id := range raw.Overrides {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if err := m.override(id, raw.Overrides[id], name); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
 	}
-	if err := l.validate(&p); err != nil {
-		return nil, fmt.Errorf("policy loader: validation: %w", err)
+
+	for _, rule := range p.Rules {
+		m.define(rule)
 	}
+	p.Rules = m.rules
 	return &p, nil
 }
 
+// merger accumulates the rules of a policy and its imports.
+type merger struct {
+	rules []Rule
+	index map[string]int
+}
+
+// add appends the rules of an imported policy. Rules without their own
+// applicability inherit the imported policy's default so that they keep the
+// scope they had in their original file.
+func (m *merger) add(imported *Policy) error {
+	for _, rule := range imported.Rules {
+		if i, ok := m.index[rule.ID]; ok {
+			if m.rules[i].Provenance.Source == rule.Provenance.Source {
+				continue
+			}
+			return fmt.Errorf("rule %q is defined in both %s and %s",
+				rule.ID, m.rules[i].Provenance.Source, rule.Provenance.Source)
+		}
+		prov := *rule.Provenance
+		prov.OverriddenBy = append([]string(nil), prov.OverriddenBy...)
+		rule.Provenance = &prov
+		if rule.AppliesTo == nil {
+			rule.AppliesTo = imported.AppliesTo
+		}
+		m.index[rule.ID] = len(m.rules)
+		m.rules = append(m.rules, rule)
+	}
+	return nil
+}
+
+// override applies o to the imported rule id on behalf of the policy file source.
+func (m *merger) override(id string, o dsl.RawOverride, source string) error {
+	i, ok := m.index[id]
+	if !ok {
+		return fmt.Errorf("override for rule %q which is not imported", id)
+	}
+	rule := &m.rules[i]
+	if o.Severity != "" {
+		sev := Severity(o.Severity)
+		if !sev.IsValid() {
+			return fmt.Errorf("override for rule %q has invalid severity %q", id, o.Severity)
+		}
+		rule.Severity = sev
+	}
+	if o.Enabled != nil {
+		enabled := *o.Enabled
+		rule.Enabled = &enabled
+	}
+	if o.Remediation != "" {
+		rule.Action.Remediation = o.Remediation
+	}
+	rule.Provenance.OverriddenBy = append(rule.Provenance.OverriddenBy, source)
+	return nil
+}
+
+// define adds a locally declared rule, replacing an imported rule with the same ID.
+func (m *merger) define(rule Rule) {
+	if i, ok := m.index[rule.ID]; ok {
+		m.rules[i] = rule
+		return
+	}
+	m.index[rule.ID] = len(m.rules)
+	m.rules = append(m.rules, rule)
+}
+
+// inheritMetadata fills descriptive fields the child policy leaves empty.
+func inheritMetadata(child, parent *Policy) {
+	if child.Version == "" {
+		child.Version = parent.Version
+	}
+	if child.Description == "" {
+		child.Description = parent.Description
+	}
+	if child.Author == "" {
+		child.Author = parent.Author
+	}
+}
+
+// resolvePath interprets ref relative to the directory of the importing file.
+func resolvePath(base, ref string) string {
+	if filepath.IsAbs(ref) {
+		return ref
+	}
+	return filepath.Join(base, ref)
+}
+
+// expandInclude returns the policy files referenced by an include entry. A
+// directory contributes every .yaml and .yml file directly inside it, in name
+// order, excluding the including file itself and policy test fixtures
+// (*_test.yaml).
+func expandInclude(path, self string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	selfKey, _ := filepath.Abs(self)
+	var out []string
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if e.IsDir() || (ext != ".yaml" && ext != ".yml") || strings.HasSuffix(strings.TrimSuffix(e.Name(), ext), "_test") {
+			continue
+		}
+		file := filepath.Join(path, e.Name())
+		if key, _ := filepath.Abs(file); key == selfKey {
+			continue
+		}
+		out = append(out, file)
+	}
+	return out, nil
+}
+
 // validate checks the structural integrity of a parsed Policy.
-func (l *Loader) validate(p *Policy) error {
+func validate(p *Policy) error {
 	if p.Name == "" {
 		return fmt.Errorf("policy name is required")
 	}
@@ -53,6 +313,21 @@ func (l *Loader) validate(p *Policy) error {
 		if !r.Severity.IsValid() {
 			return fmt.Errorf("rule %q has invalid severity %q", r.ID, r.Severity)
 		}
+		if err := validateApplicability(r.AppliesTo); err != nil {
+			return fmt.Errorf("rule %q applies_to: %w", r.ID, err)
+		}
+	}
+	if err := validateApplicability(p.AppliesTo); err != nil {
+		return fmt.Errorf("policy applies_to: %w", err)
 	}
 	return nil
 }
+
+// validateApplicability checks that an applicability version constraint parses.
+func validateApplicability(a *Applicability) error {
+	if a == nil || a.Version == "" {
+		return nil
+	}
+	_, err := util.ParseVersionConstraint(a.Version)
+	return err
+}
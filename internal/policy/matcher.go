@@ -4,12 +4,15 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/0xdevren/netsentry/internal/model"
+	"github.com/0xdevren/netsentry/internal/policy/query"
 )
 
 // Matcher evaluates a MatchSpec against a ConfigModel.
 type Matcher struct {
+	mu sync.RWMutex
 	// cache maps compiled regular expressions keyed on the pattern string.
 	cache map[string]*regexp.Regexp
 }
@@ -20,75 +23,291 @@ func NewMatcher() *Matcher {
 }
 
 // Match evaluates the provided MatchSpec against the given ConfigModel and
-// returns true when the match condition is satisfied.
+// returns true when the match condition is satisfied. Every populated
+// condition in the spec must pass; nested all_of, any_of and none_of lists
+// are evaluated recursively. The Within scope is not applied here; callers
+// select blocks with ScopeBlocks and match each one.
 func (m *Matcher) Match(spec MatchSpec, cfg *model.ConfigModel) (bool, error) {
-	switch {
-	case spec.Contains != "":
-		return m.matchContains(spec.Contains, cfg), nil
-	case spec.NotContains != "":
-		return m.matchNotContains(spec.NotContains, cfg), nil
-	case spec.Regex != "":
-		return m.matchRegex(spec.Regex, cfg)
-	case spec.RequiredBlock != "":
-		return m.matchRequiredBlock(spec.RequiredBlock, cfg), nil
-	default:
+	return m.match(spec, cfg, nil)
+}
+
+// MatchEvidence evaluates spec like Match and also returns the configuration
+// lines behind the result: when the spec matches, the lines found by its
+// contains, regex and required_block conditions; when it does not, only the
+// lines of the condition that failed, such as those violating not_contains.
+// A missing required line leaves no evidence. Block paths are not
+// populated; see ConfigModel.BlockPath.
+func (m *Matcher) MatchEvidence(spec MatchSpec, cfg *model.ConfigModel) (bool, []Evidence, error) {
+	ev := &evidence{cfg: cfg, seen: make(map[int]bool)}
+	ok, err := m.match(spec, cfg, ev)
+	return ok, ev.items, err
+}
+
+// maxEvidence caps the number of evidence lines recorded per evaluation.
+const maxEvidence = 20
+
+// evidence accumulates the configuration lines hit while evaluating a spec.
+// A nil *evidence records nothing.
+type evidence struct {
+	cfg   *model.ConfigModel
+	seen  map[int]bool
+	lines []int
+	items []Evidence
+}
+
+// add records cfg.Lines[i].
+func (ev *evidence) add(i int) {
+	if ev == nil || ev.seen[i] || len(ev.items) >= maxEvidence {
+		return
+	}
+	ev.seen[i] = true
+	ev.lines = append(ev.lines, i)
+	ev.items = append(ev.items, Evidence{Line: ev.cfg.LineNumber(i), Text: strings.TrimSpace(ev.cfg.Lines[i])})
+}
+
+// fork returns an empty collector for a condition whose evidence is only
+// kept if the condition decides the result.
+func (ev *evidence) fork() *evidence {
+	if ev == nil {
+		return nil
+	}
+	return &evidence{cfg: ev.cfg, seen: make(map[int]bool)}
+}
+
+// merge records the lines of sub.
+func (ev *evidence) merge(sub *evidence) {
+	if ev == nil {
+		return
+	}
+	for _, i := range sub.lines {
+		ev.add(i)
+	}
+}
+
+// condition evaluates one condition of a spec, recording its lines in ev.
+type condition func(ev *evidence) (bool, error)
+
+// conditions returns the populated conditions of spec in evaluation order.
+func (m *Matcher) conditions(spec MatchSpec, cfg *model.ConfigModel) []condition {
+	var conds []condition
+	if spec.Contains != "" {
+		conds = append(conds, func(ev *evidence) (bool, error) { return m.matchContains(spec.Contains, cfg, ev), nil })
+	}
+	if spec.NotContains != "" {
+		conds = append(conds, func(ev *evidence) (bool, error) { return m.matchNotContains(spec.NotContains, cfg, ev), nil })
+	}
+	if spec.Regex != "" {
+		conds = append(conds, func(ev *evidence) (bool, error) { return m.matchRegex(spec.Regex, cfg, ev) })
+	}
+	if spec.RequiredBlock != "" {
+		conds = append(conds, func(ev *evidence) (bool, error) { return m.matchRequiredBlock(spec.RequiredBlock, cfg, ev), nil })
+	}
+	if spec.Query != "" {
+		conds = append(conds, func(*evidence) (bool, error) { return m.matchQuery(spec, cfg) })
+	}
+	if len(spec.AllOf) > 0 {
+		conds = append(conds, func(ev *evidence) (bool, error) { return m.matchAllOf(spec.AllOf, cfg, ev) })
+	}
+	if len(spec.AnyOf) > 0 {
+		conds = append(conds, func(ev *evidence) (bool, error) { return m.matchAnyOf(spec.AnyOf, cfg, ev) })
+	}
+	if len(spec.NoneOf) > 0 {
+		conds = append(conds, func(ev *evidence) (bool, error) {
+			ok, err := m.matchAnyOf(spec.NoneOf, cfg, ev)
+			return !ok && err == nil, err
+		})
+	}
+	return conds
+}
+
+func (m *Matcher) match(spec MatchSpec, cfg *model.ConfigModel, ev *evidence) (bool, error) {
+	if !spec.HasCondition() {
 		return false, fmt.Errorf("matcher: MatchSpec has no defined condition")
 	}
+	return all(m.conditions(spec, cfg), ev)
 }
 
-// matchContains returns true if any configuration line contains the substring.
-func (m *Matcher) matchContains(text string, cfg *model.ConfigModel) bool {
-	for _, line := range cfg.Lines {
-		if strings.Contains(line, text) {
-			return true
+// all reports whether every condition holds, stopping at the first that
+// does not. Only the evidence of the condition that failed is kept, or of
+// every condition when all hold.
+func all(conds []condition, ev *evidence) (bool, error) {
+	var held []*evidence
+	for _, cond := range conds {
+		sub := ev.fork()
+		ok, err := cond(sub)
+		if err != nil {
+			return false, err
 		}
+		if !ok {
+			ev.merge(sub)
+			return false, nil
+		}
+		held = append(held, sub)
+	}
+	for _, sub := range held {
+		ev.merge(sub)
 	}
-	return false
+	return true, nil
 }
 
-// matchNotContains returns true if no configuration line contains the substring.
-func (m *Matcher) matchNotContains(text string, cfg *model.ConfigModel) bool {
-	for _, line := range cfg.Lines {
-		if strings.Contains(line, text) {
-			return false
+// matchAllOf returns true if every nested spec matches.
+func (m *Matcher) matchAllOf(specs []MatchSpec, cfg *model.ConfigModel, ev *evidence) (bool, error) {
+	conds := make([]condition, len(specs))
+	for i, sub := range specs {
+		sub := sub
+		conds[i] = func(ev *evidence) (bool, error) { return m.matchNested(sub, cfg, ev) }
+	}
+	return all(conds, ev)
+}
+
+// matchAnyOf returns true if at least one nested spec matches. Only the
+// evidence of the first spec that matches is kept, or of every spec when
+// none does.
+func (m *Matcher) matchAnyOf(specs []MatchSpec, cfg *model.ConfigModel, ev *evidence) (bool, error) {
+	var failed []*evidence
+	for _, spec := range specs {
+		sub := ev.fork()
+		ok, err := m.matchNested(spec, cfg, sub)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			ev.merge(sub)
+			return true, nil
 		}
+		failed = append(failed, sub)
 	}
-	return true
+	for _, sub := range failed {
+		ev.merge(sub)
+	}
+	return false, nil
+}
+
+// matchNested evaluates a spec nested inside a boolean combinator. Block
+// scoping is only meaningful at the top level of a rule, so nested specs
+// carrying a Within selector are rejected.
+func (m *Matcher) matchNested(spec MatchSpec, cfg *model.ConfigModel, ev *evidence) (bool, error) {
+	if spec.IsScoped() {
+		return false, fmt.Errorf("matcher: within is only supported at the top level of a match block")
+	}
+	return m.match(spec, cfg, ev)
+}
+
+// matchLines reports whether any configuration line satisfies hit, recording
+// every such line in ev. Without an evidence collector it stops at the first hit.
+func matchLines(cfg *model.ConfigModel, ev *evidence, hit func(line string) bool) bool {
+	found := false
+	for i, line := range cfg.Lines {
+		if !hit(line) {
+			continue
+		}
+		if ev == nil {
+			return true
+		}
+		found = true
+		ev.add(i)
+	}
+	return found
+}
+
+// matchContains returns true if any configuration line contains the substring.
+func (m *Matcher) matchContains(text string, cfg *model.ConfigModel, ev *evidence) bool {
+	return matchLines(cfg, ev, func(line string) bool { return strings.Contains(line, text) })
+}
+
+// matchNotContains returns true if no configuration line contains the substring.
+// The offending lines are recorded as evidence.
+func (m *Matcher) matchNotContains(text string, cfg *model.ConfigModel, ev *evidence) bool {
+	return !matchLines(cfg, ev, func(line string) bool { return strings.Contains(line, text) })
 }
 
 // matchRegex returns true if any configuration line matches the regular expression.
-func (m *Matcher) matchRegex(pattern string, cfg *model.ConfigModel) (bool, error) {
+func (m *Matcher) matchRegex(pattern string, cfg *model.ConfigModel, ev *evidence) (bool, error) {
 	re, err := m.compileRegex(pattern)
 	if err != nil {
 		return false, err
 	}
-	for _, line := range cfg.Lines {
-		if re.MatchString(line) {
-			return true, nil
+	return matchLines(cfg, ev, re.MatchString), nil
+}
+
+// matchRequiredBlock returns true if any configuration line begins with the block prefix.
+func (m *Matcher) matchRequiredBlock(prefix string, cfg *model.ConfigModel, ev *evidence) bool {
+	return matchLines(cfg, ev, func(line string) bool { return strings.HasPrefix(line, prefix) })
+}
+
+// ScopeBlocks returns the configuration blocks whose header matches the
+// spec's Within pattern.
+func (m *Matcher) ScopeBlocks(spec MatchSpec, cfg *model.ConfigModel) ([]model.ConfigBlock, error) {
+	re, err := m.compileRegex(spec.Within)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.FindBlocks(re.MatchString), nil
+}
+
+// QueryElements returns the structured model elements selected by the spec's
+// Query path.
+func (m *Matcher) QueryElements(spec MatchSpec, cfg *model.ConfigModel) ([]query.Element, error) {
+	path, err := query.ParsePath(spec.Query)
+	if err != nil {
+		return nil, fmt.Errorf("matcher: %w", err)
+	}
+	doc, err := query.Document(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("matcher: %w", err)
+	}
+	return path.Select(doc), nil
+}
+
+// MatchElement returns true if the element satisfies every assertion in the
+// spec's Assert list.
+func (m *Matcher) MatchElement(spec MatchSpec, el query.Element) (bool, error) {
+	for _, expr := range spec.Assert {
+		a, err := query.ParseAssertion(expr)
+		if err != nil {
+			return false, fmt.Errorf("matcher: %w", err)
+		}
+		ok, err := a.Eval(el.Value)
+		if err != nil {
+			return false, fmt.Errorf("matcher: %s: %w", el.Label, err)
+		}
+		if !ok {
+			return false, nil
 		}
 	}
-	return false, nil
+	return true, nil
 }
 
-// matchRequiredBlock returns true if any configuration line begins with the block prefix.
-func (m *Matcher) matchRequiredBlock(prefix string, cfg *model.ConfigModel) bool {
-	for _, line := range cfg.Lines {
-		if len(line) >= len(prefix) && line[:len(prefix)] == prefix {
-			return true
+// matchQuery returns true if every element selected by the query satisfies
+// the assertions. A query selecting nothing is vacuously satisfied.
+func (m *Matcher) matchQuery(spec MatchSpec, cfg *model.ConfigModel) (bool, error) {
+	elements, err := m.QueryElements(spec, cfg)
+	if err != nil {
+		return false, err
+	}
+	for _, el := range elements {
+		ok, err := m.MatchElement(spec, el)
+		if err != nil || !ok {
+			return false, err
 		}
 	}
-	return false
+	return true, nil
 }
 
 // compileRegex returns a compiled regex from cache, compiling and caching it on first use.
 func (m *Matcher) compileRegex(pattern string) (*regexp.Regexp, error) {
-	if re, ok := m.cache[pattern]; ok {
+	m.mu.RLock()
+	re, ok := m.cache[pattern]
+	m.mu.RUnlock()
+	if ok {
 		return re, nil
 	}
 	re, err := regexp.Compile(pattern)
 	if err != nil {
 		return nil, fmt.Errorf("matcher: invalid regex %q: %w", pattern, err)
 	}
+	m.mu.Lock()
 	m.cache[pattern] = re
+	m.mu.Unlock()
 	return re, nil
 }
@@ -0,0 +1,117 @@
+package policy
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// LoadPaths loads every policy named by paths. A directory contributes each
+// policy file directly inside it, in name order, skipping test fixtures.
+func (l *Loader) LoadPaths(paths []string) ([]*Policy, error) {
+	var policies []*Policy
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("policy loader: %w", err)
+		}
+		files := []string{path}
+		if info.IsDir() {
+			if files, err = expandInclude(path, ""); err != nil {
+				return nil, fmt.Errorf("policy loader: %w", err)
+			}
+			if len(files) == 0 {
+				return nil, fmt.Errorf("policy loader: no policy files in %q", path)
+			}
+		}
+		for _, file := range files {
+			p, err := l.LoadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			policies = append(policies, p)
+		}
+	}
+	return policies, nil
+}
+
+// Merge combines several policies into one so that they are evaluated in a
+// single engine pass. Each rule keeps its policy's default applicability and
+// records the policy name in its provenance.
+//
+// A rule reached unchanged through more than one policy from the same
+// defining file, for example a baseline that another policy extends, is
+// evaluated once under the first policy. A rule that a policy's overrides
+// modified is kept under that policy. Rules that share an ID but differ in
+// origin are namespaced as "<policy>/<rule-id>". The variables of the first policy that
+// has any are used for all rules.
+func Merge(policies ...*Policy) (*Policy, error) {
+	switch len(policies) {
+	case 0:
+		return nil, fmt.Errorf("policy merge: no policies")
+	case 1:
+		return policies[0], nil
+	}
+
+	sources := make(map[string]map[string]bool)
+	for _, p := range policies {
+		for _, r := range p.Rules {
+			if sources[r.ID] == nil {
+				sources[r.ID] = make(map[string]bool)
+			}
+			sources[r.ID][ruleOrigin(p, r)] = true
+		}
+	}
+
+	merged := &Policy{}
+	names := make([]string, 0, len(policies))
+	seen := make(map[string]bool)
+	ids := make(map[string]string)
+	for _, p := range policies {
+		names = append(names, p.Name)
+		if merged.Variables == nil {
+			merged.Variables = p.Variables
+		}
+		for _, r := range p.Rules {
+			origin := ruleOrigin(p, r)
+			if seen[origin+"\x00"+r.ID] {
+				continue
+			}
+			seen[origin+"\x00"+r.ID] = true
+
+			if r.AppliesTo == nil {
+				r.AppliesTo = p.AppliesTo
+			}
+			prov := Provenance{}
+			if r.Provenance != nil {
+				prov = *r.Provenance
+			}
+			prov.Policy = p.Name
+			r.Provenance = &prov
+			if len(sources[r.ID]) > 1 {
+				r.ID = p.Name + "/" + r.ID
+			}
+			if other, dup := ids[r.ID]; dup {
+				return nil, fmt.Errorf("policy merge: rule %q is defined by both %s and %s", r.ID, other, p.Name)
+			}
+			ids[r.ID] = p.Name
+			merged.Rules = append(merged.Rules, r)
+		}
+	}
+	merged.Name = strings.Join(names, ", ")
+	return merged, nil
+}
+
+// ruleOrigin identifies the file that defines r, falling back to the policy
+// name for rules without provenance. Rules modified by overrides are
+// identified by the policy they are reached through and the files that
+// overrode them, so that they are never taken for the unmodified rule.
+func ruleOrigin(p *Policy, r Rule) string {
+	if r.Provenance == nil || r.Provenance.Source == "" || r.Provenance.Source == "<inline>" {
+		return "policy:" + p.Name
+	}
+	if len(r.Provenance.OverriddenBy) > 0 {
+		return "policy:" + p.Name + "\x00" + r.Provenance.Source + "\x00" + strings.Join(r.Provenance.OverriddenBy, "\x00")
+	}
+	return r.Provenance.Source
+}
@@ -0,0 +1,269 @@
+// Package policytest runs policy test fixtures: configuration snippets paired
+// with the status each rule is expected to produce. Fixtures live next to the
+// policies they exercise in files named *_test.yaml.
+//
+//	policy: baseline.yaml
+//	tests:
+//	  - name: telnet on vty lines is rejected
+//	    device:
+//	      type: cisco-ios
+//	    config: |
+//	      line vty 0 4
+//	       transport input telnet
+//	    expect:
+//	      SEC-DISABLE-TELNET: FAIL
+package policytest
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/0xdevren/netsentry/internal/config"
+	"github.com/0xdevren/netsentry/internal/model"
+	"github.com/0xdevren/netsentry/internal/parser"
+	"github.com/0xdevren/netsentry/internal/policy"
+	"github.com/0xdevren/netsentry/internal/policy/vars"
+	"gopkg.in/yaml.v3"
+)
+
+// Suite is a fixture file: a policy and the cases run against it.
+type Suite struct {
+	// Policy is the policy file under test, relative to the fixture file.
+	Policy string `yaml:"policy"`
+	// Vars is an optional variables file, relative to the fixture file.
+	Vars string `yaml:"vars,omitempty"`
+	// Tests are the cases in the suite.
+	Tests []Case `yaml:"tests"`
+
+	// Path is the fixture file the suite was loaded from.
+	Path string `yaml:"-"`
+}
+
+// Case is a single configuration and the statuses it must produce.
+type Case struct {
+	// Name describes the case.
+	Name string `yaml:"name"`
+	// Device supplies the metadata used by applies_to and template variables.
+	// When Device.Type is empty it is detected from the configuration.
+	Device model.Device `yaml:"device,omitempty"`
+	// Config is an inline configuration snippet.
+	Config string `yaml:"config,omitempty"`
+	// ConfigFile is a configuration file, relative to the fixture file, used
+	// when Config is empty.
+	ConfigFile string `yaml:"config_file,omitempty"`
+	// Expect maps rule IDs to their expected status. Rules not listed are not
+	// checked.
+	Expect map[string]policy.ValidationStatus `yaml:"expect"`
+}
+
+// IsFixture reports whether name follows the fixture naming convention.
+func IsFixture(name string) bool {
+	return strings.HasSuffix(name, "_test.yaml") || strings.HasSuffix(name, "_test.yml")
+}
+
+// Discover returns the fixture files at path in lexical order. A file is
+// returned as is; a directory is searched recursively.
+func Discover(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("policytest: %w", err)
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	var files []string
+	err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && IsFixture(d.Name()) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("policytest: walk %q: %w", path, err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// LoadSuite reads and checks the fixture file at path.
+func LoadSuite(path string) (*Suite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("policytest: read file %q: %w", path, err)
+	}
+	var s Suite
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("policytest: %s: yaml unmarshal: %w", path, err)
+	}
+	s.Path = path
+	if s.Policy == "" {
+		return nil, fmt.Errorf("policytest: %s: policy is required", path)
+	}
+	if len(s.Tests) == 0 {
+		return nil, fmt.Errorf("policytest: %s: no tests defined", path)
+	}
+	for i, c := range s.Tests {
+		switch {
+		case c.Name == "":
+			return nil, fmt.Errorf("policytest: %s: test %d has no name", path, i)
+		case c.Config == "" && c.ConfigFile == "":
+			return nil, fmt.Errorf("policytest: %s: test %q needs config or config_file", path, c.Name)
+		case len(c.Expect) == 0:
+			return nil, fmt.Errorf("policytest: %s: test %q has no expectations", path, c.Name)
+		}
+		for id, status := range c.Expect {
+			status = policy.ValidationStatus(strings.ToUpper(string(status)))
+			if _, ok := statusRank[status]; !ok {
+				return nil, fmt.Errorf("policytest: %s: test %q: invalid status %q for rule %s", path, c.Name, c.Expect[id], id)
+			}
+			c.Expect[id] = status
+		}
+	}
+	return &s, nil
+}
+
+// resolve interprets ref relative to the suite's fixture file.
+func (s *Suite) resolve(ref string) string {
+	if filepath.IsAbs(ref) {
+		return ref
+	}
+	return filepath.Join(filepath.Dir(s.Path), ref)
+}
+
+// Mismatch is a rule whose status differs from the expectation.
+type Mismatch struct {
+	RuleID string
+	Want   policy.ValidationStatus
+	// Got is empty when the policy has no rule with RuleID.
+	Got policy.ValidationStatus
+	// Message is the message of the result that determined Got.
+	Message string
+}
+
+// String formats the mismatch as a diff line.
+func (m Mismatch) String() string {
+	if m.Got == "" {
+		return fmt.Sprintf("%s: want %s, rule not found in policy", m.RuleID, m.Want)
+	}
+	return fmt.Sprintf("%s: want %s, got %s (%s)", m.RuleID, m.Want, m.Got, m.Message)
+}
+
+// CaseResult is the outcome of running one case.
+type CaseResult struct {
+	Suite string
+	Name  string
+	// Mismatches lists every rule whose status differed from the expectation.
+	Mismatches []Mismatch
+	// Err is set when the case could not be run.
+	Err error
+}
+
+// Passed reports whether the case ran and met every expectation.
+func (r CaseResult) Passed() bool {
+	return r.Err == nil && len(r.Mismatches) == 0
+}
+
+// Runner executes suites through a policy engine.
+type Runner struct {
+	engine *policy.Engine
+	loader *policy.Loader
+}
+
+// NewRunner constructs a Runner.
+func NewRunner() *Runner {
+	return &Runner{
+		engine: policy.NewEngine(policy.EngineOptions{}),
+		loader: policy.NewLoader(),
+	}
+}
+
+// Run executes every case in the suite. A suite whose policy or variables
+// cannot be loaded yields one failed result per case.
+func (r *Runner) Run(ctx context.Context, s *Suite) []CaseResult {
+	pol, err := r.loader.LoadFile(s.resolve(s.Policy))
+	if err == nil && s.Vars != "" {
+		pol.Variables, err = vars.LoadFile(s.resolve(s.Vars))
+	}
+	results := make([]CaseResult, 0, len(s.Tests))
+	for _, c := range s.Tests {
+		res := CaseResult{Suite: s.Path, Name: c.Name, Err: err}
+		if err == nil {
+			res.Mismatches, res.Err = r.runCase(ctx, s, pol, c)
+		}
+		results = append(results, res)
+	}
+	return results
+}
+
+func (r *Runner) runCase(ctx context.Context, s *Suite, pol *policy.Policy, c Case) ([]Mismatch, error) {
+	data := []byte(c.Config)
+	if c.Config == "" {
+		var err error
+		if data, err = os.ReadFile(s.resolve(c.ConfigFile)); err != nil {
+			return nil, fmt.Errorf("read config: %w", err)
+		}
+	}
+	device := c.Device
+	if device.ID == "" {
+		device.ID = c.Name
+	}
+	if device.Type == "" {
+		device.Type = config.NewDetector().Detect(data)
+	}
+	cfg, err := parser.Parse(ctx, device.Type, data, device)
+	if err != nil {
+		return nil, err
+	}
+	results, err := r.engine.Run(ctx, pol, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return Compare(c.Expect, results), nil
+}
+
+// statusRank orders statuses so that a rule producing several results, such
+// as a block-scoped rule, is judged by its most significant one.
+var statusRank = map[policy.ValidationStatus]int{
+	policy.StatusSkip:   0,
+	policy.StatusPass:   1,
+	policy.StatusWaived: 2,
+	policy.StatusWarn:   3,
+	policy.StatusFail:   4,
+	policy.StatusError:  5,
+}
+
+// Compare checks results against the expected status of each rule and
+// returns the mismatches in rule ID order.
+func Compare(expect map[string]policy.ValidationStatus, results []policy.ValidationResult) []Mismatch {
+	got := make(map[string]policy.ValidationResult, len(results))
+	for _, res := range results {
+		cur, ok := got[res.RuleID]
+		if !ok || statusRank[res.Status] > statusRank[cur.Status] {
+			got[res.RuleID] = res
+		}
+	}
+	ids := make([]string, 0, len(expect))
+	for id := range expect {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var mismatches []Mismatch
+	for _, id := range ids {
+		want := expect[id]
+		res, ok := got[id]
+		if ok && res.Status == want {
+			continue
+		}
+		mismatches = append(mismatches, Mismatch{RuleID: id, Want: want, Got: res.Status, Message: res.Message})
+	}
+	return mismatches
+}
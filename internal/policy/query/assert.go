@@ -0,0 +1,238 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Operator is a comparison applied by an Assertion.
+type Operator string
+
+const (
+	OpEqual        Operator = "=="
+	OpNotEqual     Operator = "!="
+	OpGreater      Operator = ">"
+	OpGreaterEqual Operator = ">="
+	OpLess         Operator = "<"
+	OpLessEqual    Operator = "<="
+	// OpExists passes when the field is present and not a zero value.
+	OpExists Operator = "exists"
+	// OpMissing passes when the field is absent or a zero value.
+	OpMissing Operator = "missing"
+	// OpMatches passes when the field's string form matches a regular expression.
+	OpMatches Operator = "matches"
+	// OpContains passes when a list field holds the value or a string field
+	// contains it as a substring.
+	OpContains Operator = "contains"
+)
+
+// unaryOps take no operand.
+var unaryOps = map[Operator]bool{OpExists: true, OpMissing: true}
+
+// binaryOps take a single literal operand.
+var binaryOps = map[Operator]bool{
+	OpEqual: true, OpNotEqual: true,
+	OpGreater: true, OpGreaterEqual: true, OpLess: true, OpLessEqual: true,
+	OpMatches: true, OpContains: true,
+}
+
+// Assertion is a compiled "<field> <op> [value]" expression evaluated against
+// a selected element. A field of "." refers to the element itself.
+type Assertion struct {
+	expr  string
+	field string
+	op    Operator
+	value interface{}
+	re    *regexp.Regexp
+}
+
+// ParseAssertion compiles an assertion expression such as
+// `password != ""`, `route_map_in exists` or `mtu >= 9000`.
+func ParseAssertion(expr string) (*Assertion, error) {
+	field, rest := cutSpace(strings.TrimSpace(expr))
+	if field == "" {
+		return nil, fmt.Errorf("query: empty assertion")
+	}
+	opStr, operand := cutSpace(rest)
+	op := Operator(opStr)
+	if opStr == "not" && operand == string(OpExists) {
+		op, operand = OpMissing, ""
+	}
+
+	a := &Assertion{expr: expr, field: field, op: op}
+	switch {
+	case unaryOps[op]:
+		if operand != "" {
+			return nil, fmt.Errorf("query: assertion %q: %s takes no value", expr, op)
+		}
+	case binaryOps[op]:
+		if operand == "" {
+			return nil, fmt.Errorf("query: assertion %q: %s requires a value", expr, op)
+		}
+		v, err := parseLiteral(operand)
+		if err != nil {
+			return nil, fmt.Errorf("query: assertion %q: %w", expr, err)
+		}
+		a.value = v
+		if op == OpMatches {
+			re, err := regexp.Compile(fmt.Sprint(v))
+			if err != nil {
+				return nil, fmt.Errorf("query: assertion %q: invalid regex: %w", expr, err)
+			}
+			a.re = re
+		}
+	case opStr == "":
+		return nil, fmt.Errorf("query: assertion %q: missing operator", expr)
+	default:
+		return nil, fmt.Errorf("query: assertion %q: unsupported operator %q", expr, opStr)
+	}
+	return a, nil
+}
+
+// String returns the source expression of the assertion.
+func (a *Assertion) String() string { return a.expr }
+
+// Eval applies the assertion to element and reports whether it holds.
+func (a *Assertion) Eval(element interface{}) (bool, error) {
+	actual := element
+	if a.field != "." {
+		actual = Lookup(element, a.field)
+	}
+
+	switch a.op {
+	case OpExists:
+		return !isZero(actual), nil
+	case OpMissing:
+		return isZero(actual), nil
+	case OpEqual:
+		return equal(actual, a.value), nil
+	case OpNotEqual:
+		return !equal(actual, a.value), nil
+	case OpMatches:
+		if actual == nil {
+			return false, nil
+		}
+		return a.re.MatchString(fmt.Sprint(actual)), nil
+	case OpContains:
+		switch c := actual.(type) {
+		case []interface{}:
+			for _, item := range c {
+				if equal(item, a.value) {
+					return true, nil
+				}
+			}
+			return false, nil
+		case string:
+			return strings.Contains(c, fmt.Sprint(a.value)), nil
+		default:
+			return false, nil
+		}
+	}
+
+	left, err := toFloat(actual)
+	if err != nil {
+		return false, fmt.Errorf("query: assertion %q: field %q: %w", a.expr, a.field, err)
+	}
+	right, err := toFloat(a.value)
+	if err != nil {
+		return false, fmt.Errorf("query: assertion %q: value: %w", a.expr, err)
+	}
+	switch a.op {
+	case OpGreater:
+		return left > right, nil
+	case OpGreaterEqual:
+		return left >= right, nil
+	case OpLess:
+		return left < right, nil
+	default:
+		return left <= right, nil
+	}
+}
+
+// cutSpace splits s at the first run of whitespace.
+func cutSpace(s string) (head, tail string) {
+	i := strings.IndexAny(s, " \t")
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], strings.TrimSpace(s[i:])
+}
+
+// parseLiteral decodes a quoted string, boolean, number or bare word.
+func parseLiteral(s string) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quoted string %s", s)
+		}
+		return v, nil
+	case len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'':
+		return s[1 : len(s)-1], nil
+	case s == "true" || s == "false":
+		return s == "true", nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f, nil
+	}
+	return s, nil
+}
+
+// isZero reports whether v is absent or the zero value of its JSON type.
+func isZero(v interface{}) bool {
+	switch c := v.(type) {
+	case nil:
+		return true
+	case string:
+		return c == ""
+	case float64:
+		return c == 0
+	case bool:
+		return !c
+	case []interface{}:
+		return len(c) == 0
+	case map[string]interface{}:
+		return len(c) == 0
+	default:
+		return false
+	}
+}
+
+// equal compares a model value with a literal. Absent values equal the zero
+// value of the literal's type so that omitted fields compare as empty.
+func equal(actual, literal interface{}) bool {
+	if actual == nil {
+		return isZero(literal)
+	}
+	switch lit := literal.(type) {
+	case float64:
+		f, err := toFloat(actual)
+		return err == nil && f == lit
+	case bool:
+		b, ok := actual.(bool)
+		return ok && b == lit
+	default:
+		return fmt.Sprint(actual) == fmt.Sprint(lit)
+	}
+}
+
+// toFloat converts a numeric or numeric-string value to float64. Absent
+// values are treated as zero.
+func toFloat(v interface{}) (float64, error) {
+	switch c := v.(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		return c, nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(c), 64)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not numeric", c)
+		}
+		return f, nil
+	default:
+		return 0, fmt.Errorf("%v is not numeric", v)
+	}
+}
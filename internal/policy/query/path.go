@@ -0,0 +1,198 @@
+// Package query implements the path and assertion language used by policy
+// rules to inspect the structured fields of a ConfigModel rather than its
+// raw text.
+//
+// A path is a dot-separated list of field names, as they appear in the JSON
+// form of the model, each optionally followed by an index: "[*]" selects
+// every element of a list or map and "[n]" selects a single list element.
+//
+//	bgp.neighbors[*]
+//	acls[*].entries[*]
+//	interfaces[0]
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/0xdevren/netsentry/internal/model"
+)
+
+// segment is a single step of a path expression.
+type segment struct {
+	field    string
+	wildcard bool
+	index    int
+}
+
+// Path is a compiled path expression.
+type Path struct {
+	expr     string
+	segments []segment
+}
+
+// Element is a single value selected by a Path.
+type Element struct {
+	// Label identifies the element for reporting, e.g. "bgp.neighbors[1] (address=10.0.0.2)".
+	Label string
+	// Value is the generic JSON-decoded value of the element.
+	Value interface{}
+}
+
+// ParsePath compiles a path expression.
+func ParsePath(expr string) (*Path, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return nil, fmt.Errorf("query: empty path")
+	}
+	p := &Path{expr: expr}
+	for _, part := range strings.Split(expr, ".") {
+		seg := segment{index: -1}
+		if open := strings.IndexByte(part, '['); open >= 0 {
+			if !strings.HasSuffix(part, "]") {
+				return nil, fmt.Errorf("query: path %q: unterminated index in %q", expr, part)
+			}
+			idx := part[open+1 : len(part)-1]
+			part = part[:open]
+			if idx == "*" {
+				seg.wildcard = true
+			} else {
+				n, err := strconv.Atoi(idx)
+				if err != nil || n < 0 {
+					return nil, fmt.Errorf("query: path %q: invalid index %q", expr, idx)
+				}
+				seg.index = n
+			}
+		}
+		if part == "" {
+			return nil, fmt.Errorf("query: path %q: empty field name", expr)
+		}
+		seg.field = part
+		p.segments = append(p.segments, seg)
+	}
+	return p, nil
+}
+
+// String returns the source expression of the path.
+func (p *Path) String() string { return p.expr }
+
+// Select walks the path from root and returns every element it reaches.
+// Missing fields select nothing.
+func (p *Path) Select(root interface{}) []Element {
+	current := []Element{{Value: root}}
+	for _, seg := range p.segments {
+		var next []Element
+		for _, el := range current {
+			m, ok := el.Value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			v, ok := m[seg.field]
+			if !ok || v == nil {
+				continue
+			}
+			label := joinLabel(el.Label, seg.field)
+			switch {
+			case seg.wildcard:
+				next = append(next, expand(label, v)...)
+			case seg.index >= 0:
+				list, ok := v.([]interface{})
+				if !ok || seg.index >= len(list) {
+					continue
+				}
+				next = append(next, Element{Label: fmt.Sprintf("%s[%d]", label, seg.index), Value: list[seg.index]})
+			default:
+				next = append(next, Element{Label: label, Value: v})
+			}
+		}
+		current = next
+	}
+	for i := range current {
+		current[i].Label = describe(current[i])
+	}
+	return current
+}
+
+// Lookup resolves a dot-separated field path relative to v without indexing.
+// It returns nil when any step is missing.
+func Lookup(v interface{}, field string) interface{} {
+	for _, name := range strings.Split(field, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[name]
+	}
+	return v
+}
+
+// Document converts the structured portion of cfg into the generic form that
+// paths are evaluated against. Raw text, lines and blocks are omitted.
+func Document(cfg *model.ConfigModel) (interface{}, error) {
+	shallow := *cfg
+	shallow.RawText = ""
+	shallow.Lines = nil
+	shallow.Blocks = nil
+	data, err := json.Marshal(shallow)
+	if err != nil {
+		return nil, fmt.Errorf("query: encode config model: %w", err)
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("query: decode config model: %w", err)
+	}
+	return doc, nil
+}
+
+// expand returns the members of a list or map value as individual elements.
+func expand(label string, v interface{}) []Element {
+	switch c := v.(type) {
+	case []interface{}:
+		out := make([]Element, 0, len(c))
+		for i, item := range c {
+			out = append(out, Element{Label: fmt.Sprintf("%s[%d]", label, i), Value: item})
+		}
+		return out
+	case map[string]interface{}:
+		keys := make([]string, 0, len(c))
+		for k := range c {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := make([]Element, 0, len(c))
+		for _, k := range keys {
+			out = append(out, Element{Label: fmt.Sprintf("%s[%s]", label, k), Value: c[k]})
+		}
+		return out
+	default:
+		return nil
+	}
+}
+
+// identityKeys are the fields used, in order of preference, to give a
+// selected element a human-readable identity in result labels.
+var identityKeys = []string{"name", "address", "id", "destination", "prefix"}
+
+// describe appends the element's identity field to its label when present.
+func describe(el Element) string {
+	m, ok := el.Value.(map[string]interface{})
+	if !ok {
+		return el.Label
+	}
+	for _, k := range identityKeys {
+		if v, ok := m[k]; ok && v != nil && v != "" {
+			return fmt.Sprintf("%s (%s=%v)", el.Label, k, v)
+		}
+	}
+	return el.Label
+}
+
+func joinLabel(prefix, field string) string {
+	if prefix == "" {
+		return field
+	}
+	return prefix + "." + field
+}
@@ -0,0 +1,77 @@
+package policy
+
+import (
+	"github.com/0xdevren/netsentry/internal/policy/vars"
+)
+
+// Render returns a copy of the rule with every template variable in its match
+// conditions and remediation resolved against scope.
+func (r Rule) Render(scope vars.Scope) (Rule, error) {
+	match, err := r.Match.render(scope)
+	if err != nil {
+		return r, err
+	}
+	r.Match = match
+	if r.Action.Remediation, err = vars.Render(r.Action.Remediation, scope); err != nil {
+		return r, err
+	}
+	return r, nil
+}
+
+// Render returns a copy of the fix with template variables resolved. Fixes are
+// not rendered with their rule because only the fix for the device's own
+// type is ever used.
+func (f Fix) Render(scope vars.Scope) (Fix, error) {
+	var err error
+	for _, list := range []*[]string{&f.Parents, &f.Lines, &f.Rollback} {
+		if len(*list) == 0 {
+			continue
+		}
+		rendered := make([]string, len(*list))
+		for i, line := range *list {
+			if rendered[i], err = vars.Render(line, scope); err != nil {
+				return f, err
+			}
+		}
+		*list = rendered
+	}
+	return f, nil
+}
+
+// render resolves template variables in every string of the match spec,
+// including nested compositions.
+func (m MatchSpec) render(scope vars.Scope) (MatchSpec, error) {
+	var err error
+	for _, field := range []*string{&m.Contains, &m.NotContains, &m.RequiredBlock, &m.Query} {
+		if *field, err = vars.Render(*field, scope); err != nil {
+			return m, err
+		}
+	}
+	for _, field := range []*string{&m.Regex, &m.Within} {
+		if *field, err = vars.RenderRegexp(*field, scope); err != nil {
+			return m, err
+		}
+	}
+	if len(m.Assert) > 0 {
+		asserts := make([]string, len(m.Assert))
+		for i, a := range m.Assert {
+			if asserts[i], err = vars.Render(a, scope); err != nil {
+				return m, err
+			}
+		}
+		m.Assert = asserts
+	}
+	for _, list := range []*[]MatchSpec{&m.AllOf, &m.AnyOf, &m.NoneOf} {
+		if len(*list) == 0 {
+			continue
+		}
+		rendered := make([]MatchSpec, len(*list))
+		for i, sub := range *list {
+			if rendered[i], err = sub.render(scope); err != nil {
+				return m, err
+			}
+		}
+		*list = rendered
+	}
+	return m, nil
+}
@@ -1,6 +1,12 @@
 package policy
 
-import "github.com/0xdevren/netsentry/internal/model"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/0xdevren/netsentry/internal/model"
+	"github.com/0xdevren/netsentry/internal/policy/vars"
+)
 
 // MatchType enumerates the supported rule matching strategies.
 type MatchType string
@@ -14,9 +20,20 @@ const (
 	MatchRegex MatchType = "regex"
 	// MatchRequiredBlock passes when the configuration contains a required block by prefix.
 	MatchRequiredBlock MatchType = "required_block"
+	// MatchAllOf passes when every nested condition passes.
+	MatchAllOf MatchType = "all_of"
+	// MatchAnyOf passes when at least one nested condition passes.
+	MatchAnyOf MatchType = "any_of"
+	// MatchNoneOf passes when no nested condition passes.
+	MatchNoneOf MatchType = "none_of"
+	// MatchQuery passes when every structured model element selected by a
+	// path expression satisfies every assertion.
+	MatchQuery MatchType = "query"
 )
 
-// MatchSpec defines how a rule evaluates the device configuration.
+// MatchSpec defines how a rule evaluates the device configuration. When more
+// than one condition is set they must all pass, so a spec is an implicit
+// all_of over its populated fields.
 type MatchSpec struct {
 	// Contains is the substring to search for. Used with MatchContains.
 	Contains string `json:"contains,omitempty" yaml:"contains,omitempty"`
@@ -26,6 +43,38 @@ type MatchSpec struct {
 	Regex string `json:"regex,omitempty" yaml:"regex,omitempty"`
 	// RequiredBlock is the configuration block prefix that must be present.
 	RequiredBlock string `json:"required_block,omitempty" yaml:"required_block,omitempty"`
+	// Within is a regular expression selecting parent configuration blocks by
+	// header (e.g. "^interface GigabitEthernet"). When set, the condition is
+	// evaluated separately against the body of every matching block.
+	Within string `json:"within,omitempty" yaml:"within,omitempty"`
+	// AllOf lists nested conditions that must all pass. Used with MatchAllOf.
+	AllOf []MatchSpec `json:"all_of,omitempty" yaml:"all_of,omitempty"`
+	// AnyOf lists nested conditions of which at least one must pass. Used with MatchAnyOf.
+	AnyOf []MatchSpec `json:"any_of,omitempty" yaml:"any_of,omitempty"`
+	// NoneOf lists nested conditions that must all fail. Used with MatchNoneOf.
+	NoneOf []MatchSpec `json:"none_of,omitempty" yaml:"none_of,omitempty"`
+	// Query is a path expression selecting structured model elements
+	// (e.g. "bgp.neighbors[*]"). Used with MatchQuery.
+	Query string `json:"query,omitempty" yaml:"query,omitempty"`
+	// Assert lists the assertions each queried element must satisfy
+	// (e.g. `password != ""`, "route_map_in exists", "mtu >= 9000").
+	Assert []string `json:"assert,omitempty" yaml:"assert,omitempty"`
+}
+
+// HasCondition reports whether the spec defines at least one condition to evaluate.
+func (s MatchSpec) HasCondition() bool {
+	return s.Contains != "" || s.NotContains != "" || s.Regex != "" || s.RequiredBlock != "" ||
+		len(s.AllOf) > 0 || len(s.AnyOf) > 0 || len(s.NoneOf) > 0 || s.Query != ""
+}
+
+// IsQuery reports whether the spec evaluates structured model elements.
+func (s MatchSpec) IsQuery() bool {
+	return s.Query != ""
+}
+
+// IsScoped reports whether the spec is evaluated per configuration block.
+func (s MatchSpec) IsScoped() bool {
+	return s.Within != ""
 }
 
 // ActionSpec defines the action to take when a rule matches.
@@ -36,6 +85,21 @@ type ActionSpec struct {
 	Warn bool `json:"warn,omitempty" yaml:"warn,omitempty"`
 	// Remediation provides a suggested corrective action message.
 	Remediation string `json:"remediation,omitempty" yaml:"remediation,omitempty"`
+	// Fix holds the configuration that resolves a violation, per device type.
+	Fix map[model.DeviceType]Fix `json:"fix,omitempty" yaml:"fix,omitempty"`
+}
+
+// Fix is a vendor-specific configuration change that resolves a violation.
+type Fix struct {
+	// Parents is the configuration context the lines are entered under,
+	// outermost first (e.g. ["line vty 0 4"]). When empty on a block-scoped
+	// rule, the offending block is used as the context.
+	Parents []string `json:"parents,omitempty" yaml:"parents,omitempty"`
+	// Lines are the configuration lines to apply.
+	Lines []string `json:"lines" yaml:"lines"`
+	// Rollback are the lines that undo the fix. When empty, they are derived
+	// from Lines where the vendor syntax allows.
+	Rollback []string `json:"rollback,omitempty" yaml:"rollback,omitempty"`
 }
 
 // Rule defines a single compliance rule within a policy.
@@ -54,6 +118,25 @@ type Rule struct {
 	Action ActionSpec `json:"action" yaml:"action"`
 	// Enabled can disable a rule without removing it from the policy file.
 	Enabled *bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	// AppliesTo restricts the rule to matching devices. Rules that do not
+	// apply to a device are reported as SKIP.
+	AppliesTo *Applicability `json:"applies_to,omitempty" yaml:"applies_to,omitempty"`
+	// Provenance records where the rule was defined. It is populated by the
+	// Loader and is not read from policy files.
+	Provenance *Provenance `json:"provenance,omitempty" yaml:"-"`
+}
+
+// Provenance records the policy file a rule was defined in and the files
+// that overrode it through extends or include.
+type Provenance struct {
+	// Source is the policy file that defines the rule.
+	Source string `json:"source"`
+	// Policy is the name of the policy the rule was evaluated under when
+	// several policies are merged into one run.
+	Policy string `json:"policy,omitempty"`
+	// OverriddenBy lists, in application order, the policy files whose
+	// overrides modified the rule.
+	OverriddenBy []string `json:"overridden_by,omitempty"`
 }
 
 // IsEnabled reports whether the rule is active.
@@ -74,8 +157,14 @@ type Policy struct {
 	Description string `json:"description,omitempty" yaml:"description,omitempty"`
 	// Author is the policy author or organisation.
 	Author string `json:"author,omitempty" yaml:"author,omitempty"`
+	// AppliesTo is the default applicability for rules that do not declare
+	// their own.
+	AppliesTo *Applicability `json:"applies_to,omitempty" yaml:"applies_to,omitempty"`
 	// Rules is the ordered list of compliance rules.
 	Rules []Rule `json:"rules" yaml:"rules"`
+	// Variables supplies values for template variables in rules. It is set by
+	// the caller rather than read from the policy file.
+	Variables *vars.File `json:"-" yaml:"-"`
 }
 
 // ValidationStatus represents the outcome of a single rule evaluation.
@@ -88,10 +177,13 @@ const (
 	StatusFail ValidationStatus = "FAIL"
 	// StatusWarn indicates a non-critical finding for the rule.
 	StatusWarn ValidationStatus = "WARN"
-	// StatusSkip indicates the rule was not evaluated (e.g. disabled).
+	// StatusSkip indicates the rule was not evaluated (e.g. disabled or not
+	// applicable to the device).
 	StatusSkip ValidationStatus = "SKIP"
 	// StatusError indicates an internal error occurred during evaluation.
 	StatusError ValidationStatus = "ERROR"
+	// StatusWaived indicates a violation accepted by an active waiver.
+	StatusWaived ValidationStatus = "WAIVED"
 )
 
 // ValidationResult is the outcome of evaluating a single rule against a single device.
@@ -110,6 +202,37 @@ type ValidationResult struct {
 	Message string `json:"message,omitempty" yaml:"message,omitempty"`
 	// Remediation is a suggested corrective action (populated on FAIL/WARN).
 	Remediation string `json:"remediation,omitempty" yaml:"remediation,omitempty"`
+	// Block is the header of the configuration block the result refers to,
+	// for block-scoped rules.
+	Block string `json:"block,omitempty" yaml:"block,omitempty"`
+	// Evidence lists the configuration lines that caused a FAIL or WARN.
+	Evidence []Evidence `json:"evidence,omitempty" yaml:"evidence,omitempty"`
+	// Policy is the name of the policy the rule belongs to, in reports that
+	// combine several policies.
+	Policy string `json:"policy,omitempty" yaml:"policy,omitempty"`
+}
+
+// Evidence is a configuration line that contributed to a result.
+type Evidence struct {
+	// Line is the 1-based source line number, or 0 when unknown.
+	Line int `json:"line,omitempty" yaml:"line,omitempty"`
+	// Text is the configuration line with surrounding whitespace removed.
+	Text string `json:"text" yaml:"text"`
+	// Path holds the headers of the blocks enclosing the line, outermost first.
+	Path []string `json:"path,omitempty" yaml:"path,omitempty"`
+}
+
+// Location formats the evidence position as "line N" followed by its block
+// path, e.g. `line 12 (interface Gi0/1)`.
+func (e Evidence) Location() string {
+	loc := "line ?"
+	if e.Line > 0 {
+		loc = fmt.Sprintf("line %d", e.Line)
+	}
+	if len(e.Path) > 0 {
+		loc += " (" + strings.Join(e.Path, " > ") + ")"
+	}
+	return loc
 }
 
 // Report is the top-level output of a validation run against a device.
@@ -124,6 +247,21 @@ type Report struct {
 	Results []ValidationResult `json:"results" yaml:"results"`
 	// Summary provides aggregate compliance metrics.
 	Summary ReportSummary `json:"summary" yaml:"summary"`
+	// Waivers lists the active waivers covering the device and evaluated rules.
+	Waivers []Waiver `json:"waivers,omitempty" yaml:"waivers,omitempty"`
+	// Policies summarises each policy separately when the report combines
+	// several policies. Summary then covers all of them.
+	Policies []PolicySummary `json:"policies,omitempty" yaml:"policies,omitempty"`
+}
+
+// PolicySummary holds the compliance metrics of one policy in a combined report.
+type PolicySummary struct {
+	// Name is the policy name.
+	Name string `json:"name" yaml:"name"`
+	// Version is the policy version.
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+	// Summary aggregates the results of the policy's rules.
+	Summary ReportSummary `json:"summary" yaml:"summary"`
 }
 
 // ReportSummary aggregates the compliance metrics for a validation report.
@@ -140,6 +278,9 @@ type ReportSummary struct {
 	Skipped int `json:"skipped" yaml:"skipped"`
 	// Errors is the number of rules that encountered an internal error.
 	Errors int `json:"errors" yaml:"errors"`
+	// Waived is the number of violations accepted by an active waiver. Waived
+	// results do not count towards the score.
+	Waived int `json:"waived" yaml:"waived"`
 	// Score is the compliance percentage (0-100).
 	Score float64 `json:"score" yaml:"score"`
 }
@@ -163,6 +304,8 @@ func ComputeSummary(results []ValidationResult) ReportSummary {
 			s.Skipped++
 		case StatusError:
 			s.Errors++
+		case StatusWaived:
+			s.Waived++
 		}
 	}
 	evaluated := s.Passed + s.Failed + s.Warnings
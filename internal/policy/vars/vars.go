@@ -0,0 +1,355 @@
+// Package vars resolves template variables embedded in policy rules so that a
+// single policy can carry per-site and per-device values.
+//
+// A reference has the form {{ .<namespace>.<key> }} where the namespace is one
+// of:
+//
+//	device  built-in device fields (id, hostname, type, management_ip, version,
+//	        site, role) and per-device entries from a variables file
+//	tags    the device's inventory tags
+//	site    the entry for the device's site in a variables file
+//	vars    global values from a variables file
+//
+// Keys may be nested with further dots, e.g. {{ .site.ntp.primary }}.
+package vars
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/0xdevren/netsentry/internal/model"
+	"gopkg.in/yaml.v3"
+)
+
+// Namespace names accepted as the first element of a reference.
+const (
+	NamespaceDevice = "device"
+	NamespaceTags   = "tags"
+	NamespaceSite   = "site"
+	NamespaceVars   = "vars"
+)
+
+// DeviceFields lists the built-in keys of the device namespace.
+var DeviceFields = []string{"id", "hostname", "type", "management_ip", "version", "site", "role"}
+
+// File is a variables file supplying per-site, per-device and global values.
+//
+//	vars:
+//	  syslog_host: 10.0.0.5
+//	sites:
+//	  dc1:
+//	    ntp_server: 10.1.1.1
+//	devices:
+//	  edge-01:
+//	    site: dc1
+//	    loopback: 192.0.2.1
+//
+// Device entries are keyed by device ID or hostname. A "site" key in a device
+// entry selects the site when the device record does not carry one.
+type File struct {
+	Vars    map[string]interface{}            `yaml:"vars"`
+	Sites   map[string]map[string]interface{} `yaml:"sites"`
+	Devices map[string]map[string]interface{} `yaml:"devices"`
+}
+
+// LoadFile reads a variables file from path.
+func LoadFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("vars: read file %q: %w", path, err)
+	}
+	var f File
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("vars: yaml unmarshal %q: %w", path, err)
+	}
+	return &f, nil
+}
+
+// Merge combines variables files, such as a file on disk and the config
+// contexts of an inventory. Entries of later files take precedence key by
+// key. Nil files are skipped; the result is nil when all are.
+func Merge(files ...*File) *File {
+	var out *File
+	for _, f := range files {
+		if f == nil {
+			continue
+		}
+		if out == nil {
+			out = &File{
+				Vars:    make(map[string]interface{}),
+				Sites:   make(map[string]map[string]interface{}),
+				Devices: make(map[string]map[string]interface{}),
+			}
+		}
+		for k, v := range f.Vars {
+			out.Vars[k] = v
+		}
+		mergeEntries(out.Sites, f.Sites)
+		mergeEntries(out.Devices, f.Devices)
+	}
+	return out
+}
+
+func mergeEntries(dst, src map[string]map[string]interface{}) {
+	for name, entry := range src {
+		if dst[name] == nil {
+			dst[name] = make(map[string]interface{}, len(entry))
+		}
+		for k, v := range entry {
+			dst[name][k] = v
+		}
+	}
+}
+
+// Scope is the set of values references are resolved against for one device,
+// keyed by namespace.
+type Scope map[string]map[string]interface{}
+
+// Scope builds the resolution scope for device d. It is safe to call on a nil
+// File, in which case only the device and tags namespaces are populated.
+func (f *File) Scope(d model.Device) Scope {
+	device := make(map[string]interface{})
+	var entry map[string]interface{}
+	if f != nil {
+		entry = f.Devices[d.ID]
+		if entry == nil && d.Hostname != "" {
+			entry = f.Devices[d.Hostname]
+		}
+	}
+	for k, v := range entry {
+		device[k] = v
+	}
+	builtin := map[string]string{
+		"id": d.ID, "hostname": d.Hostname, "type": string(d.Type),
+		"management_ip": d.ManagementIP, "version": d.Version, "site": d.Site, "role": d.Role,
+	}
+	for k, v := range builtin {
+		if v != "" {
+			device[k] = v
+		}
+	}
+
+	tags := make(map[string]interface{}, len(d.Tags))
+	for k, v := range d.Tags {
+		tags[k] = v
+	}
+
+	site := make(map[string]interface{})
+	siteName, _ := device["site"].(string)
+	if f != nil && siteName != "" {
+		for k, v := range f.Sites[siteName] {
+			site[k] = v
+		}
+	}
+	if siteName != "" {
+		if _, ok := site["name"]; !ok {
+			site["name"] = siteName
+		}
+	}
+
+	global := make(map[string]interface{})
+	if f != nil {
+		for k, v := range f.Vars {
+			global[k] = v
+		}
+	}
+
+	return Scope{
+		NamespaceDevice: device,
+		NamespaceTags:   tags,
+		NamespaceSite:   site,
+		NamespaceVars:   global,
+	}
+}
+
+// Reference is a parsed {{ .namespace.key }} reference.
+type Reference struct {
+	// Namespace is the first path element, e.g. "site".
+	Namespace string
+	// Key is the remaining dot-separated path, e.g. "ntp_server".
+	Key string
+}
+
+// String returns the reference in dotted form, e.g. "site.ntp_server".
+func (r Reference) String() string { return r.Namespace + "." + r.Key }
+
+var (
+	placeholderRe = regexp.MustCompile(`\{\{(.*?)\}\}`)
+	referenceRe   = regexp.MustCompile(`^\.([A-Za-z_][A-Za-z0-9_-]*)((?:\.[A-Za-z0-9_-]+)+)$`)
+)
+
+// HasTemplate reports whether s contains a template placeholder.
+func HasTemplate(s string) bool { return strings.Contains(s, "{{") }
+
+// References returns the variables referenced by s in order of appearance.
+func References(s string) ([]Reference, error) {
+	if !HasTemplate(s) {
+		return nil, nil
+	}
+	var refs []Reference
+	for _, m := range placeholderRe.FindAllStringSubmatch(s, -1) {
+		ref, err := parseReference(m[1])
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	if rest := placeholderRe.ReplaceAllString(s, ""); strings.Contains(rest, "{{") || strings.Contains(rest, "}}") {
+		return nil, fmt.Errorf("vars: unbalanced template braces in %q", s)
+	}
+	return refs, nil
+}
+
+func parseReference(inner string) (Reference, error) {
+	inner = strings.TrimSpace(inner)
+	m := referenceRe.FindStringSubmatch(inner)
+	if m == nil {
+		return Reference{}, fmt.Errorf("vars: invalid variable reference %q; expected {{ .namespace.key }}", inner)
+	}
+	ref := Reference{Namespace: m[1], Key: strings.TrimPrefix(m[2], ".")}
+	switch ref.Namespace {
+	case NamespaceDevice, NamespaceTags, NamespaceSite, NamespaceVars:
+		return ref, nil
+	default:
+		return Reference{}, fmt.Errorf("vars: unknown namespace %q in %q; must be one of device, tags, site, vars", ref.Namespace, inner)
+	}
+}
+
+// Lookup resolves ref against the scope. Only scalar values resolve.
+func (s Scope) Lookup(ref Reference) (string, bool) {
+	var v interface{} = s[ref.Namespace]
+	for _, name := range strings.Split(ref.Key, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if v, ok = m[name]; !ok {
+			return "", false
+		}
+	}
+	switch v.(type) {
+	case nil, map[string]interface{}, []interface{}:
+		return "", false
+	}
+	return fmt.Sprint(v), true
+}
+
+// Render substitutes every reference in s with its value from scope. It
+// returns an error naming all references that do not resolve.
+func Render(s string, scope Scope) (string, error) {
+	return render(s, scope, nil)
+}
+
+// RenderRegexp is Render for regular expressions: values are quoted with
+// regexp.QuoteMeta so they match literally. An address such as 10.1.1.1 then
+// does not match 10x1x1x1, and values containing ( or [ still compile.
+func RenderRegexp(s string, scope Scope) (string, error) {
+	return render(s, scope, regexp.QuoteMeta)
+}
+
+func render(s string, scope Scope, quote func(string) string) (string, error) {
+	if !HasTemplate(s) {
+		return s, nil
+	}
+	if _, err := References(s); err != nil {
+		return "", err
+	}
+	var missing []string
+	out := placeholderRe.ReplaceAllStringFunc(s, func(m string) string {
+		ref, _ := parseReference(m[2 : len(m)-2])
+		v, ok := scope.Lookup(ref)
+		if !ok {
+			missing = append(missing, ref.String())
+			return m
+		}
+		if quote != nil {
+			return quote(v)
+		}
+		return v
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("vars: unresolved variable(s) %s", strings.Join(uniqueSorted(missing), ", "))
+	}
+	return out, nil
+}
+
+// Stub replaces every placeholder in s with a neutral literal so that the
+// syntax around it, such as a regular expression, can be checked before the
+// variable values are known.
+func Stub(s string) string {
+	if !HasTemplate(s) {
+		return s
+	}
+	return placeholderRe.ReplaceAllString(s, "x")
+}
+
+// Check reports why ref cannot be resolved for every device described by f,
+// or the empty string when it can. Tag references depend on inventory data
+// and are not checked.
+func (f *File) Check(ref Reference) string {
+	switch ref.Namespace {
+	case NamespaceTags:
+		return ""
+	case NamespaceDevice:
+		if containsString(DeviceFields, ref.Key) {
+			return ""
+		}
+		if f == nil || len(f.Devices) == 0 {
+			return "not a built-in device field and no device variables are defined"
+		}
+		return missingIn(f.Devices, NamespaceDevice, ref, "device")
+	case NamespaceSite:
+		if ref.Key == "name" {
+			return ""
+		}
+		if f == nil || len(f.Sites) == 0 {
+			return "no site variables are defined"
+		}
+		return missingIn(f.Sites, NamespaceSite, ref, "site")
+	default:
+		if f == nil {
+			return "no variables are defined"
+		}
+		if _, ok := (Scope{NamespaceVars: f.Vars}).Lookup(ref); !ok {
+			return "not defined in vars"
+		}
+		return ""
+	}
+}
+
+// missingIn lists the entries of set that do not resolve ref.
+func missingIn(set map[string]map[string]interface{}, ns string, ref Reference, kind string) string {
+	var missing []string
+	for name, values := range set {
+		if _, ok := (Scope{ns: values}).Lookup(ref); !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("not defined for %s(s) %s", kind, strings.Join(uniqueSorted(missing), ", "))
+}
+
+func uniqueSorted(values []string) []string {
+	sort.Strings(values)
+	out := values[:0]
+	for i, v := range values {
+		if i == 0 || v != values[i-1] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
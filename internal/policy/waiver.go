@@ -0,0 +1,201 @@
+package policy
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/0xdevren/netsentry/internal/model"
+	"gopkg.in/yaml.v3"
+)
+
+// waiverDateLayout is the layout of waiver expiry dates.
+const waiverDateLayout = "2006-01-02"
+
+// DeviceSelector identifies the devices a waiver covers. Every populated
+// selector must match, as for Applicability.
+type DeviceSelector struct {
+	// Names lists device IDs or hostnames. Shell-style patterns such as
+	// "edge-*" are accepted.
+	Names []string `json:"names,omitempty" yaml:"names,omitempty"`
+	// Applicability narrows the selection by type, role, site, tags or version.
+	Applicability `yaml:",inline"`
+}
+
+// IsEmpty reports whether the selector has no criteria.
+func (s DeviceSelector) IsEmpty() bool {
+	a := s.Applicability
+	return len(s.Names) == 0 && len(a.Types) == 0 && len(a.Roles) == 0 &&
+		len(a.Sites) == 0 && len(a.Tags) == 0 && a.Version == ""
+}
+
+// Matches reports whether the selector covers device d.
+func (s DeviceSelector) Matches(d model.Device) bool {
+	if len(s.Names) > 0 && !matchesName(s.Names, d) {
+		return false
+	}
+	ok, _ := s.Applicability.Matches(d)
+	return ok
+}
+
+func matchesName(patterns []string, d model.Device) bool {
+	for _, p := range patterns {
+		for _, name := range []string{d.ID, d.Hostname} {
+			if name == "" {
+				continue
+			}
+			if ok, _ := path.Match(p, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Waiver is an approved exception that accepts violations of a rule on the
+// selected devices until it expires.
+type Waiver struct {
+	// ID is an optional reference such as a change or risk ticket number.
+	ID string `json:"id,omitempty" yaml:"id,omitempty"`
+	// RuleID is the rule being waived.
+	RuleID string `json:"rule_id" yaml:"rule_id"`
+	// Device selects the devices the waiver covers.
+	Device DeviceSelector `json:"device" yaml:"device"`
+	// Justification explains why the violation is accepted.
+	Justification string `json:"justification" yaml:"justification"`
+	// Approver is the person or body that approved the waiver.
+	Approver string `json:"approver" yaml:"approver"`
+	// Expires is the last day (YYYY-MM-DD, UTC) on which the waiver applies.
+	Expires string `json:"expires" yaml:"expires"`
+}
+
+// Ref returns the waiver ID, or the rule ID when the waiver has none.
+func (w Waiver) Ref() string {
+	if w.ID != "" {
+		return w.ID
+	}
+	return w.RuleID
+}
+
+// ExpiresAt returns the instant the waiver stops applying: the end of its
+// expiry day.
+func (w Waiver) ExpiresAt() (time.Time, error) {
+	day, err := time.Parse(waiverDateLayout, w.Expires)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("waiver %s: invalid expiry date %q; want YYYY-MM-DD", w.Ref(), w.Expires)
+	}
+	return day.AddDate(0, 0, 1), nil
+}
+
+// IsActive reports whether the waiver applies at now.
+func (w Waiver) IsActive(now time.Time) bool {
+	end, err := w.ExpiresAt()
+	return err == nil && now.Before(end)
+}
+
+// WaiverFile is the on-disk form of a list of waivers.
+type WaiverFile struct {
+	Waivers []Waiver `yaml:"waivers"`
+}
+
+// LoadWaiverFile reads and validates the waivers in filename.
+func LoadWaiverFile(filename string) ([]Waiver, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("waivers: read file %q: %w", filename, err)
+	}
+	var f WaiverFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("waivers: yaml unmarshal: %w", err)
+	}
+	for i, w := range f.Waivers {
+		if err := validateWaiver(w); err != nil {
+			return nil, fmt.Errorf("waivers: entry %d: %w", i, err)
+		}
+	}
+	return f.Waivers, nil
+}
+
+// validateWaiver checks that a waiver carries everything an auditor needs.
+func validateWaiver(w Waiver) error {
+	switch {
+	case w.RuleID == "":
+		return fmt.Errorf("rule_id is required")
+	case w.Device.IsEmpty():
+		return fmt.Errorf("waiver %s: device selector is required; use names: [\"*\"] to cover every device", w.Ref())
+	case w.Justification == "":
+		return fmt.Errorf("waiver %s: justification is required", w.Ref())
+	case w.Approver == "":
+		return fmt.Errorf("waiver %s: approver is required", w.Ref())
+	}
+	if _, err := w.ExpiresAt(); err != nil {
+		return err
+	}
+	return validateApplicability(&w.Device.Applicability)
+}
+
+// ApplyWaivers turns FAIL and WARN results covered by an active waiver into
+// WAIVED. Results covered only by an expired waiver keep their status and
+// note the expiry. It returns the active waivers that cover the device and
+// one of the evaluated rules, for listing in the report.
+func ApplyWaivers(results []ValidationResult, waivers []Waiver, device model.Device, now time.Time) []Waiver {
+	var active, expired []Waiver
+	for _, w := range waivers {
+		if !w.Device.Matches(device) {
+			continue
+		}
+		if w.IsActive(now) {
+			active = append(active, w)
+		} else {
+			expired = append(expired, w)
+		}
+	}
+
+	for i := range results {
+		r := &results[i]
+		if r.Status != StatusFail && r.Status != StatusWarn {
+			continue
+		}
+		if j := findWaiver(active, *r); j >= 0 {
+			w := active[j]
+			r.Status = StatusWaived
+			r.Message = fmt.Sprintf("%s (waived by %s: %s; approved by %s until %s)",
+				r.Message, w.Ref(), w.Justification, w.Approver, w.Expires)
+			continue
+		}
+		if j := findWaiver(expired, *r); j >= 0 {
+			r.Message = fmt.Sprintf("%s (waiver %s expired on %s)", r.Message, expired[j].Ref(), expired[j].Expires)
+		}
+	}
+
+	var listed []Waiver
+	for _, w := range active {
+		for _, r := range results {
+			if w.Covers(r) {
+				listed = append(listed, w)
+				break
+			}
+		}
+	}
+	return listed
+}
+
+// Covers reports whether the waiver's rule ID names the rule of result r. In
+// combined reports a namespaced rule ID ("<policy>/<rule-id>") is also
+// covered by a waiver for the bare rule ID.
+func (w Waiver) Covers(r ValidationResult) bool {
+	if w.RuleID == r.RuleID {
+		return true
+	}
+	return r.Policy != "" && r.RuleID == r.Policy+"/"+w.RuleID
+}
+
+func findWaiver(waivers []Waiver, r ValidationResult) int {
+	for i, w := range waivers {
+		if w.Covers(r) {
+			return i
+		}
+	}
+	return -1
+}
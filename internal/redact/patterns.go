@@ -0,0 +1,51 @@
+package redact
+
+import "github.com/0xdevren/netsentry/internal/model"
+
+// ciscoLike are the platforms sharing the IOS configuration syntax for
+// secrets.
+var ciscoLike = []model.DeviceType{model.DeviceTypeCiscoIOS, model.DeviceTypeCiscoNXOS, model.DeviceTypeAristaEOS}
+
+// junos is the JunOS platform, in set and curly-brace syntax.
+var junos = []model.DeviceType{model.DeviceTypeJuniperOS}
+
+// junosSecretKeywords are the JunOS statements whose value is a secret.
+const junosSecretKeywords = `(?:encrypted-password|authentication-key|authentication-password|privacy-password|simple-password|hello-authentication-key|secret|ascii-text|hexadecimal)`
+
+// DefaultPatterns returns the built-in patterns for the secrets of the
+// supported platforms: enable and user secrets, SNMP communities and user
+// keys, routing protocol passwords, TACACS+ and RADIUS keys, key chains, NTP
+// keys and IKE pre-shared keys. Encrypted and hashed values are redacted too,
+// as type 7 passwords can be decrypted and weak hashes cracked.
+func DefaultPatterns() []Pattern {
+	return []Pattern{
+		// IOS, NX-OS and EOS.
+		{Name: "enable-secret", Vendors: ciscoLike, Match: `^\s*enable (?:secret|password)(?: level \d+)?(?: \d+| sha512)? (\S+)`},
+		{Name: "aaa-root-secret", Vendors: ciscoLike, Match: `^\s*aaa root secret(?: \d+| sha512)? (\S+)`},
+		{Name: "username-secret", Vendors: ciscoLike, Match: `^\s*username \S+(?: .*?)? (?:secret|password)(?: \d+| sha512)? (\S+)`},
+		{Name: "line-password", Vendors: ciscoLike, Match: `^\s*password(?: \d+)? (\S+)`},
+		{Name: "snmp-community", Vendors: ciscoLike, Match: `^\s*snmp-server community (\S+)`},
+		{Name: "snmp-user-auth", Vendors: ciscoLike, Match: `^\s*snmp-server user .*?\bauth (?:md5|sha\S*) (\S+)`},
+		{Name: "snmp-user-priv", Vendors: ciscoLike, Match: `^\s*snmp-server user .*?\bpriv (?:(?:des|3des|aes\S*)(?: \d+)? )?(\S+)`},
+		{Name: "bgp-neighbor-password", Vendors: ciscoLike, Match: `^\s*neighbor \S+ password(?: \d+)? (\S+)`},
+		{Name: "aaa-server-key", Vendors: ciscoLike, Match: `^\s*(?:tacacs-server|radius-server)\b.*?\bkey(?: \d+)? (\S+)`},
+		{Name: "server-key-encrypted", Vendors: ciscoLike, Match: `^\s*(?:server-)?key [067] (\S+)`},
+		{Name: "server-key", Vendors: ciscoLike, Match: `^\s*(?:server-)?key ([^\s\d]\S*)`},
+		{Name: "key-string", Vendors: ciscoLike, Match: `^\s*key-string(?: [067])? (\S+)`},
+		{Name: "ospf-authentication-key", Vendors: ciscoLike, Match: `^\s*ip ospf authentication-key(?: \d+)? (\S+)`},
+		{Name: "ospf-message-digest-key", Vendors: ciscoLike, Match: `^\s*ip ospf message-digest-key \d+ md5(?: \d+)? (\S+)`},
+		{Name: "isis-password", Vendors: ciscoLike, Match: `^\s*(?:isis|domain|area)-password (\S+)`},
+		{Name: "ntp-authentication-key", Vendors: ciscoLike, Match: `^\s*ntp authentication-key \d+ md5(?: [07])? (\S+)`},
+		{Name: "isakmp-key", Vendors: ciscoLike, Match: `^\s*crypto isakmp key(?: [06])? (\S+)`},
+		{Name: "pre-shared-key", Vendors: ciscoLike, Match: `^\s*pre-shared-key(?: local| remote)?(?: [06])? (\S+)`},
+
+		// JunOS, as set commands or curly-brace statements. Values may be
+		// quoted; the quotes are kept. The parsed block tree drops the
+		// trailing ";" of statements and the "{" of headers, so both are
+		// optional at the end of a line.
+		{Name: "junos-secret-set", Vendors: junos, Match: `^\s*set .*\b` + junosSecretKeywords + `\s+("[^"]*"|\S+)`},
+		{Name: "junos-secret", Vendors: junos, Match: `^\s*` + junosSecretKeywords + `\s+("[^"]*"|[^\s;]+)\s*(?:;|$)`},
+		{Name: "junos-snmp-community-set", Vendors: junos, Match: `^\s*set snmp community ("[^"]*"|[^\s;{]+)`},
+		{Name: "junos-snmp-community", Vendors: junos, Match: `^\s*community ("[^"]*"|[^\s;{]+)\s*[{;]?\s*$`},
+	}
+}
@@ -0,0 +1,326 @@
+// Package redact masks secrets, such as enable secrets, SNMP communities,
+// routing protocol passwords and TACACS+ keys, in device configuration text
+// before it is stored or reported.
+//
+// Secrets are found by vendor-aware patterns and replaced by a token holding
+// a stable hash of the value, e.g. "enable secret 9 <redacted:5f1c0a9e2b7d>".
+// The same secret always yields the same token, so redacted configurations
+// can still be compared for drift: a changed password changes its token
+// without exposing either value.
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/0xdevren/netsentry/internal/drift"
+	"github.com/0xdevren/netsentry/internal/model"
+	"github.com/0xdevren/netsentry/internal/policy"
+	"gopkg.in/yaml.v3"
+)
+
+// tokenPrefix starts every redaction token. Values already redacted are left
+// as they are, so redaction can be applied more than once.
+const tokenPrefix = "<redacted:"
+
+// Pattern finds secrets in configuration lines. Every capture group of Match
+// is a secret; use non-capturing groups (?:...) for the surrounding syntax.
+type Pattern struct {
+	// Name identifies the pattern.
+	Name string `yaml:"name"`
+	// Vendors limits the pattern to configurations of these device types. A
+	// pattern without vendors applies to every configuration.
+	Vendors []model.DeviceType `yaml:"vendors,omitempty"`
+	// Match is the regular expression (RE2 syntax) matched against each line.
+	Match string `yaml:"match"`
+}
+
+// Options configures a Redactor.
+type Options struct {
+	// Patterns are applied in addition to the default patterns.
+	Patterns []Pattern `yaml:"patterns,omitempty"`
+	// NoDefaults disables the built-in vendor patterns, leaving Patterns.
+	NoDefaults bool `yaml:"no_defaults,omitempty"`
+	// HashKey keys the hashes of redaction tokens with HMAC-SHA256. Without
+	// a key tokens hold a plain SHA-256 hash, which a short or common secret
+	// can be guessed back from. Tokens are only comparable between runs
+	// using the same key.
+	HashKey []byte `yaml:"-"`
+}
+
+// LoadFile reads redaction options from the YAML file at path:
+//
+//	no_defaults: false
+//	patterns:
+//	  - name: bgp-md5
+//	    vendors: [cisco-ios]
+//	    match: '^\s*neighbor \S+ password(?: \d+)? (\S+)'
+func LoadFile(path string) (Options, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Options{}, fmt.Errorf("redact: read %q: %w", path, err)
+	}
+	var opts Options
+	if err := yaml.Unmarshal(data, &opts); err != nil {
+		return Options{}, fmt.Errorf("redact: %s: yaml unmarshal: %w", path, err)
+	}
+	return opts, nil
+}
+
+// compiledPattern is a Pattern with its expression compiled.
+type compiledPattern struct {
+	vendors map[model.DeviceType]bool
+	re      *regexp.Regexp
+}
+
+// Redactor masks secrets in configuration text, reports and drift results.
+// It is safe for concurrent use.
+type Redactor struct {
+	patterns []compiledPattern
+	key      []byte
+}
+
+// NewRedactor compiles the default patterns, unless disabled, and those of
+// opts.
+func NewRedactor(opts Options) (*Redactor, error) {
+	var patterns []Pattern
+	if !opts.NoDefaults {
+		patterns = append(patterns, DefaultPatterns()...)
+	}
+	patterns = append(patterns, opts.Patterns...)
+
+	r := &Redactor{key: opts.HashKey}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p.Match)
+		if err != nil {
+			return nil, fmt.Errorf("redact: pattern %q: %w", p.Name, err)
+		}
+		if re.NumSubexp() == 0 {
+			return nil, fmt.Errorf("redact: pattern %q: no capture group marks the secret", p.Name)
+		}
+		cp := compiledPattern{re: re}
+		if len(p.Vendors) > 0 {
+			cp.vendors = make(map[model.DeviceType]bool, len(p.Vendors))
+			for _, v := range p.Vendors {
+				cp.vendors[v] = true
+			}
+		}
+		r.patterns = append(r.patterns, cp)
+	}
+	return r, nil
+}
+
+// Default returns a Redactor using the default patterns only.
+func Default() *Redactor {
+	r, err := NewRedactor(Options{})
+	if err != nil {
+		panic(err) // the default patterns are known to compile
+	}
+	return r
+}
+
+// RandomKey returns a random HashKey. Tokens hashed with it are comparable
+// only within the process, which suffices for a server redacting what it
+// stores and serves.
+func RandomKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err) // crypto/rand does not fail on supported platforms
+	}
+	return key
+}
+
+// WithKey returns a copy of r hashing tokens with key.
+func (r *Redactor) WithKey(key []byte) *Redactor {
+	c := *r
+	c.key = key
+	return &c
+}
+
+// applies reports whether p applies to configurations of device type t.
+// Every pattern applies to configurations of unknown type.
+func (p compiledPattern) applies(t model.DeviceType) bool {
+	return p.vendors == nil || t == "" || t == model.DeviceTypeUnknown || p.vendors[t]
+}
+
+// Line returns line with the secrets the patterns for device type t find in
+// it replaced by redaction tokens.
+func (r *Redactor) Line(t model.DeviceType, line string) string {
+	for _, p := range r.patterns {
+		if !p.applies(t) {
+			continue
+		}
+		matches := p.re.FindAllStringSubmatchIndex(line, -1)
+		if matches == nil {
+			continue
+		}
+		var sb strings.Builder
+		last := 0
+		for _, m := range matches {
+			for g := 1; g < len(m)/2; g++ {
+				start, end := m[2*g], m[2*g+1]
+				if start < last || start == end {
+					continue
+				}
+				sb.WriteString(line[last:start])
+				sb.WriteString(r.token(line[start:end]))
+				last = end
+			}
+		}
+		sb.WriteString(line[last:])
+		line = sb.String()
+	}
+	return line
+}
+
+// token returns the redaction token replacing secret. Quotes around the
+// secret are kept.
+func (r *Redactor) token(secret string) string {
+	if strings.HasPrefix(secret, tokenPrefix) || strings.HasPrefix(secret, `"`+tokenPrefix) {
+		return secret
+	}
+	quote := ""
+	if len(secret) >= 2 && secret[0] == '"' && secret[len(secret)-1] == '"' {
+		quote, secret = `"`, secret[1:len(secret)-1]
+	}
+	var sum []byte
+	if len(r.key) > 0 {
+		mac := hmac.New(sha256.New, r.key)
+		mac.Write([]byte(secret))
+		sum = mac.Sum(nil)
+	} else {
+		s := sha256.Sum256([]byte(secret))
+		sum = s[:]
+	}
+	return quote + tokenPrefix + hex.EncodeToString(sum[:6]) + ">" + quote
+}
+
+// Text redacts each line of a configuration of device type t.
+func (r *Redactor) Text(t model.DeviceType, data []byte) []byte {
+	lines := strings.SplitAfter(string(data), "\n")
+	var sb strings.Builder
+	sb.Grow(len(data))
+	for _, l := range lines {
+		body := strings.TrimRight(l, "\r\n")
+		sb.WriteString(r.Line(t, body))
+		sb.WriteString(l[len(body):])
+	}
+	return []byte(sb.String())
+}
+
+// lines redacts a list of configuration lines, returning a new slice.
+func (r *Redactor) lines(t model.DeviceType, lines []string) []string {
+	if lines == nil {
+		return nil
+	}
+	out := make([]string, len(lines))
+	for i, l := range lines {
+		out[i] = r.Line(t, l)
+	}
+	return out
+}
+
+// Config returns a copy of cfg whose raw text, lines and blocks are
+// redacted. The parsed models are shared with cfg.
+func (r *Redactor) Config(cfg *model.ConfigModel) *model.ConfigModel {
+	if cfg == nil {
+		return nil
+	}
+	t := cfg.Device.Type
+	out := *cfg
+	out.RawText = string(r.Text(t, []byte(cfg.RawText)))
+	out.Lines = r.lines(t, cfg.Lines)
+	out.Blocks = r.blocks(t, cfg.Blocks)
+	return &out
+}
+
+// blocks redacts configuration blocks and their children.
+func (r *Redactor) blocks(t model.DeviceType, blocks []model.ConfigBlock) []model.ConfigBlock {
+	if blocks == nil {
+		return nil
+	}
+	out := make([]model.ConfigBlock, len(blocks))
+	for i, b := range blocks {
+		b.Header = r.Line(t, b.Header)
+		b.Lines = r.lines(t, b.Lines)
+		b.Children = r.blocks(t, b.Children)
+		out[i] = b
+	}
+	return out
+}
+
+// Report returns a copy of rep whose result messages, blocks and evidence
+// are redacted.
+func (r *Redactor) Report(rep *policy.Report) *policy.Report {
+	if rep == nil {
+		return nil
+	}
+	out := *rep
+	out.Results = make([]policy.ValidationResult, len(rep.Results))
+	for i, res := range rep.Results {
+		t := res.Device.Type
+		if t == "" {
+			t = rep.Device.Type
+		}
+		res.Message = r.Line(t, res.Message)
+		res.Block = r.Line(t, res.Block)
+		if res.Evidence != nil {
+			evidence := make([]policy.Evidence, len(res.Evidence))
+			for j, ev := range res.Evidence {
+				ev.Text = r.Line(t, ev.Text)
+				ev.Path = r.lines(t, ev.Path)
+				evidence[j] = ev
+			}
+			res.Evidence = evidence
+		}
+		out.Results[i] = res
+	}
+	return &out
+}
+
+// FleetReport returns a copy of rep with the report of every device
+// redacted.
+func (r *Redactor) FleetReport(rep *policy.FleetReport) *policy.FleetReport {
+	if rep == nil {
+		return nil
+	}
+	out := *rep
+	out.Devices = make([]policy.DeviceOutcome, len(rep.Devices))
+	for i, d := range rep.Devices {
+		d.Report = r.Report(d.Report)
+		out.Devices[i] = d
+	}
+	return &out
+}
+
+// Diff returns a copy of diff, between configurations of device type t,
+// with its lines redacted. A changed secret still shows as a removed and
+// an added line, with different tokens.
+func (r *Redactor) Diff(t model.DeviceType, diff *drift.DiffResult) *drift.DiffResult {
+	if diff == nil {
+		return nil
+	}
+	out := *diff
+	out.Added = r.lineDiffs(t, diff.Added)
+	out.Removed = r.lineDiffs(t, diff.Removed)
+	return &out
+}
+
+// lineDiffs redacts drift lines.
+func (r *Redactor) lineDiffs(t model.DeviceType, diffs []drift.LineDiff) []drift.LineDiff {
+	if diffs == nil {
+		return nil
+	}
+	out := make([]drift.LineDiff, len(diffs))
+	for i, d := range diffs {
+		d.Line = r.Line(t, d.Line)
+		out[i] = d
+	}
+	return out
+}
@@ -0,0 +1,256 @@
+// Package remediation assembles ready-to-apply configuration patches, and
+// their rollbacks, from the failed results of a validation run and the
+// structured fixes declared on policy rules.
+package remediation
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/0xdevren/netsentry/internal/model"
+	"github.com/0xdevren/netsentry/internal/policy"
+)
+
+// Section is a group of configuration lines entered under one context.
+type Section struct {
+	// Parents is the configuration context, outermost first. It is empty for
+	// global configuration.
+	Parents []string `json:"parents,omitempty"`
+	// Lines are the configuration lines in apply order.
+	Lines []string `json:"lines"`
+	// Rules lists the IDs of the rules that contributed lines.
+	Rules []string `json:"rules"`
+}
+
+// ManualStep is a failed rule with no structured fix for the device type.
+type ManualStep struct {
+	RuleID string `json:"rule_id"`
+	// Remediation is the rule's free-text remediation, if any.
+	Remediation string `json:"remediation,omitempty"`
+	// Reason explains why no patch lines were generated.
+	Reason string `json:"reason"`
+}
+
+// Patch is the configuration change that resolves the failed results of one
+// validation report.
+type Patch struct {
+	// Device is the device the patch applies to.
+	Device model.Device `json:"device"`
+	// Sections are the changes in apply order: global configuration first,
+	// then blocks in the order they appear in the running configuration, then
+	// blocks that do not exist yet.
+	Sections []Section `json:"sections"`
+	// Rollback undoes Sections, in apply order.
+	Rollback []Section `json:"rollback"`
+	// Irreversible lists patch lines for which no rollback could be derived.
+	Irreversible []string `json:"irreversible,omitempty"`
+	// Manual lists failed rules that must be remediated by hand.
+	Manual []ManualStep `json:"manual,omitempty"`
+}
+
+// IsEmpty reports whether the patch has neither lines nor manual steps.
+func (p *Patch) IsEmpty() bool {
+	return len(p.Sections) == 0 && len(p.Manual) == 0
+}
+
+// Build assembles the patch for the FAIL results in rep. Fixes are taken from
+// the rules of pol for the device's type and have their template variables
+// resolved against pol.Variables. cfg supplies the block order of the running
+// configuration.
+func Build(rep *policy.Report, pol *policy.Policy, cfg *model.ConfigModel) (*Patch, error) {
+	if rep == nil || pol == nil || cfg == nil {
+		return nil, fmt.Errorf("remediation: report, policy and config are required")
+	}
+	rules := make(map[string]policy.Rule, len(pol.Rules))
+	for _, r := range pol.Rules {
+		rules[r.ID] = r
+	}
+	device := cfg.Device
+	scope := pol.Variables.Scope(device)
+
+	patch := &Patch{Device: device}
+	b := newSectionBuilder(cfg)
+	var rollback []rollbackEntry
+	for _, res := range rep.Results {
+		if res.Status != policy.StatusFail {
+			continue
+		}
+		rule, ok := rules[res.RuleID]
+		if !ok {
+			continue
+		}
+		fix, ok := rule.Action.Fix[device.Type]
+		if !ok || len(fix.Lines) == 0 {
+			patch.Manual = appendManual(patch.Manual, res, fmt.Sprintf("no fix defined for %s", device.Type))
+			continue
+		}
+		fix, err := fix.Render(scope)
+		if err != nil {
+			patch.Manual = appendManual(patch.Manual, res, err.Error())
+			continue
+		}
+		parents := fix.Parents
+		if len(parents) == 0 && res.Block != "" {
+			parents = []string{res.Block}
+		}
+
+		added := b.add(parents, fix.Lines, rule.ID)
+		if len(added) == 0 {
+			continue
+		}
+		undo := fix.Rollback
+		if len(undo) == 0 {
+			existing := contextLines(cfg, parents)
+			for _, line := range added {
+				r, ok := deriveRollback(device.Type, line)
+				if ok && !replacesValue(device.Type, line, existing) {
+					undo = append(undo, r)
+				} else {
+					patch.Irreversible = append(patch.Irreversible, line)
+				}
+			}
+		}
+		rollback = append(rollback, rollbackEntry{parents: parents, lines: undo, rule: rule.ID})
+	}
+
+	patch.Sections = b.ordered()
+	patch.Rollback = buildRollback(cfg, rollback)
+	return patch, nil
+}
+
+// appendManual records a failed result that produced no patch lines. A rule
+// is listed once even when it failed in several blocks.
+func appendManual(steps []ManualStep, res policy.ValidationResult, reason string) []ManualStep {
+	for _, s := range steps {
+		if s.RuleID == res.RuleID {
+			return steps
+		}
+	}
+	return append(steps, ManualStep{RuleID: res.RuleID, Remediation: res.Remediation, Reason: reason})
+}
+
+// contextLines returns the configured lines of the context named by parents:
+// the lines of its innermost block, or every line for the global context.
+// A context the configuration does not have yet has no lines.
+func contextLines(cfg *model.ConfigModel, parents []string) []string {
+	if len(parents) == 0 {
+		return cfg.Lines
+	}
+	header := parents[len(parents)-1]
+	blocks := cfg.FindBlocks(func(h string) bool { return h == header })
+	if len(blocks) == 0 {
+		return nil
+	}
+	return blocks[0].Lines
+}
+
+// rollbackEntry is the undo lines of one applied fix.
+type rollbackEntry struct {
+	parents []string
+	lines   []string
+	rule    string
+}
+
+// buildRollback groups undo lines by context. Contexts are undone in the
+// reverse of their apply order and lines within a context are reversed.
+func buildRollback(cfg *model.ConfigModel, entries []rollbackEntry) []Section {
+	b := newSectionBuilder(cfg)
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		lines := make([]string, 0, len(e.lines))
+		for j := len(e.lines) - 1; j >= 0; j-- {
+			lines = append(lines, e.lines[j])
+		}
+		b.add(e.parents, lines, e.rule)
+	}
+	sections := b.ordered()
+	for i, j := 0, len(sections)-1; i < j; i, j = i+1, j-1 {
+		sections[i], sections[j] = sections[j], sections[i]
+	}
+	return sections
+}
+
+// sectionBuilder merges lines into sections keyed by context and orders them.
+type sectionBuilder struct {
+	order    map[string]int
+	index    map[string]int
+	sections []Section
+	seen     []map[string]bool
+}
+
+func newSectionBuilder(cfg *model.ConfigModel) *sectionBuilder {
+	return &sectionBuilder{order: blockOrder(cfg), index: make(map[string]int)}
+}
+
+// add appends the lines not already present under parents and returns them.
+func (b *sectionBuilder) add(parents, lines []string, ruleID string) []string {
+	key := strings.Join(parents, "\x00")
+	i, ok := b.index[key]
+	if !ok {
+		i = len(b.sections)
+		b.index[key] = i
+		b.sections = append(b.sections, Section{Parents: parents})
+		b.seen = append(b.seen, make(map[string]bool))
+	}
+	var added []string
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || b.seen[i][line] {
+			continue
+		}
+		b.seen[i][line] = true
+		added = append(added, line)
+	}
+	if len(added) > 0 {
+		s := &b.sections[i]
+		s.Lines = append(s.Lines, added...)
+		if !containsString(s.Rules, ruleID) {
+			s.Rules = append(s.Rules, ruleID)
+		}
+	}
+	return added
+}
+
+// ordered returns the non-empty sections: global configuration first, then
+// existing blocks in configuration order, then new blocks in the order they
+// were added.
+func (b *sectionBuilder) ordered() []Section {
+	out := make([]Section, 0, len(b.sections))
+	for _, s := range b.sections {
+		if len(s.Lines) > 0 {
+			out = append(out, s)
+		}
+	}
+	rank := func(s Section) int {
+		if len(s.Parents) == 0 {
+			return -1
+		}
+		if pos, ok := b.order[s.Parents[0]]; ok {
+			return pos
+		}
+		return len(b.order)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return rank(out[i]) < rank(out[j]) })
+	return out
+}
+
+// blockOrder maps each block header to its position in the configuration.
+func blockOrder(cfg *model.ConfigModel) map[string]int {
+	order := make(map[string]int)
+	for _, b := range cfg.FindBlocks(func(string) bool { return true }) {
+		if _, ok := order[b.Header]; !ok {
+			order[b.Header] = len(order)
+		}
+	}
+	return order
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
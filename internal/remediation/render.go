@@ -0,0 +1,195 @@
+package remediation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/0xdevren/netsentry/internal/model"
+)
+
+// deriveRollback returns the line that undoes line on a device of type t.
+// Cisco-style syntax negates a command with a "no" prefix; JunOS reverses a
+// "set" with a "delete". Other forms, such as JunOS deletions, cannot be
+// reversed without knowing the previous value.
+func deriveRollback(t model.DeviceType, line string) (string, bool) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", false
+	}
+	if t == model.DeviceTypeJuniperOS {
+		if fields[0] == "set" && len(fields) > 1 {
+			return "delete " + strings.Join(fields[1:], " "), true
+		}
+		return "", false
+	}
+	switch fields[0] {
+	case "no":
+		if len(fields) == 1 {
+			return "", false
+		}
+		return strings.Join(fields[1:], " "), true
+	case "default":
+		return "", false
+	}
+	return "no " + line, true
+}
+
+// replacingCommands are commands, by their leading words, that hold a single
+// value: applying one replaces the value configured before, and negating it
+// removes the setting instead of restoring that value. "no transport input
+// ssh" does not bring back telnet, and "no enable secret" deletes the secret.
+// A "*" word names the instance, such as the user, the value belongs to.
+var replacingCommands = []string{
+	"aaa authentication login",
+	"banner",
+	"clock timezone",
+	"enable password",
+	"enable secret",
+	"exec-timeout",
+	"hostname",
+	"ip domain name",
+	"ip domain-name",
+	"ip ssh version",
+	"logging buffered",
+	"logging trap",
+	"login block-for",
+	"password",
+	"security passwords min-length",
+	"snmp-server contact",
+	"snmp-server location",
+	"transport input",
+	"transport output",
+	"transport preferred",
+	"username *",
+}
+
+// junosReplacingCommands are the JunOS statements holding a single value, as
+// set commands.
+var junosReplacingCommands = []string{
+	"set system domain-name",
+	"set system host-name",
+	"set system login message",
+	"set system root-authentication",
+	"set system services ssh protocol-version",
+	"set system services ssh root-login",
+	"set system time-zone",
+	"set snmp contact",
+	"set snmp location",
+}
+
+// replacesValue reports whether line, a single-valued command, replaces a
+// different value among existing, the lines of the context it is applied in.
+// Such a line cannot be rolled back by negating it.
+func replacesValue(t model.DeviceType, line string, existing []string) bool {
+	commands := replacingCommands
+	if t == model.DeviceTypeJuniperOS {
+		commands = junosReplacingCommands
+	}
+	fields := strings.Fields(line)
+	for _, c := range commands {
+		words := strings.Fields(c)
+		if len(fields) < len(words) {
+			continue
+		}
+		for i, w := range words {
+			if w == "*" {
+				words[i] = fields[i]
+			}
+		}
+		if !hasWords(fields, words) {
+			continue
+		}
+		for _, e := range existing {
+			if e = strings.TrimSpace(e); e != line && hasWords(strings.Fields(e), words) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// hasWords reports whether fields starts with words.
+func hasWords(fields, words []string) bool {
+	if len(fields) < len(words) {
+		return false
+	}
+	for i, w := range words {
+		if fields[i] != w {
+			return false
+		}
+	}
+	return true
+}
+
+// Render returns the patch as configuration text ready to be applied to the
+// device, with manual steps listed as comments.
+func (p *Patch) Render() string {
+	var sb strings.Builder
+	c := commentPrefix(p.Device.Type)
+	fmt.Fprintf(&sb, "%s NetSentry remediation for %s (%s)\n", c, p.Device, p.Device.Type)
+	writeSections(&sb, p.Device.Type, p.Sections)
+	if len(p.Manual) > 0 {
+		fmt.Fprintf(&sb, "%s\n%s Manual remediation required:\n", c, c)
+		for _, m := range p.Manual {
+			fmt.Fprintf(&sb, "%s   %s: %s", c, m.RuleID, m.Reason)
+			if m.Remediation != "" {
+				fmt.Fprintf(&sb, "; %s", m.Remediation)
+			}
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+// RenderRollback returns the configuration text that undoes the patch. Lines
+// that could not be reversed are listed as comments.
+func (p *Patch) RenderRollback() string {
+	var sb strings.Builder
+	c := commentPrefix(p.Device.Type)
+	fmt.Fprintf(&sb, "%s NetSentry rollback for %s (%s)\n", c, p.Device, p.Device.Type)
+	writeSections(&sb, p.Device.Type, p.Rollback)
+	if len(p.Irreversible) > 0 {
+		fmt.Fprintf(&sb, "%s\n%s No rollback could be derived for:\n", c, c)
+		for _, line := range p.Irreversible {
+			fmt.Fprintf(&sb, "%s   %s\n", c, line)
+		}
+	}
+	return sb.String()
+}
+
+// writeSections renders sections in the configuration syntax of t.
+func writeSections(sb *strings.Builder, t model.DeviceType, sections []Section) {
+	c := commentPrefix(t)
+	for _, s := range sections {
+		fmt.Fprintf(sb, "%s %s\n", c, strings.Join(s.Rules, ", "))
+		if t == model.DeviceTypeJuniperOS {
+			for _, parent := range s.Parents {
+				fmt.Fprintf(sb, "edit %s\n", parent)
+			}
+			for _, line := range s.Lines {
+				sb.WriteString(line + "\n")
+			}
+			if len(s.Parents) > 0 {
+				sb.WriteString("top\n")
+			}
+			continue
+		}
+		for depth, parent := range s.Parents {
+			fmt.Fprintf(sb, "%s%s\n", strings.Repeat(" ", depth), parent)
+		}
+		indent := strings.Repeat(" ", len(s.Parents))
+		for _, line := range s.Lines {
+			sb.WriteString(indent + line + "\n")
+		}
+		sb.WriteString("!\n")
+	}
+}
+
+// commentPrefix returns the comment marker of the configuration syntax of t.
+func commentPrefix(t model.DeviceType) string {
+	if t == model.DeviceTypeJuniperOS {
+		return "#"
+	}
+	return "!"
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 
 	"github.com/0xdevren/netsentry/internal/policy"
+	"github.com/0xdevren/netsentry/internal/redact"
 )
 
 // Reporter is the interface implemented by all output format generators.
@@ -15,6 +16,12 @@ type Reporter interface {
 	Generate(report *policy.Report) error
 }
 
+// FleetReporter is implemented by reporters that can render a fleet report.
+type FleetReporter interface {
+	// GenerateFleet writes the fleet report to the configured destination.
+	GenerateFleet(report *policy.FleetReport) error
+}
+
 // Format enumerates the supported output formats.
 type Format string
 
@@ -36,10 +43,22 @@ type Options struct {
 	OutputPath string
 	// NoColor disables ANSI colour codes in table output.
 	NoColor bool
+	// Redactor masks secrets in the configuration lines quoted by the
+	// report. Nil leaves them as they are.
+	Redactor *redact.Redactor
 }
 
 // New constructs the Reporter appropriate for the given Options.
 func New(opts Options) (Reporter, error) {
+	r, err := newReporter(opts)
+	if err != nil || opts.Redactor == nil {
+		return r, err
+	}
+	return &redactingReporter{next: r, redactor: opts.Redactor}, nil
+}
+
+// newReporter constructs the Reporter for opts.Format.
+func newReporter(opts Options) (Reporter, error) {
 	switch opts.Format {
 	case FormatTable, "":
 		return NewTableReporter(opts), nil
@@ -55,3 +74,45 @@ func New(opts Options) (Reporter, error) {
 		return nil, fmt.Errorf("report: unsupported format %q", opts.Format)
 	}
 }
+
+// NewFleet constructs the FleetReporter appropriate for the given Options.
+// Fleet reports support the table, json and yaml formats.
+func NewFleet(opts Options) (FleetReporter, error) {
+	r, err := newFleetReporter(opts)
+	if err != nil || opts.Redactor == nil {
+		return r, err
+	}
+	return &redactingReporter{nextFleet: r, redactor: opts.Redactor}, nil
+}
+
+// newFleetReporter constructs the FleetReporter for opts.Format.
+func newFleetReporter(opts Options) (FleetReporter, error) {
+	switch opts.Format {
+	case FormatTable, "":
+		return NewTableReporter(opts), nil
+	case FormatJSON:
+		return NewJSONReporter(opts), nil
+	case FormatYAML:
+		return NewYAMLReporter(opts), nil
+	default:
+		return nil, fmt.Errorf("report: unsupported fleet format %q", opts.Format)
+	}
+}
+
+// redactingReporter redacts reports before handing them to the reporter it
+// wraps.
+type redactingReporter struct {
+	next      Reporter
+	nextFleet FleetReporter
+	redactor  *redact.Redactor
+}
+
+// Generate redacts report and generates it.
+func (r *redactingReporter) Generate(report *policy.Report) error {
+	return r.next.Generate(r.redactor.Report(report))
+}
+
+// GenerateFleet redacts report and generates it.
+func (r *redactingReporter) GenerateFleet(report *policy.FleetReport) error {
+	return r.nextFleet.GenerateFleet(r.redactor.FleetReport(report))
+}
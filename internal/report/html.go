@@ -32,6 +32,8 @@ func (r *HTMLReporter) Generate(report *policy.Report) error {
 				return "fail"
 			case policy.StatusWarn:
 				return "warn"
+			case policy.StatusWaived:
+				return "waived"
 			default:
 				return "skip"
 			}
@@ -99,11 +101,15 @@ const htmlTemplate = `<!DOCTYPE html>
   .fail { color: #dc3545; font-weight: 600; }
   .warn { color: #ffc107; font-weight: 600; }
   .skip { color: #6c757d; font-weight: 600; }
+  .waived { color: #6f9bff; font-weight: 600; }
+  h2 { color: #00bfff; font-size: 1.2rem; margin-top: 2rem; }
   .critical { color: #dc3545; font-weight: 700; }
   .high { color: #fd7e14; font-weight: 600; }
   .medium { color: #ffc107; }
   .low { color: #20c997; }
   .info { color: #6c757d; }
+  .evidence { color: #aaa; font-size: 0.8rem; margin-top: 0.35rem; }
+  .evidence code { color: #e0e0e0; background: #1a1d27; padding: 0 0.25rem; border-radius: 3px; }
   .badge { display: inline-block; padding: 0.2rem 0.5rem; border-radius: 4px; font-size: 0.75rem; }
 </style>
 </head>
@@ -122,9 +128,32 @@ const htmlTemplate = `<!DOCTYPE html>
     <div class="value warn">{{.Summary.Warnings}}</div></div>
   <div class="stat"><div class="label">Skipped</div>
     <div class="value skip">{{.Summary.Skipped}}</div></div>
+  {{if .Summary.Waived}}<div class="stat"><div class="label">Waived</div>
+    <div class="value waived">{{.Summary.Waived}}</div></div>{{end}}
   <div class="stat"><div class="label">Total</div>
     <div class="value">{{.Summary.Total}}</div></div>
 </div>
+{{if .Policies}}
+<table>
+  <thead>
+    <tr><th>Policy</th><th>Score</th><th>Passed</th><th>Failed</th><th>Warnings</th><th>Skipped</th><th>Total</th></tr>
+  </thead>
+  <tbody>
+    {{range .Policies}}
+    <tr>
+      <td>{{.Name}}{{if .Version}} v{{.Version}}{{end}}</td>
+      <td><span style="color: {{scoreColor .Summary.Score}}">{{printf "%.0f" .Summary.Score}}%</span></td>
+      <td>{{.Summary.Passed}}</td>
+      <td>{{.Summary.Failed}}</td>
+      <td>{{.Summary.Warnings}}</td>
+      <td>{{.Summary.Skipped}}</td>
+      <td>{{.Summary.Total}}</td>
+    </tr>
+    {{end}}
+  </tbody>
+</table>
+<h2>Results</h2>
+{{end}}
 <table>
   <thead>
     <tr><th>Rule ID</th><th>Status</th><th>Severity</th><th>Message</th><th>Remediation</th></tr>
@@ -135,12 +164,32 @@ const htmlTemplate = `<!DOCTYPE html>
       <td>{{.RuleID}}</td>
       <td><span class="{{statusClass .Status}}">{{.Status}}</span></td>
       <td><span class="{{severityClass .Severity}}">{{.Severity}}</span></td>
-      <td>{{.Message}}</td>
+      <td>{{.Message}}{{range .Evidence}}
+        <div class="evidence">{{.Location}}: <code>{{.Text}}</code></div>{{end}}</td>
       <td>{{.Remediation}}</td>
     </tr>
     {{end}}
   </tbody>
 </table>
+{{if .Waivers}}
+<h2>Active Waivers</h2>
+<table>
+  <thead>
+    <tr><th>Waiver</th><th>Rule ID</th><th>Justification</th><th>Approver</th><th>Expires</th></tr>
+  </thead>
+  <tbody>
+    {{range .Waivers}}
+    <tr>
+      <td>{{.Ref}}</td>
+      <td>{{.RuleID}}</td>
+      <td>{{.Justification}}</td>
+      <td>{{.Approver}}</td>
+      <td>{{.Expires}}</td>
+    </tr>
+    {{end}}
+  </tbody>
+</table>
+{{end}}
 </body>
 </html>`
 
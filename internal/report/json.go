@@ -31,6 +31,16 @@ func (r *JSONReporter) Generate(report *policy.Report) error {
 	return nil
 }
 
+// GenerateFleet encodes the fleet report as indented JSON.
+func (r *JSONReporter) GenerateFleet(report *policy.FleetReport) error {
+	enc := json.NewEncoder(r.writer)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return fmt.Errorf("json reporter: encode: %w", err)
+	}
+	return nil
+}
+
 // YAMLReporter serialises the Report as YAML.
 type YAMLReporter struct {
 	writer io.Writer
@@ -51,6 +61,15 @@ func (r *YAMLReporter) Generate(report *policy.Report) error {
 	return err
 }
 
+// GenerateFleet encodes the fleet report as YAML.
+func (r *YAMLReporter) GenerateFleet(report *policy.FleetReport) error {
+	data, err := yaml.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("yaml reporter: marshal: %w", err)
+	}
+	_, err = r.writer.Write(data)
+	return err
+}
 
 // resolveWriter returns the appropriate io.Writer from Options.
 func resolveWriter(opts Options) io.Writer {
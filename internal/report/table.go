@@ -62,6 +62,31 @@ func (r *TableReporter) Generate(report *policy.Report) error {
 	}
 	table.Render()
 
+	if hasEvidence(report.Results) {
+		fmt.Fprintln(buf)
+		fmt.Fprintln(buf, "EVIDENCE:")
+		for _, res := range report.Results {
+			for _, ev := range res.Evidence {
+				fmt.Fprintf(buf, "  %-24s %s: %s\n", res.RuleID, ev.Location(), ev.Text)
+			}
+		}
+	}
+
+	// Per-policy summaries of a combined run.
+	if len(report.Policies) > 0 {
+		fmt.Fprintln(buf, strings.Repeat("-", 72))
+		fmt.Fprintln(buf, "POLICIES:")
+		for _, p := range report.Policies {
+			name := p.Name
+			if p.Version != "" {
+				name += " (v" + p.Version + ")"
+			}
+			ps := p.Summary
+			fmt.Fprintf(buf, "  %-32s passed %d, failed %d, warnings %d, score %.0f%%\n",
+				name, ps.Passed, ps.Failed, ps.Warnings, ps.Score)
+		}
+	}
+
 	// Summary.
 	fmt.Fprintln(buf, strings.Repeat("-", 72))
 	fmt.Fprintln(buf, "SUMMARY:")
@@ -70,12 +95,109 @@ func (r *TableReporter) Generate(report *policy.Report) error {
 	fmt.Fprintf(buf, "  Failed   : %d\n", s.Failed)
 	fmt.Fprintf(buf, "  Warnings : %d\n", s.Warnings)
 	fmt.Fprintf(buf, "  Skipped  : %d\n", s.Skipped)
+	if s.Waived > 0 {
+		fmt.Fprintf(buf, "  Waived   : %d\n", s.Waived)
+	}
 	fmt.Fprintf(buf, "  Score    : %.0f%%\n", s.Score)
 	fmt.Fprintln(buf)
 
+	if len(report.Waivers) > 0 {
+		fmt.Fprintln(buf, "ACTIVE WAIVERS:")
+		for _, w := range report.Waivers {
+			fmt.Fprintf(buf, "  %-20s %-24s expires %s, approved by %s\n", w.Ref(), w.RuleID, w.Expires, w.Approver)
+			fmt.Fprintf(buf, "  %-20s %s\n", "", w.Justification)
+		}
+		fmt.Fprintln(buf)
+	}
+
 	return nil
 }
 
+// GenerateFleet writes the fleet report: one row per device followed by the
+// worst offenders, the rules failing on most devices and the fleet summary.
+func (r *TableReporter) GenerateFleet(report *policy.FleetReport) error {
+	buf := bufio.NewWriter(r.writer)
+	defer buf.Flush()
+
+	s := report.Summary
+	fmt.Fprintf(buf, "\nFLEET  : %d devices\n", s.Devices)
+	fmt.Fprintf(buf, "POLICY : %s\n", report.Policy)
+	fmt.Fprintln(buf, strings.Repeat("-", 72))
+
+	table := tablewriter.NewWriter(buf)
+	table.SetHeader([]string{"DEVICE", "TYPE", "SCORE", "PASSED", "FAILED", "WARNINGS", "STATUS"})
+	table.SetBorder(false)
+	table.SetHeaderLine(true)
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.SetColumnSeparator(" ")
+	for _, d := range report.Devices {
+		if d.Report == nil {
+			table.Append([]string{d.Device.String(), string(d.Device.Type), "-", "-", "-", "-", r.formatStatus(policy.StatusError)})
+			continue
+		}
+		ds := d.Report.Summary
+		status := policy.StatusPass
+		switch {
+		case ds.Failed > 0:
+			status = policy.StatusFail
+		case ds.Warnings > 0:
+			status = policy.StatusWarn
+		}
+		table.Append([]string{
+			d.Device.String(), string(d.Device.Type), fmt.Sprintf("%.0f%%", ds.Score),
+			fmt.Sprint(ds.Passed), fmt.Sprint(ds.Failed), fmt.Sprint(ds.Warnings), r.formatStatus(status),
+		})
+	}
+	table.Render()
+
+	if len(s.WorstOffenders) > 0 {
+		fmt.Fprintln(buf)
+		fmt.Fprintln(buf, "WORST OFFENDERS:")
+		for _, d := range s.WorstOffenders {
+			fmt.Fprintf(buf, "  %-32s %3.0f%%  %d failed, %d warnings\n", d.Device, d.Score, d.Failed, d.Warnings)
+		}
+	}
+	if len(s.TopFailingRules) > 0 {
+		fmt.Fprintln(buf)
+		fmt.Fprintln(buf, "TOP FAILING RULES:")
+		for _, rf := range s.TopFailingRules {
+			fmt.Fprintf(buf, "  %-32s %-9s failing on %d of %d devices\n", rf.RuleID, r.formatSeverity(rf.Severity), rf.Devices, s.Devices)
+		}
+	}
+	if s.Errors > 0 {
+		fmt.Fprintln(buf)
+		fmt.Fprintln(buf, "ERRORS:")
+		for _, d := range report.Devices {
+			if d.Error != "" {
+				fmt.Fprintf(buf, "  %-32s %s\n", d.Source, d.Error)
+			}
+		}
+	}
+
+	fmt.Fprintln(buf, strings.Repeat("-", 72))
+	fmt.Fprintln(buf, "FLEET SUMMARY:")
+	fmt.Fprintf(buf, "  Devices       : %d\n", s.Devices)
+	fmt.Fprintf(buf, "  Compliant     : %d\n", s.Compliant)
+	fmt.Fprintf(buf, "  Non-compliant : %d\n", s.NonCompliant)
+	if s.Errors > 0 {
+		fmt.Fprintf(buf, "  Errors        : %d\n", s.Errors)
+	}
+	fmt.Fprintf(buf, "  Average score : %.0f%%\n", s.Score)
+	fmt.Fprintln(buf)
+	return nil
+}
+
+// hasEvidence reports whether any result carries evidence lines.
+func hasEvidence(results []policy.ValidationResult) bool {
+	for _, res := range results {
+		if len(res.Evidence) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
 func (r *TableReporter) formatStatus(s policy.ValidationStatus) string {
 	if r.noColor || os.Getenv("NO_COLOR") != "" {
 		return string(s)
@@ -89,6 +211,8 @@ func (r *TableReporter) formatStatus(s policy.ValidationStatus) string {
 		return color.YellowString(string(s))
 	case policy.StatusSkip:
 		return color.CyanString(string(s))
+	case policy.StatusWaived:
+		return color.BlueString(string(s))
 	default:
 		return color.MagentaString(string(s))
 	}
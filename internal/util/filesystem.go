@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 // FileExists reports whether the file or directory at path exists.
@@ -50,3 +51,16 @@ func AbsPath(path string) (string, error) {
 	}
 	return abs, nil
 }
+
+// ExpandHome replaces a leading "~" in path with the current user's home
+// directory.
+func ExpandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("filesystem: expand %q: %w", path, err)
+	}
+	return filepath.Join(home, path[1:]), nil
+}
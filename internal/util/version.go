@@ -0,0 +1,120 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// CompareVersions compares two vendor OS version strings such as
+// "15.2(4)M3", "4.28.3M" or "20.4R3.8". The numeric components are extracted
+// in order and compared pairwise; missing components are treated as zero.
+// It returns -1, 0 or 1.
+func CompareVersions(a, b string) int {
+	na, nb := versionNumbers(a), versionNumbers(b)
+	for i := 0; i < len(na) || i < len(nb); i++ {
+		var x, y int
+		if i < len(na) {
+			x = na[i]
+		}
+		if i < len(nb) {
+			y = nb[i]
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
+
+// versionNumbers returns the runs of decimal digits in v as integers.
+func versionNumbers(v string) []int {
+	fields := strings.FieldsFunc(v, func(r rune) bool { return !unicode.IsDigit(r) })
+	out := make([]int, 0, len(fields))
+	for _, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			continue
+		}
+		out = append(out, n)
+	}
+	return out
+}
+
+// versionClause is a single "<op> <version>" comparison.
+type versionClause struct {
+	op      string
+	version string
+}
+
+// VersionConstraint is a comma-separated conjunction of version comparisons,
+// e.g. ">= 15.2, < 17". A clause without an operator requires equality.
+type VersionConstraint struct {
+	expr    string
+	clauses []versionClause
+}
+
+// versionOps lists the supported operators, longest first so that prefixes
+// such as ">" do not shadow ">=".
+var versionOps = []string{">=", "<=", "==", "!=", ">", "<", "="}
+
+// ParseVersionConstraint compiles a version constraint expression.
+func ParseVersionConstraint(expr string) (*VersionConstraint, error) {
+	c := &VersionConstraint{expr: expr}
+	for _, part := range strings.Split(expr, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, fmt.Errorf("version: empty clause in constraint %q", expr)
+		}
+		clause := versionClause{op: "=="}
+		for _, op := range versionOps {
+			if strings.HasPrefix(part, op) {
+				clause.op = op
+				if op == "=" {
+					clause.op = "=="
+				}
+				part = strings.TrimSpace(strings.TrimPrefix(part, op))
+				break
+			}
+		}
+		if len(versionNumbers(part)) == 0 {
+			return nil, fmt.Errorf("version: clause %q in constraint %q has no version number", part, expr)
+		}
+		clause.version = part
+		c.clauses = append(c.clauses, clause)
+	}
+	return c, nil
+}
+
+// Allows reports whether version satisfies every clause of the constraint.
+func (c *VersionConstraint) Allows(version string) bool {
+	for _, cl := range c.clauses {
+		cmp := CompareVersions(version, cl.version)
+		var ok bool
+		switch cl.op {
+		case ">=":
+			ok = cmp >= 0
+		case "<=":
+			ok = cmp <= 0
+		case ">":
+			ok = cmp > 0
+		case "<":
+			ok = cmp < 0
+		case "!=":
+			ok = cmp != 0
+		default:
+			ok = cmp == 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the source expression of the constraint.
+func (c *VersionConstraint) String() string { return c.expr }
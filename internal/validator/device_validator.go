@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"time"
 
 	"github.com/0xdevren/netsentry/internal/policy"
 )
@@ -36,29 +37,73 @@ func (v *DeviceValidator) Validate(ctx context.Context, req ValidationRequest) (
 	if req.Config == nil {
 		return nil, fmt.Errorf("device validator: ConfigModel is required")
 	}
-	if req.Policy == nil {
+	policies := req.Policies
+	if req.Policy != nil {
+		policies = append([]*policy.Policy{req.Policy}, policies...)
+	}
+	if len(policies) == 0 {
 		return nil, fmt.Errorf("device validator: Policy is required")
 	}
+	pol, err := policy.Merge(policies...)
+	if err != nil {
+		return nil, fmt.Errorf("device validator: %w", err)
+	}
 
-	results, err := v.engine.Run(ctx, req.Policy, req.Config)
+	results, err := v.engine.Run(ctx, pol, req.Config)
 	if err != nil {
 		return nil, fmt.Errorf("device validator: engine run: %w", err)
 	}
 
-	// Sort results by rule ID for deterministic output.
+	// Sort results by policy, in request order, then rule ID for deterministic output.
+	order := make(map[string]int, len(policies))
+	for i := len(policies) - 1; i >= 0; i-- {
+		order[policies[i].Name] = i
+	}
 	sort.Slice(results, func(i, j int) bool {
+		pi, pj := order[results[i].Policy], order[results[j].Policy]
+		if pi != pj {
+			return pi < pj
+		}
 		return results[i].RuleID < results[j].RuleID
 	})
 
+	waivers := policy.ApplyWaivers(results, req.Waivers, req.Config.Device, time.Now().UTC())
 	summary := policy.ComputeSummary(results)
 
 	report := &policy.Report{
 		Device:        req.Config.Device,
-		Policy:        req.Policy.Name,
-		PolicyVersion: req.Policy.Version,
+		Policy:        pol.Name,
+		PolicyVersion: pol.Version,
 		Results:       results,
 		Summary:       summary,
+		Waivers:       waivers,
+	}
+	if len(policies) > 1 {
+		report.Policies = summarisePolicies(policies, results)
 	}
 
 	return report, nil
 }
+
+// summarisePolicies computes a summary for each policy of a combined run from
+// the results attributed to it.
+func summarisePolicies(policies []*policy.Policy, results []policy.ValidationResult) []policy.PolicySummary {
+	byPolicy := make(map[string][]policy.ValidationResult)
+	for _, r := range results {
+		byPolicy[r.Policy] = append(byPolicy[r.Policy], r)
+	}
+	summaries := make([]policy.PolicySummary, 0, len(policies))
+	seen := make(map[string]bool)
+	for _, p := range policies {
+		if seen[p.Name] {
+			continue
+		}
+		seen[p.Name] = true
+		summaries = append(summaries, policy.PolicySummary{
+			Name:    p.Name,
+			Version: p.Version,
+			Summary: policy.ComputeSummary(byPolicy[p.Name]),
+		})
+	}
+	return summaries
+}
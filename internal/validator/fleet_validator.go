@@ -0,0 +1,218 @@
+package validator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/0xdevren/netsentry/internal/config"
+	"github.com/0xdevren/netsentry/internal/config/source"
+	"github.com/0xdevren/netsentry/internal/model"
+	"github.com/0xdevren/netsentry/internal/parser"
+	"github.com/0xdevren/netsentry/internal/policy"
+	"github.com/0xdevren/netsentry/internal/util"
+)
+
+// FleetTarget is one device of a fleet run.
+type FleetTarget struct {
+	// Source is the device configuration file, or a description of where
+	// Load retrieves the configuration from.
+	Source string
+	// Load retrieves the configuration. When nil the file at Source is read.
+	Load func(ctx context.Context) ([]byte, error)
+	// Device carries metadata known before parsing, such as inventory fields.
+	// An empty Type is detected from the configuration and an empty ID is
+	// taken from the parsed hostname.
+	Device model.Device
+}
+
+// FleetValidationRequest encapsulates a validation run across many devices.
+type FleetValidationRequest struct {
+	// Targets lists the devices to validate.
+	Targets []FleetTarget
+	// Policies are evaluated against every device, merged as for a single
+	// device run.
+	Policies []*policy.Policy
+	// Waivers are applied to every device; device selectors decide which
+	// waivers cover which device.
+	Waivers []policy.Waiver
+	// Concurrency is the number of devices validated in parallel.
+	Concurrency int
+	// DeviceTimeout bounds the time spent loading and validating each device.
+	// Zero means no per-device limit.
+	DeviceTimeout time.Duration
+	// Top limits the worst offenders and failing rules in the fleet summary.
+	// Defaults to 10.
+	Top int
+}
+
+// FleetValidator validates many device configurations in parallel.
+type FleetValidator struct {
+	detector *config.Detector
+}
+
+// NewFleetValidator constructs a FleetValidator.
+func NewFleetValidator() *FleetValidator {
+	return &FleetValidator{detector: config.NewDetector()}
+}
+
+// Validate loads, parses and validates every target. A device that cannot be
+// read, parsed or evaluated is recorded with its error; it does not stop the
+// run. Outcomes are ordered by device ID.
+func (fv *FleetValidator) Validate(ctx context.Context, req FleetValidationRequest) (*policy.FleetReport, error) {
+	if len(req.Policies) == 0 {
+		return nil, fmt.Errorf("fleet validator: Policy is required")
+	}
+	pol, err := policy.Merge(req.Policies...)
+	if err != nil {
+		return nil, fmt.Errorf("fleet validator: %w", err)
+	}
+	concurrency := req.Concurrency
+	if concurrency <= 0 {
+		concurrency = 4
+	}
+	top := req.Top
+	if top <= 0 {
+		top = 10
+	}
+
+	pool := util.NewWorkerPool[FleetTarget, policy.DeviceOutcome](concurrency, func(ctx context.Context, t FleetTarget) policy.DeviceOutcome {
+		return fv.validateOne(ctx, t, req)
+	})
+	devices := pool.Run(ctx, req.Targets)
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("fleet validator: %w", err)
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		if devices[i].Device.ID != devices[j].Device.ID {
+			return devices[i].Device.ID < devices[j].Device.ID
+		}
+		return devices[i].Source < devices[j].Source
+	})
+
+	return &policy.FleetReport{
+		Policy:  pol.Name,
+		Devices: devices,
+		Summary: policy.ComputeFleetSummary(devices, top),
+	}, nil
+}
+
+func (fv *FleetValidator) validateOne(ctx context.Context, t FleetTarget, req FleetValidationRequest) policy.DeviceOutcome {
+	if req.DeviceTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, req.DeviceTimeout)
+		defer cancel()
+	}
+	out := policy.DeviceOutcome{Device: t.Device, Source: t.Source}
+	if out.Device.ID == "" {
+		out.Device.ID = out.Device.Hostname
+	}
+	fail := func(err error) policy.DeviceOutcome {
+		if out.Device.ID == "" {
+			out.Device.ID = t.fallbackID()
+		}
+		out.Error = err.Error()
+		out.ErrorCode = ErrorCode(err)
+		return out
+	}
+
+	var data []byte
+	var err error
+	if t.Load != nil {
+		data, err = t.Load(ctx)
+	} else {
+		data, err = os.ReadFile(t.Source)
+	}
+	if err != nil {
+		return fail(fmt.Errorf("load config: %w", err))
+	}
+	if out.Device.Type == "" {
+		out.Device.Type = fv.detector.Detect(data)
+	}
+	cfg, err := parser.Parse(ctx, out.Device.Type, data, out.Device)
+	if err != nil {
+		return fail(fmt.Errorf("parse: %w", err))
+	}
+	if cfg.Device.ID == "" {
+		cfg.Device.ID = cfg.Device.Hostname
+	}
+	if cfg.Device.ID == "" {
+		cfg.Device.ID = t.fallbackID()
+	}
+	out.Device = cfg.Device
+
+	dv, err := NewDeviceValidator(DeviceValidatorOptions{Concurrency: 1})
+	if err != nil {
+		return fail(err)
+	}
+	rep, err := dv.Validate(ctx, ValidationRequest{
+		Config:   cfg,
+		Policies: req.Policies,
+		Waivers:  req.Waivers,
+	})
+	if err != nil {
+		return fail(err)
+	}
+	out.Report = rep
+	return out
+}
+
+// fallbackID identifies a device whose configuration has no hostname: by its
+// management address, or else by the base name of its configuration file
+// without the extension.
+func (t FleetTarget) fallbackID() string {
+	if t.Device.ManagementIP != "" {
+		return t.Device.ManagementIP
+	}
+	base := filepath.Base(t.Source)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// Error codes reported in policy.DeviceOutcome.ErrorCode.
+const (
+	// ErrorCodeHostKeyMismatch marks a device whose SSH host key differs from
+	// the recorded one.
+	ErrorCodeHostKeyMismatch = "host_key_mismatch"
+	// ErrorCodeHostKeyUnknown marks a device without a known host key under
+	// the strict host key policy.
+	ErrorCodeHostKeyUnknown = "host_key_unknown"
+)
+
+// ErrorCode classifies err into one of the ErrorCode constants, or returns ""
+// for errors without a code.
+func ErrorCode(err error) string {
+	var mismatch *source.HostKeyMismatchError
+	var unknown *source.UnknownHostKeyError
+	switch {
+	case errors.As(err, &mismatch):
+		return ErrorCodeHostKeyMismatch
+	case errors.As(err, &unknown):
+		return ErrorCodeHostKeyUnknown
+	default:
+		return ""
+	}
+}
+
+// FleetExitCode computes the process exit code of a fleet run: 2 when any
+// device could not be validated, otherwise the highest per-device ExitCode.
+func FleetExitCode(report *policy.FleetReport, strict bool) int {
+	if report == nil {
+		return 2
+	}
+	code := 0
+	for _, d := range report.Devices {
+		c := 2
+		if d.Report != nil {
+			c = ExitCode(d.Report, strict)
+		}
+		if c > code {
+			code = c
+		}
+	}
+	return code
+}
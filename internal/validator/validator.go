@@ -22,10 +22,17 @@ type ValidationRequest struct {
 	Config *model.ConfigModel
 	// Policy is the loaded policy to validate against.
 	Policy *policy.Policy
+	// Policies are further policies evaluated in the same run. When more than
+	// one policy is given they are merged with policy.Merge and the report
+	// carries a summary per policy.
+	Policies []*policy.Policy
 	// Strict causes warnings to be treated as failures for exit-code purposes.
 	Strict bool
 	// Concurrency is the number of parallel rule evaluation workers.
 	Concurrency int
+	// Waivers are exceptions applied to the results. Violations covered by an
+	// active waiver are reported as WAIVED.
+	Waivers []policy.Waiver
 }
 
 // ExitCode computes the appropriate process exit code from a Report.
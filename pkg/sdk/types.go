@@ -7,6 +7,15 @@ type Report struct {
 	PolicyVersion string          `json:"policy_version,omitempty"`
 	Results       []Result        `json:"results"`
 	Summary       ReportSummary   `json:"summary"`
+	Policies      []PolicySummary `json:"policies,omitempty"`
+}
+
+// PolicySummary is the SDK representation of one policy's share of a
+// multi-policy report.
+type PolicySummary struct {
+	Name    string        `json:"name"`
+	Version string        `json:"version,omitempty"`
+	Summary ReportSummary `json:"summary"`
 }
 
 // Device is the SDK representation of a network device.
@@ -18,11 +27,20 @@ type Device struct {
 
 // Result is the SDK representation of a single rule evaluation outcome.
 type Result struct {
-	RuleID      string `json:"rule_id"`
-	Status      string `json:"status"`
-	Severity    string `json:"severity"`
-	Message     string `json:"message"`
-	Remediation string `json:"remediation,omitempty"`
+	RuleID      string     `json:"rule_id"`
+	Policy      string     `json:"policy,omitempty"`
+	Status      string     `json:"status"`
+	Severity    string     `json:"severity"`
+	Message     string     `json:"message"`
+	Remediation string     `json:"remediation,omitempty"`
+	Evidence    []Evidence `json:"evidence,omitempty"`
+}
+
+// Evidence is the SDK representation of a configuration line behind a result.
+type Evidence struct {
+	Line int      `json:"line,omitempty"`
+	Text string   `json:"text"`
+	Path []string `json:"path,omitempty"`
 }
 
 // ReportSummary is the SDK representation of compliance summary metrics.
@@ -32,5 +50,6 @@ type ReportSummary struct {
 	Failed   int     `json:"failed"`
 	Warnings int     `json:"warnings"`
 	Skipped  int     `json:"skipped"`
+	Waived   int     `json:"waived"`
 	Score    float64 `json:"score"`
 }
@@ -0,0 +1,138 @@
+package netsentry_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/0xdevren/netsentry/internal/app"
+	"github.com/0xdevren/netsentry/internal/config/source"
+	"github.com/0xdevren/netsentry/internal/inventory"
+	"github.com/0xdevren/netsentry/internal/model"
+	"github.com/0xdevren/netsentry/internal/policy"
+	"github.com/0xdevren/netsentry/internal/validator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupInventory_Oxidized(t *testing.T) {
+	ctx := context.Background()
+	dir := writePolicies(t, map[string]string{
+		"router.db":      "# name:model:group\ncore-01:iosxe:dc1\nleaf-01:eos:dc2\n\nspine-09:junos:dc1\nlab-01:routeros\n",
+		"dc1/core-01":    "version 17.3\nhostname core-01\nip ssh version 2\nservice password-encryption\n",
+		"dc2/leaf-01":    "hostname leaf-01\nip ssh version 2\n",
+		"lab-01":         "/system identity set name=lab-01\n",
+		"nodes.json":     `[{"name":"core-01","full_name":"dc1/core-01","ip":"10.0.0.1","group":"dc1","model":"ios","status":"success"}]`,
+		"custom.db":      "core-01,10.0.0.1,ios,dc1,core\n",
+		"noname.db":      ":ios:dc1\n",
+		"git/.gitignore": "*\n",
+	})
+
+	inv, err := inventory.LoadBackup(ctx, inventory.BackupOptions{Format: inventory.BackupFormatOxidized, Dir: dir})
+	require.NoError(t, err)
+	var _ inventory.Provider = inv
+	var _ source.ConfigSource = inv
+
+	entries := inv.Entries()
+	require.Len(t, entries, 3, "devices without a backed-up configuration are skipped")
+	assert.Equal(t, "dc1/core-01", entries[0].Config)
+	assert.Equal(t, model.DeviceTypeCiscoIOS, entries[0].Type)
+	assert.Equal(t, "dc1", entries[0].Site)
+	assert.Equal(t, "iosxe", entries[0].Tags["model"])
+	assert.Equal(t, model.DeviceTypeAristaEOS, entries[1].Type)
+	assert.Equal(t, "lab-01", entries[2].Config, "ungrouped devices sit at the top level")
+	assert.Empty(t, entries[2].Type, "unknown models are detected from the configuration")
+
+	d, err := inv.Get(ctx, "leaf-01")
+	require.NoError(t, err)
+	assert.Equal(t, "dc2", d.Site)
+	data, err := inv.Load(ctx, source.LoadRequest{Path: "leaf-01"})
+	require.NoError(t, err)
+	assert.Equal(t, "hostname leaf-01\nip ssh version 2\n", string(data))
+	_, err = inv.Load(ctx, source.LoadRequest{Path: "spine-09"})
+	assert.ErrorContains(t, err, `device "spine-09" not found`)
+
+	inv, err = inventory.LoadBackup(ctx, inventory.BackupOptions{Dir: dir, RouterDB: filepath.Join(dir, "nodes.json")})
+	require.NoError(t, err)
+	d, err = inv.Get(ctx, "core-01")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.1", d.ManagementIP)
+	assert.Equal(t, model.DeviceTypeCiscoIOS, d.Type)
+
+	inv, err = inventory.LoadBackup(ctx, inventory.BackupOptions{
+		Dir:       dir,
+		RouterDB:  filepath.Join(dir, "custom.db"),
+		Delimiter: ",",
+		Columns:   []string{"name", "ip", "model", "group", "role"},
+	})
+	require.NoError(t, err)
+	d, err = inv.Get(ctx, "core-01")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.1", d.ManagementIP)
+	assert.Equal(t, "core", d.Tags["role"], "extra columns become tags")
+
+	_, err = inventory.LoadBackup(ctx, inventory.BackupOptions{Dir: dir, RouterDB: filepath.Join(dir, "noname.db")})
+	assert.ErrorContains(t, err, "device 0 has no name")
+	_, err = inventory.LoadBackup(ctx, inventory.BackupOptions{Format: "clogin", Dir: dir})
+	assert.ErrorContains(t, err, `unsupported format "clogin"`)
+
+	// The inventory feeds fleet validation directly.
+	inv, err = inventory.LoadBackup(ctx, inventory.BackupOptions{Dir: dir})
+	require.NoError(t, err)
+	targets, err := app.ProviderFleetTargets(ctx, "oxidized", inv, inv)
+	require.NoError(t, err)
+	require.Len(t, targets, 3)
+	assert.Equal(t, "oxidized://core-01", targets[0].Source)
+	pol, err := policy.NewLoader().LoadBytes([]byte(fleetPolicy))
+	require.NoError(t, err)
+	rep, err := validator.NewFleetValidator().Validate(ctx, validator.FleetValidationRequest{
+		Targets:  targets[:2],
+		Policies: []*policy.Policy{pol},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "core-01", rep.Devices[0].Device.ID)
+	assert.Equal(t, "dc1", rep.Devices[0].Device.Site)
+	assert.Equal(t, 1, rep.Summary.Compliant)
+}
+
+func TestBackupInventory_RANCID(t *testing.T) {
+	ctx := context.Background()
+	files := map[string]string{
+		"core/router.db":          "core-01;cisco;up;main core\nold-01;cisco;down\nCORE-02;cisco-nx;up\n",
+		"core/configs/core-01":    "!RANCID-CONTENT-TYPE: cisco\nhostname core-01\n",
+		"core/configs/old-01":     "!RANCID-CONTENT-TYPE: cisco\nhostname old-01\n",
+		"core/configs/core-02":    "!RANCID-CONTENT-TYPE: cisco-nx\nhostname core-02\n",
+		"edge/router.db":          "# RANCID 2 format\nedge-01:juniper:up\n",
+		"edge/configs/edge-01":    "#RANCID-CONTENT-TYPE: juniper\nset system host-name edge-01\n",
+		"edge/configs/.cvsignore": "\n",
+	}
+	dir := writePolicies(t, files)
+
+	inv, err := inventory.LoadBackup(ctx, inventory.BackupOptions{Format: inventory.BackupFormatRANCID, Dir: dir})
+	require.NoError(t, err)
+	devices, err := inv.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, devices, 3, "devices not marked up are skipped")
+	assert.Equal(t, "core-01", devices[0].ID)
+	assert.Equal(t, "core", devices[0].Site)
+	assert.Equal(t, "main core", devices[0].Tags["comment"])
+	assert.Equal(t, "core-02", devices[1].ID, "RANCID lower-cases names")
+	assert.Equal(t, model.DeviceTypeCiscoNXOS, devices[1].Type)
+	assert.Equal(t, model.DeviceTypeJuniperOS, devices[2].Type)
+	assert.Equal(t, "edge", devices[2].Site)
+
+	// A RANCID base directory kept in git reads the same.
+	repo := newGitBackupRepo(t)
+	repo.commit(files)
+	inv, err = inventory.LoadBackup(ctx, inventory.BackupOptions{
+		Format:  inventory.BackupFormatRANCID,
+		GitRepo: repo.dir,
+	})
+	require.NoError(t, err)
+	data, err := inv.Load(ctx, source.LoadRequest{Path: "edge-01"})
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "set system host-name edge-01")
+
+	_, err = inventory.LoadBackup(ctx, inventory.BackupOptions{Format: inventory.BackupFormatRANCID, Dir: filepath.Join(dir, "core", "configs")})
+	assert.ErrorContains(t, err, "no <group>/router.db")
+}
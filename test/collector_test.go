@@ -0,0 +1,306 @@
+package netsentry_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/0xdevren/netsentry/internal/config"
+	"github.com/0xdevren/netsentry/internal/config/source"
+	"github.com/0xdevren/netsentry/internal/model"
+	"github.com/0xdevren/netsentry/internal/policy"
+	"github.com/0xdevren/netsentry/internal/validator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const iosRunningConfig = "version 15.2\nhostname edge-01\nip ssh version 2\n"
+
+// sshOptions connects to s, trusting its host key on first use.
+func sshOptions(t *testing.T, s *sshTestServer) source.SSHOptions {
+	return source.SSHOptions{
+		Host: s.Host, Port: s.Port, User: "admin", Password: s.Password, Timeout: 5 * time.Second,
+		HostKeyPolicy: source.HostKeyTOFU, KnownHostsFile: filepath.Join(t.TempDir(), "known_hosts"),
+	}
+}
+
+func TestCollector_CommandByType(t *testing.T) {
+	srv := startSSHServer(t, map[string]string{"show running-config": iosRunningConfig})
+
+	data, dt, err := config.NewCollector().Collect(context.Background(), sshOptions(t, srv), model.DeviceTypeCiscoIOS)
+	require.NoError(t, err)
+	assert.Equal(t, iosRunningConfig, string(data))
+	assert.Equal(t, model.DeviceTypeCiscoIOS, dt)
+	assert.Equal(t, []string{"show running-config"}, srv.Executed())
+}
+
+func TestCollector_ProbesUnknownPlatform(t *testing.T) {
+	junos := "set system host-name mx-01\nset system services ssh\n"
+	srv := startSSHServer(t, map[string]string{"show configuration | display set": junos})
+
+	data, dt, err := config.NewCollector().Collect(context.Background(), sshOptions(t, srv), "")
+	require.NoError(t, err)
+	assert.Equal(t, junos, string(data))
+	assert.Equal(t, model.DeviceTypeJuniperOS, dt)
+	assert.Equal(t, []string{"show running-config", "show configuration | display set"}, srv.Executed())
+
+	empty := startSSHServer(t, nil)
+	_, _, err = config.NewCollector().Collect(context.Background(), sshOptions(t, empty), "")
+	assert.ErrorContains(t, err, "cannot determine device type")
+}
+
+func TestScan_FleetWithDeviceTimeout(t *testing.T) {
+	fast := startSSHServer(t, map[string]string{"show running-config": iosRunningConfig})
+	slow := startSSHServer(t, map[string]string{"show running-config": "version 15.2\nhostname edge-02\n"})
+	slow.SetDelay(2 * time.Second)
+
+	pol := &policy.Policy{Name: "scan", Rules: []policy.Rule{
+		{ID: "SSH-001", Severity: policy.SeverityHigh, Match: policy.MatchSpec{Contains: "ip ssh version 2"}},
+	}}
+	collector := config.NewCollector()
+	var targets []validator.FleetTarget
+	for _, srv := range []*sshTestServer{fast, slow} {
+		opts := sshOptions(t, srv)
+		targets = append(targets, validator.FleetTarget{
+			Source: srv.Host,
+			Device: model.Device{ManagementIP: srv.Host},
+			Load: func(ctx context.Context) ([]byte, error) {
+				data, _, err := collector.Collect(ctx, opts, "")
+				return data, err
+			},
+		})
+	}
+
+	rep, err := validator.NewFleetValidator().Validate(context.Background(), validator.FleetValidationRequest{
+		Targets:       targets,
+		Policies:      []*policy.Policy{pol},
+		Concurrency:   2,
+		DeviceTimeout: 500 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	require.Len(t, rep.Devices, 2)
+
+	assert.Equal(t, "127.0.0.1", rep.Devices[0].Device.ID, "a device that timed out is identified by its address")
+	assert.Contains(t, rep.Devices[0].Error, "context deadline exceeded")
+	assert.Equal(t, "edge-01", rep.Devices[1].Device.ID)
+	require.NotNil(t, rep.Devices[1].Report)
+	assert.Equal(t, 1, rep.Devices[1].Report.Summary.Passed)
+	assert.Equal(t, 2, validator.FleetExitCode(rep, false))
+}
+
+func TestSSHSource_HostKeyPolicies(t *testing.T) {
+	srv := startSSHServer(t, map[string]string{"show running-config": iosRunningConfig})
+	ctx := context.Background()
+	load := func(opts source.SSHOptions) error {
+		_, err := source.NewSSHSource().Load(ctx, source.LoadRequest{SSHOptions: &opts})
+		return err
+	}
+	opts := sshOptions(t, srv)
+
+	opts.HostKeyPolicy = source.HostKeyStrict
+	var unknown *source.UnknownHostKeyError
+	require.True(t, errors.As(load(opts), &unknown), "strict rejects hosts missing from known_hosts")
+	assert.Equal(t, ssh.FingerprintSHA256(srv.HostKey.PublicKey()), unknown.Fingerprint)
+
+	opts.HostKeyPolicy = source.HostKeyTOFU
+	require.NoError(t, load(opts), "tofu trusts a new host")
+	recorded, err := os.ReadFile(opts.KnownHostsFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(recorded), knownhosts.Normalize(srv.Addr()))
+
+	opts.HostKeyPolicy = source.HostKeyStrict
+	require.NoError(t, load(opts), "strict accepts the recorded key")
+
+	// Replace the recorded key, as if the device presented a different one.
+	other := startSSHServer(t, nil)
+	line := knownhosts.Line([]string{knownhosts.Normalize(srv.Addr())}, other.HostKey.PublicKey())
+	require.NoError(t, os.WriteFile(opts.KnownHostsFile, []byte(line+"\n"), 0o600))
+	for _, policy := range []source.HostKeyPolicy{source.HostKeyStrict, source.HostKeyTOFU} {
+		opts.HostKeyPolicy = policy
+		err := load(opts)
+		var mismatch *source.HostKeyMismatchError
+		require.True(t, errors.As(err, &mismatch), "%s rejects a changed key: %v", policy, err)
+		assert.Equal(t, validator.ErrorCodeHostKeyMismatch, validator.ErrorCode(err))
+		require.Len(t, mismatch.Known, 1)
+		assert.Contains(t, mismatch.Known[0], ssh.FingerprintSHA256(other.HostKey.PublicKey()))
+	}
+
+	opts.HostKeyPolicy = source.HostKeyInsecure
+	assert.NoError(t, load(opts))
+}
+
+func TestSSHSource_HostKeyAlgorithms(t *testing.T) {
+	srv := startSSHServer(t, map[string]string{"show running-config": iosRunningConfig})
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	rsaSigner, err := ssh.NewSignerFromKey(rsaKey)
+	require.NoError(t, err)
+	srv.AddHostKey(rsaSigner)
+
+	// Whichever key type is recorded, it is the one negotiated, so the host
+	// is not taken for one whose key has changed.
+	for _, key := range []ssh.PublicKey{rsaSigner.PublicKey(), srv.HostKey.PublicKey()} {
+		opts := sshOptions(t, srv)
+		line := knownhosts.Line([]string{knownhosts.Normalize(srv.Addr())}, key)
+		require.NoError(t, os.WriteFile(opts.KnownHostsFile, []byte(line+"\n"), 0o600))
+		for _, policy := range []source.HostKeyPolicy{source.HostKeyStrict, source.HostKeyTOFU} {
+			opts.HostKeyPolicy = policy
+			_, err := source.NewSSHSource().Load(context.Background(), source.LoadRequest{SSHOptions: &opts})
+			assert.NoError(t, err, "%s with a known %s key", policy, key.Type())
+		}
+	}
+}
+
+func TestSSHSource_InteractiveShell(t *testing.T) {
+	running := "version 15.2\nhostname edge-01\ninterface Loopback0\n ip address 10.0.0.1 255.255.255.255\nip ssh version 2\nend\n"
+	srv := startSSHServer(t, map[string]string{"show running-config": running})
+	srv.SetShell(cliScript{Hostname: "edge-01", EnableSecret: "en-secret", PageLength: 2})
+	ctx := context.Background()
+
+	opts := sshOptions(t, srv)
+	opts.Interactive = true
+	opts.EnablePassword = "en-secret"
+	data, dt, err := config.NewCollector().Collect(ctx, opts, model.DeviceTypeCiscoIOS)
+	require.NoError(t, err)
+	assert.Equal(t, running, string(data), "echo, prompts and CRLF line endings are stripped")
+	assert.Equal(t, model.DeviceTypeCiscoIOS, dt)
+	assert.Equal(t, []string{"enable", "terminal length 0", "show running-config"}, srv.Executed())
+
+	load := func(opts source.SSHOptions) ([]byte, error) {
+		opts.DeviceType = model.DeviceTypeCiscoIOS
+		return source.NewSSHSource().Load(ctx, source.LoadRequest{SSHOptions: &opts})
+	}
+	opts.EnablePassword = "wrong"
+	_, err = load(opts)
+	assert.ErrorContains(t, err, "privileged mode refused")
+	opts.EnablePassword = ""
+	_, err = load(opts)
+	assert.ErrorContains(t, err, "none is configured")
+
+	// An output line that looks like a prompt does not end the output,
+	// even when a read ends with it.
+	banner := "version 15.2\nhostname edge-01\nbanner motd ^C\n---->\n^C\nip ssh version 2\nend\n"
+	split := startSSHServer(t, map[string]string{"show running-config": banner})
+	split.SetShell(cliScript{Hostname: "edge-01", Pause: "---->"})
+	opts = sshOptions(t, split)
+	opts.Interactive = true
+	data, err = load(opts)
+	require.NoError(t, err)
+	assert.Equal(t, banner, string(data))
+
+	// A device ignoring the pager command pages its output; each --More--
+	// prompt is answered and erased from the result.
+	paged := startSSHServer(t, map[string]string{"show running-config": running})
+	paged.SetShell(cliScript{Hostname: "edge-01", PageLength: 2, PagerCommand: "terminal pager 0"})
+	opts = sshOptions(t, paged)
+	opts.Interactive = true
+	data, err = load(opts)
+	require.NoError(t, err)
+	assert.Equal(t, running, string(data))
+}
+
+func TestSSHSource_ProxyJumpAgentAndCertificate(t *testing.T) {
+	dir := t.TempDir()
+
+	// The first bastion accepts a key held by the SSH agent.
+	_, agentKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	keyring := agent.NewKeyring()
+	require.NoError(t, keyring.Add(agent.AddedKey{PrivateKey: agentKey}))
+	sock := filepath.Join(dir, "agent.sock")
+	ln, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() { _ = agent.ServeAgent(keyring, conn); conn.Close() }()
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", sock)
+
+	// The second bastion and the device trust certificates of a user CA.
+	_, caKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	ca, err := ssh.NewSignerFromKey(caKey)
+	require.NoError(t, err)
+	userPub, userKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	sshPub, err := ssh.NewPublicKey(userPub)
+	require.NoError(t, err)
+	cert := &ssh.Certificate{
+		Key: sshPub, CertType: ssh.UserCert, KeyId: "admin", ValidPrincipals: []string{"admin"},
+		ValidBefore: ssh.CertTimeInfinity,
+	}
+	require.NoError(t, cert.SignCert(rand.Reader, ca))
+	block, err := ssh.MarshalPrivateKey(userKey, "")
+	require.NoError(t, err)
+	keyPath := filepath.Join(dir, "id_ed25519")
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(block), 0o600))
+	require.NoError(t, os.WriteFile(keyPath+"-cert.pub", ssh.MarshalAuthorizedKey(cert), 0o600))
+
+	bastion1 := startSSHServer(t, nil)
+	bastion1.Password = "unused"
+	agentPub, err := ssh.NewPublicKey(agentKey.Public())
+	require.NoError(t, err)
+	bastion1.AuthorizeKey(agentPub)
+	bastion2 := startSSHServer(t, nil)
+	bastion2.Password = "unused"
+	bastion2.TrustUserCA(ca.PublicKey())
+	device := startSSHServer(t, map[string]string{"show running-config": iosRunningConfig})
+	device.Password = "unused"
+	device.TrustUserCA(ca.PublicKey())
+
+	hops, err := source.ParseProxyJump("jump@" + bastion1.Addr() + "," + bastion2.Addr())
+	require.NoError(t, err)
+	require.Len(t, hops, 2)
+	assert.Equal(t, "jump", hops[0].User)
+	hops[0].UseAgent = true
+
+	opts := sshOptions(t, device)
+	opts.Password = ""
+	opts.PrivateKeyPath = keyPath
+	opts.CertificatePath = keyPath + "-cert.pub"
+	opts.ProxyJump = hops
+	data, err := source.NewSSHSource().Load(context.Background(), source.LoadRequest{SSHOptions: &opts})
+	require.NoError(t, err, "each hop authenticates with its own credentials, or the device's")
+	assert.Equal(t, iosRunningConfig, string(data))
+	assert.Equal(t, []string{bastion2.Addr()}, bastion1.Forwarded())
+	assert.Equal(t, []string{device.Addr()}, bastion2.Forwarded())
+
+	known, err := os.ReadFile(opts.KnownHostsFile)
+	require.NoError(t, err)
+	for _, srv := range []*sshTestServer{bastion1, bastion2, device} {
+		assert.Contains(t, string(known), knownhosts.Normalize(srv.Addr()), "every hop's host key is verified")
+	}
+
+	// Without the agent the first bastion rejects the device's certificate.
+	opts.ProxyJump[0].UseAgent = false
+	_, err = source.NewSSHSource().Load(context.Background(), source.LoadRequest{SSHOptions: &opts})
+	assert.ErrorContains(t, err, "jump host")
+
+	// The device's password is not offered to a jump host, even one that
+	// would accept it.
+	bastion3 := startSSHServer(t, nil)
+	bastion3.Password = "secret"
+	opts = sshOptions(t, device)
+	opts.Password = "secret"
+	opts.ProxyJump = []source.SSHHop{{Host: bastion3.Host, Port: bastion3.Port}}
+	_, err = source.NewSSHSource().Load(context.Background(), source.LoadRequest{SSHOptions: &opts})
+	assert.ErrorContains(t, err, "jump host")
+	assert.Empty(t, bastion3.Forwarded())
+}
@@ -0,0 +1,271 @@
+package netsentry_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/0xdevren/netsentry/internal/app"
+	"github.com/0xdevren/netsentry/internal/config/source"
+	"github.com/0xdevren/netsentry/internal/credentials"
+	"github.com/0xdevren/netsentry/internal/inventory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestSecret_Redacted(t *testing.T) {
+	cred := credentials.Credential{Username: "netops", Password: "s3cret", Token: "t0ken"}
+
+	for _, out := range []string{
+		fmt.Sprintf("%v", cred),
+		fmt.Sprintf("%+v", cred),
+		fmt.Sprintf("%#v", cred),
+		fmt.Sprint(cred.Password),
+	} {
+		assert.NotContains(t, out, "s3cret")
+		assert.NotContains(t, out, "t0ken")
+	}
+	data, err := json.Marshal(cred)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"Username":"netops","Password":"[REDACTED]","EnablePassword":"","Token":"[REDACTED]"}`, string(data))
+	data, err = yaml.Marshal(cred)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "s3cret")
+
+	var logs bytes.Buffer
+	slog.New(slog.NewJSONHandler(&logs, nil)).Info("connecting", "password", cred.Password)
+	assert.Contains(t, logs.String(), `"password":"[REDACTED]"`)
+
+	assert.Equal(t, "s3cret", cred.Password.Reveal())
+}
+
+func TestEnvProvider(t *testing.T) {
+	t.Setenv("NETSENTRY_CRED_CORE_ROUTERS_USERNAME", "netops")
+	t.Setenv("NETSENTRY_CRED_CORE_ROUTERS_PASSWORD", "s3cret")
+	t.Setenv("TEST_NETBOX_TOKEN", "t0ken")
+	ctx := context.Background()
+
+	cred, err := credentials.NewEnvProvider("").Get(ctx, "core-routers")
+	require.NoError(t, err)
+	assert.Equal(t, "netops", cred.Username)
+	assert.Equal(t, "s3cret", cred.Password.Reveal())
+	assert.Empty(t, cred.EnablePassword)
+
+	p, err := credentials.Open("env:TEST_")
+	require.NoError(t, err)
+	cred, err = p.Get(ctx, "netbox")
+	require.NoError(t, err)
+	assert.Equal(t, "t0ken", cred.Token.Reveal())
+
+	_, err = p.Get(ctx, "missing")
+	assert.True(t, errors.Is(err, credentials.ErrNotFound))
+
+	_, err = (&credentials.Ref{Name: "core-routers"}).Resolve(ctx)
+	assert.ErrorContains(t, err, "no credentials provider")
+	_, err = credentials.Open("keychain:login")
+	assert.ErrorContains(t, err, `unsupported provider "keychain"`)
+}
+
+func TestEncryptedFileProvider(t *testing.T) {
+	plaintext := []byte("core-routers:\n  username: netops\n  password: s3cret\n  enable_password: en4ble\nnetbox:\n  token: t0ken\n")
+	data, err := credentials.EncryptFile(plaintext, []byte("correct horse"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "NETSENTRY-CREDENTIALS-V1\n"))
+	assert.NotContains(t, string(data), "s3cret")
+	path := filepath.Join(t.TempDir(), "credentials.enc")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	p, err := credentials.LoadEncryptedFile(path, []byte("correct horse"))
+	require.NoError(t, err)
+	cred, err := p.Get(context.Background(), "core-routers")
+	require.NoError(t, err)
+	assert.Equal(t, "netops", cred.Username)
+	assert.Equal(t, "s3cret", cred.Password.Reveal())
+	assert.Equal(t, "en4ble", cred.EnablePassword.Reveal())
+	_, err = p.Get(context.Background(), "missing")
+	assert.True(t, errors.Is(err, credentials.ErrNotFound))
+
+	_, err = credentials.LoadEncryptedFile(path, []byte("wrong"))
+	assert.ErrorContains(t, err, "wrong passphrase")
+
+	t.Setenv(credentials.PassphraseEnv, "correct horse")
+	fp, err := credentials.Open("file:" + path)
+	require.NoError(t, err)
+	cred, err = fp.Get(context.Background(), "netbox")
+	require.NoError(t, err)
+	assert.Equal(t, "t0ken", cred.Token.Reveal())
+
+	_, err = credentials.EncryptFile([]byte("- not a map"), []byte("correct horse"))
+	assert.ErrorContains(t, err, "yaml unmarshal")
+}
+
+func TestVaultProvider(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		paths = append(paths, r.URL.Path)
+		switch r.URL.Path {
+		case "/v1/secret/data/netsentry/core-routers":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+				"data":     map[string]interface{}{"username": "netops", "password": "s3cret"},
+				"metadata": map[string]interface{}{"version": 3},
+			}})
+		case "/v1/kv/netsentry/netbox":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"token": "t0ken"}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	t.Setenv("VAULT_ADDR", srv.URL)
+	t.Setenv("VAULT_TOKEN", "root")
+	p, err := credentials.Open("vault:secret/netsentry")
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		cred, err := p.Get(ctx, "core-routers")
+		require.NoError(t, err)
+		assert.Equal(t, "netops", cred.Username)
+		assert.Equal(t, "s3cret", cred.Password.Reveal())
+	}
+	assert.Len(t, paths, 1, "lookups are cached")
+	_, err = p.Get(ctx, "missing")
+	assert.True(t, errors.Is(err, credentials.ErrNotFound))
+
+	kv1 := credentials.NewVaultProvider(credentials.VaultOptions{
+		Address: srv.URL, Token: "root", Mount: "kv", Prefix: "netsentry", KVVersion: 1,
+	})
+	cred, err := kv1.Get(ctx, "netbox")
+	require.NoError(t, err)
+	assert.Equal(t, "t0ken", cred.Token.Reveal())
+
+	denied := credentials.NewVaultProvider(credentials.VaultOptions{Address: srv.URL, Token: "guess", Mount: "kv"})
+	_, err = denied.Get(ctx, "netbox")
+	assert.ErrorContains(t, err, "unexpected status 403")
+}
+
+func TestExecProvider(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	script := filepath.Join(t.TempDir(), "lookup.sh")
+	require.NoError(t, os.WriteFile(script, []byte(`#!/bin/sh
+case "$2" in
+core-routers) echo '{"username": "netops", "password": "s3cret"}' ;;
+garbled) echo 'password=s3cret' ;;
+*) exit 2 ;;
+esac
+`), 0o700))
+	ctx := context.Background()
+
+	p, err := credentials.Open("exec:" + script + " --name")
+	require.NoError(t, err)
+	cred, err := p.Get(ctx, "core-routers")
+	require.NoError(t, err)
+	assert.Equal(t, "netops", cred.Username)
+	assert.Equal(t, "s3cret", cred.Password.Reveal())
+
+	_, err = p.Get(ctx, "missing")
+	assert.True(t, errors.Is(err, credentials.ErrNotFound))
+	_, err = p.Get(ctx, "garbled")
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "s3cret", "command output stays out of errors")
+}
+
+func TestCredentialRefs_Sources(t *testing.T) {
+	t.Setenv("NETSENTRY_CRED_EOS_USERNAME", "admin")
+	t.Setenv("NETSENTRY_CRED_EOS_PASSWORD", "secret")
+	t.Setenv("NETSENTRY_CRED_EOS_ENABLE_PASSWORD", "en4ble")
+	t.Setenv("NETSENTRY_CRED_NETBOX_TOKEN", "s3cret")
+	ctx := context.Background()
+	creds := credentials.NewEnvProvider("")
+
+	// Device API sources take the username and passwords of the credential.
+	srv, lastCmds := startEAPIServer(t, map[string]string{"show running-config": eosRunningConfig})
+	addr := strings.TrimPrefix(srv.URL, "https://")
+	data, err := source.NewEAPISource().Load(ctx, source.LoadRequest{Path: addr, DeviceAPIOptions: &source.DeviceAPIOptions{
+		Credential: &credentials.Ref{Provider: creds, Name: "eos"},
+		TLS:        source.TLSOptions{InsecureSkipVerify: true},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, eosRunningConfig, string(data))
+	assert.Equal(t, map[string]interface{}{"cmd": "enable", "input": "en4ble"}, (*lastCmds)[0])
+
+	// SSH sources resolve the credential before connecting.
+	sshSrv := startSSHServer(t, map[string]string{"show running-config": iosRunningConfig})
+	t.Setenv("NETSENTRY_CRED_EDGE_USERNAME", "admin")
+	t.Setenv("NETSENTRY_CRED_EDGE_PASSWORD", sshSrv.Password)
+	opts := sshOptions(t, sshSrv)
+	opts.User, opts.Password = "", ""
+	opts.Credential = &credentials.Ref{Provider: creds, Name: "edge"}
+	data, err = source.NewSSHSource().Load(ctx, source.LoadRequest{SSHOptions: &opts})
+	require.NoError(t, err)
+	assert.Equal(t, iosRunningConfig, string(data))
+
+	opts.Credential = &credentials.Ref{Provider: creds, Name: "missing"}
+	_, err = source.NewSSHSource().Load(ctx, source.LoadRequest{SSHOptions: &opts})
+	assert.ErrorContains(t, err, `ssh source: credentials: "missing"`)
+
+	// Inventory services take their token from the credential.
+	netbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Token s3cret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"count": 0, "results": []interface{}{}})
+	}))
+	defer netbox.Close()
+	_, err = inventory.NewNetBoxInventory(inventory.NetBoxOptions{
+		BaseURL:    netbox.URL,
+		Credential: &credentials.Ref{Provider: creds, Name: "netbox"},
+	}).List(ctx)
+	require.NoError(t, err)
+
+	// Inventory credentials name their secret; api sources send its token.
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(iosRunningConfig))
+	}))
+	defer api.Close()
+	invPath := filepath.Join(t.TempDir(), "inventory.yaml")
+	require.NoError(t, os.WriteFile(invPath, []byte(`credentials:
+  cmdb:
+    secret: netbox
+devices:
+  - id: edge-01
+    type: cisco-ios
+    credentials: cmdb
+    source:
+      type: api
+      url: `+api.URL+`/{id}
+`), 0o600))
+	inv, err := inventory.LoadFile(invPath)
+	require.NoError(t, err)
+	targets := app.InventoryFleetTargets(inv, creds)
+	require.Len(t, targets, 1)
+	data, err = targets[0].Load(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, iosRunningConfig, string(data))
+
+	targets = app.InventoryFleetTargets(inv, nil)
+	_, err = targets[0].Load(ctx)
+	assert.ErrorContains(t, err, "no credentials provider")
+}
@@ -0,0 +1,210 @@
+package netsentry_test
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/0xdevren/netsentry/internal/config/source"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const eosRunningConfig = "! Command: show running-config\nhostname spine-01\nmanagement api http-commands\n   no shutdown\n"
+
+// startEAPIServer runs a stand-in for the eAPI endpoint of an EOS device. It
+// accepts admin/secret, requires "enable" first and answers the commands
+// in outputs; any other command fails with an EOS error.
+func startEAPIServer(t *testing.T, outputs map[string]string) (*httptest.Server, *[]interface{}) {
+	t.Helper()
+	var lastCmds []interface{}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/command-api" {
+			http.NotFound(w, r)
+			return
+		}
+		var req struct {
+			Method string `json:"method"`
+			Params struct {
+				Version int           `json:"version"`
+				Cmds    []interface{} `json:"cmds"`
+				Format  string        `json:"format"`
+			} `json:"params"`
+			ID string `json:"id"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "runCmds", req.Method)
+		assert.Equal(t, "text", req.Params.Format)
+		lastCmds = req.Params.Cmds
+
+		result := []map[string]string{}
+		for i, c := range req.Params.Cmds {
+			cmd, _ := c.(string)
+			if m, ok := c.(map[string]interface{}); ok {
+				cmd, _ = m["cmd"].(string)
+			}
+			if i == 0 && cmd == "enable" {
+				result = append(result, map[string]string{"output": ""})
+				continue
+			}
+			out, ok := outputs[cmd]
+			if !ok {
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{
+					"jsonrpc": "2.0", "id": req.ID,
+					"error": map[string]interface{}{"code": 1002, "message": "CLI command 2 of 2 '" + cmd + "' failed: invalid command"},
+				})
+				return
+			}
+			result = append(result, map[string]string{"output": out})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &lastCmds
+}
+
+// writeServerCA writes the certificate of srv as a PEM CA file.
+func writeServerCA(t *testing.T, srv *httptest.Server) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+func TestEAPISource_RunCmds(t *testing.T) {
+	ctx := context.Background()
+	srv, lastCmds := startEAPIServer(t, map[string]string{
+		"show running-config": eosRunningConfig,
+		"show version":        "Arista DCS-7050SX3-48YC8\nSoftware image version: 4.30.1F",
+	})
+	addr := strings.TrimPrefix(srv.URL, "https://")
+	ca := writeServerCA(t, srv)
+	eapi := source.NewEAPISource()
+
+	data, err := eapi.Load(ctx, source.LoadRequest{Path: addr, DeviceAPIOptions: &source.DeviceAPIOptions{
+		Username: "admin", Password: "secret", TLS: source.TLSOptions{CAFile: ca},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, eosRunningConfig, string(data))
+	assert.Equal(t, []interface{}{"enable", "show running-config"}, *lastCmds)
+
+	data, err = eapi.Load(ctx, source.LoadRequest{Path: addr, DeviceAPIOptions: &source.DeviceAPIOptions{
+		Username: "admin", Password: "secret", EnablePassword: "en4ble",
+		Commands: []string{"show version", "show running-config"},
+		TLS:      source.TLSOptions{InsecureSkipVerify: true},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, "Arista DCS-7050SX3-48YC8\nSoftware image version: 4.30.1F\n"+eosRunningConfig, string(data),
+		"outputs are concatenated in command order")
+	require.Len(t, *lastCmds, 3)
+	assert.Equal(t, map[string]interface{}{"cmd": "enable", "input": "en4ble"}, (*lastCmds)[0])
+
+	opts := func(mut func(*source.DeviceAPIOptions)) *source.DeviceAPIOptions {
+		o := &source.DeviceAPIOptions{Username: "admin", Password: "secret", TLS: source.TLSOptions{CAFile: ca}}
+		mut(o)
+		return o
+	}
+	_, err = eapi.Load(ctx, source.LoadRequest{Path: addr, DeviceAPIOptions: opts(func(o *source.DeviceAPIOptions) {
+		o.TLS = source.TLSOptions{}
+	})})
+	assert.ErrorContains(t, err, "certificate", "untrusted certificates are rejected")
+
+	_, err = eapi.Load(ctx, source.LoadRequest{Path: addr, DeviceAPIOptions: opts(func(o *source.DeviceAPIOptions) {
+		o.Password = "wrong"
+	})})
+	assert.ErrorContains(t, err, "authentication failed (status 401)")
+
+	_, err = eapi.Load(ctx, source.LoadRequest{Path: addr, DeviceAPIOptions: opts(func(o *source.DeviceAPIOptions) {
+		o.Commands = []string{"show bogus"}
+	})})
+	assert.ErrorContains(t, err, "eapi source: error 1002")
+
+	_, err = eapi.Load(ctx, source.LoadRequest{Path: addr, DeviceAPIOptions: opts(func(o *source.DeviceAPIOptions) {
+		o.TLS.CAFile = filepath.Join(t.TempDir(), "missing.pem")
+	})})
+	assert.ErrorContains(t, err, "read CA file")
+}
+
+func TestNXAPISource_CLIShowASCII(t *testing.T) {
+	ctx := context.Background()
+	outputs := map[string]string{
+		"show running-config": "!Command: show running-config\nhostname leaf-01\nfeature nxapi\n",
+		"show version":        "Cisco Nexus Operating System (NX-OS) Software",
+	}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "admin" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var req struct {
+			InsAPI struct {
+				Type  string `json:"type"`
+				Input string `json:"input"`
+			} `json:"ins_api"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "/ins", r.URL.Path)
+		assert.Equal(t, "cli_show_ascii", req.InsAPI.Type)
+
+		var results []map[string]string
+		for _, cmd := range strings.Split(req.InsAPI.Input, ";") {
+			cmd = strings.TrimSpace(cmd)
+			if out, ok := outputs[cmd]; ok {
+				results = append(results, map[string]string{"input": cmd, "msg": "Success", "code": "200", "body": out})
+			} else {
+				results = append(results, map[string]string{"input": cmd, "msg": "Input CLI command error", "code": "400", "clierror": "% Invalid command\n"})
+			}
+		}
+		// NX-API returns a bare object for a single command.
+		var output interface{} = results
+		if len(results) == 1 {
+			output = results[0]
+		}
+		if results[len(results)-1]["code"] != "200" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"ins_api": map[string]interface{}{
+			"type": "cli_show_ascii", "version": "1.0", "sid": "eoc",
+			"outputs": map[string]interface{}{"output": output},
+		}})
+	}))
+	t.Cleanup(srv.Close)
+	addr := strings.TrimPrefix(srv.URL, "https://")
+	ca := writeServerCA(t, srv)
+	nxapi := source.NewNXAPISource()
+
+	load := func(commands ...string) ([]byte, error) {
+		return nxapi.Load(ctx, source.LoadRequest{Path: addr, DeviceAPIOptions: &source.DeviceAPIOptions{
+			Username: "admin", Password: "secret", Commands: commands, TLS: source.TLSOptions{CAFile: ca},
+		}})
+	}
+	data, err := load()
+	require.NoError(t, err)
+	assert.Equal(t, outputs["show running-config"], string(data))
+
+	data, err = load("show version", "show running-config")
+	require.NoError(t, err)
+	assert.Equal(t, outputs["show version"]+"\n"+outputs["show running-config"], string(data))
+
+	_, err = load("show running-config", "show bogus")
+	assert.ErrorContains(t, err, `nxapi source: "show bogus": code 400: % Invalid command`)
+
+	_, err = nxapi.Load(ctx, source.LoadRequest{Path: addr, DeviceAPIOptions: &source.DeviceAPIOptions{
+		Username: "admin", Password: "wrong", TLS: source.TLSOptions{CAFile: ca},
+	}})
+	assert.ErrorContains(t, err, "authentication failed (status 401)")
+
+	_, err = nxapi.Load(ctx, source.LoadRequest{Path: addr})
+	assert.ErrorContains(t, err, "DeviceAPIOptions are required")
+}
@@ -0,0 +1,388 @@
+package netsentry_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/0xdevren/netsentry/internal/app"
+	"github.com/0xdevren/netsentry/internal/config"
+	"github.com/0xdevren/netsentry/internal/inventory"
+	"github.com/0xdevren/netsentry/internal/model"
+	"github.com/0xdevren/netsentry/internal/policy"
+	"github.com/0xdevren/netsentry/internal/policy/vars"
+	"github.com/0xdevren/netsentry/internal/validator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const fleetPolicy = `
+name: fleet
+rules:
+  - id: SSH-001
+    severity: HIGH
+    match:
+      contains: "ip ssh version 2"
+    action:
+      deny: false
+  - id: PWENC-001
+    severity: MEDIUM
+    match:
+      contains: "service password-encryption"
+    action:
+      deny: false
+`
+
+func TestFleetValidator_ConfigDir(t *testing.T) {
+	dir := writePolicies(t, map[string]string{
+		"policy.yaml":       fleetPolicy,
+		"configs/r1.conf":   "version 15.2\nhostname core-01\nip ssh version 2\nservice password-encryption\n",
+		"configs/r2.conf":   "version 15.2\nhostname edge-01\nip ssh version 2\n",
+		"configs/r3.conf":   "version 15.2\nhostname edge-02\ninterface GigabitEthernet0/1\n",
+		"configs/.git/HEAD": "ref: refs/heads/main\n",
+		"configs/bad/x.txt": "not a device configuration\n",
+		"configs/vars.yaml": "sites:\n  dc1:\n    ntp_server: 10.1.1.1\n",
+		"configs/README.md": "# Device configurations\n",
+		"backups/edge-03":   "version 15.2\nhostname edge-03\n",
+	})
+
+	targets, err := app.FleetTargets(filepath.Join(dir, "configs"), "")
+	require.NoError(t, err)
+	require.Len(t, targets, 4, "hidden directories and files that are not configurations are skipped")
+
+	files, err := config.Discover(filepath.Join(dir, "backups"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "backups", "edge-03")}, files, "configurations without an extension are recognised")
+
+	pol, err := policy.NewLoader().LoadFile(filepath.Join(dir, "policy.yaml"))
+	require.NoError(t, err)
+	rep, err := validator.NewFleetValidator().Validate(context.Background(), validator.FleetValidationRequest{
+		Targets:     targets,
+		Policies:    []*policy.Policy{pol},
+		Concurrency: 2,
+	})
+	require.NoError(t, err)
+
+	ids := make([]string, 0, len(rep.Devices))
+	for _, d := range rep.Devices {
+		ids = append(ids, d.Device.ID)
+	}
+	assert.Equal(t, []string{"core-01", "edge-01", "edge-02", "x"}, ids, "devices are identified by hostname")
+	assert.Contains(t, rep.Devices[3].Error, "parse")
+
+	s := rep.Summary
+	assert.Equal(t, 4, s.Devices)
+	assert.Equal(t, 1, s.Compliant)
+	assert.Equal(t, 2, s.NonCompliant)
+	assert.Equal(t, 1, s.Errors)
+	assert.InDelta(t, 50.0, s.Score, 0.01)
+	require.Len(t, s.WorstOffenders, 2)
+	assert.Equal(t, "edge-02", s.WorstOffenders[0].Device)
+	require.Len(t, s.TopFailingRules, 2)
+	assert.Equal(t, policy.RuleFailures{RuleID: "PWENC-001", Severity: policy.SeverityMedium, Devices: 2}, s.TopFailingRules[0])
+
+	assert.Equal(t, 2, validator.FleetExitCode(rep, false), "unvalidated devices are execution errors")
+	rep.Devices = rep.Devices[:1]
+	assert.Equal(t, 0, validator.FleetExitCode(rep, false))
+}
+
+func TestInventory_LoadFile(t *testing.T) {
+	dir := writePolicies(t, map[string]string{
+		"inventory.yaml": `
+devices:
+  - id: edge-01
+    type: cisco-ios
+    site: dc1
+    role: edge
+    config: configs/edge-01.conf
+    ssh:
+      user: netops
+      key: keys/netops
+      proxy_jump:
+        - host: bastion.example.net
+          agent: true
+  - hostname: spine-01
+    tags: {tier: spine}
+`,
+		"dup.yaml":    "devices:\n  - id: a\n  - hostname: a\n",
+		"noname.yaml": "devices:\n  - site: dc1\n",
+		"nohop.yaml":  "devices:\n  - id: a\n    ssh:\n      proxy_jump:\n        - user: ops\n",
+	})
+
+	inv, err := inventory.LoadFile(filepath.Join(dir, "inventory.yaml"))
+	require.NoError(t, err)
+	entries := inv.Entries()
+	require.Len(t, entries, 2)
+	assert.Equal(t, model.DeviceTypeCiscoIOS, entries[0].Type)
+	assert.Equal(t, "dc1", entries[0].Site)
+	assert.Equal(t, filepath.Join(dir, "configs", "edge-01.conf"), entries[0].Config)
+	require.NotNil(t, entries[0].SSH)
+	assert.Equal(t, filepath.Join(dir, "keys", "netops"), entries[0].SSH.Key)
+	require.Len(t, entries[0].SSH.ProxyJump, 1)
+	assert.Equal(t, inventory.SSHEndpoint{Host: "bastion.example.net", Agent: true}, entries[0].SSH.ProxyJump[0])
+
+	d, err := inv.Get(context.Background(), "spine-01")
+	require.NoError(t, err)
+	assert.Equal(t, "spine", d.Tags["tier"])
+
+	_, err = inventory.LoadFile(filepath.Join(dir, "dup.yaml"))
+	assert.ErrorContains(t, err, "duplicate device")
+	_, err = inventory.LoadFile(filepath.Join(dir, "noname.yaml"))
+	assert.ErrorContains(t, err, "no id or hostname")
+	_, err = inventory.LoadFile(filepath.Join(dir, "nohop.yaml"))
+	assert.ErrorContains(t, err, "proxy_jump hop 0 has no host")
+
+	targets, err := app.FleetTargets("", filepath.Join(dir, "inventory.yaml"))
+	require.NoError(t, err)
+	require.Len(t, targets, 1, "devices without a config file are skipped")
+	assert.Equal(t, "edge-01", targets[0].Device.ID)
+}
+
+func TestInventory_GroupsAndSources(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("CONFIG_API_TOKEN", "s3cret")
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = io.WriteString(w, "version 15.2\nhostname leaf-01\nip ssh version 2\n")
+	}))
+	defer api.Close()
+	repo := newGitBackupRepo(t)
+	repo.commit(map[string]string{
+		"configs/core-01": "version 15.2\nhostname core-01\nip ssh version 2\nservice password-encryption\n",
+	})
+
+	dir := writePolicies(t, map[string]string{
+		"inventory.yaml": `
+groups:
+  all:
+    credentials: netops
+    tags: {managed: "true"}
+  dc1:
+    site: dc1
+    type: cisco-ios
+    vars: {ntp_server: 10.1.1.1, syslog: 10.9.9.9}
+  backups:
+    source:
+      type: git
+      repo: ` + repo.dir + `
+      path: configs/{id}
+credentials:
+  netops:
+    user: netops
+    key: keys/netops
+  api:
+    token_env: CONFIG_API_TOKEN
+devices:
+  - id: edge-01
+    groups: [dc1]
+    role: edge
+    config: configs/edge-01.conf
+  - id: core-01
+    groups: [dc1, backups]
+    vars: {ntp_server: 10.1.1.2}
+  - id: leaf-01
+    credentials: api
+    source:
+      type: api
+      url: ` + api.URL + `/devices/{id}
+  - id: spine-01
+    management_ip: 10.20.0.1
+    source: {type: eapi}
+device_files: [devices.csv]
+`,
+		"devices.csv":          "id,management_ip,groups,config,rack\nedge-02,10.0.0.2,dc1,configs/edge-02.conf,r12\n",
+		"solo.csv":             "# exported from the CMDB\nhostname,management_ip,type\nedge-02,10.0.0.2,arista-eos\n",
+		"configs/edge-01.conf": "version 15.2\nhostname edge-01\nip ssh version 2\n",
+		"configs/edge-02.conf": "version 15.2\nhostname edge-02\n",
+		"nogroup.yaml":         "devices:\n  - id: a\n    groups: [dc9]\n",
+		"nocreds.yaml":         "devices:\n  - id: a\n    credentials: root\n",
+		"norepo.yaml":          "devices:\n  - id: a\n    source: {type: git, path: a.conf}\n",
+		"badsource.yaml":       "devices:\n  - id: a\n    source: {type: tftp}\n",
+		"badtype.yaml":         "groups:\n  g: {type: cisco-asa}\ndevices:\n  - id: a\n",
+		"both.yaml":            "devices:\n  - id: a\n    config: a.conf\n    source: {type: ssh}\n",
+	})
+
+	inv, err := inventory.LoadFile(filepath.Join(dir, "inventory.yaml"))
+	require.NoError(t, err)
+	entries := inv.Entries()
+	require.Len(t, entries, 5, "CSV devices follow those of the file")
+
+	edge := entries[0]
+	assert.Equal(t, model.DeviceTypeCiscoIOS, edge.Type)
+	assert.Equal(t, "dc1", edge.Site)
+	assert.Equal(t, "netops", edge.Credentials, "the all group applies to every device")
+	assert.Equal(t, map[string]string{"managed": "true"}, edge.Tags)
+	assert.Equal(t, inventory.SourceFile, edge.Source.Type)
+	assert.Equal(t, filepath.Join(dir, "configs", "edge-01.conf"), edge.Config)
+
+	core := entries[1]
+	require.NotNil(t, core.Source)
+	assert.Equal(t, inventory.SourceGit, core.Source.Type)
+	assert.Equal(t, "configs/core-01", core.Source.Path, "placeholders are filled per device")
+	assert.Equal(t, "HEAD", core.Source.Ref)
+	assert.Equal(t, map[string]interface{}{"ntp_server": "10.1.1.2", "syslog": "10.9.9.9"}, core.Vars, "device vars override group vars")
+
+	assert.Equal(t, "api", entries[2].Credentials)
+	assert.True(t, entries[3].Source.Live())
+	assert.Equal(t, "r12", entries[4].Tags["rack"], "extra CSV columns become tags")
+	assert.Equal(t, "dc1", entries[4].Site)
+
+	cred, ok := inv.Credential("netops")
+	require.True(t, ok)
+	assert.Equal(t, filepath.Join(dir, "keys", "netops"), cred.Key)
+
+	scope := inv.Variables().Scope(core.Device)
+	v, ok := scope.Lookup(vars.Reference{Namespace: vars.NamespaceDevice, Key: "ntp_server"})
+	assert.True(t, ok)
+	assert.Equal(t, "10.1.1.2", v)
+
+	for name, msg := range map[string]string{
+		"nogroup.yaml":   `device "a": unknown group "dc9"`,
+		"nocreds.yaml":   `device "a": unknown credentials "root"`,
+		"norepo.yaml":    "git source needs a repo and a path",
+		"badsource.yaml": `unsupported source type "tftp"`,
+		"badtype.yaml":   `group "g": unsupported device type "cisco-asa"`,
+		"both.yaml":      "config and source cannot be combined",
+	} {
+		_, err := inventory.LoadFile(filepath.Join(dir, name))
+		assert.ErrorContains(t, err, msg, name)
+	}
+
+	// A CSV file is an inventory of its own.
+	csvInv, err := inventory.LoadFile(filepath.Join(dir, "solo.csv"))
+	require.NoError(t, err)
+	d, err := csvInv.Get(ctx, "edge-02")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.2", d.ManagementIP)
+	assert.Equal(t, model.DeviceTypeAristaEOS, d.Type)
+
+	// Stored configurations are validated; the live device is left to scan.
+	targets := app.InventoryFleetTargets(inv, nil)
+	require.Len(t, targets, 4)
+	assert.Equal(t, "HEAD:configs/core-01", targets[1].Source)
+	assert.Equal(t, api.URL+"/devices/leaf-01", targets[2].Source)
+	pol, err := policy.NewLoader().LoadBytes([]byte(fleetPolicy))
+	require.NoError(t, err)
+	rep, err := validator.NewFleetValidator().Validate(ctx, validator.FleetValidationRequest{
+		Targets:  targets,
+		Policies: []*policy.Policy{pol},
+	})
+	require.NoError(t, err)
+	require.Len(t, rep.Devices, 4)
+	assert.Zero(t, rep.Summary.Errors)
+	assert.Equal(t, 1, rep.Summary.Compliant)
+}
+
+func TestScanTargets(t *testing.T) {
+	ctx := context.Background()
+	dir := writePolicies(t, map[string]string{
+		"inventory.yaml": `
+devices:
+  - id: edge-01
+    config: configs/edge-01.conf
+  - id: core-01
+    vars: {ntp_server: 10.1.1.2}
+  - id: spine-01
+    management_ip: 10.20.0.1
+    source: {type: eapi}
+`,
+		"configs/edge-01.conf": "version 15.2\nhostname edge-01\n",
+	})
+	netbox, _ := startNetBox(t)
+	pol, err := policy.NewLoader().LoadBytes([]byte(fleetPolicy))
+	require.NoError(t, err)
+
+	opts := app.ScanOptions{
+		Targets:       []string{"10.0.0.9:2222", "10.0.0.10"},
+		InventoryPath: filepath.Join(dir, "inventory.yaml"),
+		NetBox:        &inventory.NetBoxOptions{BaseURL: netbox.URL, Token: "s3cret"},
+		Transport:     "ssh",
+		Policies:      []*policy.Policy{pol},
+	}
+	targets, _, err := app.ScanTargets(ctx, opts)
+	require.NoError(t, err)
+	sources := make([]string, len(targets))
+	for i, tg := range targets {
+		sources[i] = tg.Source
+	}
+	assert.Equal(t, []string{
+		filepath.Join(dir, "configs", "edge-01.conf"),
+		"ssh://core-01:22",
+		"eapi://10.20.0.1:443",
+		"ssh://10.0.0.1:22",
+		"ssh://[2001:db8::1]:22",
+		"ssh://fw-01:22",
+		"ssh://10.0.0.9:2222",
+		"ssh://10.0.0.10:22",
+	}, sources)
+	assert.Equal(t, model.DeviceTypeAristaEOS, targets[2].Device.Type, "device APIs imply the device type")
+	assert.Equal(t, "edge-01", targets[3].Device.ID, "NetBox devices are reported by name")
+	assert.Equal(t, "11", targets[3].Device.Tags["netbox_id"])
+
+	scope := pol.Variables.Scope(model.Device{ID: "core-01"})
+	v, ok := scope.Lookup(vars.Reference{Namespace: vars.NamespaceDevice, Key: "ntp_server"})
+	assert.True(t, ok, "inventory vars reach the policies")
+	assert.Equal(t, "10.1.1.2", v)
+	scope = pol.Variables.Scope(targets[3].Device)
+	v, ok = scope.Lookup(vars.Reference{Namespace: vars.NamespaceDevice, Key: "ntp.primary"})
+	assert.True(t, ok, "config contexts reach the policies")
+	assert.Equal(t, "10.1.1.1", v)
+
+	for _, tc := range []struct {
+		opts app.ScanOptions
+		code int
+		msg  string
+	}{
+		{app.ScanOptions{Transport: "telnet"}, 3, `unsupported transport "telnet"`},
+		{app.ScanOptions{Transport: "ssh", Targets: []string{"10.0.0.1:99999"}}, 3, "invalid port"},
+		{app.ScanOptions{Transport: "ssh", NetBox: &inventory.NetBoxOptions{BaseURL: netbox.URL, Token: "wrong"}}, 2, "unexpected status 403"},
+	} {
+		_, code, err := app.ScanTargets(ctx, tc.opts)
+		assert.ErrorContains(t, err, tc.msg)
+		assert.Equal(t, tc.code, code, tc.msg)
+	}
+}
+
+func TestRunValidateFleet_DeviceTimeout(t *testing.T) {
+	// Each device takes longer than half the timeout, so validating them one
+	// after another only succeeds if the timeout applies per device.
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+		_, _ = io.WriteString(w, "version 15.2\nhostname "+filepath.Base(r.URL.Path)+"\nip ssh version 2\nservice password-encryption\n")
+	}))
+	t.Cleanup(api.Close)
+	dir := writePolicies(t, map[string]string{
+		"inventory.yaml": `
+groups:
+  all:
+    source:
+      type: api
+      url: ` + api.URL + `/devices/{id}
+devices:
+  - id: edge-01
+  - id: edge-02
+`,
+		"policy.yaml": fleetPolicy,
+	})
+
+	appCtx := app.NewContext(app.RuntimeConfig{LogLevel: "error"})
+	rep, code, err := app.NewOrchestrator(appCtx).RunValidateFleet(context.Background(), app.ValidateCommandOptions{
+		InventoryPath: filepath.Join(dir, "inventory.yaml"),
+		PolicyPaths:   []string{filepath.Join(dir, "policy.yaml")},
+		Format:        "json",
+		OutputPath:    filepath.Join(dir, "report.json"),
+		Timeout:       500 * time.Millisecond,
+		Concurrency:   1,
+	})
+	require.NoError(t, err)
+	require.Len(t, rep.Devices, 2)
+	assert.Zero(t, rep.Summary.Errors)
+	assert.Equal(t, 0, code)
+}
@@ -0,0 +1,156 @@
+package netsentry_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/0xdevren/netsentry/internal/inventory"
+	"github.com/0xdevren/netsentry/internal/model"
+	"github.com/0xdevren/netsentry/internal/policy/vars"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPInventory_Mapping(t *testing.T) {
+	ctx := context.Background()
+	t.Setenv("CMDB_TOKEN", "s3cret")
+	pages := map[string]interface{}{
+		"1": map[string]interface{}{
+			"data": []interface{}{
+				map[string]interface{}{
+					"asset_tag": "A-1001", "name": "edge-01",
+					"os":         map[string]interface{}{"family": "IOS-XE", "version": "17.3.4"},
+					"interfaces": []interface{}{map[string]interface{}{"address": "10.0.0.1/24"}},
+					"location":   map[string]interface{}{"site name": "dc1", "rack": 12.0},
+					"attributes": map[string]interface{}{"ntp": "10.1.1.1"},
+					"labels":     []interface{}{"pci", "prod"},
+				},
+				map[string]interface{}{"os": map[string]interface{}{"family": "IOS-XE"}},
+			},
+			"links": map[string]interface{}{"next": "?page=2"},
+		},
+		"2": map[string]interface{}{
+			"data": []interface{}{
+				map[string]interface{}{"asset_tag": "A-1002", "name": "leaf-01", "os": map[string]interface{}{"family": "eos"}},
+			},
+			"links": map[string]interface{}{"next": nil},
+		},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		page := r.URL.Query().Get("page")
+		if page == "" {
+			page = "1"
+		}
+		_ = json.NewEncoder(w).Encode(pages[page])
+	}))
+	defer srv.Close()
+
+	dir := writePolicies(t, map[string]string{
+		"cmdb.yaml": `
+url: ` + srv.URL + `/api/assets
+headers:
+  Authorization: Bearer ${CMDB_TOKEN}
+items: $.data[*]
+next: $.links.next
+fields:
+  id: $.asset_tag
+  hostname: $.name
+  type: $.os.family
+  version: $.os.version
+  management_ip: $.interfaces[0].address
+  site: $.location['site name']
+types:
+  IOS-XE: cisco-ios
+tags:
+  rack: $.location.rack
+  labels: $.labels
+vars: $.attributes
+`,
+		"noid.yaml":    "url: http://cmdb\nfields:\n  site: $.site\n",
+		"badpath.yaml": "url: http://cmdb\nfields:\n  id: $.interfaces[first]\n",
+		"badtype.yaml": "url: http://cmdb\nfields:\n  id: $.id\ntypes:\n  ASA: cisco-asa\n",
+		"field.yaml":   "url: http://cmdb\nfields:\n  id: $.id\n  serial: $.serial\n",
+	})
+
+	mapping, err := inventory.LoadHTTPMapping(filepath.Join(dir, "cmdb.yaml"))
+	require.NoError(t, err)
+	cmdb := inventory.NewHTTPInventory(mapping, inventory.HTTPOptions{})
+	var _ inventory.VariablesProvider = cmdb
+
+	devices, err := cmdb.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, devices, 2, "records without an id or hostname are skipped and the next page is followed")
+	edge := devices[0]
+	assert.Equal(t, "A-1001", edge.ID)
+	assert.Equal(t, "edge-01", edge.Hostname)
+	assert.Equal(t, model.DeviceTypeCiscoIOS, edge.Type)
+	assert.Equal(t, "17.3.4", edge.Version)
+	assert.Equal(t, "10.0.0.1", edge.ManagementIP)
+	assert.Equal(t, "dc1", edge.Site)
+	assert.Equal(t, map[string]string{"rack": "12", "labels": `["pci","prod"]`}, edge.Tags)
+	assert.Equal(t, model.DeviceTypeAristaEOS, devices[1].Type, "unlisted types are read as platform names")
+
+	v, ok := cmdb.Variables().Scope(edge).Lookup(vars.Reference{Namespace: vars.NamespaceDevice, Key: "ntp"})
+	assert.True(t, ok)
+	assert.Equal(t, "10.1.1.1", v)
+
+	d, err := cmdb.Get(ctx, "A-1002")
+	require.NoError(t, err)
+	assert.Equal(t, "leaf-01", d.Hostname)
+	_, err = cmdb.Get(ctx, "A-9999")
+	assert.ErrorContains(t, err, `device "A-9999" not found`)
+
+	for name, msg := range map[string]string{
+		"noid.yaml":    "fields need an id or hostname path",
+		"badpath.yaml": `invalid index "first"`,
+		"badtype.yaml": `unsupported device type "cisco-asa"`,
+		"field.yaml":   `unknown device field "serial"`,
+	} {
+		_, err := inventory.LoadHTTPMapping(filepath.Join(dir, name))
+		assert.ErrorContains(t, err, msg, name)
+	}
+
+	t.Setenv("CMDB_TOKEN", "wrong")
+	_, err = cmdb.List(ctx)
+	assert.ErrorContains(t, err, "http inventory: unexpected status 401")
+}
+
+func TestHTTPInventory_NextLinkOnOtherHost(t *testing.T) {
+	var leaked []string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaked = append(leaked, r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer other.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": []interface{}{map[string]interface{}{"name": "edge-01"}},
+			"next": other.URL + "/api/assets?page=2",
+		})
+	}))
+	defer srv.Close()
+
+	dir := writePolicies(t, map[string]string{"cmdb.yaml": `
+url: ` + srv.URL + `/api/assets
+headers:
+  Authorization: Bearer s3cret
+items: $.data[*]
+next: $.next
+fields:
+  hostname: $.name
+`})
+	mapping, err := inventory.LoadHTTPMapping(filepath.Join(dir, "cmdb.yaml"))
+	require.NoError(t, err)
+
+	_, err = inventory.NewHTTPInventory(mapping, inventory.HTTPOptions{}).List(context.Background())
+	assert.ErrorContains(t, err, "is not on http://"+srv.Listener.Addr().String())
+	assert.Empty(t, leaked, "the headers are not sent to another host")
+}
@@ -1,10 +1,15 @@
 package netsentry_test
 
 import (
+	"context"
 	"testing"
 
 	"github.com/0xdevren/netsentry/internal/model"
+	"github.com/0xdevren/netsentry/internal/parser/cisco"
+	"github.com/0xdevren/netsentry/internal/parser/juniper"
 	"github.com/0xdevren/netsentry/internal/policy"
+	"github.com/0xdevren/netsentry/internal/policy/vars"
+	"github.com/0xdevren/netsentry/internal/util"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -130,3 +135,456 @@ func TestEvaluator_SkipsDisabledRule(t *testing.T) {
 	result := evaluator.Evaluate(rule, cfg)
 	assert.Equal(t, policy.StatusSkip, result.Status)
 }
+
+func parseIOS(t *testing.T, text string) *model.ConfigModel {
+	t.Helper()
+	cfg, err := cisco.NewIOSParser().Parse(context.Background(), []byte(text), model.Device{ID: "R1"})
+	require.NoError(t, err)
+	return cfg
+}
+
+const scopedConfig = `hostname R1
+!
+interface GigabitEthernet0/0
+ ip address 10.0.0.1 255.255.255.0
+ no ip proxy-arp
+!
+interface GigabitEthernet0/1
+ ip address 10.0.1.1 255.255.255.0
+!
+interface Loopback0
+ ip address 1.1.1.1 255.255.255.255
+!
+line vty 0 4
+ transport input ssh
+!
+`
+
+func TestIOSParser_BuildsBlocks(t *testing.T) {
+	cfg := parseIOS(t, scopedConfig)
+	require.Len(t, cfg.Blocks, 4)
+	assert.Equal(t, "interface GigabitEthernet0/0", cfg.Blocks[0].Header)
+	assert.Equal(t, []string{"ip address 10.0.0.1 255.255.255.0", "no ip proxy-arp"}, cfg.Blocks[0].Lines)
+	assert.Equal(t, "line vty 0 4", cfg.Blocks[3].Header)
+}
+
+func TestEvaluator_Within_OneResultPerOffendingBlock(t *testing.T) {
+	rule := policy.Rule{
+		ID:       "IF-001",
+		Severity: policy.SeverityMedium,
+		Match:    policy.MatchSpec{Within: `^interface GigabitEthernet`, Contains: "no ip proxy-arp"},
+	}
+	evaluator := policy.NewEvaluator(policy.NewMatcher())
+	results := evaluator.EvaluateAll(rule, parseIOS(t, scopedConfig))
+	require.Len(t, results, 1)
+	assert.Equal(t, policy.StatusFail, results[0].Status)
+	assert.Contains(t, results[0].Message, "interface GigabitEthernet0/1")
+}
+
+func TestEvaluator_Within_PassWhenAllBlocksComply(t *testing.T) {
+	rule := policy.Rule{
+		ID:       "VTY-001",
+		Severity: policy.SeverityHigh,
+		Match:    policy.MatchSpec{Within: `^line vty`, Contains: "transport input ssh"},
+	}
+	evaluator := policy.NewEvaluator(policy.NewMatcher())
+	results := evaluator.EvaluateAll(rule, parseIOS(t, scopedConfig))
+	require.Len(t, results, 1)
+	assert.Equal(t, policy.StatusPass, results[0].Status)
+}
+
+func TestEvaluator_Within_SkipWhenNoBlockInScope(t *testing.T) {
+	rule := policy.Rule{
+		ID:       "BGP-001",
+		Severity: policy.SeverityHigh,
+		Match:    policy.MatchSpec{Within: `^router bgp`, Contains: "password"},
+	}
+	evaluator := policy.NewEvaluator(policy.NewMatcher())
+	result := evaluator.Evaluate(rule, parseIOS(t, scopedConfig))
+	assert.Equal(t, policy.StatusSkip, result.Status)
+}
+
+func TestMatcher_MultipleConditions_AllMustPass(t *testing.T) {
+	m := policy.NewMatcher()
+	cfg := makeConfig("snmp-server group ADMIN v3 priv")
+	matched, err := m.Match(policy.MatchSpec{Contains: "snmp-server group", Regex: `v3 priv$`, NotContains: "community"}, cfg)
+	require.NoError(t, err)
+	assert.True(t, matched)
+
+	cfg = makeConfig("snmp-server group ADMIN v3 priv", "snmp-server community public RO")
+	matched, err = m.Match(policy.MatchSpec{Contains: "snmp-server group", Regex: `v3 priv$`, NotContains: "community"}, cfg)
+	require.NoError(t, err)
+	assert.False(t, matched)
+}
+
+func TestMatcher_Composition(t *testing.T) {
+	snmpV3Only := policy.MatchSpec{
+		AllOf: []policy.MatchSpec{
+			{Regex: `^snmp-server group \S+ v3`},
+			{NoneOf: []policy.MatchSpec{
+				{Regex: `^snmp-server community`},
+				{Contains: "v2c"},
+			}},
+		},
+	}
+	tests := []struct {
+		name  string
+		lines []string
+		want  bool
+	}{
+		{"v3 only", []string{"snmp-server group ADMIN v3 priv"}, true},
+		{"v3 with community", []string{"snmp-server group ADMIN v3 priv", "snmp-server community public RO"}, false},
+		{"no snmp", []string{"hostname R1"}, false},
+	}
+	m := policy.NewMatcher()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matched, err := m.Match(snmpV3Only, makeConfig(tt.lines...))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, matched)
+		})
+	}
+}
+
+func TestMatcher_AnyOf(t *testing.T) {
+	m := policy.NewMatcher()
+	spec := policy.MatchSpec{AnyOf: []policy.MatchSpec{
+		{Contains: "transport input telnet"},
+		{Contains: "transport input all"},
+	}}
+	matched, err := m.Match(spec, makeConfig(" transport input all"))
+	require.NoError(t, err)
+	assert.True(t, matched)
+
+	matched, err = m.Match(spec, makeConfig(" transport input ssh"))
+	require.NoError(t, err)
+	assert.False(t, matched)
+}
+
+func TestMatcher_NestedWithin_Error(t *testing.T) {
+	m := policy.NewMatcher()
+	spec := policy.MatchSpec{AllOf: []policy.MatchSpec{{Within: "^line vty", Contains: "ssh"}}}
+	_, err := m.Match(spec, makeConfig("line vty 0 4"))
+	assert.Error(t, err)
+}
+
+const bgpConfig = `hostname R1
+interface Ethernet1
+ mtu 9214
+interface Ethernet2
+ mtu 1500
+router bgp 65000
+ neighbor 10.0.0.1 remote-as 65001
+ neighbor 10.0.0.1 password s3cret
+ neighbor 10.0.0.1 route-map IMPORT in
+ neighbor 10.0.0.2 remote-as 65002
+`
+
+func TestEvaluator_Query_ReportsFailingElements(t *testing.T) {
+	rule := policy.Rule{
+		ID:       "BGP-AUTH",
+		Severity: policy.SeverityHigh,
+		Match: policy.MatchSpec{
+			Query:  "bgp.neighbors[*]",
+			Assert: []string{`password != ""`, "route_map_in exists"},
+		},
+	}
+	evaluator := policy.NewEvaluator(policy.NewMatcher())
+	results := evaluator.EvaluateAll(rule, parseIOS(t, bgpConfig))
+	require.Len(t, results, 1)
+	assert.Equal(t, policy.StatusFail, results[0].Status)
+	assert.Contains(t, results[0].Message, "bgp.neighbors[1] (address=10.0.0.2)")
+}
+
+func TestMatcher_Query_NumericAssertion(t *testing.T) {
+	m := policy.NewMatcher()
+	cfg := parseIOS(t, bgpConfig)
+
+	matched, err := m.Match(policy.MatchSpec{Query: "interfaces[*]", Assert: []string{"mtu >= 9000"}}, cfg)
+	require.NoError(t, err)
+	assert.False(t, matched)
+
+	matched, err = m.Match(policy.MatchSpec{Query: "interfaces[0]", Assert: []string{"mtu >= 9000", `name matches "^Ethernet"`}}, cfg)
+	require.NoError(t, err)
+	assert.True(t, matched)
+}
+
+func TestMatcher_Query_InvalidAssertion(t *testing.T) {
+	m := policy.NewMatcher()
+	_, err := m.Match(policy.MatchSpec{Query: "interfaces[*]", Assert: []string{"mtu ~= 9000"}}, parseIOS(t, bgpConfig))
+	assert.Error(t, err)
+}
+
+func TestEvaluator_AppliesTo_SkipsOtherPlatforms(t *testing.T) {
+	rule := policy.Rule{
+		ID:        "SSH-001",
+		Severity:  policy.SeverityHigh,
+		Match:     policy.MatchSpec{Contains: "ip ssh version 2"},
+		AppliesTo: &policy.Applicability{Types: []model.DeviceType{model.DeviceTypeJuniperOS}},
+	}
+	cfg := parseIOS(t, "hostname R1\nip ssh version 2\n")
+	cfg.Device.Type = model.DeviceTypeCiscoIOS
+
+	result := policy.NewEvaluator(policy.NewMatcher()).Evaluate(rule, cfg)
+	assert.Equal(t, policy.StatusSkip, result.Status)
+	assert.Contains(t, result.Message, "not applicable")
+}
+
+func TestEvaluator_AppliesTo_VersionConstraint(t *testing.T) {
+	rule := policy.Rule{
+		ID:        "SSH-001",
+		Severity:  policy.SeverityHigh,
+		Match:     policy.MatchSpec{Contains: "ip ssh version 2"},
+		AppliesTo: &policy.Applicability{Version: ">= 15.2, < 17"},
+	}
+	evaluator := policy.NewEvaluator(policy.NewMatcher())
+
+	cfg := parseIOS(t, "version 15.4\nhostname R1\nip ssh version 2\n")
+	require.Equal(t, "15.4", cfg.Device.Version)
+	assert.Equal(t, policy.StatusPass, evaluator.Evaluate(rule, cfg).Status)
+
+	cfg = parseIOS(t, "version 12.4\nhostname R1\n")
+	assert.Equal(t, policy.StatusSkip, evaluator.Evaluate(rule, cfg).Status)
+
+	cfg = parseIOS(t, "hostname R1\n")
+	assert.Equal(t, policy.StatusSkip, evaluator.Evaluate(rule, cfg).Status, "unknown version is not applicable")
+}
+
+func TestEngine_AppliesTo_InheritsPolicyDefault(t *testing.T) {
+	p := &policy.Policy{
+		Name:      "junos-only",
+		AppliesTo: &policy.Applicability{Types: []model.DeviceType{model.DeviceTypeJuniperOS}},
+		Rules: []policy.Rule{
+			{ID: "R1", Severity: policy.SeverityLow, Match: policy.MatchSpec{Contains: "hostname"}},
+			{
+				ID: "R2", Severity: policy.SeverityLow, Match: policy.MatchSpec{Contains: "hostname"},
+				AppliesTo: &policy.Applicability{Roles: []string{"edge"}},
+			},
+		},
+	}
+	cfg := parseIOS(t, "hostname R1\n")
+	cfg.Device.Type = model.DeviceTypeCiscoIOS
+	cfg.Device.Role = "edge"
+
+	results, err := policy.NewEngine(policy.EngineOptions{}).Run(context.Background(), p, cfg)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	byID := map[string]policy.ValidationStatus{}
+	for _, r := range results {
+		byID[r.RuleID] = r.Status
+	}
+	assert.Equal(t, policy.StatusSkip, byID["R1"])
+	assert.Equal(t, policy.StatusPass, byID["R2"])
+}
+
+func TestUtil_CompareVersions(t *testing.T) {
+	assert.Equal(t, -1, util.CompareVersions("15.2(4)M3", "15.10"))
+	assert.Equal(t, 1, util.CompareVersions("20.4R3.8", "20.4R3"))
+	assert.Equal(t, 0, util.CompareVersions("4.28.0", "4.28"))
+	_, err := util.ParseVersionConstraint(">= , < 17")
+	assert.Error(t, err)
+}
+
+func TestVars_RenderAndReferences(t *testing.T) {
+	f := &vars.File{
+		Vars:    map[string]interface{}{"syslog_host": "10.0.0.5"},
+		Sites:   map[string]map[string]interface{}{"dc1": {"ntp": map[string]interface{}{"primary": "10.1.1.1"}}},
+		Devices: map[string]map[string]interface{}{"edge-01": {"site": "dc1"}},
+	}
+	scope := f.Scope(model.Device{ID: "edge-01", Tags: map[string]string{"tier": "gold"}})
+
+	out, err := vars.Render("ntp server {{ .site.ntp.primary }} ({{.site.name}}, {{ .tags.tier }})", scope)
+	require.NoError(t, err)
+	assert.Equal(t, "ntp server 10.1.1.1 (dc1, gold)", out)
+
+	_, err = vars.Render("logging host {{ .vars.missing }}", scope)
+	assert.ErrorContains(t, err, "vars.missing")
+
+	_, err = vars.References("{{ .inventory.rack }}")
+	assert.Error(t, err)
+	_, err = vars.References("ntp server {{ .site.ntp_server")
+	assert.Error(t, err)
+}
+
+func TestEngine_TemplateVariables(t *testing.T) {
+	p := &policy.Policy{
+		Name: "templated",
+		Rules: []policy.Rule{
+			{
+				ID: "NTP", Severity: policy.SeverityMedium,
+				Match:  policy.MatchSpec{Regex: `^ntp server {{ .site.ntp_server }}$`},
+				Action: policy.ActionSpec{Remediation: "configure ntp server {{ .site.ntp_server }}"},
+			},
+			{
+				ID: "JUNOS-ONLY", Severity: policy.SeverityLow,
+				Match:     policy.MatchSpec{Contains: "{{ .vars.undefined }}"},
+				AppliesTo: &policy.Applicability{Types: []model.DeviceType{model.DeviceTypeJuniperOS}},
+			},
+		},
+		Variables: &vars.File{Sites: map[string]map[string]interface{}{
+			"dc1": {"ntp_server": "10.1.1.1"},
+			"dc2": {"ntp_server": "10.2.1.1"},
+		}},
+	}
+	engine := policy.NewEngine(policy.EngineOptions{})
+	run := func(site string) map[string]policy.ValidationResult {
+		cfg := parseIOS(t, "hostname R1\nntp server 10.1.1.1\n")
+		cfg.Device.Type = model.DeviceTypeCiscoIOS
+		cfg.Device.Site = site
+		results, err := engine.Run(context.Background(), p, cfg)
+		require.NoError(t, err)
+		byID := map[string]policy.ValidationResult{}
+		for _, r := range results {
+			byID[r.RuleID] = r
+		}
+		return byID
+	}
+
+	dc1 := run("dc1")
+	assert.Equal(t, policy.StatusPass, dc1["NTP"].Status)
+	assert.Equal(t, policy.StatusSkip, dc1["JUNOS-ONLY"].Status, "inapplicable rules are not rendered")
+
+	dc2 := run("dc2")
+	assert.Equal(t, policy.StatusFail, dc2["NTP"].Status)
+	assert.Equal(t, "configure ntp server 10.2.1.1", dc2["NTP"].Remediation)
+
+	unknown := run("dc9")
+	assert.Equal(t, policy.StatusError, unknown["NTP"].Status)
+	assert.Contains(t, unknown["NTP"].Message, "site.ntp_server")
+}
+
+func TestEngine_TemplateVariablesInRegexAreLiteral(t *testing.T) {
+	p := &policy.Policy{
+		Name: "templated",
+		Rules: []policy.Rule{
+			{
+				ID: "NTP", Severity: policy.SeverityMedium,
+				Match: policy.MatchSpec{Regex: `^ntp server {{ .site.ntp_server }}$`},
+			},
+			{
+				ID: "UPLINK", Severity: policy.SeverityLow,
+				Match: policy.MatchSpec{Within: `^interface {{ .site.uplink }}$`, Contains: "description {{ .site.circuit }}"},
+			},
+		},
+		Variables: &vars.File{Sites: map[string]map[string]interface{}{
+			"dc1": {"ntp_server": "10.1.1.1", "uplink": "GigabitEthernet0/1", "circuit": "[ISP-A] (primary)"},
+		}},
+	}
+	cfg := parseIOS(t, "hostname R1\nntp server 10x1x1x1\ninterface GigabitEthernet0/1\n description [ISP-A] (primary)\n")
+	cfg.Device.Type = model.DeviceTypeCiscoIOS
+	cfg.Device.Site = "dc1"
+	results, err := policy.NewEngine(policy.EngineOptions{}).Run(context.Background(), p, cfg)
+	require.NoError(t, err)
+	byID := map[string]policy.ValidationResult{}
+	for _, r := range results {
+		byID[r.RuleID] = r
+	}
+	assert.Equal(t, policy.StatusFail, byID["NTP"].Status, "dots in the value match only dots")
+
+	p.Variables.Sites["dc1"]["uplink"] = "GigabitEthernet0/1 (core)"
+	cfg = parseIOS(t, "hostname R1\ninterface GigabitEthernet0/1 (core)\n description [ISP-A] (primary)\n")
+	cfg.Device.Type = model.DeviceTypeCiscoIOS
+	cfg.Device.Site = "dc1"
+	results, err = policy.NewEngine(policy.EngineOptions{}).Run(context.Background(), p, cfg)
+	require.NoError(t, err)
+	for _, r := range results {
+		byID[r.RuleID] = r
+	}
+	assert.Equal(t, policy.StatusPass, byID["UPLINK"].Status, byID["UPLINK"].Message)
+
+	out, err := vars.RenderRegexp(`^ntp server {{ .site.ntp_server }}$`, p.Variables.Scope(cfg.Device))
+	require.NoError(t, err)
+	assert.Equal(t, `^ntp server 10\.1\.1\.1$`, out)
+}
+
+func TestEvaluator_EvidenceLineNumbersAndPath(t *testing.T) {
+	evaluator := policy.NewEvaluator(policy.NewMatcher())
+	cfg := parseIOS(t, scopedConfig)
+
+	deny := policy.Rule{
+		ID: "PROXY-ARP", Severity: policy.SeverityLow,
+		Match:  policy.MatchSpec{Contains: "no ip proxy-arp"},
+		Action: policy.ActionSpec{Deny: true},
+	}
+	res := evaluator.Evaluate(deny, cfg)
+	require.Equal(t, policy.StatusFail, res.Status)
+	assert.Equal(t, []policy.Evidence{
+		{Line: 5, Text: "no ip proxy-arp", Path: []string{"interface GigabitEthernet0/0"}},
+	}, res.Evidence)
+	assert.Equal(t, "line 5 (interface GigabitEthernet0/0)", res.Evidence[0].Location())
+
+	required := policy.Rule{
+		ID: "IF-001", Severity: policy.SeverityMedium,
+		Match: policy.MatchSpec{Within: `^interface GigabitEthernet`, Contains: "no ip proxy-arp"},
+	}
+	results := evaluator.EvaluateAll(required, cfg)
+	require.Len(t, results, 1)
+	assert.Equal(t, []policy.Evidence{{Line: 7, Text: "interface GigabitEthernet0/1"}}, results[0].Evidence,
+		"a block missing a required line points at its header")
+
+	pass := evaluator.Evaluate(policy.Rule{
+		ID: "SSH", Severity: policy.SeverityLow,
+		Match: policy.MatchSpec{Contains: "transport input ssh"},
+	}, cfg)
+	assert.Equal(t, policy.StatusPass, pass.Status)
+	assert.Empty(t, pass.Evidence)
+}
+
+func TestMatcher_EvidenceFromDecidingCondition(t *testing.T) {
+	m := policy.NewMatcher()
+	cfg := parseIOS(t, "hostname R1\nntp server 10.1.1.1\nline vty 0 4\n transport input telnet\n")
+	texts := func(spec policy.MatchSpec) (bool, []string) {
+		ok, ev, err := m.MatchEvidence(spec, cfg)
+		require.NoError(t, err)
+		var out []string
+		for _, e := range ev {
+			out = append(out, e.Text)
+		}
+		return ok, out
+	}
+
+	ok, ev := texts(policy.MatchSpec{AllOf: []policy.MatchSpec{{Contains: "hostname"}, {Contains: "ip ssh version 2"}}})
+	assert.False(t, ok)
+	assert.Empty(t, ev, "a missing required line leaves no evidence")
+
+	ok, ev = texts(policy.MatchSpec{Contains: "hostname", NotContains: "transport input telnet"})
+	assert.False(t, ok)
+	assert.Equal(t, []string{"transport input telnet"}, ev, "only the failing condition is evidence")
+
+	ok, ev = texts(policy.MatchSpec{AnyOf: []policy.MatchSpec{{Contains: "ntp server"}, {Contains: "hostname"}}})
+	assert.True(t, ok)
+	assert.Equal(t, []string{"ntp server 10.1.1.1"}, ev, "the first matching alternative is evidence")
+
+	ok, ev = texts(policy.MatchSpec{Contains: "hostname", NoneOf: []policy.MatchSpec{{Contains: "ip ssh"}, {Contains: "transport input telnet"}}})
+	assert.False(t, ok)
+	assert.Equal(t, []string{"transport input telnet"}, ev)
+
+	ok, ev = texts(policy.MatchSpec{AllOf: []policy.MatchSpec{{Contains: "hostname"}, {Regex: "^ntp server"}}})
+	assert.True(t, ok)
+	assert.Equal(t, []string{"hostname R1", "ntp server 10.1.1.1"}, ev)
+
+	res := policy.NewEvaluator(m).Evaluate(policy.Rule{
+		ID: "SSH", Severity: policy.SeverityHigh,
+		Match: policy.MatchSpec{AllOf: []policy.MatchSpec{{Contains: "hostname"}, {Contains: "ip ssh version 2"}}},
+	}, cfg)
+	assert.Equal(t, policy.StatusFail, res.Status)
+	assert.Empty(t, res.Evidence)
+	assert.NotEmpty(t, res.Message)
+}
+
+func TestEvaluator_EvidenceJunOSPath(t *testing.T) {
+	text := "system {\n    host-name J1;\n    services {\n        telnet;\n    }\n}\n"
+	cfg, err := juniper.NewJunOSParser().Parse(context.Background(), []byte(text), model.Device{ID: "J1"})
+	require.NoError(t, err)
+
+	res := policy.NewEvaluator(policy.NewMatcher()).Evaluate(policy.Rule{
+		ID: "NO-TELNET", Severity: policy.SeverityHigh,
+		Match:  policy.MatchSpec{Contains: "telnet"},
+		Action: policy.ActionSpec{Deny: true},
+	}, cfg)
+	require.Equal(t, policy.StatusFail, res.Status)
+	require.Len(t, res.Evidence, 1)
+	assert.Equal(t, 4, res.Evidence[0].Line)
+	assert.Equal(t, "telnet;", res.Evidence[0].Text)
+	assert.Equal(t, []string{"system", "services"}, res.Evidence[0].Path)
+}
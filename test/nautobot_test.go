@@ -0,0 +1,129 @@
+package netsentry_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/0xdevren/netsentry/internal/inventory"
+	"github.com/0xdevren/netsentry/internal/model"
+	"github.com/0xdevren/netsentry/internal/policy/vars"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// nautobotDevices are device records as the Nautobot GraphQL API returns
+// them.
+var nautobotDevices = []map[string]interface{}{
+	{
+		"id": "6f9c3c6e-0001-4c1e-9d2a-000000000001", "name": "edge-01",
+		"platform":           map[string]interface{}{"name": "Cisco IOS-XE", "network_driver": "cisco_xe"},
+		"role":               map[string]interface{}{"name": "edge"},
+		"location":           map[string]interface{}{"name": "DC1"},
+		"primary_ip4":        map[string]interface{}{"address": "10.0.0.1/32"},
+		"primary_ip6":        nil,
+		"tags":               []interface{}{map[string]interface{}{"name": "pci"}},
+		"config_context":     map[string]interface{}{"ntp": map[string]interface{}{"primary": "10.1.1.1"}},
+		"_custom_field_data": map[string]interface{}{"owner": "netops", "contract": nil},
+	},
+	{
+		"id": "6f9c3c6e-0002-4c1e-9d2a-000000000002", "name": "leaf-01",
+		"platform":    map[string]interface{}{"name": "Arista EOS", "network_driver": ""},
+		"location":    map[string]interface{}{"name": "DC2"},
+		"primary_ip4": nil,
+		"primary_ip6": map[string]interface{}{"address": "2001:db8::1/64"},
+	},
+}
+
+// graphQLRequest is the body of a GraphQL request.
+type graphQLRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables"`
+}
+
+// startNautobot runs a Nautobot GraphQL stand-in serving nautobotDevices,
+// recording the requests it receives.
+func startNautobot(t *testing.T) (*httptest.Server, *[]graphQLRequest) {
+	t.Helper()
+	var requests []graphQLRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/graphql/" || r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Token s3cret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		var req graphQLRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		requests = append(requests, req)
+		switch id := req.Variables["id"]; {
+		case id == "6f9c3c6e-0002-4c1e-9d2a-000000000002":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"device": nautobotDevices[1]}})
+		case id != nil:
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"data":   map[string]interface{}{"device": nil},
+				"errors": []interface{}{map[string]interface{}{"message": "Device matching query does not exist."}},
+			})
+		default:
+			// One device per page.
+			offset := int(req.Variables["offset"].(float64))
+			page := []map[string]interface{}{}
+			if offset < len(nautobotDevices) {
+				page = nautobotDevices[offset : offset+1]
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"devices": page}})
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestNautobotInventory_List(t *testing.T) {
+	ctx := context.Background()
+	srv, requests := startNautobot(t)
+	nb := inventory.NewNautobotInventory(inventory.NautobotOptions{
+		BaseURL:  srv.URL,
+		Token:    "s3cret",
+		Filters:  inventory.NetBoxFilters{Sites: []string{"DC1", "DC2"}, Statuses: []string{"Active"}},
+		PageSize: 1,
+	})
+	var _ inventory.Provider = nb
+
+	devices, err := nb.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, devices, 2)
+	require.Len(t, *requests, 3, "pages are requested until one comes back short")
+	first := (*requests)[0]
+	assert.Contains(t, first.Query, "devices(limit: $limit, offset: $offset, location: $location, status: $status)")
+	assert.NotContains(t, first.Query, "$role", "unused filters are not declared")
+	assert.Equal(t, []interface{}{"DC1", "DC2"}, first.Variables["location"])
+
+	edge := devices[0]
+	assert.Equal(t, "6f9c3c6e-0001-4c1e-9d2a-000000000001", edge.ID)
+	assert.Equal(t, "edge-01", edge.Hostname)
+	assert.Equal(t, model.DeviceTypeCiscoIOS, edge.Type)
+	assert.Equal(t, "edge", edge.Role)
+	assert.Equal(t, "DC1", edge.Site)
+	assert.Equal(t, "10.0.0.1", edge.ManagementIP)
+	assert.Equal(t, map[string]string{"platform": "cisco_xe", "pci": "true", "owner": "netops"}, edge.Tags)
+	assert.Equal(t, model.DeviceTypeAristaEOS, devices[1].Type, "the platform name is used without a network driver")
+	assert.Equal(t, "2001:db8::1", devices[1].ManagementIP)
+
+	v, ok := nb.Variables().Scope(edge).Lookup(vars.Reference{Namespace: vars.NamespaceDevice, Key: "ntp.primary"})
+	assert.True(t, ok)
+	assert.Equal(t, "10.1.1.1", v)
+
+	d, err := nb.Get(ctx, "6f9c3c6e-0002-4c1e-9d2a-000000000002")
+	require.NoError(t, err)
+	assert.Equal(t, "leaf-01", d.Hostname)
+	_, err = nb.Get(ctx, "missing")
+	assert.ErrorContains(t, err, "nautobot: device missing: graphql: Device matching query does not exist.")
+
+	_, err = inventory.NewNautobotInventory(inventory.NautobotOptions{BaseURL: srv.URL, Token: "wrong"}).List(ctx)
+	assert.ErrorContains(t, err, "unexpected status 403")
+}
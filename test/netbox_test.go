@@ -0,0 +1,195 @@
+package netsentry_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/0xdevren/netsentry/internal/inventory"
+	"github.com/0xdevren/netsentry/internal/model"
+	"github.com/0xdevren/netsentry/internal/policy/vars"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// netboxDevices are device records as the NetBox API returns them; the
+// second uses the device_role field of NetBox 3.x.
+var netboxDevices = []map[string]interface{}{
+	{
+		"id": 11, "name": "edge-01",
+		"platform":    map[string]interface{}{"name": "Cisco IOS-XE", "slug": "cisco-ios-xe"},
+		"role":        map[string]interface{}{"name": "Edge Router", "slug": "edge"},
+		"primary_ip4": map[string]interface{}{"address": "10.0.0.1/32"},
+		"site":        map[string]interface{}{"name": "dc1", "slug": "dc1"},
+		"tags":        []interface{}{map[string]interface{}{"name": "PCI", "slug": "pci"}},
+		"custom_fields": map[string]interface{}{
+			"owner": "netops", "rack_units": 1.0, "managed": true, "contract": nil,
+			"circuits": []interface{}{"c1", "c2"},
+		},
+		"config_context": map[string]interface{}{
+			"ntp": map[string]interface{}{"primary": "10.1.1.1"},
+		},
+	},
+	{
+		"id": 12, "name": "leaf-01",
+		"platform":    map[string]interface{}{"name": "Arista EOS", "slug": "eos"},
+		"device_role": map[string]interface{}{"name": "Leaf", "slug": "leaf"},
+		"primary_ip4": nil,
+		"primary_ip":  map[string]interface{}{"address": "2001:db8::1/64"},
+		"site":        map[string]interface{}{"name": "dc2", "slug": "dc2"},
+	},
+	{
+		"id": 13, "name": "fw-01",
+		"platform": map[string]interface{}{"name": "PAN-OS", "slug": "panos"},
+		"site":     map[string]interface{}{"name": "dc1", "slug": "dc1"},
+	},
+}
+
+// startNetBox runs a NetBox stand-in serving netboxDevices one per page.
+func startNetBox(t *testing.T) (*httptest.Server, *[]string) {
+	t.Helper()
+	var queries []string
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Token s3cret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/dcim/devices/":
+			queries = append(queries, r.URL.RawQuery)
+			offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+			page := map[string]interface{}{
+				"count":   len(netboxDevices),
+				"results": netboxDevices[offset : offset+1],
+				"next":    nil,
+			}
+			if offset+1 < len(netboxDevices) {
+				next := *r.URL
+				q := next.Query()
+				q.Set("offset", strconv.Itoa(offset+1))
+				next.RawQuery = q.Encode()
+				page["next"] = srv.URL + next.String()
+			}
+			_ = json.NewEncoder(w).Encode(page)
+		case "/api/dcim/devices/12/":
+			_ = json.NewEncoder(w).Encode(netboxDevices[1])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &queries
+}
+
+func TestNetBoxInventory_List(t *testing.T) {
+	ctx := context.Background()
+	srv, queries := startNetBox(t)
+	nb := inventory.NewNetBoxInventory(inventory.NetBoxOptions{
+		BaseURL: srv.URL + "/",
+		Token:   "s3cret",
+		Filters: inventory.NetBoxFilters{Sites: []string{"dc1", "dc2"}, Roles: []string{"edge"}, Tags: []string{"pci"}, Statuses: []string{"active"}},
+	})
+
+	devices, err := nb.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, devices, 3, "every page is fetched")
+	require.Len(t, *queries, 3)
+	assert.Equal(t, "limit=1000&role=edge&site=dc1&site=dc2&status=active&tag=pci", (*queries)[0])
+
+	edge := devices[0]
+	assert.Equal(t, "11", edge.ID)
+	assert.Equal(t, "edge-01", edge.Hostname)
+	assert.Equal(t, model.DeviceTypeCiscoIOS, edge.Type)
+	assert.Equal(t, "edge", edge.Role)
+	assert.Equal(t, "dc1", edge.Site)
+	assert.Equal(t, "10.0.0.1", edge.ManagementIP, "the prefix length is stripped")
+	assert.Equal(t, map[string]string{
+		"platform": "cisco-ios-xe", "pci": "true",
+		"owner": "netops", "rack_units": "1", "managed": "true", "circuits": `["c1","c2"]`,
+	}, edge.Tags)
+
+	assert.Equal(t, model.DeviceTypeAristaEOS, devices[1].Type)
+	assert.Equal(t, "leaf", devices[1].Role, "NetBox 3.x device_role is read")
+	assert.Equal(t, "2001:db8::1", devices[1].ManagementIP)
+	assert.Empty(t, devices[2].Type, "unmapped platforms are detected from the configuration")
+	assert.Empty(t, devices[2].ManagementIP)
+
+	// Config contexts resolve as device template variables.
+	scope := vars.Merge(&vars.File{Vars: map[string]interface{}{"syslog": "10.9.9.9"}}, nb.Variables()).Scope(edge)
+	v, ok := scope.Lookup(vars.Reference{Namespace: vars.NamespaceDevice, Key: "ntp.primary"})
+	assert.True(t, ok)
+	assert.Equal(t, "10.1.1.1", v)
+	v, ok = scope.Lookup(vars.Reference{Namespace: vars.NamespaceVars, Key: "syslog"})
+	assert.True(t, ok)
+	assert.Equal(t, "10.9.9.9", v)
+
+	d, err := nb.Get(ctx, "12")
+	require.NoError(t, err)
+	assert.Equal(t, "leaf-01", d.Hostname)
+	_, err = nb.Get(ctx, "99")
+	assert.ErrorContains(t, err, "netbox: device 99: unexpected status 404")
+
+	_, err = inventory.NewNetBoxInventory(inventory.NetBoxOptions{BaseURL: srv.URL, Token: "wrong"}).List(ctx)
+	assert.ErrorContains(t, err, "unexpected status 403")
+}
+
+func TestNetBoxInventory_NextLinkStaysOnBaseURL(t *testing.T) {
+	// The next link names another host, as NetBox does behind a proxy that
+	// does not forward the Host header. The token must not be sent there.
+	var leaked []string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaked = append(leaked, r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer other.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Token s3cret" || r.URL.Path != "/netbox/api/dcim/devices/" {
+			http.NotFound(w, r)
+			return
+		}
+		page := map[string]interface{}{"results": netboxDevices[1:2], "next": nil}
+		if r.URL.Query().Get("offset") == "" {
+			page["results"] = netboxDevices[:1]
+			page["next"] = other.URL + "/netbox/api/dcim/devices/?limit=1000&offset=1"
+		}
+		_ = json.NewEncoder(w).Encode(page)
+	}))
+	defer srv.Close()
+
+	devices, err := inventory.NewNetBoxInventory(inventory.NetBoxOptions{BaseURL: srv.URL + "/netbox", Token: "s3cret"}).List(context.Background())
+	require.NoError(t, err)
+	require.Len(t, devices, 2, "the next page is fetched from BaseURL")
+	assert.Equal(t, "leaf-01", devices[1].Hostname)
+	assert.Empty(t, leaked)
+}
+
+func TestNetBoxInventory_NextLinkLoop(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests > 10 {
+			http.Error(w, "looping", http.StatusTooManyRequests)
+			return
+		}
+		// Every page links to the second, as a proxy rewriting the
+		// links badly would.
+		page := map[string]interface{}{
+			"results": netboxDevices[:1],
+			"next":    "http://" + r.Host + "/api/dcim/devices/?limit=1000&offset=1",
+		}
+		if r.URL.Query().Get("offset") == "1" {
+			page["results"] = netboxDevices[1:2]
+		}
+		_ = json.NewEncoder(w).Encode(page)
+	}))
+	defer srv.Close()
+
+	devices, err := inventory.NewNetBoxInventory(inventory.NetBoxOptions{BaseURL: srv.URL, Token: "s3cret"}).List(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, devices, 2, "a page already fetched is not fetched again")
+	assert.Equal(t, 2, requests)
+}
@@ -0,0 +1,182 @@
+package netsentry_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/0xdevren/netsentry/internal/config"
+	"github.com/0xdevren/netsentry/internal/config/source"
+	"github.com/0xdevren/netsentry/internal/model"
+	"github.com/0xdevren/netsentry/internal/parser"
+	"github.com/0xdevren/netsentry/internal/policy"
+	"github.com/0xdevren/netsentry/internal/validator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const junosXML = `<configuration xmlns:junos="http://xml.juniper.net/junos/20.4R0/junos" junos:changed-seconds="1700000000">
+  <version>20.4R3</version>
+  <system>
+    <host-name>mx-01</host-name>
+    <services><ssh><root-login>deny</root-login></ssh></services>
+    <junos:comment>/* managed by netops */</junos:comment>
+  </system>
+  <interfaces>
+    <interface>
+      <name>ge-0/0/0</name>
+      <description>core uplink</description>
+      <unit><name>0</name><family><inet><address><name>10.0.0.1/30</name></address></inet></family></unit>
+    </interface>
+    <interface inactive="inactive">
+      <name>ge-0/0/9</name>
+      <disable/>
+    </interface>
+  </interfaces>
+  <protocols>
+    <bgp><group><name>transit</name><neighbor><name>192.0.2.1</name><peer-as>64500</peer-as></neighbor></group></bgp>
+  </protocols>
+</configuration>`
+
+const openConfigXML = `<interfaces xmlns="http://openconfig.net/yang/interfaces">
+  <interface>
+    <name>Ethernet1</name>
+    <config><name>Ethernet1</name><description>to spine-01</description><mtu>9214</mtu><enabled>true</enabled></config>
+    <subinterfaces><subinterface><index>0</index>
+      <ipv4 xmlns="http://openconfig.net/yang/interfaces/ip"><addresses><address><ip>10.1.0.1</ip>
+        <config><ip>10.1.0.1</ip><prefix-length>31</prefix-length></config></address></addresses></ipv4>
+    </subinterface></subinterfaces>
+  </interface>
+  <interface>
+    <name>Ethernet2</name>
+    <config><name>Ethernet2</name><enabled>false</enabled></config>
+  </interface>
+</interfaces>
+<system xmlns="http://openconfig.net/yang/system"><config><hostname>leaf-01</hostname></config></system>
+<network-instances xmlns="http://openconfig.net/yang/network-instance">
+  <network-instance><name>default</name>
+    <protocols>
+      <protocol><identifier>BGP</identifier><name>BGP</name>
+        <bgp><global><config><as>65010</as><router-id>10.255.0.1</router-id></config></global>
+          <neighbors><neighbor><neighbor-address>10.1.0.0</neighbor-address>
+            <config><neighbor-address>10.1.0.0</neighbor-address><peer-as>65000</peer-as></config></neighbor></neighbors>
+        </bgp>
+      </protocol>
+      <protocol><identifier>STATIC</identifier><name>static</name>
+        <static-routes><static><prefix>0.0.0.0/0</prefix>
+          <next-hops><next-hop><index>1</index><config><next-hop>10.1.0.0</next-hop></config></next-hop></next-hops>
+        </static></static-routes>
+      </protocol>
+    </protocols>
+  </network-instance>
+</network-instances>`
+
+func TestNetconfSource_GetConfig(t *testing.T) {
+	ctx := context.Background()
+	for _, base11 := range []bool{false, true} {
+		srv := startSSHServer(t, nil)
+		srv.SetNetconf(netconfResponder{Base11: base11, Datastores: map[string]string{
+			"running":   junosXML,
+			"candidate": "<configuration><system><host-name>mx-01-new</host-name></system></configuration>",
+		}})
+		nc := source.NewNetconfSource()
+		load := func(datastore string) ([]byte, error) {
+			return nc.Load(ctx, source.LoadRequest{NetconfOptions: &source.NetconfOptions{SSH: sshOptions(t, srv), Datastore: datastore}})
+		}
+
+		data, err := load("")
+		require.NoError(t, err, "base 1.1: %v", base11)
+		assert.Equal(t, junosXML, string(data))
+		assert.Equal(t, []string{"get-config running", "close-session"}, srv.Executed())
+
+		data, err = load("candidate")
+		require.NoError(t, err)
+		assert.Contains(t, string(data), "mx-01-new")
+
+		_, err = load("startup")
+		assert.ErrorContains(t, err, `unsupported datastore "startup"`)
+	}
+
+	srv := startSSHServer(t, nil)
+	srv.SetNetconf(netconfResponder{Datastores: map[string]string{"running": junosXML}})
+	_, err := source.NewNetconfSource().Load(ctx, source.LoadRequest{
+		NetconfOptions: &source.NetconfOptions{SSH: sshOptions(t, srv), Datastore: "candidate"},
+	})
+	assert.ErrorContains(t, err, "rpc-error: no such datastore")
+
+	big := startSSHServer(t, nil)
+	big.SetNetconf(netconfResponder{Base11: true, Oversized: true, Datastores: map[string]string{"running": junosXML}})
+	_, err = source.NewNetconfSource().Load(ctx, source.LoadRequest{NetconfOptions: &source.NetconfOptions{SSH: sshOptions(t, big)}})
+	assert.ErrorContains(t, err, "message exceeds 67108864 bytes")
+
+	// Collected XML validates like CLI configuration.
+	opts := sshOptions(t, srv)
+	rep, err := validator.NewFleetValidator().Validate(ctx, validator.FleetValidationRequest{
+		Targets: []validator.FleetTarget{{
+			Source: "netconf://" + srv.Addr(),
+			Load: func(ctx context.Context) ([]byte, error) {
+				return source.NewNetconfSource().Load(ctx, source.LoadRequest{NetconfOptions: &source.NetconfOptions{SSH: opts}})
+			},
+		}},
+		Policies: []*policy.Policy{{Name: "junos", Rules: []policy.Rule{
+			{ID: "SSH-001", Severity: policy.SeverityHigh, Match: policy.MatchSpec{Contains: "set system services ssh root-login deny"}},
+		}}},
+	})
+	require.NoError(t, err)
+	require.Len(t, rep.Devices, 1)
+	require.NotNil(t, rep.Devices[0].Report, rep.Devices[0].Error)
+	assert.Equal(t, "mx-01", rep.Devices[0].Device.ID)
+	assert.Equal(t, model.DeviceTypeJuniperOS, rep.Devices[0].Device.Type)
+	assert.Equal(t, 1, rep.Devices[0].Report.Summary.Passed)
+}
+
+func TestJunOSParser_XML(t *testing.T) {
+	data := []byte(`<rpc-reply><data>` + junosXML + `</data></rpc-reply>`)
+	assert.Equal(t, model.DeviceTypeJuniperOS, config.NewDetector().Detect(data))
+
+	cfg, err := parser.Parse(context.Background(), model.DeviceTypeJuniperOS, data, model.Device{})
+	require.NoError(t, err)
+	assert.Equal(t, "mx-01", cfg.Device.Hostname)
+	assert.Equal(t, "20.4R3", cfg.Device.Version)
+	assert.Equal(t, []string{
+		"set version 20.4R3",
+		"set system host-name mx-01",
+		"set system services ssh root-login deny",
+		`set interfaces ge-0/0/0 description "core uplink"`,
+		"set interfaces ge-0/0/0 unit 0 family inet address 10.0.0.1/30",
+		"set protocols bgp group transit neighbor 192.0.2.1 peer-as 64500",
+	}, cfg.Lines, "comments and inactive statements are left out")
+
+	require.Len(t, cfg.Interfaces, 1)
+	assert.Equal(t, "10.0.0.1/30", cfg.Interfaces[0].IPAddress)
+	require.NotNil(t, cfg.BGPConfig)
+	require.Len(t, cfg.BGPConfig.Neighbors, 1)
+	assert.Equal(t, "192.0.2.1", cfg.BGPConfig.Neighbors[0].Address)
+
+	_, err = parser.Parse(context.Background(), model.DeviceTypeJuniperOS, []byte("<configuration><system>"), model.Device{})
+	assert.ErrorContains(t, err, "junos parser: xml")
+}
+
+func TestOpenConfigParser(t *testing.T) {
+	data := []byte(`<data xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">` + openConfigXML + `</data>`)
+	assert.Equal(t, model.DeviceTypeUnknown, config.NewDetector().Detect(data), "OpenConfig is vendor-neutral")
+
+	cfg, err := parser.Parse(context.Background(), model.DeviceTypeUnknown, data, model.Device{ID: "leaf-01"})
+	require.NoError(t, err)
+	assert.Equal(t, "leaf-01", cfg.Device.Hostname)
+	assert.Equal(t, model.DeviceTypeUnknown, cfg.Device.Type)
+
+	require.Len(t, cfg.Interfaces, 2)
+	assert.Equal(t, "to spine-01", cfg.Interfaces[0].Description)
+	assert.Equal(t, "10.1.0.1/31", cfg.Interfaces[0].IPAddress)
+	assert.Equal(t, 9214, cfg.Interfaces[0].MTU)
+	assert.True(t, cfg.Interfaces[1].Shutdown)
+
+	require.NotNil(t, cfg.BGPConfig)
+	assert.Equal(t, 65010, cfg.BGPConfig.LocalAS)
+	assert.Equal(t, []model.BGPNeighbor{{Address: "10.1.0.0", RemoteAS: 65000}}, cfg.BGPConfig.Neighbors)
+	assert.Equal(t, []model.StaticRoute{{Destination: "0.0.0.0/0", NextHop: "10.1.0.0"}}, cfg.StaticRoutes)
+
+	assert.Contains(t, cfg.Lines, "/interfaces/interface[name=Ethernet1]/config/mtu 9214")
+	assert.Contains(t, cfg.Lines, "/interfaces/interface[name=Ethernet1]/subinterfaces/subinterface[index=0]/ipv4/addresses/address[ip=10.1.0.1]/config/prefix-length 31")
+	assert.Contains(t, cfg.Lines, "/system/config/hostname leaf-01")
+}
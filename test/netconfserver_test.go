@@ -0,0 +1,142 @@
+package netsentry_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// netconfResponder describes the NETCONF server of the test device.
+type netconfResponder struct {
+	// Base11 offers NETCONF 1.1 chunked framing besides 1.0.
+	Base11 bool
+	// Datastores maps datastore names to the content of get-config replies.
+	Datastores map[string]string
+	// Oversized announces a 1.1 reply chunk larger than any configuration.
+	Oversized bool
+}
+
+// SetNetconf enables the netconf subsystem answering with r.
+func (s *sshTestServer) SetNetconf(r netconfResponder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.netconf = &r
+}
+
+// serveNetconf answers get-config and close-session RPCs, recording them as
+// "get-config <datastore>" and "close-session".
+func (s *sshTestServer) serveNetconf(ch ssh.Channel, r netconfResponder) {
+	in := bufio.NewReader(ch)
+	caps := "<capability>urn:ietf:params:netconf:base:1.0</capability>"
+	if r.Base11 {
+		caps += "<capability>urn:ietf:params:netconf:base:1.1</capability>"
+	}
+	_, _ = io.WriteString(ch, `<hello xmlns="urn:ietf:params:xml:ns:netconf:base:1.0"><capabilities>`+caps+
+		"</capabilities><session-id>1</session-id></hello>]]>]]>")
+	hello, err := readUntil(in, "]]>]]>")
+	if err != nil {
+		return
+	}
+	chunked := r.Base11 && strings.Contains(hello, "urn:ietf:params:netconf:base:1.1")
+
+	for {
+		var msg string
+		if chunked {
+			msg, err = readChunks(in)
+		} else {
+			msg, err = readUntil(in, "]]>]]>")
+		}
+		if err != nil {
+			return
+		}
+		var rpc struct {
+			MessageID string `xml:"message-id,attr"`
+			GetConfig *struct {
+				Source struct {
+					Datastore struct {
+						XMLName xml.Name
+					} `xml:",any"`
+				} `xml:"source"`
+			} `xml:"get-config"`
+			CloseSession *struct{} `xml:"close-session"`
+		}
+		if err := xml.Unmarshal([]byte(msg), &rpc); err != nil {
+			return
+		}
+		body := "<ok/>"
+		switch {
+		case rpc.GetConfig != nil:
+			name := rpc.GetConfig.Source.Datastore.XMLName.Local
+			s.record("get-config " + name)
+			if data, ok := r.Datastores[name]; ok {
+				body = "<data>" + data + "</data>"
+			} else {
+				body = "<rpc-error><error-type>protocol</error-type><error-tag>invalid-value</error-tag>" +
+					"<error-severity>error</error-severity><error-message>no such datastore</error-message></rpc-error>"
+			}
+		case rpc.CloseSession != nil:
+			s.record("close-session")
+		}
+		reply := `<rpc-reply message-id="` + rpc.MessageID + `" xmlns="urn:ietf:params:xml:ns:netconf:base:1.0">` + body + "</rpc-reply>"
+		if chunked && r.Oversized {
+			_, _ = fmt.Fprintf(ch, "\n#%d\n%s", 1<<30, reply)
+		} else if chunked {
+			// Split the reply to exercise reassembly of several chunks.
+			half := len(reply) / 2
+			_, _ = fmt.Fprintf(ch, "\n#%d\n%s\n#%d\n%s\n##\n", half, reply[:half], len(reply)-half, reply[half:])
+		} else {
+			_, _ = io.WriteString(ch, reply+"]]>]]>")
+		}
+		if rpc.CloseSession != nil {
+			return
+		}
+	}
+}
+
+func (s *sshTestServer) record(command string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.executed = append(s.executed, command)
+}
+
+func readUntil(r *bufio.Reader, marker string) (string, error) {
+	var buf bytes.Buffer
+	for !bytes.HasSuffix(buf.Bytes(), []byte(marker)) {
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		buf.WriteByte(b)
+	}
+	return strings.TrimSuffix(buf.String(), marker), nil
+}
+
+func readChunks(r *bufio.Reader) (string, error) {
+	var buf bytes.Buffer
+	for {
+		if _, err := readUntil(r, "\n#"); err != nil {
+			return "", err
+		}
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		header = strings.TrimSuffix(header, "\n")
+		if header == "#" {
+			return buf.String(), nil
+		}
+		n, err := strconv.Atoi(header)
+		if err != nil {
+			return "", err
+		}
+		if _, err := io.CopyN(&buf, r, int64(n)); err != nil {
+			return "", err
+		}
+	}
+}
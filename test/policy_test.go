@@ -1,9 +1,19 @@
 package netsentry_test
 
 import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/0xdevren/netsentry/internal/model"
 	"github.com/0xdevren/netsentry/internal/policy"
+	"github.com/0xdevren/netsentry/internal/policy/dsl"
+	"github.com/0xdevren/netsentry/internal/policy/policytest"
+	"github.com/0xdevren/netsentry/internal/policy/vars"
+	"github.com/0xdevren/netsentry/internal/validator"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -121,3 +131,557 @@ func TestComputeSummary(t *testing.T) {
 	// Score = 2 / (2+1+1) * 100 = 50
 	assert.InDelta(t, 50.0, s.Score, 0.01)
 }
+
+func TestDSLValidator_Composition(t *testing.T) {
+	src := `
+name: composition
+rules:
+  - id: SNMP-V3
+    severity: HIGH
+    match:
+      all_of:
+        - regex: "^snmp-server group \\S+ v3"
+        - none_of:
+            - contains: "snmp-server community"
+    action:
+      deny: false
+  - id: BAD-001
+    severity: LOW
+    match:
+      any_of:
+        - within: "^line vty"
+          contains: "ssh"
+        - regex: "[unclosed"
+    action:
+      deny: true
+  - id: BAD-002
+    severity: LOW
+    match:
+      none_of: []
+    action:
+      deny: true
+`
+	raw, err := dsl.NewParser().ParseBytes([]byte(src))
+	require.NoError(t, err)
+	errs := dsl.NewValidator().Validate(raw)
+
+	fields := make([]string, 0, len(errs))
+	for _, e := range errs {
+		fields = append(fields, e.RuleID+" "+e.Field)
+	}
+	assert.ElementsMatch(t, []string{
+		"BAD-001 match.any_of[0].within",
+		"BAD-001 match.any_of[1].regex",
+		"BAD-002 match.none_of",
+	}, fields)
+}
+
+func TestDSLValidator_AppliesTo(t *testing.T) {
+	src := `
+name: applicability
+applies_to:
+  types: [cisco-ios, vyos]
+rules:
+  - id: R1
+    severity: LOW
+    applies_to:
+      version: "latest"
+      platform: ios
+    match:
+      contains: "hostname"
+    action:
+      deny: false
+`
+	raw, err := dsl.NewParser().ParseBytes([]byte(src))
+	require.NoError(t, err)
+	errs := dsl.NewValidator().Validate(raw)
+	fields := make([]string, 0, len(errs))
+	for _, e := range errs {
+		fields = append(fields, e.Field)
+		if e.Field == "applies_to.platform" {
+			assert.Contains(t, e.Message, `unsupported applies_to key "platform"`)
+			assert.Contains(t, e.Message, "version")
+		}
+	}
+	assert.ElementsMatch(t, []string{"applies_to.types", "applies_to.platform", "applies_to.version"}, fields)
+}
+
+// writePolicies writes the named policy documents into a temporary directory
+// and returns its path.
+func writePolicies(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, body := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(body), 0o644))
+	}
+	return dir
+}
+
+const basePolicy = `
+name: base
+version: "2.0"
+applies_to:
+  types: [cisco-ios]
+rules:
+  - id: BASE-001
+    severity: HIGH
+    match:
+      contains: "ip ssh version 2"
+    action:
+      deny: false
+      remediation: "enable ssh v2"
+  - id: BASE-002
+    severity: LOW
+    match:
+      contains: "service password-encryption"
+    action:
+      deny: false
+`
+
+func TestLoader_Extends_OverridesAndProvenance(t *testing.T) {
+	dir := writePolicies(t, map[string]string{
+		"base.yaml": basePolicy,
+		"extra/routing.yaml": `
+name: routing
+rules:
+  - id: ROUTE-001
+    severity: MEDIUM
+    match:
+      contains: "router bgp"
+    action:
+      deny: false
+`,
+		"site.yaml": `
+name: site
+extends: [base.yaml]
+include: [extra]
+overrides:
+  BASE-001:
+    severity: CRITICAL
+    remediation: "site specific fix"
+  ROUTE-001:
+    enabled: false
+rules:
+  - id: BASE-002
+    severity: MEDIUM
+    match:
+      contains: "service password-encryption"
+    action:
+      deny: false
+  - id: SITE-001
+    severity: LOW
+    match:
+      contains: "hostname"
+    action:
+      deny: false
+`,
+	})
+
+	pol, err := policy.NewLoader().LoadFile(filepath.Join(dir, "site.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, "2.0", pol.Version, "metadata is inherited from extends")
+
+	ids := make([]string, 0, len(pol.Rules))
+	for _, r := range pol.Rules {
+		ids = append(ids, r.ID)
+	}
+	assert.Equal(t, []string{"BASE-001", "BASE-002", "ROUTE-001", "SITE-001"}, ids)
+
+	base1 := pol.Rules[0]
+	assert.Equal(t, policy.SeverityCritical, base1.Severity)
+	assert.Equal(t, "site specific fix", base1.Action.Remediation)
+	assert.Equal(t, filepath.Join(dir, "base.yaml"), base1.Provenance.Source)
+	assert.Equal(t, []string{filepath.Join(dir, "site.yaml")}, base1.Provenance.OverriddenBy)
+	require.NotNil(t, base1.AppliesTo, "imported rules keep their policy's applies_to")
+	assert.Equal(t, []model.DeviceType{model.DeviceTypeCiscoIOS}, base1.AppliesTo.Types)
+
+	assert.Equal(t, policy.SeverityMedium, pol.Rules[1].Severity, "local rule replaces imported rule")
+	assert.Equal(t, filepath.Join(dir, "site.yaml"), pol.Rules[1].Provenance.Source)
+	assert.False(t, pol.Rules[2].IsEnabled())
+	assert.Equal(t, filepath.Join(dir, "extra", "routing.yaml"), pol.Rules[2].Provenance.Source)
+
+	// The cached parent is not mutated by the child's overrides.
+	parent, err := policy.NewLoader().LoadFile(filepath.Join(dir, "base.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, policy.SeverityHigh, parent.Rules[0].Severity)
+}
+
+func TestLoader_Extends_DetectsCycle(t *testing.T) {
+	dir := writePolicies(t, map[string]string{
+		"a.yaml": "name: a\nextends: [b.yaml]\n",
+		"b.yaml": "name: b\ninclude: [a.yaml]\n",
+	})
+	_, err := policy.NewLoader().LoadFile(filepath.Join(dir, "a.yaml"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "import cycle")
+}
+
+func TestLoader_Extends_Errors(t *testing.T) {
+	dir := writePolicies(t, map[string]string{
+		"base.yaml":  basePolicy,
+		"other.yaml": strings.Replace(basePolicy, "name: base", "name: other", 1),
+		"unknown.yaml": `
+name: unknown
+extends: [base.yaml]
+overrides:
+  MISSING-001:
+    enabled: false
+`,
+		"conflict.yaml": "name: conflict\ninclude: [base.yaml, other.yaml]\n",
+	})
+	loader := policy.NewLoader()
+
+	_, err := loader.LoadFile(filepath.Join(dir, "unknown.yaml"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "MISSING-001")
+
+	_, err = loader.LoadFile(filepath.Join(dir, "conflict.yaml"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "defined in both")
+
+	_, err = loader.LoadBytes([]byte("name: inline\nextends: [base.yaml]\n"))
+	assert.Error(t, err)
+}
+
+func TestDSLValidator_Overrides(t *testing.T) {
+	src := `
+name: overrides
+overrides:
+  SEC-001:
+    severity: URGENT
+  SEC-002: {}
+rules: []
+`
+	raw, err := dsl.NewParser().ParseBytes([]byte(src))
+	require.NoError(t, err)
+	errs := dsl.NewValidator().Validate(raw)
+	fields := make([]string, 0, len(errs))
+	for _, e := range errs {
+		fields = append(fields, e.Field)
+	}
+	assert.ElementsMatch(t, []string{"overrides", "overrides.SEC-001.severity", "overrides.SEC-002"}, fields)
+}
+
+func TestDSLValidator_TemplateVariables(t *testing.T) {
+	src := `
+name: templated
+rules:
+  - id: NTP
+    severity: MEDIUM
+    match:
+      regex: "^ntp server {{ .site.ntp_server }}$"
+    action:
+      remediation: "set {{ .vars.syslog_host }} and {{ .tags.tier }}"
+  - id: BAD
+    severity: LOW
+    match:
+      contains: "{{ site.ntp_server }}"
+    action:
+      deny: true
+`
+	raw, err := dsl.NewParser().ParseBytes([]byte(src))
+	require.NoError(t, err)
+
+	errs := dsl.NewValidator().Validate(raw)
+	require.Len(t, errs, 3, "%v", errs)
+	assert.Contains(t, errs[0].Message, `unresolved variable "site.ntp_server"`)
+
+	variables := &vars.File{
+		Vars:  map[string]interface{}{"syslog_host": "10.0.0.5"},
+		Sites: map[string]map[string]interface{}{"dc1": {"ntp_server": "10.1.1.1"}, "dc2": {}},
+	}
+	errs = dsl.NewValidator().WithVariables(variables).Validate(raw)
+	fields := make([]string, 0, len(errs))
+	for _, e := range errs {
+		fields = append(fields, e.RuleID+":"+e.Field)
+	}
+	assert.Equal(t, []string{"NTP:match.regex", "BAD:match.contains"}, fields)
+	assert.Contains(t, errs[0].Message, "dc2")
+}
+
+func TestApplyWaivers(t *testing.T) {
+	device := model.Device{ID: "edge-01", Site: "dc1"}
+	results := []policy.ValidationResult{
+		{RuleID: "SNMP", Status: policy.StatusFail, Message: "snmp v2c"},
+		{RuleID: "TELNET", Status: policy.StatusFail, Message: "telnet enabled"},
+		{RuleID: "NTP", Status: policy.StatusPass},
+		{RuleID: "SSH", Status: policy.StatusFail},
+	}
+	waivers := []policy.Waiver{
+		{ID: "CHG-1", RuleID: "SNMP", Device: policy.DeviceSelector{Names: []string{"edge-*"}},
+			Justification: "legacy NMS", Approver: "secops", Expires: "2026-12-31"},
+		{ID: "CHG-2", RuleID: "TELNET", Device: policy.DeviceSelector{Names: []string{"*"}},
+			Justification: "migration", Approver: "secops", Expires: "2026-01-31"},
+		{ID: "CHG-3", RuleID: "SSH", Device: policy.DeviceSelector{Applicability: policy.Applicability{Sites: []string{"dc2"}}},
+			Justification: "other site", Approver: "secops", Expires: "2026-12-31"},
+		{ID: "CHG-4", RuleID: "NTP", Device: policy.DeviceSelector{Names: []string{"edge-01"}},
+			Justification: "unused", Approver: "secops", Expires: "2026-12-31"},
+	}
+	now := time.Date(2026, 12, 31, 23, 0, 0, 0, time.UTC)
+
+	listed := policy.ApplyWaivers(results, waivers, device, now)
+
+	assert.Equal(t, policy.StatusWaived, results[0].Status)
+	assert.Contains(t, results[0].Message, "CHG-1")
+	assert.Equal(t, policy.StatusFail, results[1].Status, "expired waivers do not apply")
+	assert.Contains(t, results[1].Message, "expired")
+	assert.Equal(t, policy.StatusPass, results[2].Status)
+	assert.Equal(t, policy.StatusFail, results[3].Status, "waiver for another site does not apply")
+
+	refs := make([]string, 0, len(listed))
+	for _, w := range listed {
+		refs = append(refs, w.Ref())
+	}
+	assert.Equal(t, []string{"CHG-1", "CHG-4"}, refs)
+
+	s := policy.ComputeSummary(results)
+	assert.Equal(t, 1, s.Waived)
+	assert.Equal(t, 2, s.Failed)
+	assert.InDelta(t, 100.0/3, s.Score, 0.01, "waived results are excluded from the score")
+}
+
+func TestLoadWaiverFile(t *testing.T) {
+	dir := writePolicies(t, map[string]string{
+		"ok.yaml": `
+waivers:
+  - id: CHG-1
+    rule_id: SNMP
+    device:
+      names: ["edge-*"]
+      roles: [edge]
+    justification: legacy NMS
+    approver: secops
+    expires: "2026-12-31"
+`,
+		"no-approver.yaml": `
+waivers:
+  - rule_id: SNMP
+    device: {names: ["*"]}
+    justification: legacy NMS
+    expires: "2026-12-31"
+`,
+		"no-device.yaml": `
+waivers:
+  - rule_id: SNMP
+    justification: legacy NMS
+    approver: secops
+    expires: "2026-12-31"
+`,
+		"bad-date.yaml": `
+waivers:
+  - rule_id: SNMP
+    device: {names: ["*"]}
+    justification: legacy NMS
+    approver: secops
+    expires: "31/12/2026"
+`,
+	})
+
+	waivers, err := policy.LoadWaiverFile(filepath.Join(dir, "ok.yaml"))
+	require.NoError(t, err)
+	require.Len(t, waivers, 1)
+	assert.Equal(t, []string{"edge"}, waivers[0].Device.Roles)
+	assert.True(t, waivers[0].Device.Matches(model.Device{ID: "edge-07", Role: "edge"}))
+	assert.False(t, waivers[0].Device.Matches(model.Device{ID: "edge-07", Role: "core"}))
+
+	for _, name := range []string{"no-approver.yaml", "no-device.yaml", "bad-date.yaml"} {
+		_, err := policy.LoadWaiverFile(filepath.Join(dir, name))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestPolicyTest_RunSuite(t *testing.T) {
+	dir := writePolicies(t, map[string]string{
+		"base.yaml": basePolicy,
+		"base_test.yaml": `
+policy: base.yaml
+tests:
+  - name: ssh v2 configured
+    device: {type: cisco-ios}
+    config: |
+      ip ssh version 2
+    expect:
+      BASE-001: pass
+  - name: wrong expectation
+    device: {type: cisco-ios}
+    config: |
+      hostname R1
+    expect:
+      BASE-001: PASS
+      BASE-002: FAIL
+      MISSING: FAIL
+  - name: other platforms are skipped
+    device: {type: juniper-junos}
+    config: |
+      set system host-name J1
+    expect:
+      BASE-001: SKIP
+`,
+		"all.yaml": "name: all\ninclude: [\".\"]\n",
+	})
+
+	files, err := policytest.Discover(dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(dir, "base_test.yaml")}, files)
+
+	suite, err := policytest.LoadSuite(files[0])
+	require.NoError(t, err)
+	results := policytest.NewRunner().Run(context.Background(), suite)
+	require.Len(t, results, 3)
+
+	assert.True(t, results[0].Passed())
+	assert.True(t, results[2].Passed())
+	require.NoError(t, results[1].Err)
+	require.Len(t, results[1].Mismatches, 2)
+	assert.Equal(t, "BASE-001: want PASS, got FAIL (rule BASE-001: required condition not met: )",
+		results[1].Mismatches[0].String())
+	assert.Equal(t, "MISSING: want FAIL, rule not found in policy", results[1].Mismatches[1].String())
+
+	all, err := policy.NewLoader().LoadFile(filepath.Join(dir, "all.yaml"))
+	require.NoError(t, err)
+	assert.Len(t, all.Rules, 2, "fixtures are not included as policies")
+}
+
+func TestPolicyTest_LoadSuiteErrors(t *testing.T) {
+	dir := writePolicies(t, map[string]string{
+		"nopolicy_test.yaml": "tests:\n  - name: x\n    config: a\n    expect: {R: PASS}\n",
+		"status_test.yaml":   "policy: p.yaml\ntests:\n  - name: x\n    config: a\n    expect: {R: BROKEN}\n",
+		"noconfig_test.yaml": "policy: p.yaml\ntests:\n  - name: x\n    expect: {R: PASS}\n",
+	})
+	for name, want := range map[string]string{
+		"nopolicy_test.yaml": "policy is required",
+		"status_test.yaml":   `invalid status "BROKEN"`,
+		"noconfig_test.yaml": "needs config or config_file",
+	} {
+		_, err := policytest.LoadSuite(filepath.Join(dir, name))
+		require.Error(t, err, name)
+		assert.Contains(t, err.Error(), want, name)
+	}
+}
+
+func TestValidate_MultiplePolicies(t *testing.T) {
+	dir := writePolicies(t, map[string]string{
+		"base.yaml": basePolicy,
+		"security.yaml": `
+name: security
+extends: [base.yaml]
+rules:
+  - id: COMMON-001
+    severity: MEDIUM
+    match:
+      contains: "no ip http server"
+    action:
+      deny: false
+`,
+		"routing.yaml": `
+name: routing
+extends: [base.yaml]
+rules:
+  - id: COMMON-001
+    severity: MEDIUM
+    match:
+      contains: "router bgp"
+    action:
+      deny: false
+`,
+	})
+
+	policies, err := policy.NewLoader().LoadPaths([]string{
+		filepath.Join(dir, "security.yaml"),
+		filepath.Join(dir, "routing.yaml"),
+	})
+	require.NoError(t, err)
+	require.Len(t, policies, 2)
+
+	merged, err := policy.Merge(policies...)
+	require.NoError(t, err)
+	ids := make([]string, 0, len(merged.Rules))
+	for _, r := range merged.Rules {
+		ids = append(ids, r.ID)
+	}
+	assert.Equal(t, []string{"BASE-001", "BASE-002", "security/COMMON-001", "routing/COMMON-001"}, ids,
+		"shared baseline rules are evaluated once; colliding IDs are namespaced")
+	assert.Equal(t, "security", merged.Rules[0].Provenance.Policy)
+	assert.Equal(t, "security, routing", merged.Name)
+
+	cfg := &model.ConfigModel{
+		Device: model.Device{ID: "edge-01", Type: model.DeviceTypeCiscoIOS},
+		Lines:  []string{"ip ssh version 2", "no ip http server"},
+	}
+	rep, err := validator.Validate(context.Background(), validator.ValidationRequest{
+		Config:   cfg,
+		Policies: policies,
+		Waivers: []policy.Waiver{{ID: "CHG-7", RuleID: "COMMON-001", Device: policy.DeviceSelector{Names: []string{"*"}},
+			Justification: "no bgp here", Approver: "neteng", Expires: "2099-12-31"}},
+	})
+	require.NoError(t, err)
+
+	statuses := make(map[string]policy.ValidationStatus)
+	for _, r := range rep.Results {
+		statuses[r.RuleID] = r.Status
+	}
+	assert.Equal(t, policy.StatusPass, statuses["BASE-001"])
+	assert.Equal(t, policy.StatusFail, statuses["BASE-002"])
+	assert.Equal(t, policy.StatusPass, statuses["security/COMMON-001"])
+	assert.Equal(t, policy.StatusWaived, statuses["routing/COMMON-001"], "a bare rule ID waives the namespaced rule")
+	assert.Equal(t, "routing", rep.Results[len(rep.Results)-1].Policy, "results are grouped by policy")
+
+	require.Len(t, rep.Policies, 2)
+	assert.Equal(t, "security", rep.Policies[0].Name)
+	assert.Equal(t, 2, rep.Policies[0].Summary.Passed)
+	assert.Equal(t, 1, rep.Policies[0].Summary.Failed)
+	assert.Equal(t, "routing", rep.Policies[1].Name)
+	assert.Equal(t, 1, rep.Policies[1].Summary.Waived)
+	assert.Equal(t, 4, rep.Summary.Total)
+}
+
+func TestValidate_MultiplePolicies_Overrides(t *testing.T) {
+	dir := writePolicies(t, map[string]string{
+		"base.yaml": `
+name: base
+rules:
+  - id: R1
+    severity: LOW
+    match:
+      contains: "hostname"
+    action:
+      deny: false
+`,
+		"child.yaml": `
+name: child
+extends: [base.yaml]
+overrides:
+  R1:
+    severity: CRITICAL
+    enabled: false
+`,
+	})
+	cfg := &model.ConfigModel{
+		Device: model.Device{ID: "edge-01", Type: model.DeviceTypeCiscoIOS},
+		Lines:  []string{"hostname edge-01"},
+	}
+
+	for _, order := range [][]string{{"base.yaml", "child.yaml"}, {"child.yaml", "base.yaml"}} {
+		policies, err := policy.NewLoader().LoadPaths([]string{filepath.Join(dir, order[0]), filepath.Join(dir, order[1])})
+		require.NoError(t, err)
+		rep, err := validator.Validate(context.Background(), validator.ValidationRequest{Config: cfg, Policies: policies})
+		require.NoError(t, err)
+
+		results := make(map[string]policy.ValidationResult)
+		for _, r := range rep.Results {
+			results[r.RuleID] = r
+		}
+		require.Len(t, results, 2, "the overridden rule is kept next to the original: %v", order)
+		assert.Equal(t, policy.StatusPass, results["base/R1"].Status, order)
+		assert.Equal(t, policy.SeverityLow, results["base/R1"].Severity, order)
+		assert.Equal(t, "base", results["base/R1"].Policy, order)
+		assert.Equal(t, policy.StatusSkip, results["child/R1"].Status, order)
+		assert.Equal(t, policy.SeverityCritical, results["child/R1"].Severity, order)
+		assert.Equal(t, "child", results["child/R1"].Policy, order)
+		for _, p := range rep.Policies {
+			assert.Equal(t, 1, p.Summary.Total, "%s: %v", p.Name, order)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package netsentry_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/0xdevren/netsentry/internal/api"
+	"github.com/0xdevren/netsentry/internal/app"
+	"github.com/0xdevren/netsentry/internal/drift"
+	"github.com/0xdevren/netsentry/internal/model"
+	"github.com/0xdevren/netsentry/internal/parser/juniper"
+	"github.com/0xdevren/netsentry/internal/policy"
+	"github.com/0xdevren/netsentry/internal/redact"
+	"github.com/0xdevren/netsentry/internal/telemetry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactor_VendorPatterns(t *testing.T) {
+	r := redact.Default()
+
+	for _, tc := range []struct {
+		typ    model.DeviceType
+		line   string
+		secret string
+	}{
+		{model.DeviceTypeCiscoIOS, "enable secret 9 $9$nhEmQVczB7dqsO$X.HsgL6x1il0RxkOSSvyQYwucySCt7qFm4v7pqCxkKM", "$9$nhEmQVczB7dqsO"},
+		{model.DeviceTypeCiscoIOS, "username admin privilege 15 secret 5 $1$mERr$hx5rVt7rPNoS4wqbXKX7m0", "$1$mERr$"},
+		{model.DeviceTypeCiscoIOS, "snmp-server community s3cr3tRO RO 10", "s3cr3tRO"},
+		{model.DeviceTypeCiscoIOS, " neighbor 10.0.0.2 password 7 0822455D0A16", "0822455D0A16"},
+		{model.DeviceTypeCiscoIOS, "tacacs-server host 10.1.1.1 key 7 045802150C2E", "045802150C2E"},
+		{model.DeviceTypeCiscoIOS, " key 7 045802150C2E", "045802150C2E"},
+		{model.DeviceTypeCiscoIOS, " password 7 121A0C041104", "121A0C041104"},
+		{model.DeviceTypeCiscoNXOS, "snmp-server user admin network-admin auth md5 0x1a2b3c priv 0x4d5e6f localizedkey", "0x4d5e6f"},
+		{model.DeviceTypeAristaEOS, "   neighbor SPINES password 7 Jx9mMK4WxWs=", "Jx9mMK4WxWs="},
+		{model.DeviceTypeJuniperOS, `set system root-authentication encrypted-password "$6$aB3dE$Lk1"`, "$6$aB3dE$Lk1"},
+		{model.DeviceTypeJuniperOS, `set protocols bgp group ext authentication-key "$9$Hk5FCA0IRS"`, "$9$Hk5FCA0IRS"},
+		{model.DeviceTypeJuniperOS, "set snmp community monitorRO authorization read-only", "monitorRO"},
+		{model.DeviceTypeJuniperOS, `            secret "$9$dkb2aZjq.5Q"; ## SECRET-DATA`, "$9$dkb2aZjq.5Q"},
+		{model.DeviceTypeJuniperOS, "    community monitorRO {", "monitorRO"},
+	} {
+		got := r.Line(tc.typ, tc.line)
+		assert.NotContains(t, got, tc.secret, tc.line)
+		assert.Contains(t, got, "<redacted:", tc.line)
+		assert.Equal(t, got, r.Line(tc.typ, got), "redacting twice changes nothing: %s", tc.line)
+	}
+
+	assert.Regexp(t, `^set system root-authentication encrypted-password "<redacted:[0-9a-f]{12}>"$`,
+		r.Line(model.DeviceTypeJuniperOS, `set system root-authentication encrypted-password "x"`), "quotes are kept")
+	assert.Regexp(t, `^snmp-server community <redacted:[0-9a-f]{12}> RO$`, r.Line(model.DeviceTypeUnknown, "snmp-server community public RO"),
+		"every pattern applies to configurations of unknown type")
+	assert.Regexp(t, `^enable secret 0 <redacted:[0-9a-f]{12}>$`, r.Line(model.DeviceTypeUnknown, "enable secret 0 s3cret"),
+		"JunOS patterns do not match IOS lines")
+	assert.Equal(t, "interface GigabitEthernet0/1", r.Line(model.DeviceTypeCiscoIOS, "interface GigabitEthernet0/1"))
+	assert.Equal(t, "set snmp community public", r.Line(model.DeviceTypeCiscoIOS, "set snmp community public"),
+		"JunOS patterns do not apply to IOS configurations")
+}
+
+func TestRedactor_StableTokens(t *testing.T) {
+	r := redact.Default()
+	a := r.Line(model.DeviceTypeCiscoIOS, "snmp-server community alpha RO")
+	assert.Equal(t, a, r.Line(model.DeviceTypeCiscoIOS, "snmp-server community alpha RO"))
+	assert.NotEqual(t, a, r.Line(model.DeviceTypeCiscoIOS, "snmp-server community bravo RO"))
+
+	keyed, err := redact.NewRedactor(redact.Options{HashKey: []byte("k1")})
+	require.NoError(t, err)
+	assert.NotEqual(t, a, keyed.Line(model.DeviceTypeCiscoIOS, "snmp-server community alpha RO"), "a key changes the tokens")
+
+	// A changed password is still drift, without either value in the diff.
+	baseline := []byte("hostname edge-01\nenable secret 9 oldS3cret\n")
+	current := []byte("hostname edge-01\nenable secret 9 newS3cret\n")
+	diff := r.Diff(model.DeviceTypeCiscoIOS, drift.NewComparator().Compare("edge-01", baseline, current))
+	require.Len(t, diff.Added, 1)
+	require.Len(t, diff.Removed, 1)
+	assert.NotEqual(t, diff.Added[0].Line, diff.Removed[0].Line)
+	assert.NotContains(t, diff.String(), "S3cret")
+
+	// Redacting before comparing gives the same result.
+	redacted := drift.NewComparator().Compare("edge-01",
+		r.Text(model.DeviceTypeCiscoIOS, baseline), r.Text(model.DeviceTypeCiscoIOS, current))
+	assert.Equal(t, diff.Added, redacted.Added)
+	assert.Equal(t, diff.Removed, redacted.Removed)
+}
+
+func TestRedactor_PatternFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "redact.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+no_defaults: true
+patterns:
+  - name: api-key
+    vendors: [arista-eos]
+    match: 'api-key (\S+)'
+`), 0o600))
+	opts, err := redact.LoadFile(path)
+	require.NoError(t, err)
+	r, err := redact.NewRedactor(opts)
+	require.NoError(t, err)
+
+	assert.NotContains(t, r.Line(model.DeviceTypeAristaEOS, "management api-key abc123"), "abc123")
+	assert.Equal(t, "management api-key abc123", r.Line(model.DeviceTypeCiscoIOS, "management api-key abc123"))
+	assert.Equal(t, "snmp-server community public", r.Line(model.DeviceTypeAristaEOS, "snmp-server community public"),
+		"no_defaults drops the built-in patterns")
+
+	_, err = redact.NewRedactor(redact.Options{Patterns: []redact.Pattern{{Name: "bad", Match: "api-key \\S+"}}})
+	assert.ErrorContains(t, err, `redact: pattern "bad": no capture group marks the secret`)
+}
+
+func TestRedactor_ConfigAndReport(t *testing.T) {
+	r := redact.Default()
+	cfg := &model.ConfigModel{
+		Device:  model.Device{ID: "edge-01", Type: model.DeviceTypeCiscoIOS},
+		RawText: "hostname edge-01\nsnmp-server community s3cret RO\n",
+		Lines:   []string{"hostname edge-01", "snmp-server community s3cret RO"},
+		Blocks: []model.ConfigBlock{{
+			Header: "router bgp 65000",
+			Lines:  []string{"neighbor 10.0.0.2 password s3cret"},
+		}},
+	}
+	out := r.Config(cfg)
+	assert.NotContains(t, out.RawText, "s3cret")
+	assert.True(t, strings.HasSuffix(out.RawText, " RO\n"))
+	assert.NotContains(t, out.Lines[1], "s3cret")
+	assert.NotContains(t, out.Blocks[0].Lines[0], "s3cret")
+	assert.Contains(t, cfg.RawText, "s3cret", "the original is left unchanged")
+
+	rep := &policy.Report{
+		Device: model.Device{ID: "edge-01", Type: model.DeviceTypeCiscoIOS},
+		Results: []policy.ValidationResult{{
+			RuleID:   "SNMP-001",
+			Status:   policy.StatusFail,
+			Evidence: []policy.Evidence{{Line: 2, Text: "snmp-server community s3cret RO"}},
+		}},
+	}
+	data, err := json.Marshal(r.Report(rep))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "s3cret")
+	assert.Equal(t, "snmp-server community s3cret RO", rep.Results[0].Evidence[0].Text)
+}
+
+// newRedactingAPI returns an API router whose context redacts with the
+// default patterns and a random key, as netsentry serve does.
+func newRedactingAPI() http.Handler {
+	return api.BuildRouter(&app.Context{
+		Logger:   telemetry.NewLogger(telemetry.LogOptions{Output: io.Discard}),
+		Redactor: redact.Default().WithKey(redact.RandomKey()),
+	})
+}
+
+func TestRedactor_RandomKey(t *testing.T) {
+	line := "snmp-server community public RO"
+	unkeyed := redact.Default().Line(model.DeviceTypeCiscoIOS, line)
+
+	a := redact.Default().WithKey(redact.RandomKey())
+	b := redact.Default().WithKey(redact.RandomKey())
+	assert.Equal(t, a.Line(model.DeviceTypeCiscoIOS, line), a.Line(model.DeviceTypeCiscoIOS, line), "tokens are stable within the process")
+	assert.NotEqual(t, unkeyed, a.Line(model.DeviceTypeCiscoIOS, line), "served tokens are not plain hashes")
+	assert.NotEqual(t, a.Line(model.DeviceTypeCiscoIOS, line), b.Line(model.DeviceTypeCiscoIOS, line), "every process has its own key")
+	assert.Len(t, redact.RandomKey(), 32)
+}
+
+func TestAPI_RedactsValidateAndDrift(t *testing.T) {
+	srv := httptest.NewServer(newRedactingAPI())
+	defer srv.Close()
+
+	body, err := json.Marshal(api.ValidateRequest{
+		Config: "version 15.2\nhostname edge-01\nsnmp-server community s3cret RO\n",
+		PolicyYAML: `
+name: snmp
+rules:
+  - id: SNMP-001
+    severity: HIGH
+    match:
+      contains: "snmp-server community"
+    action:
+      deny: true
+`,
+	})
+	require.NoError(t, err)
+	resp, err := http.Post(srv.URL+"/api/v1/validate", "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(data))
+	assert.NotContains(t, string(data), "s3cret")
+	var rep policy.Report
+	require.NoError(t, json.Unmarshal(data, &rep))
+	require.Len(t, rep.Results, 1)
+	require.Len(t, rep.Results[0].Evidence, 1)
+	assert.Regexp(t, `^snmp-server community <redacted:[0-9a-f]{12}> RO$`, rep.Results[0].Evidence[0].Text)
+
+	for _, snapshot := range []string{
+		"hostname edge-01\nenable secret 0 oldS3cret\n",
+		"hostname edge-01\nenable secret 0 newS3cret\n",
+	} {
+		resp, err := http.Post(srv.URL+"/api/v1/drift/redact-edge-01", "text/plain", strings.NewReader(snapshot))
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+	}
+	resp, err = http.Get(srv.URL + "/api/v1/drift/redact-edge-01")
+	require.NoError(t, err)
+	data, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(data))
+	var report struct {
+		Diff  drift.DiffResult `json:"diff"`
+		Score drift.DriftScore `json:"score"`
+	}
+	require.NoError(t, json.Unmarshal(data, &report))
+	assert.NotContains(t, string(data), "S3cret")
+	require.Len(t, report.Diff.Added, 1, "the changed password is reported as drift")
+	assert.Contains(t, report.Diff.Added[0].Line, "enable secret 0 <redacted:")
+}
+
+func TestRedactor_JunOSBlocks(t *testing.T) {
+	text := `system {
+    root-authentication {
+        encrypted-password "$6$SECRETHASH";
+    }
+}
+snmp {
+    community s3cretcomm {
+        authorization read-only;
+    }
+}
+`
+	cfg, err := juniper.NewJunOSParser().Parse(context.Background(), []byte(text), model.Device{ID: "J1", Type: model.DeviceTypeJuniperOS})
+	require.NoError(t, err)
+	r := redact.Default()
+
+	data, err := json.Marshal(r.Config(cfg).Blocks)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "SECRETHASH", "block lines are redacted")
+	assert.NotContains(t, string(data), "s3cretcomm", "block headers are redacted")
+
+	results := policy.NewEvaluator(policy.NewMatcher()).EvaluateAll(policy.Rule{
+		ID: "ROOT-HASH", Severity: policy.SeverityHigh,
+		Match:  policy.MatchSpec{Within: `^root-authentication`, Contains: "encrypted-password"},
+		Action: policy.ActionSpec{Deny: true},
+	}, cfg)
+	require.Len(t, results, 1)
+	require.Equal(t, policy.StatusFail, results[0].Status)
+	require.NotEmpty(t, results[0].Evidence)
+	data, err = json.Marshal(r.Report(&policy.Report{Device: cfg.Device, Results: results}))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "SECRETHASH", "evidence of block-scoped rules is redacted")
+	assert.Contains(t, string(data), "encrypted-password")
+}
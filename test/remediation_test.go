@@ -0,0 +1,140 @@
+package netsentry_test
+
+import (
+	"testing"
+
+	"github.com/0xdevren/netsentry/internal/model"
+	"github.com/0xdevren/netsentry/internal/policy"
+	"github.com/0xdevren/netsentry/internal/remediation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func evaluateReport(pol *policy.Policy, cfg *model.ConfigModel) *policy.Report {
+	evaluator := policy.NewEvaluator(policy.NewMatcher())
+	rep := &policy.Report{}
+	for _, rule := range pol.Rules {
+		rep.Results = append(rep.Results, evaluator.EvaluateAll(rule, cfg)...)
+	}
+	return rep
+}
+
+func iosFix(parents []string, lines ...string) map[model.DeviceType]policy.Fix {
+	return map[model.DeviceType]policy.Fix{
+		model.DeviceTypeCiscoIOS: {Parents: parents, Lines: lines},
+	}
+}
+
+func TestRemediation_BuildOrdersSections(t *testing.T) {
+	cfg := parseIOS(t, scopedConfig)
+	cfg.Device.Type = model.DeviceTypeCiscoIOS
+	pol := &policy.Policy{Name: "fixes", Rules: []policy.Rule{
+		{ID: "OSPF-001", Severity: policy.SeverityLow,
+			Match:  policy.MatchSpec{RequiredBlock: "router ospf"},
+			Action: policy.ActionSpec{Fix: iosFix([]string{"router ospf 1"}, "passive-interface default")}},
+		{ID: "VTY-002", Severity: policy.SeverityHigh,
+			Match:  policy.MatchSpec{Within: `^line vty`, Contains: "exec-timeout"},
+			Action: policy.ActionSpec{Fix: iosFix(nil, "exec-timeout 5 0")}},
+		{ID: "IF-001", Severity: policy.SeverityMedium,
+			Match:  policy.MatchSpec{Within: `^interface GigabitEthernet`, Contains: "no ip proxy-arp"},
+			Action: policy.ActionSpec{Fix: iosFix(nil, "no ip proxy-arp")}},
+		{ID: "SVC-001", Severity: policy.SeverityHigh,
+			Match:  policy.MatchSpec{RequiredBlock: "service password-encryption"},
+			Action: policy.ActionSpec{Fix: iosFix(nil, "service password-encryption")}},
+		{ID: "NTP-001", Severity: policy.SeverityMedium,
+			Match:  policy.MatchSpec{RequiredBlock: "ntp server"},
+			Action: policy.ActionSpec{Remediation: "Configure an NTP server."}},
+	}}
+
+	patch, err := remediation.Build(evaluateReport(pol, cfg), pol, cfg)
+	require.NoError(t, err)
+
+	require.Len(t, patch.Sections, 4)
+	assert.Empty(t, patch.Sections[0].Parents)
+	assert.Equal(t, []string{"service password-encryption"}, patch.Sections[0].Lines)
+	assert.Equal(t, []string{"interface GigabitEthernet0/1"}, patch.Sections[1].Parents)
+	assert.Equal(t, []string{"line vty 0 4"}, patch.Sections[2].Parents)
+	assert.Equal(t, []string{"router ospf 1"}, patch.Sections[3].Parents)
+
+	require.Len(t, patch.Manual, 1)
+	assert.Equal(t, "NTP-001", patch.Manual[0].RuleID)
+
+	require.Len(t, patch.Rollback, 4)
+	assert.Equal(t, []string{"router ospf 1"}, patch.Rollback[0].Parents)
+	assert.Equal(t, []string{"no passive-interface default"}, patch.Rollback[0].Lines)
+	assert.Equal(t, []string{"ip proxy-arp"}, patch.Rollback[2].Lines)
+	assert.Equal(t, []string{"no service password-encryption"}, patch.Rollback[3].Lines)
+
+	text := patch.Render()
+	assert.Contains(t, text, "interface GigabitEthernet0/1\n no ip proxy-arp\n!\n")
+	assert.Contains(t, text, "!   NTP-001: no fix defined for cisco-ios; Configure an NTP server.")
+}
+
+func TestRemediation_RollbackAndJunOS(t *testing.T) {
+	cfg := &model.ConfigModel{
+		Device: model.Device{ID: "J1", Type: model.DeviceTypeJuniperOS},
+		Lines:  []string{"set system host-name J1"},
+	}
+	pol := &policy.Policy{Name: "fixes", Rules: []policy.Rule{
+		{ID: "SSH-001", Severity: policy.SeverityHigh,
+			Match: policy.MatchSpec{RequiredBlock: "set system services ssh"},
+			Action: policy.ActionSpec{Fix: map[model.DeviceType]policy.Fix{
+				model.DeviceTypeJuniperOS: {Lines: []string{
+					"set system services ssh protocol-version v2",
+					"delete system services telnet",
+				}},
+			}}},
+	}}
+
+	patch, err := remediation.Build(evaluateReport(pol, cfg), pol, cfg)
+	require.NoError(t, err)
+	require.Len(t, patch.Rollback, 1)
+	assert.Equal(t, []string{"delete system services ssh protocol-version v2"}, patch.Rollback[0].Lines)
+	assert.Equal(t, []string{"delete system services telnet"}, patch.Irreversible)
+	assert.Contains(t, patch.RenderRollback(), "#   delete system services telnet")
+}
+
+func TestRemediation_ReplacedValuesAreIrreversible(t *testing.T) {
+	cfg := parseIOS(t, `hostname edge-01
+enable secret 5 $1$old$hash
+username ops secret 5 $1$ops$hash
+line con 0
+ transport input telnet
+line vty 0 4
+ transport input telnet
+`)
+	cfg.Device.Type = model.DeviceTypeCiscoIOS
+	pol := &policy.Policy{Name: "fixes", Rules: []policy.Rule{
+		{ID: "ENABLE-001", Severity: policy.SeverityHigh,
+			Match:  policy.MatchSpec{RequiredBlock: "enable secret 9"},
+			Action: policy.ActionSpec{Fix: iosFix(nil, "enable secret 9 $9$new$hash")}},
+		{ID: "USER-001", Severity: policy.SeverityHigh,
+			Match:  policy.MatchSpec{RequiredBlock: "username admin"},
+			Action: policy.ActionSpec{Fix: iosFix(nil, "username admin secret 9 $9$adm$hash")}},
+		{ID: "VTY-001", Severity: policy.SeverityHigh,
+			Match:  policy.MatchSpec{Within: `^line vty`, Contains: "transport input ssh"},
+			Action: policy.ActionSpec{Fix: iosFix(nil, "transport input ssh", "exec-timeout 5 0")}},
+		{ID: "CON-001", Severity: policy.SeverityHigh,
+			Match: policy.MatchSpec{Within: `^line con`, Contains: "transport input ssh"},
+			Action: policy.ActionSpec{Fix: map[model.DeviceType]policy.Fix{model.DeviceTypeCiscoIOS: {
+				Lines: []string{"transport input ssh"}, Rollback: []string{"transport input telnet"},
+			}}}},
+	}}
+
+	patch, err := remediation.Build(evaluateReport(pol, cfg), pol, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"enable secret 9 $9$new$hash", "transport input ssh"}, patch.Irreversible,
+		"negating a command that replaced a value would not restore it")
+
+	undo := make(map[string][]string)
+	for _, s := range patch.Rollback {
+		key := "global"
+		if len(s.Parents) > 0 {
+			key = s.Parents[0]
+		}
+		undo[key] = s.Lines
+	}
+	assert.Equal(t, []string{"no username admin secret 9 $9$adm$hash"}, undo["global"], "a new user is removed again")
+	assert.Equal(t, []string{"no exec-timeout 5 0"}, undo["line vty 0 4"], "an unset value is negated")
+	assert.Equal(t, []string{"transport input telnet"}, undo["line con 0"], "an explicit rollback is used as is")
+}
@@ -0,0 +1,387 @@
+package netsentry_test
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshTestServer is an in-process SSH server standing in for a network device
+// or a bastion. Exec requests are answered from commands; unknown commands
+// fail with exit status 1 like a device CLI rejecting the input. Shell
+// requests run the scripted CLI set with SetShell, the netconf subsystem the
+// responder set with SetNetconf, and direct-tcpip channels are forwarded like
+// a jump host does.
+type sshTestServer struct {
+	Host     string
+	Port     int
+	Password string
+	HostKey  ssh.Signer
+
+	config   *ssh.ServerConfig
+	mu       sync.Mutex
+	commands map[string]string
+	delay    time.Duration
+	executed []string
+	shell    *cliScript
+	netconf  *netconfResponder
+	keys     []ssh.PublicKey
+	userCA   ssh.PublicKey
+	forwards []string
+}
+
+// cliScript describes the interactive CLI of the test device.
+type cliScript struct {
+	// Hostname is shown in the prompt.
+	Hostname string
+	// EnableSecret, when set, starts sessions unprivileged until "enable"
+	// is given this password. Commands other than "enable" are rejected
+	// in unprivileged mode.
+	EnableSecret string
+	// PageLength pages command output after this many lines until the
+	// pager command is run; zero disables paging.
+	PageLength int
+	// PagerCommand disables paging; defaults to "terminal length 0".
+	PagerCommand string
+	// Pause, when set, splits command output after each occurrence of this
+	// text and waits before writing the rest, so that the client reads
+	// the output up to there on its own.
+	Pause string
+}
+
+// startSSHServer starts a server accepting the password "secret" and stops it
+// when the test ends.
+func startSSHServer(t *testing.T, commands map[string]string) *sshTestServer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	s := &sshTestServer{Password: "secret", HostKey: signer, commands: commands}
+	s.Host = host
+	s.Port, _ = strconv.Atoi(port)
+
+	certs := &ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return s.userCA != nil && bytes.Equal(auth.Marshal(), s.userCA.Marshal())
+		},
+		UserKeyFallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			for _, k := range s.keys {
+				if bytes.Equal(k.Marshal(), key.Marshal()) {
+					return nil, nil
+				}
+			}
+			return nil, ssh.ErrNoAuth
+		},
+	}
+	cfg := &ssh.ServerConfig{
+		PasswordCallback: func(_ ssh.ConnMetadata, pw []byte) (*ssh.Permissions, error) {
+			if string(pw) != s.Password {
+				return nil, ssh.ErrNoAuth
+			}
+			return nil, nil
+		},
+		PublicKeyCallback: certs.Authenticate,
+	}
+	cfg.AddHostKey(signer)
+	s.config = cfg
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, cfg)
+		}
+	}()
+	return s
+}
+
+// Addr returns the server address as host:port.
+func (s *sshTestServer) Addr() string {
+	return net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+}
+
+// AddHostKey offers key as a host key in addition to HostKey. It must be
+// called before the first connection.
+func (s *sshTestServer) AddHostKey(key ssh.Signer) {
+	s.config.AddHostKey(key)
+}
+
+// SetDelay makes every command take d before answering.
+func (s *sshTestServer) SetDelay(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delay = d
+}
+
+// AuthorizeKey accepts public key authentication with key.
+func (s *sshTestServer) AuthorizeKey(key ssh.PublicKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = append(s.keys, key)
+}
+
+// TrustUserCA accepts user certificates signed by ca.
+func (s *sshTestServer) TrustUserCA(ca ssh.PublicKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.userCA = ca
+}
+
+// Forwarded returns the addresses connections were forwarded to.
+func (s *sshTestServer) Forwarded() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.forwards...)
+}
+
+// SetShell enables interactive sessions running script.
+func (s *sshTestServer) SetShell(script cliScript) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.shell = &script
+}
+
+// Executed returns the commands run so far.
+func (s *sshTestServer) Executed() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.executed...)
+}
+
+func (s *sshTestServer) serve(conn net.Conn, cfg *ssh.ServerConfig) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for nc := range chans {
+		if nc.ChannelType() == "direct-tcpip" {
+			go s.forward(nc)
+			continue
+		}
+		if nc.ChannelType() != "session" {
+			_ = nc.Reject(ssh.UnknownChannelType, "session only")
+			continue
+		}
+		ch, requests, err := nc.Accept()
+		if err != nil {
+			return
+		}
+		go s.session(ch, requests)
+	}
+}
+
+// forward connects a direct-tcpip channel to its destination.
+func (s *sshTestServer) forward(nc ssh.NewChannel) {
+	var dest struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(nc.ExtraData(), &dest); err != nil {
+		_ = nc.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	addr := net.JoinHostPort(dest.Host, strconv.Itoa(int(dest.Port)))
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		_ = nc.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	ch, reqs, err := nc.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	s.mu.Lock()
+	s.forwards = append(s.forwards, addr)
+	s.mu.Unlock()
+	go ssh.DiscardRequests(reqs)
+	go func() {
+		_, _ = io.Copy(conn, ch)
+		conn.Close()
+	}()
+	_, _ = io.Copy(ch, conn)
+	ch.Close()
+}
+
+func (s *sshTestServer) session(ch ssh.Channel, requests <-chan *ssh.Request) {
+	defer ch.Close()
+	for req := range requests {
+		switch {
+		case req.Type == "pty-req":
+			_ = req.Reply(true, nil)
+			continue
+		case req.Type == "subsystem":
+			s.mu.Lock()
+			responder := s.netconf
+			s.mu.Unlock()
+			if responder == nil || len(req.Payload) < 4 || string(req.Payload[4:]) != "netconf" {
+				_ = req.Reply(false, nil)
+				continue
+			}
+			_ = req.Reply(true, nil)
+			go ssh.DiscardRequests(requests)
+			s.serveNetconf(ch, *responder)
+			return
+		case req.Type == "shell":
+			s.mu.Lock()
+			script := s.shell
+			s.mu.Unlock()
+			if script == nil {
+				_ = req.Reply(false, nil)
+				continue
+			}
+			_ = req.Reply(true, nil)
+			go ssh.DiscardRequests(requests)
+			s.cli(ch, *script)
+			return
+		case req.Type != "exec" || len(req.Payload) < 4:
+			_ = req.Reply(false, nil)
+			continue
+		}
+		command := string(req.Payload[4:])
+		_ = req.Reply(true, nil)
+
+		s.mu.Lock()
+		s.executed = append(s.executed, command)
+		out, ok := s.commands[command]
+		delay := s.delay
+		s.mu.Unlock()
+
+		time.Sleep(delay)
+		status := uint32(0)
+		if !ok {
+			out, status = "% Invalid input detected\n", 1
+		}
+		_, _ = ch.Write([]byte(out))
+		payload := make([]byte, 4)
+		binary.BigEndian.PutUint32(payload, status)
+		_, _ = ch.SendRequest("exit-status", false, payload)
+		return
+	}
+}
+
+// cli emulates a device shell on a terminal: input is echoed, output lines
+// end in CRLF, and paged output waits for a key at a --More-- prompt.
+func (s *sshTestServer) cli(ch ssh.Channel, script cliScript) {
+	in := bufio.NewReader(ch)
+	write := func(text string) { _, _ = ch.Write([]byte(text)) }
+	pager := script.PagerCommand
+	if pager == "" {
+		pager = "terminal length 0"
+	}
+	privileged := script.EnableSecret == ""
+	paging := script.PageLength > 0
+	prompt := func() {
+		if privileged {
+			write(script.Hostname + "#")
+		} else {
+			write(script.Hostname + ">")
+		}
+	}
+	readLine := func(echo bool) (string, bool) {
+		var line []byte
+		for {
+			b, err := in.ReadByte()
+			if err != nil {
+				return "", false
+			}
+			if b == '\r' || b == '\n' {
+				write("\r\n")
+				return string(line), true
+			}
+			line = append(line, b)
+			if echo {
+				write(string(b))
+			}
+		}
+	}
+
+	write("\r\nUser Access Verification\r\n\r\n")
+	prompt()
+	for {
+		line, ok := readLine(true)
+		if !ok {
+			return
+		}
+		line = strings.TrimSpace(line)
+		if line == "exit" {
+			return
+		}
+		if line != "" {
+			s.mu.Lock()
+			s.executed = append(s.executed, line)
+			out, known := s.commands[line]
+			s.mu.Unlock()
+
+			switch {
+			case line == "enable":
+				if !privileged {
+					write("Password: ")
+					secret, ok := readLine(false)
+					if !ok {
+						return
+					}
+					if secret == script.EnableSecret {
+						privileged = true
+					} else {
+						write("% Access denied\r\n\r\n")
+					}
+				}
+			case !privileged || !known && line != pager:
+				write("                ^\r\n% Invalid input detected at '^' marker.\r\n\r\n")
+			case line == pager:
+				paging = false
+			default:
+				lines := strings.SplitAfter(strings.ReplaceAll(out, "\n", "\r\n"), "\n")
+				for i, l := range lines {
+					if l == "" {
+						continue
+					}
+					if paging && i > 0 && i%script.PageLength == 0 {
+						write(" --More-- ")
+						if _, err := in.ReadByte(); err != nil {
+							return
+						}
+						write("\b\b\b\b\b\b\b\b\b\b          \b\b\b\b\b\b\b\b\b\b")
+					}
+					if i := strings.Index(l, script.Pause); script.Pause != "" && i >= 0 {
+						write(l[:i+len(script.Pause)])
+						time.Sleep(50 * time.Millisecond)
+						l = l[i+len(script.Pause):]
+					}
+					write(l)
+				}
+			}
+		}
+		prompt()
+	}
+}